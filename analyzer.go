@@ -21,6 +21,8 @@ type Analyzer struct {
 	Logger        Logger
 	Platform      Platform
 	SBOMRestorer  layer.SBOMRestorer
+	// BuildStack, if set, is validated against the run image and the result is recorded in analyzed.toml.
+	BuildStack *BuildStack
 
 	// Platform API < 0.7
 	Buildpacks            []buildpack.GroupBuildpack
@@ -35,6 +37,7 @@ func (a *Analyzer) Analyze() (platform.AnalyzedMetadata, error) {
 		cacheMeta       platform.CacheMetadata
 		previousImageID *platform.ImageIdentifier
 		runImageID      *platform.ImageIdentifier
+		stack           *platform.AnalyzedStack
 		err             error
 	)
 
@@ -75,10 +78,17 @@ func (a *Analyzer) Analyze() (platform.AnalyzedMetadata, error) {
 		}
 	}
 
+	if a.BuildStack != nil && a.RunImage != nil && a.RunImage.Found() {
+		if stack, err = ValidateRunImageStack(*a.BuildStack, a.RunImage); err != nil {
+			return platform.AnalyzedMetadata{}, err
+		}
+	}
+
 	return platform.AnalyzedMetadata{
 		PreviousImage: previousImageID,
 		RunImage:      runImageID,
 		Metadata:      appMeta,
+		Stack:         stack,
 	}, nil
 }
 
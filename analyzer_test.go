@@ -234,6 +234,33 @@ func testAnalyzerBuilder(platformAPI string) func(t *testing.T, when spec.G, it
 
 					h.AssertEq(t, md.RunImage.Reference, "s0m3D1g3sT")
 				})
+
+				when("the build stack is provided", func() {
+					it.Before(func() {
+						h.AssertNil(t, image.SetLabel(platform.StackIDLabel, "some.stack"))
+						h.AssertNil(t, image.SetLabel(platform.MixinsLabel, `["curl"]`))
+					})
+
+					it("records the stack in the analyzed metadata", func() {
+						analyzer.BuildStack = &lifecycle.BuildStack{ID: "some.stack", Mixins: []string{"curl", "build:git"}}
+
+						md, err := analyzer.Analyze()
+						h.AssertNil(t, err)
+
+						h.AssertEq(t, md.Stack, &platform.AnalyzedStack{
+							ID:          "some.stack",
+							BuildMixins: []string{"curl", "build:git"},
+							RunMixins:   []string{"curl"},
+						})
+					})
+
+					it("fails if the run image has a different stack", func() {
+						analyzer.BuildStack = &lifecycle.BuildStack{ID: "other.stack"}
+
+						_, err := analyzer.Analyze()
+						h.AssertError(t, err, "incompatible stack")
+					})
+				})
 			})
 		})
 	}
@@ -14,9 +14,11 @@ type PathInfo struct {
 }
 
 // AddFilesToArchive writes entries describing all files to the provided TarWriter
+// Files that are hard links to a file written earlier in the same call are written as hard links
 func AddFilesToArchive(tw TarWriter, files []PathInfo) error {
+	links := hardLinks{}
 	for _, file := range files {
-		if err := AddFileToArchive(tw, file.Path, file.Info); err != nil {
+		if err := addFileToArchive(tw, file.Path, file.Info, links); err != nil {
 			return err
 		}
 	}
@@ -25,6 +27,13 @@ func AddFilesToArchive(tw TarWriter, files []PathInfo) error {
 
 // AddFileToArchive writes an entry describing the file at path with the given os.FileInfo to the provided TarWriter
 func AddFileToArchive(tw TarWriter, path string, fi os.FileInfo) error {
+	return addFileToArchive(tw, path, fi, nil)
+}
+
+// hardLinks maps the inode of each regular file with more than one link to the path it was first written as
+type hardLinks map[inode]string
+
+func addFileToArchive(tw TarWriter, path string, fi os.FileInfo, links hardLinks) error {
 	if fi.Mode()&os.ModeSocket != 0 {
 		return nil
 	}
@@ -42,11 +51,27 @@ func AddFileToArchive(tw TarWriter, path string, fi os.FileInfo) error {
 		}
 		header.Linkname = target
 	}
+	if fi.Mode().IsRegular() && links != nil {
+		if ino, ok := hardLinkInode(fi); ok {
+			if target, ok := links[ino]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = target
+				header.Size = 0
+			} else {
+				links[ino] = path
+			}
+		}
+	}
 	addSysAttributes(header, fi)
+	if fi.Mode().IsRegular() || fi.IsDir() {
+		if err := addXattrs(header, path); err != nil {
+			return err
+		}
+	}
 	if err := tw.WriteHeader(header); err != nil {
 		return err
 	}
-	if fi.Mode().IsRegular() {
+	if header.Typeflag == tar.TypeReg {
 		f, err := os.Open(path)
 		if err != nil {
 			return err
@@ -60,13 +85,15 @@ func AddFileToArchive(tw TarWriter, path string, fi os.FileInfo) error {
 }
 
 // AddDirToArchive walks dir writes entries describing dir and all of its children files to the provided TarWriter
+// Files that are hard links to a file written earlier are written as hard links
 func AddDirToArchive(tw TarWriter, dir string) error {
 	dir = filepath.Clean(dir)
 
+	links := hardLinks{}
 	return filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		return AddFileToArchive(tw, file, fi)
+		return addFileToArchive(tw, file, fi, links)
 	})
 }
@@ -0,0 +1,160 @@
+//go:build linux
+// +build linux
+
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"golang.org/x/sys/unix"
+
+	"github.com/buildpacks/lifecycle/archive"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestArchiveLinux(t *testing.T) {
+	spec.Run(t, "linux", testArchiveLinux, spec.Report(report.Terminal{}))
+}
+
+func testArchiveLinux(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir  string
+		srcDir  string
+		destDir string
+	)
+
+	// writeAndExtract writes srcDir to a tar and extracts it to destDir, returning the headers that were written
+	writeAndExtract := func() map[string]*tar.Header {
+		var buf bytes.Buffer
+		tw := archive.NewNormalizingTarWriter(tar.NewWriter(&buf))
+		h.AssertNil(t, archive.AddDirToArchive(tw, srcDir))
+		h.AssertNil(t, tw.Close())
+
+		headers := map[string]*tar.Header{}
+		tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			headers[hdr.Name] = hdr
+		}
+
+		extractReader := archive.NewNormalizingTarReader(tar.NewReader(&buf))
+		extractReader.PrependDir(destDir)
+		h.AssertNil(t, archive.Extract(extractReader))
+		return headers
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "archive-linux-test")
+		h.AssertNil(t, err)
+		srcDir = filepath.Join(tmpDir, "src")
+		destDir = filepath.Join(tmpDir, "dest")
+		h.AssertNil(t, os.MkdirAll(filepath.Join(srcDir, "bin"), 0755))
+		h.AssertNil(t, os.MkdirAll(destDir, 0755))
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("files are hard linked", func() {
+		it.Before(func() {
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(srcDir, "bin", "git"), []byte("some-binary"), 0755))
+			h.AssertNil(t, os.Link(filepath.Join(srcDir, "bin", "git"), filepath.Join(srcDir, "bin", "git-upload-pack")))
+		})
+
+		it("writes the second path as a hard link and restores the link", func() {
+			headers := writeAndExtract()
+
+			link := headers[filepath.Join(srcDir, "bin", "git-upload-pack")]
+			h.AssertEq(t, link.Typeflag, byte(tar.TypeLink))
+			h.AssertEq(t, link.Linkname, filepath.Join(srcDir, "bin", "git"))
+			h.AssertEq(t, link.Size, int64(0))
+
+			extracted := filepath.Join(destDir, srcDir, "bin")
+			contents, err := ioutil.ReadFile(filepath.Join(extracted, "git-upload-pack"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "some-binary")
+			target, err := os.Stat(filepath.Join(extracted, "git"))
+			h.AssertNil(t, err)
+			linked, err := os.Stat(filepath.Join(extracted, "git-upload-pack"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, os.SameFile(target, linked), true)
+			h.AssertEq(t, linked.Sys().(*syscall.Stat_t).Nlink, uint64(2))
+		})
+	})
+
+	when("files have extended attributes", func() {
+		it.Before(func() {
+			path := filepath.Join(srcDir, "bin", "server")
+			h.AssertNil(t, ioutil.WriteFile(path, []byte("some-server"), 0755))
+			if err := unix.Setxattr(path, "user.some-attr", []byte("some-value"), 0); err == unix.ENOTSUP {
+				t.Skip("filesystem does not support extended attributes")
+			} else {
+				h.AssertNil(t, err)
+			}
+		})
+
+		it("writes PAX records and restores the attributes", func() {
+			headers := writeAndExtract()
+
+			hdr := headers[filepath.Join(srcDir, "bin", "server")]
+			h.AssertEq(t, hdr.PAXRecords["SCHILY.xattr.user.some-attr"], "some-value")
+
+			value := make([]byte, 64)
+			n, err := unix.Getxattr(filepath.Join(destDir, srcDir, "bin", "server"), "user.some-attr", value)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(value[:n]), "some-value")
+		})
+
+		it("preserves file capabilities", func() {
+			if os.Getuid() != 0 {
+				t.Skip("requires CAP_SETFCAP to set file capabilities")
+			}
+			// cap_net_bind_service=ep, see VFS_CAP_REVISION_2 in linux/capability.h
+			capability := make([]byte, 20)
+			binary.LittleEndian.PutUint32(capability[0:], 0x02000001)
+			binary.LittleEndian.PutUint32(capability[4:], 1<<10)
+			h.AssertNil(t, unix.Setxattr(filepath.Join(srcDir, "bin", "server"), "security.capability", capability, 0))
+
+			writeAndExtract()
+
+			value := make([]byte, 64)
+			n, err := unix.Getxattr(filepath.Join(destDir, srcDir, "bin", "server"), "security.capability", value)
+			h.AssertNil(t, err)
+			h.AssertEq(t, value[:n], capability)
+		})
+
+		it("does not preserve other attributes", func() {
+			if os.Getuid() != 0 {
+				t.Skip("requires CAP_SYS_ADMIN to set trusted attributes")
+			}
+			path := filepath.Join(srcDir, "bin", "server")
+			if err := unix.Setxattr(path, "trusted.some-attr", []byte("some-value"), 0); err == unix.ENOTSUP || err == unix.EPERM {
+				t.Skip("filesystem does not support trusted attributes")
+			} else {
+				h.AssertNil(t, err)
+			}
+
+			headers := writeAndExtract()
+
+			hdr := headers[path]
+			_, ok := hdr.PAXRecords["SCHILY.xattr.trusted.some-attr"]
+			h.AssertEq(t, ok, false)
+			_, err := unix.Getxattr(filepath.Join(destDir, srcDir, "bin", "server"), "trusted.some-attr", make([]byte, 64))
+			h.AssertEq(t, err, unix.ENODATA)
+		})
+	})
+}
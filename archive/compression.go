@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm used to compress a tar archive.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCompression parses the name of a compression algorithm. An empty name is parsed as CompressionNone.
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(name); c {
+	case "":
+		return CompressionNone, nil
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported compression '%s', must be one of: %s, %s, %s", name, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+// ValidateLevel returns an error if level is not a valid level for c.
+// Level 0 always selects the default level of the algorithm; gzip accepts levels 1 to 9 and zstd accepts levels 1 to 22.
+// The default gzip level is the fastest one, which is also the level image layers have always been compressed with.
+func (c Compression) ValidateLevel(level int) error {
+	max := 0
+	switch c {
+	case CompressionGzip:
+		max = gzip.BestCompression
+	case CompressionZstd:
+		max = 22
+	}
+	if level != 0 && (level < 1 || level > max) {
+		if max == 0 {
+			return fmt.Errorf("compression level %d is not supported for compression '%s'", level, c)
+		}
+		return fmt.Errorf("compression level %d is not supported for compression '%s', must be between 1 and %d", level, c, max)
+	}
+	return nil
+}
+
+// Extension returns the file extension conventionally appended to ".tar" for archives compressed with c.
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// NewCompressingWriter returns a writer that compresses what is written to it with c at the given level, and writes
+// the result to w. Closing the returned writer flushes it but does not close w.
+func NewCompressingWriter(w io.Writer, c Compression, level int) (io.WriteCloser, error) {
+	if err := c.ValidateLevel(level); err != nil {
+		return nil, err
+	}
+	switch c {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.BestSpeed
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		var opts []zstd.EOption
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// NewDecompressingReader detects whether the contents of r are compressed with gzip or zstd, and returns a reader of
+// the decompressed contents along with the detected compression. Uncompressed contents are returned as they are.
+// Closing the returned reader does not close r.
+func NewDecompressingReader(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", err
+		}
+		return gr, CompressionGzip, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, "", err
+		}
+		return zr.IOReadCloser(), CompressionZstd, nil
+	default:
+		return ioutil.NopCloser(br), CompressionNone, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package archive_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/archive"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCompression(t *testing.T) {
+	spec.Run(t, "Compression", testCompression, spec.Report(report.Terminal{}))
+}
+
+func testCompression(t *testing.T, when spec.G, it spec.S) {
+	contents := bytes.Repeat([]byte("some-layer-contents"), 1000)
+
+	compress := func(c archive.Compression, level int) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		w, err := archive.NewCompressingWriter(&buf, c, level)
+		h.AssertNil(t, err)
+		_, err = w.Write(contents)
+		h.AssertNil(t, err)
+		h.AssertNil(t, w.Close())
+		return buf.Bytes()
+	}
+
+	when("#ParseCompression", func() {
+		it("parses the supported compressions", func() {
+			for name, expected := range map[string]archive.Compression{
+				"":     archive.CompressionNone,
+				"none": archive.CompressionNone,
+				"gzip": archive.CompressionGzip,
+				"zstd": archive.CompressionZstd,
+			} {
+				c, err := archive.ParseCompression(name)
+				h.AssertNil(t, err)
+				h.AssertEq(t, c, expected)
+			}
+		})
+
+		it("fails for other compressions", func() {
+			_, err := archive.ParseCompression("xz")
+			h.AssertError(t, err, "unsupported compression 'xz', must be one of: none, gzip, zstd")
+		})
+	})
+
+	when("#ValidateLevel", func() {
+		it("accepts the levels of each compression", func() {
+			h.AssertNil(t, archive.CompressionGzip.ValidateLevel(0))
+			h.AssertNil(t, archive.CompressionGzip.ValidateLevel(9))
+			h.AssertNil(t, archive.CompressionZstd.ValidateLevel(22))
+			h.AssertNil(t, archive.CompressionNone.ValidateLevel(0))
+		})
+
+		it("rejects other levels", func() {
+			h.AssertError(t, archive.CompressionGzip.ValidateLevel(10), "compression level 10 is not supported for compression 'gzip', must be between 1 and 9")
+			h.AssertError(t, archive.CompressionZstd.ValidateLevel(-1), "must be between 1 and 22")
+			h.AssertError(t, archive.CompressionNone.ValidateLevel(3), "compression level 3 is not supported for compression 'none'")
+		})
+	})
+
+	when("#NewDecompressingReader", func() {
+		for _, tc := range []struct {
+			compression archive.Compression
+			level       int
+		}{
+			{archive.CompressionNone, 0},
+			{archive.CompressionGzip, 0},
+			{archive.CompressionGzip, 9},
+			{archive.CompressionZstd, 0},
+			{archive.CompressionZstd, 19},
+		} {
+			tc := tc
+			it("reads contents compressed with "+string(tc.compression), func() {
+				rc, detected, err := archive.NewDecompressingReader(bytes.NewReader(compress(tc.compression, tc.level)))
+				h.AssertNil(t, err)
+				defer rc.Close()
+				h.AssertEq(t, detected, tc.compression)
+
+				actual, err := ioutil.ReadAll(rc)
+				h.AssertNil(t, err)
+				h.AssertEq(t, actual, contents)
+			})
+		}
+
+		it("reads empty contents", func() {
+			rc, detected, err := archive.NewDecompressingReader(bytes.NewReader(nil))
+			h.AssertNil(t, err)
+			defer rc.Close()
+			h.AssertEq(t, detected, archive.CompressionNone)
+		})
+	})
+
+	it("compresses the contents", func() {
+		for _, c := range []archive.Compression{archive.CompressionGzip, archive.CompressionZstd} {
+			if len(compress(c, 0)) >= len(contents) {
+				t.Fatalf("expected %s to compress the contents", c)
+			}
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -40,11 +41,44 @@ func unsetUmaskIfNeeded() {
 	}
 }
 
+// ExtractOptions restrict the entries that ExtractWithOptions writes to the filesystem.
+type ExtractOptions struct {
+	// Root is the directory that every entry must resolve under, including through symlinks in the filesystem or
+	// symlinks extracted from the archive. Directory entries for the parents of Root are skipped.
+	// If empty, entries may be extracted anywhere.
+	Root string
+	// AllowSpecialFiles permits character device, block device and fifo entries.
+	AllowSpecialFiles bool
+	// AllowSetuid permits entries with the setuid or setgid bit set.
+	AllowSetuid bool
+}
+
+// UnsafeEntryError is returned when an entry is rejected by the ExtractOptions.
+type UnsafeEntryError struct {
+	Name   string
+	Reason string
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return fmt.Sprintf("refusing to extract %q: %s", e.Name, e.Reason)
+}
+
 // Extract reads all entries from TarReader and extracts them to the filesystem.
+// Special files and setuid or setgid files are rejected.
 func Extract(tr TarReader) error {
+	return ExtractWithOptions(tr, ExtractOptions{})
+}
+
+// ExtractWithOptions reads all entries from TarReader and extracts them to the filesystem,
+// returning an *UnsafeEntryError for the first entry that is not permitted by opts.
+func ExtractWithOptions(tr TarReader, opts ExtractOptions) error {
 	setUmaskIfNeeded()
 	defer unsetUmaskIfNeeded()
 
+	guard, err := newPathGuard(opts.Root)
+	if err != nil {
+		return err
+	}
 	buf := make([]byte, 32*32*1024)
 	dirsFound := make(map[string]bool)
 
@@ -63,6 +97,18 @@ func Extract(tr TarReader) error {
 			return errors.Wrap(err, "error extracting from archive")
 		}
 
+		if err := checkEntryType(hdr, opts); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir && guard.isAncestor(hdr.Name) {
+			continue
+		}
+		// symlinks and hard links are created rather than followed, but any other entry is written through a symlink at its path
+		followFinal := hdr.Typeflag != tar.TypeSymlink && hdr.Typeflag != tar.TypeLink
+		if err := guard.check(hdr.Name, hdr.Name, followFinal); err != nil {
+			return err
+		}
+
 		switch hdr.Typeflag {
 		case tar.TypeDir:
 			if _, err := os.Stat(hdr.Name); os.IsNotExist(err) {
@@ -73,31 +119,215 @@ func Extract(tr TarReader) error {
 				return errors.Wrapf(err, "failed to create directory %q", hdr.Name)
 			}
 			dirsFound[hdr.Name] = true
+			if err := setXattrs(hdr); err != nil {
+				return errors.Wrapf(err, "failed to set extended attributes of directory %q", hdr.Name)
+			}
 
 		case tar.TypeReg, tar.TypeRegA:
-			dirPath := filepath.Dir(hdr.Name)
-			if !dirsFound[dirPath] {
-				if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-					if err := os.MkdirAll(dirPath, applyUmask(os.ModePerm, originalUmask)); err != nil { // if there is no header for the parent directory in the tar, apply the provided umask
-						return errors.Wrapf(err, "failed to create parent dir %q for file %q", dirPath, hdr.Name)
-					}
-					dirsFound[dirPath] = true
-				}
+			if err := ensureParentDir(hdr.Name, dirsFound); err != nil {
+				return err
 			}
-
 			if err := writeFile(tr, hdr.Name, hdr.FileInfo().Mode(), buf); err != nil {
 				return errors.Wrapf(err, "failed to write file %q", hdr.Name)
 			}
+			if err := setXattrs(hdr); err != nil {
+				return errors.Wrapf(err, "failed to set extended attributes of file %q", hdr.Name)
+			}
+		case tar.TypeLink:
+			if err := guard.check(hdr.Name, hdr.Linkname, true); err != nil {
+				return err
+			}
+			if err := ensureParentDir(hdr.Name, dirsFound); err != nil {
+				return err
+			}
+			if err := createHardLink(hdr, buf); err != nil {
+				return errors.Wrapf(err, "failed to create hard link %q to %q", hdr.Name, hdr.Linkname)
+			}
 		case tar.TypeSymlink:
 			if err := createSymlink(hdr); err != nil {
 				return errors.Wrapf(err, "failed to create symlink %q with target %q", hdr.Name, hdr.Linkname)
 			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := ensureParentDir(hdr.Name, dirsFound); err != nil {
+				return err
+			}
+			if err := createSpecialFile(hdr); err != nil {
+				return errors.Wrapf(err, "failed to create special file %q", hdr.Name)
+			}
 		default:
 			return fmt.Errorf("unknown file type in tar %d", hdr.Typeflag)
 		}
 	}
 }
 
+func checkEntryType(hdr *tar.Header, opts ExtractOptions) error {
+	switch hdr.Typeflag {
+	case tar.TypeChar, tar.TypeBlock:
+		if !opts.AllowSpecialFiles {
+			return &UnsafeEntryError{Name: hdr.Name, Reason: "device files are not allowed"}
+		}
+	case tar.TypeFifo:
+		if !opts.AllowSpecialFiles {
+			return &UnsafeEntryError{Name: hdr.Name, Reason: "fifos are not allowed"}
+		}
+	}
+	if hdr.FileInfo().Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 && !opts.AllowSetuid {
+		return &UnsafeEntryError{Name: hdr.Name, Reason: "setuid and setgid files are not allowed"}
+	}
+	return nil
+}
+
+// maxSymlinks is the maximum number of symlinks followed when resolving a path, like the Linux limit
+const maxSymlinks = 40
+
+// pathGuard checks that paths resolve under a root directory.
+type pathGuard struct {
+	root         string          // empty if paths are not restricted
+	resolvedRoot string          // root with any symlinks resolved
+	realDirs     map[string]bool // directories under root that are known not to be symlinks
+}
+
+func newPathGuard(root string) (*pathGuard, error) {
+	if root == "" {
+		return &pathGuard{}, nil
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if os.IsNotExist(err) {
+		resolvedRoot = root
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "resolving root %q", root)
+	}
+	return &pathGuard{root: root, resolvedRoot: resolvedRoot, realDirs: map[string]bool{}}, nil
+}
+
+// isAncestor returns true if path is a parent of the root
+func (g *pathGuard) isAncestor(path string) bool {
+	if g.root == "" {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(path), g.root)
+	return err == nil && rel != "." && !isOutside(rel)
+}
+
+// check returns an *UnsafeEntryError for the entry if path resolves outside the root.
+// Symlinks in the existing parents of path are followed, as is path itself if followFinal is true.
+func (g *pathGuard) check(entry, path string, followFinal bool) error {
+	if g.root == "" {
+		return nil
+	}
+	components, ok := g.relComponents(path)
+	if !ok {
+		return &UnsafeEntryError{Name: entry, Reason: fmt.Sprintf("%q is outside of %q", path, g.root)}
+	}
+	current := g.resolvedRoot
+	for links := 0; len(components) > 0; {
+		next := filepath.Join(current, components[0])
+		components = components[1:]
+		if len(components) == 0 && !followFinal || g.realDirs[next] {
+			current = next
+			continue
+		}
+		fi, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			// nothing below a missing path can be a symlink
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			if fi.IsDir() {
+				g.realDirs[next] = true
+			}
+			current = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return &UnsafeEntryError{Name: entry, Reason: fmt.Sprintf("too many symlinks resolving %q", path)}
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(current, target)
+		}
+		targetComponents, ok := g.relComponents(target)
+		if !ok {
+			return &UnsafeEntryError{Name: entry, Reason: fmt.Sprintf("symlink %q resolves outside of %q", next, g.root)}
+		}
+		components = append(targetComponents, components...)
+		current = g.resolvedRoot
+	}
+	return nil
+}
+
+// relComponents returns the components of path relative to the root, or false if path is outside the root
+func (g *pathGuard) relComponents(path string) ([]string, bool) {
+	path = filepath.Clean(path)
+	for _, root := range []string{g.root, g.resolvedRoot} {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || isOutside(rel) {
+			continue
+		}
+		if rel == "." {
+			return nil, true
+		}
+		return strings.Split(rel, string(filepath.Separator)), true
+	}
+	return nil, false
+}
+
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel)
+}
+
+// ensureParentDir creates the parent directory of path if it does not exist
+func ensureParentDir(path string, dirsFound map[string]bool) error {
+	dirPath := filepath.Dir(path)
+	if !dirsFound[dirPath] {
+		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+			if err := os.MkdirAll(dirPath, applyUmask(os.ModePerm, originalUmask)); err != nil { // if there is no header for the parent directory in the tar, apply the provided umask
+				return errors.Wrapf(err, "failed to create parent dir %q for file %q", dirPath, path)
+			}
+			dirsFound[dirPath] = true
+		}
+	}
+	return nil
+}
+
+// createHardLink links hdr.Name to the previously extracted hdr.Linkname.
+// If the user isn't permitted to link to the file (e.g. an unprivileged user when fs.protected_hardlinks is set),
+// the file is copied instead.
+func createHardLink(hdr *tar.Header, buf []byte) error {
+	if err := os.Remove(hdr.Name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err := os.Link(hdr.Linkname, hdr.Name)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	target, err := os.Open(hdr.Linkname)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	fi, err := target.Stat()
+	if err != nil {
+		return err
+	}
+	if err := writeFile(target, hdr.Name, fi.Mode(), buf); err != nil {
+		return err
+	}
+	return setXattrs(hdr)
+}
+
 func applyUmask(mode os.FileMode, umask int) os.FileMode {
 	return os.FileMode(int(mode) &^ umask)
 }
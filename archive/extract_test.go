@@ -2,6 +2,7 @@ package archive_test
 
 import (
 	"archive/tar"
+	"errors"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -122,6 +123,133 @@ func testExtract(t *testing.T, when spec.G, it spec.S) {
 			}
 		})
 	})
+
+	when("#ExtractWithOptions", func() {
+		var (
+			root    string
+			outside string
+			opts    archive.ExtractOptions
+		)
+
+		it.Before(func() {
+			root = filepath.Join(tmpDir, "root")
+			outside = filepath.Join(tmpDir, "outside")
+			h.AssertNil(t, os.MkdirAll(root, 0755))
+			h.AssertNil(t, os.MkdirAll(outside, 0755))
+			opts = archive.ExtractOptions{Root: root}
+		})
+
+		assertUnsafeEntry := func(err error, name string) {
+			t.Helper()
+			var unsafeErr *archive.UnsafeEntryError
+			if !errors.As(err, &unsafeErr) {
+				t.Fatalf("expected an UnsafeEntryError, got: %v", err)
+			}
+			h.AssertEq(t, unsafeErr.Name, name)
+		}
+
+		it("extracts entries within the root", func() {
+			err := archive.ExtractWithOptions(headersReader(
+				&tar.Header{Name: tmpDir, Typeflag: tar.TypeDir, Mode: 0755},
+				&tar.Header{Name: root, Typeflag: tar.TypeDir, Mode: 0755},
+				&tar.Header{Name: filepath.Join(root, "sub"), Typeflag: tar.TypeDir, Mode: 0755},
+				&tar.Header{Name: filepath.Join(root, "link"), Typeflag: tar.TypeSymlink, Linkname: "sub"},
+				&tar.Header{Name: filepath.Join(root, "link", "file"), Typeflag: tar.TypeReg, Mode: 0644},
+			), opts)
+			h.AssertNil(t, err)
+			h.AssertPathExists(t, filepath.Join(root, "sub", "file"))
+		})
+
+		it("rejects entries with '..' that are outside of the root", func() {
+			name := root + string(filepath.Separator) + filepath.Join("..", "escaped")
+			err := archive.ExtractWithOptions(headersReader(
+				&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644},
+			), opts)
+			assertUnsafeEntry(err, name)
+			h.AssertPathDoesNotExist(t, filepath.Join(tmpDir, "escaped"))
+		})
+
+		when("symlinks point outside of the root", func() {
+			it.Before(func() {
+				if runtime.GOOS == "windows" {
+					t.Skip("symlinks require elevated privileges on windows")
+				}
+			})
+
+			it("does not write through an extracted symlink to a directory", func() {
+				name := filepath.Join(root, "link", "file")
+				err := archive.ExtractWithOptions(headersReader(
+					&tar.Header{Name: filepath.Join(root, "link"), Typeflag: tar.TypeSymlink, Linkname: filepath.Join("..", "outside")},
+					&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644},
+				), opts)
+				assertUnsafeEntry(err, name)
+				h.AssertPathDoesNotExist(t, filepath.Join(outside, "file"))
+			})
+
+			it("does not write through an existing symlink to a file", func() {
+				h.AssertNil(t, os.Symlink(filepath.Join(outside, "file"), filepath.Join(root, "file")))
+				name := filepath.Join(root, "file")
+				err := archive.ExtractWithOptions(headersReader(
+					&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644},
+				), opts)
+				assertUnsafeEntry(err, name)
+				h.AssertPathDoesNotExist(t, filepath.Join(outside, "file"))
+			})
+
+			it("does not create hard links to files outside of the root", func() {
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600))
+				name := filepath.Join(root, "secret")
+				err := archive.ExtractWithOptions(headersReader(
+					&tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: filepath.Join(outside, "secret")},
+				), opts)
+				assertUnsafeEntry(err, name)
+				h.AssertPathDoesNotExist(t, name)
+			})
+		})
+
+		when("entries are special files", func() {
+			it.Before(func() {
+				if runtime.GOOS == "windows" {
+					t.Skip("special files are not supported on windows")
+				}
+			})
+
+			it("rejects devices, fifos and setuid files by default", func() {
+				for _, hdr := range []*tar.Header{
+					{Name: filepath.Join(root, "null"), Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3},
+					{Name: filepath.Join(root, "sda"), Typeflag: tar.TypeBlock, Mode: 0660, Devmajor: 8},
+					{Name: filepath.Join(root, "fifo"), Typeflag: tar.TypeFifo, Mode: 0644},
+					{Name: filepath.Join(root, "suid"), Typeflag: tar.TypeReg, Mode: 04755},
+					{Name: filepath.Join(root, "sgid"), Typeflag: tar.TypeDir, Mode: 02755},
+				} {
+					assertUnsafeEntry(archive.ExtractWithOptions(headersReader(hdr), opts), hdr.Name)
+					h.AssertPathDoesNotExist(t, hdr.Name)
+				}
+			})
+
+			it("creates fifos and setuid files when allowed", func() {
+				opts.AllowSpecialFiles = true
+				opts.AllowSetuid = true
+				err := archive.ExtractWithOptions(headersReader(
+					&tar.Header{Name: filepath.Join(root, "fifo"), Typeflag: tar.TypeFifo, Mode: 0644},
+					&tar.Header{Name: filepath.Join(root, "suid"), Typeflag: tar.TypeReg, Mode: 04755},
+				), opts)
+				h.AssertNil(t, err)
+
+				fi, err := os.Lstat(filepath.Join(root, "fifo"))
+				h.AssertNil(t, err)
+				h.AssertEq(t, fi.Mode()&os.ModeNamedPipe != 0, true)
+				fi, err = os.Lstat(filepath.Join(root, "suid"))
+				h.AssertNil(t, err)
+				h.AssertEq(t, fi.Mode()&os.ModeSetuid != 0, true)
+			})
+		})
+	})
+}
+
+// headersReader returns a TarReader for empty entries with the given headers, in order
+func headersReader(hdrs ...*tar.Header) *fakeTarReader {
+	return &fakeTarReader{hdrs: hdrs}
 }
 
 func newFakeTarReader(t *testing.T) (*archive.NormalizingTarReader, string) {
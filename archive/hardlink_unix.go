@@ -0,0 +1,23 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package archive
+
+import (
+	"os"
+	"syscall"
+)
+
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkInode returns the inode of the file if it has more than one link
+func hardLinkInode(fi os.FileInfo) (inode, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,10 @@
+package archive
+
+import "os"
+
+type inode struct{}
+
+// hardLinkInode always returns false, hard links are written as separate copies on Windows
+func hardLinkInode(fi os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
@@ -12,7 +12,7 @@ type TarReader interface {
 }
 
 // NormalizingTarReader read from the wrapped TarReader normalizes header before passing them through to the caller
-// NormalizingTarReader always normalizes header.Name so that path separators match the runtime OS
+// NormalizingTarReader always normalizes header.Name (and header.Linkname of hard links) so that path separators match the runtime OS
 // Other modifications can be enabled by invoking options on the NormalizingTarReader
 type NormalizingTarReader struct {
 	TarReader
@@ -24,6 +24,9 @@ type NormalizingTarReader struct {
 func (tr *NormalizingTarReader) Strip(prefix string) {
 	tr.headerOpts = append(tr.headerOpts, func(header *tar.Header) *tar.Header {
 		header.Name = strings.TrimPrefix(header.Name, prefix)
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = strings.TrimPrefix(header.Linkname, prefix)
+		}
 		return header
 	})
 }
@@ -42,6 +45,10 @@ func (tr *NormalizingTarReader) PrependDir(dir string) {
 		// Suppress gosec check for zip slip vulnerability, as we set dir in our code.
 		// #nosec G305
 		hdr.Name = filepath.Join(dir, hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			// #nosec G305
+			hdr.Linkname = filepath.Join(dir, hdr.Linkname)
+		}
 		return hdr
 	})
 }
@@ -73,5 +80,8 @@ func (tr *NormalizingTarReader) Next() (*tar.Header, error) {
 		return tr.Next() // If entire path is stripped move on to the next entry
 	}
 	hdr.Name = filepath.FromSlash(hdr.Name)
+	if hdr.Typeflag == tar.TypeLink {
+		hdr.Linkname = filepath.FromSlash(hdr.Linkname)
+	}
 	return hdr, nil
 }
@@ -18,5 +18,19 @@ func createSymlink(hdr *tar.Header) error {
 	return os.Symlink(hdr.Linkname, hdr.Name)
 }
 
+// createSpecialFile creates the character device, block device or fifo described by hdr
+func createSpecialFile(hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	return unix.Mknod(hdr.Name, mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+}
+
 func addSysAttributes(hdr *tar.Header, fi os.FileInfo) {
 }
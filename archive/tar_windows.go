@@ -48,6 +48,10 @@ func createSymlink(hdr *tar.Header) error {
 	return syscall.CreateSymbolicLink(name, target, flags)
 }
 
+func createSpecialFile(hdr *tar.Header) error {
+	return errors.New("special files are not supported on Windows")
+}
+
 // addSysAttributes adds PAXRecords containing file attributes
 func addSysAttributes(hdr *tar.Header, fi os.FileInfo) {
 	attrs := fi.Sys().(*syscall.Win32FileAttributeData).FileAttributes
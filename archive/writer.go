@@ -65,6 +65,9 @@ func (tw *NormalizingTarWriter) WriteHeader(hdr *tar.Header) error {
 		hdr = opt(hdr)
 	}
 	hdr.Name = filepath.ToSlash(strings.TrimPrefix(hdr.Name, filepath.VolumeName(hdr.Name)))
+	if hdr.Typeflag == tar.TypeLink {
+		hdr.Linkname = filepath.ToSlash(strings.TrimPrefix(hdr.Linkname, filepath.VolumeName(hdr.Linkname)))
+	}
 	hdr.Uname = ""
 	hdr.Gname = ""
 	return tw.TarWriter.WriteHeader(hdr)
@@ -0,0 +1,107 @@
+//go:build linux
+// +build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const paxXattrPrefix = "SCHILY.xattr."
+
+// capabilityXattr holds the file capabilities of an executable, e.g. cap_net_bind_service
+const capabilityXattr = "security.capability"
+
+// userXattrPrefix is the namespace of extended attributes that any file owner may set
+const userXattrPrefix = "user."
+
+// preservedXattr returns true if the extended attribute is written to and restored from archives.
+// Other attributes, such as SELinux labels, ACLs and trusted.* attributes, describe the host rather than the file.
+func preservedXattr(name string) bool {
+	return name == capabilityXattr || strings.HasPrefix(name, userXattrPrefix)
+}
+
+// addXattrs adds PAXRecords containing the preserved extended attributes of the file at path, e.g. security.capability
+func addXattrs(hdr *tar.Header, path string) error {
+	names, err := listXattrs(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !preservedXattr(name) {
+			continue
+		}
+		value, err := getXattr(path, name)
+		if err != nil {
+			return err
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords[paxXattrPrefix+name] = string(value)
+	}
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err == unix.ENOTSUP || size == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing extended attributes of %q", path)
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing extended attributes of %q", path)
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading extended attribute %s of %q", name, path)
+	}
+	buf := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading extended attribute %s of %q", name, path)
+	}
+	return buf[:size], nil
+}
+
+// setXattrs sets the preserved extended attributes in the PAXRecords of hdr on the file at hdr.Name.
+// Attributes that the user isn't permitted to set (e.g. security.capability when unprivileged)
+// or that the filesystem doesn't support are skipped.
+func setXattrs(hdr *tar.Header) error {
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, paxXattrPrefix)
+		if !preservedXattr(name) {
+			continue
+		}
+		err := unix.Lsetxattr(hdr.Name, name, []byte(value), 0)
+		if err == unix.EPERM || err == unix.ENOTSUP {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "setting extended attribute %s", name)
+		}
+	}
+	return nil
+}
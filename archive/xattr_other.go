@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package archive
+
+import "archive/tar"
+
+func addXattrs(hdr *tar.Header, path string) error {
+	return nil
+}
+
+func setXattrs(hdr *tar.Header) error {
+	return nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+const EnvRegistryCredentialHelpers = "CNB_REGISTRY_CREDENTIAL_HELPERS"
+
+// credentialsNotFound is the message docker credential helpers print when they have no credentials for a registry.
+const credentialsNotFound = "credentials not found in native keychain"
+
+// CredentialHelperKeychain is an implementation of authn.Keychain that gets credentials from docker credential helpers.
+// Helpers maps registry hostnames to the name of a helper, e.g. "gcr.io" -> "gcloud" runs docker-credential-gcloud.
+// The helper is run on each call to Resolve so that it can return fresh credentials.
+type CredentialHelperKeychain struct {
+	Helpers map[string]string
+}
+
+// CredentialHelperKeychainFromEnv returns a CredentialHelperKeychain configured by the provided environment variable.
+// The value of the environment variable should be a JSON object that maps OCI registry hostnames to helper names.
+func CredentialHelperKeychainFromEnv(envVar string) (*CredentialHelperKeychain, error) {
+	helpers := map[string]string{}
+	if env := os.Getenv(envVar); env != "" {
+		if err := json.Unmarshal([]byte(env), &helpers); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s value", envVar)
+		}
+	}
+	return &CredentialHelperKeychain{Helpers: helpers}, nil
+}
+
+type helperCredentials struct {
+	Username string
+	Secret   string
+}
+
+func (k *CredentialHelperKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	registry := resource.RegistryStr()
+	helper, ok := k.Helpers[registry]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+
+	serverURL := registry
+	if registry == name.DefaultRegistry {
+		serverURL = authn.DefaultAuthKey
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get") // #nosec G204
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), credentialsNotFound) {
+			return authn.Anonymous, nil
+		}
+		return nil, errors.Wrapf(err, "running credential helper '%s' for registry '%s': %s", helper, registry, strings.TrimSpace(stderr.String()))
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, errors.Wrapf(err, "parsing output of credential helper '%s'", helper)
+	}
+	if creds.Username == "<token>" {
+		return &providedAuth{config: &authn.AuthConfig{IdentityToken: creds.Secret}}, nil
+	}
+	return &providedAuth{config: &authn.AuthConfig{Username: creds.Username, Password: creds.Secret}}, nil
+}
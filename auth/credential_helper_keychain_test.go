@@ -0,0 +1,109 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/auth"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCredentialHelperKeychain(t *testing.T) {
+	spec.Run(t, "CredentialHelperKeychain", testCredentialHelperKeychain, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testCredentialHelperKeychain(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir   string
+		origPath string
+		registry name.Registry
+	)
+
+	it.Before(func() {
+		h.SkipIf(t, runtime.GOOS == "windows", "credential helper fixture is a shell script")
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.auth.helpers.")
+		h.AssertNil(t, err)
+		h.AssertNil(t, ioutil.WriteFile(filepath.Join(tmpDir, "docker-credential-fake"), []byte(`#!/bin/sh
+read server
+if [ "$server" = "some-registry.com" ]; then
+  echo '{"ServerURL":"some-registry.com","Username":"user","Secret":"secret"}'
+elif [ "$server" = "token-registry.com" ]; then
+  echo '{"ServerURL":"token-registry.com","Username":"<token>","Secret":"identity-token"}'
+else
+  echo 'credentials not found in native keychain'
+  exit 1
+fi
+`), 0755))
+		origPath = os.Getenv("PATH")
+		h.AssertNil(t, os.Setenv("PATH", tmpDir+string(os.PathListSeparator)+origPath))
+		registry, err = name.NewRegistry("some-registry.com", name.WeakValidation)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.Setenv("PATH", origPath))
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("gets the credentials from the helper configured for the registry", func() {
+		keychain := &auth.CredentialHelperKeychain{Helpers: map[string]string{"some-registry.com": "fake"}}
+		authenticator, err := keychain.Resolve(registry)
+		h.AssertNil(t, err)
+		config, err := authenticator.Authorization()
+		h.AssertNil(t, err)
+		h.AssertEq(t, config, &authn.AuthConfig{Username: "user", Password: "secret"})
+	})
+
+	it("uses identity tokens", func() {
+		tokenRegistry, err := name.NewRegistry("token-registry.com", name.WeakValidation)
+		h.AssertNil(t, err)
+		keychain := &auth.CredentialHelperKeychain{Helpers: map[string]string{"token-registry.com": "fake"}}
+		authenticator, err := keychain.Resolve(tokenRegistry)
+		h.AssertNil(t, err)
+		config, err := authenticator.Authorization()
+		h.AssertNil(t, err)
+		h.AssertEq(t, config, &authn.AuthConfig{IdentityToken: "identity-token"})
+	})
+
+	when("the helper has no credentials for the registry", func() {
+		it("returns an Anonymous authenticator", func() {
+			otherRegistry, err := name.NewRegistry("other-registry.com", name.WeakValidation)
+			h.AssertNil(t, err)
+			keychain := &auth.CredentialHelperKeychain{Helpers: map[string]string{"other-registry.com": "fake"}}
+			authenticator, err := keychain.Resolve(otherRegistry)
+			h.AssertNil(t, err)
+			h.AssertEq(t, authenticator, authn.Anonymous)
+		})
+	})
+
+	when("no helper is configured for the registry", func() {
+		it("returns an Anonymous authenticator", func() {
+			keychain := &auth.CredentialHelperKeychain{Helpers: map[string]string{}}
+			authenticator, err := keychain.Resolve(registry)
+			h.AssertNil(t, err)
+			h.AssertEq(t, authenticator, authn.Anonymous)
+		})
+	})
+
+	when("#CredentialHelperKeychainFromEnv", func() {
+		it.After(func() {
+			h.AssertNil(t, os.Unsetenv("CNB_REGISTRY_CREDENTIAL_HELPERS"))
+		})
+
+		it("reads the helpers from the environment", func() {
+			h.AssertNil(t, os.Setenv("CNB_REGISTRY_CREDENTIAL_HELPERS", `{"some-registry.com": "fake"}`))
+			keychain, err := auth.CredentialHelperKeychainFromEnv("CNB_REGISTRY_CREDENTIAL_HELPERS")
+			h.AssertNil(t, err)
+			h.AssertEq(t, keychain.Helpers, map[string]string{"some-registry.com": "fake"})
+		})
+	})
+}
@@ -17,17 +17,30 @@ const EnvRegistryAuth = "CNB_REGISTRY_AUTH"
 // DefaultKeychain returns a keychain containing authentication configuration for the given images
 // from the following sources, if they exist, in order of precedence:
 // the provided environment variable
+// the token files in the directory given by CNB_REGISTRY_AUTH_DIR
+// the credential helpers given by CNB_REGISTRY_CREDENTIAL_HELPERS
 // the docker config.json file
 func DefaultKeychain(images ...string) (authn.Keychain, error) {
 	envKeychain, err := EnvKeychain(EnvRegistryAuth)
 	if err != nil {
 		return nil, err
 	}
+	keychains := []authn.Keychain{envKeychain}
 
-	return authn.NewMultiKeychain(
-		envKeychain,
-		InMemoryKeychain(authn.DefaultKeychain, images...),
-	), nil
+	if dir := os.Getenv(EnvRegistryAuthDir); dir != "" {
+		keychains = append(keychains, &TokenDirKeychain{Dir: dir})
+	}
+
+	helperKeychain, err := CredentialHelperKeychainFromEnv(EnvRegistryCredentialHelpers)
+	if err != nil {
+		return nil, err
+	}
+	if len(helperKeychain.Helpers) > 0 {
+		keychains = append(keychains, helperKeychain)
+	}
+
+	keychains = append(keychains, RefreshingInMemoryKeychain(authn.DefaultKeychain, images...))
+	return authn.NewMultiKeychain(keychains...), nil
 }
 
 // ResolvedKeychain is an implementation of authn.Keychain that stores credentials in memory.
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// expirySkew is subtracted from the expiry of a token so that it is refreshed before it expires.
+const expirySkew = 30 * time.Second
+
+// DefaultTTL is how long credentials without a known expiry are stored before they are resolved again.
+// Opaque tokens from token files and credential helpers may expire without the keychain being able to tell.
+const DefaultTTL = 5 * time.Minute
+
+// RefreshingKeychain is an implementation of authn.Keychain that stores credentials resolved from another keychain
+// in memory, like InMemoryKeychain, but resolves them again once they expire.
+// Credentials containing a JWT expire with the token; other credentials expire after TTL.
+// When the backing keychain can no longer resolve credentials, the last resolved credentials are returned.
+type RefreshingKeychain struct {
+	// TTL is how long credentials without a known expiry are stored, it defaults to DefaultTTL.
+	TTL time.Duration
+
+	keychain authn.Keychain
+
+	mutex sync.Mutex
+	auths map[string]*cachedAuth
+}
+
+type cachedAuth struct {
+	config     *authn.AuthConfig
+	resolvedAt time.Time
+	expiresAt  time.Time // zero when the credentials have no known expiry
+}
+
+// RefreshingInMemoryKeychain resolves credentials for the given images from the given keychain and returns a new keychain
+// that stores them in memory. Credentials are resolved from the given keychain again when they expire.
+func RefreshingInMemoryKeychain(keychain authn.Keychain, images ...string) *RefreshingKeychain {
+	k := &RefreshingKeychain{
+		TTL:      DefaultTTL,
+		keychain: keychain,
+		auths:    map[string]*cachedAuth{},
+	}
+	for _, image := range images {
+		ref, err := name.ParseReference(image, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		if cached := k.resolve(ref.Context().Registry); cached != nil {
+			k.auths[ref.Context().RegistryStr()] = cached
+		}
+	}
+	return k
+}
+
+func (k *RefreshingKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	cached, ok := k.auths[resource.RegistryStr()]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	if k.expired(cached) {
+		if refreshed := k.resolve(resource); refreshed != nil {
+			k.auths[resource.RegistryStr()] = refreshed
+			cached = refreshed
+		}
+	}
+	return &providedAuth{config: cached.config}, nil
+}
+
+func (k *RefreshingKeychain) expired(cached *cachedAuth) bool {
+	if !cached.expiresAt.IsZero() {
+		return !time.Now().Before(cached.expiresAt)
+	}
+	return !time.Now().Before(cached.resolvedAt.Add(k.TTL))
+}
+
+// resolve returns the credentials for the resource, or nil if there are none.
+func (k *RefreshingKeychain) resolve(resource authn.Resource) *cachedAuth {
+	authenticator, err := k.keychain.Resolve(resource)
+	if err != nil || authenticator == authn.Anonymous {
+		return nil
+	}
+	config, err := authenticator.Authorization()
+	if err != nil || *config == (authn.AuthConfig{}) {
+		return nil
+	}
+	cached := &cachedAuth{config: config, resolvedAt: time.Now()}
+	if exp, ok := tokenExpiry(config); ok {
+		cached.expiresAt = exp.Add(-expirySkew)
+	}
+	return cached
+}
+
+// tokenExpiry returns the expiry of the first JWT found in the credentials.
+func tokenExpiry(config *authn.AuthConfig) (time.Time, bool) {
+	for _, token := range []string{config.RegistryToken, config.IdentityToken, config.Password} {
+		if exp, ok := jwtExpiry(token); ok {
+			return exp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
@@ -0,0 +1,113 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/auth"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRefreshingKeychain(t *testing.T) {
+	spec.Run(t, "RefreshingKeychain", testRefreshingKeychain, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testRefreshingKeychain(t *testing.T, when spec.G, it spec.S) {
+	var (
+		backing      *FakeKeychain
+		registry     name.Registry
+		expiredToken = fakeJWT(time.Now().Add(-time.Minute))
+		validToken   = fakeJWT(time.Now().Add(time.Hour))
+	)
+
+	it.Before(func() {
+		var err error
+		registry, err = name.NewRegistry("some-registry.com", name.WeakValidation)
+		h.AssertNil(t, err)
+		backing = &FakeKeychain{authMap: map[string]*authn.AuthConfig{}}
+	})
+
+	assertResolves := func(keychain authn.Keychain, expected *authn.AuthConfig) {
+		t.Helper()
+		authenticator, err := keychain.Resolve(registry)
+		h.AssertNil(t, err)
+		config, err := authenticator.Authorization()
+		h.AssertNil(t, err)
+		h.AssertEq(t, config, expected)
+	}
+
+	when("the token has expired", func() {
+		it.Before(func() {
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: expiredToken}
+		})
+
+		it("resolves the credentials again", func() {
+			keychain := auth.RefreshingInMemoryKeychain(backing, "some-registry.com/image")
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: validToken}
+
+			assertResolves(keychain, &authn.AuthConfig{RegistryToken: validToken})
+		})
+
+		when("the backing keychain fails to resolve", func() {
+			it("returns the last resolved credentials", func() {
+				keychain := auth.RefreshingInMemoryKeychain(backing, "some-registry.com/image")
+				backing.returnsForResolve = errors.New("some-error")
+
+				assertResolves(keychain, &authn.AuthConfig{RegistryToken: expiredToken})
+			})
+		})
+	})
+
+	when("the credentials have not expired", func() {
+		it("returns the credentials resolved at startup", func() {
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: validToken}
+			keychain := auth.RefreshingInMemoryKeychain(backing, "some-registry.com/image")
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: "other-token"}
+
+			assertResolves(keychain, &authn.AuthConfig{RegistryToken: validToken})
+		})
+
+		it("returns credentials without an expiry until the TTL has passed", func() {
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{Username: "user", Password: "password"}
+			keychain := auth.RefreshingInMemoryKeychain(backing, "some-registry.com/image")
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{Username: "user", Password: "other-password"}
+
+			assertResolves(keychain, &authn.AuthConfig{Username: "user", Password: "password"})
+		})
+	})
+
+	when("the TTL of credentials without an expiry has passed", func() {
+		it("resolves opaque tokens again", func() {
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: "some-opaque-token"}
+			keychain := auth.RefreshingInMemoryKeychain(backing, "some-registry.com/image")
+			keychain.TTL = 0
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: "rotated-opaque-token"}
+
+			assertResolves(keychain, &authn.AuthConfig{RegistryToken: "rotated-opaque-token"})
+		})
+	})
+
+	when("the registry was not resolved at startup", func() {
+		it("returns an Anonymous authenticator", func() {
+			keychain := auth.RefreshingInMemoryKeychain(backing, "some-registry.com/image")
+			backing.authMap["some-registry.com"] = &authn.AuthConfig{RegistryToken: validToken}
+
+			authenticator, err := keychain.Resolve(registry)
+			h.AssertNil(t, err)
+			h.AssertEq(t, authenticator, authn.Anonymous)
+		})
+	})
+}
+
+func fakeJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+	return "header." + payload + ".signature"
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/pkg/errors"
+)
+
+const EnvRegistryAuthDir = "CNB_REGISTRY_AUTH_DIR"
+
+// TokenDirKeychain is an implementation of authn.Keychain that reads credentials from a directory
+// containing one file per registry, named after the registry hostname (e.g. gcr.io or index.docker.io).
+// Each file contains an Authorization header, e.g. "Bearer some-token".
+// Files are read on each call to Resolve so that credentials rotated during a build are picked up.
+type TokenDirKeychain struct {
+	Dir string
+}
+
+func (k *TokenDirKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	registry := resource.RegistryStr()
+	if registry == "" || strings.ContainsAny(registry, `/\`) || registry == "." || registry == ".." {
+		return authn.Anonymous, nil
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(k.Dir, registry))
+	if os.IsNotExist(err) {
+		return authn.Anonymous, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading token file for registry '%s'", registry)
+	}
+	header := strings.TrimSpace(string(contents))
+	if header == "" {
+		return authn.Anonymous, nil
+	}
+	authConfig, err := authHeaderToConfig(header)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing token file for registry '%s'", registry)
+	}
+	return &providedAuth{config: authConfig}, nil
+}
@@ -0,0 +1,75 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/auth"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestTokenDirKeychain(t *testing.T) {
+	spec.Run(t, "TokenDirKeychain", testTokenDirKeychain, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testTokenDirKeychain(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir   string
+		keychain *auth.TokenDirKeychain
+		registry name.Registry
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.auth.tokens.")
+		h.AssertNil(t, err)
+		keychain = &auth.TokenDirKeychain{Dir: tmpDir}
+		registry, err = name.NewRegistry("some-registry.com", name.WeakValidation)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("reads the token file for the registry on each resolve", func() {
+		h.Mkfile(t, "Bearer some-token\n", filepath.Join(tmpDir, "some-registry.com"))
+		authenticator, err := keychain.Resolve(registry)
+		h.AssertNil(t, err)
+		config, err := authenticator.Authorization()
+		h.AssertNil(t, err)
+		h.AssertEq(t, config, &authn.AuthConfig{RegistryToken: "some-token"})
+
+		h.Mkfile(t, "Basic some-rotated-auth=", filepath.Join(tmpDir, "some-registry.com"))
+		authenticator, err = keychain.Resolve(registry)
+		h.AssertNil(t, err)
+		config, err = authenticator.Authorization()
+		h.AssertNil(t, err)
+		h.AssertEq(t, config, &authn.AuthConfig{Auth: "some-rotated-auth="})
+	})
+
+	when("there is no token file for the registry", func() {
+		it("returns an Anonymous authenticator", func() {
+			authenticator, err := keychain.Resolve(registry)
+			h.AssertNil(t, err)
+			h.AssertEq(t, authenticator, authn.Anonymous)
+		})
+	})
+
+	when("the token file is invalid", func() {
+		it("doesn't print the contents in the error message", func() {
+			h.Mkfile(t, "Some Bad Header", filepath.Join(tmpDir, "some-registry.com"))
+			_, err := keychain.Resolve(registry)
+			h.AssertNotNil(t, err)
+			h.AssertStringContains(t, err.Error(), "parsing token file for registry 'some-registry.com'")
+			h.AssertStringDoesNotContain(t, err.Error(), "Some Bad Header")
+		})
+	})
+}
@@ -66,6 +66,7 @@ func (b *Builder) Build() (*platform.BuildMetadata, error) {
 	var bomFiles []buildpack.BOMFile
 	var slices []layers.Slice
 	var labels []buildpack.Label
+	imgConfig := imageConfig{}
 
 	bpEnv := env.NewBuildEnv(os.Environ())
 
@@ -102,6 +103,11 @@ func (b *Builder) Build() (*platform.BuildMetadata, error) {
 
 		slices = append(slices, br.Slices...)
 
+		b.Logger.Debug("Updating image config")
+		for _, conflict := range imgConfig.add(bp.ID, br) {
+			b.Logger.Warn(conflict)
+		}
+
 		b.Logger.Debugf("Finished running build for buildpack %s", bp)
 	}
 
@@ -131,6 +137,11 @@ func (b *Builder) Build() (*platform.BuildMetadata, error) {
 		Processes:                   procList,
 		Slices:                      slices,
 		BuildpackDefaultProcessType: processMap.defaultType,
+		Ports:                       imgConfig.ports,
+		Volumes:                     imgConfig.volumes,
+		StopSignal:                  imgConfig.stopSignal.value,
+		User:                        imgConfig.user.value,
+		Prefetch:                    imgConfig.prefetchPaths(config.AppDir),
 	}, nil
 }
 
@@ -279,3 +290,90 @@ func (m processMap) list() []launch.Process {
 	}
 	return result
 }
+
+// imageConfig merges the image config provided by each buildpack.
+// Ports, volumes and prefetched files are combined; for the stop signal and user, the last buildpack to set a value wins.
+type imageConfig struct {
+	ports      []buildpack.Port
+	volumes    []buildpack.Volume
+	stopSignal providedValue
+	user       providedValue
+	prefetch   []string
+}
+
+type providedValue struct {
+	value       string
+	buildpackID string
+}
+
+// add adds the image config from the build result of the given buildpack
+// it returns a message for each value that conflicts with a value provided by a previous buildpack
+func (c *imageConfig) add(bpID string, br buildpack.BuildResult) []string {
+	var conflicts []string
+	for _, port := range br.Ports {
+		if !c.hasPort(port) {
+			c.ports = append(c.ports, port)
+		}
+	}
+	for _, volume := range br.Volumes {
+		if !c.hasVolume(volume) {
+			c.volumes = append(c.volumes, volume)
+		}
+	}
+	if conflict := c.stopSignal.set("stop signal", br.StopSignal, bpID); conflict != "" {
+		conflicts = append(conflicts, conflict)
+	}
+	if conflict := c.user.set("user", br.User, bpID); conflict != "" {
+		conflicts = append(conflicts, conflict)
+	}
+	c.prefetch = append(c.prefetch, br.Prefetch...)
+	return conflicts
+}
+
+// prefetchPaths returns the files to prefetch in the order buildpacks listed them, without duplicates.
+// Relative paths are resolved against the app dir.
+func (c *imageConfig) prefetchPaths(appDir string) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, path := range c.prefetch {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(appDir, path)
+		}
+		if path = filepath.Clean(path); !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (c *imageConfig) hasPort(port buildpack.Port) bool {
+	for _, p := range c.ports {
+		if p.String() == port.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *imageConfig) hasVolume(volume buildpack.Volume) bool {
+	for _, v := range c.volumes {
+		if v.Path == volume.Path {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *providedValue) set(name, value, bpID string) string {
+	if value == "" {
+		return ""
+	}
+	var conflict string
+	if v.value != "" && v.value != value {
+		conflict = fmt.Sprintf("buildpack '%s' overrides %s '%s' provided by buildpack '%s' with '%s'", bpID, name, v.value, v.buildpackID, value)
+	}
+	v.value = value
+	v.buildpackID = bpID
+	return conflict
+}
@@ -788,6 +788,68 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 						}
 					})
 				})
+
+				when("image config", func() {
+					it("should merge ports and volumes from each buildpack", func() {
+						bpA := testmock.NewMockBuildpack(mockCtrl)
+						buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+						bpA.EXPECT().Build(gomock.Any(), config, gomock.Any()).Return(buildpack.BuildResult{
+							Ports:    []buildpack.Port{{Port: 8080}, {Port: 53, Protocol: "udp"}},
+							Volumes:  []buildpack.Volume{{Path: "/data"}},
+							Prefetch: []string{"some-file", filepath.Join(layersDir, "A", "some-layer", "some-file")},
+						}, nil)
+						bpB := testmock.NewMockBuildpack(mockCtrl)
+						buildpackStore.EXPECT().Lookup("B", "v2").Return(bpB, nil)
+						bpB.EXPECT().Build(gomock.Any(), config, gomock.Any()).Return(buildpack.BuildResult{
+							Ports:      []buildpack.Port{{Port: 8080, Protocol: "tcp"}, {Port: 9090}},
+							Volumes:    []buildpack.Volume{{Path: "/data"}, {Path: "/tmp/cache"}},
+							StopSignal: "SIGINT",
+							User:       "1000:1000",
+							Prefetch:   []string{"./some-file", "some-other-file"},
+						}, nil)
+
+						metadata, err := builder.Build()
+						h.AssertNil(t, err)
+						h.AssertEq(t, metadata.Ports, []buildpack.Port{{Port: 8080}, {Port: 53, Protocol: "udp"}, {Port: 9090}})
+						h.AssertEq(t, metadata.Volumes, []buildpack.Volume{{Path: "/data"}, {Path: "/tmp/cache"}})
+						h.AssertEq(t, metadata.StopSignal, "SIGINT")
+						h.AssertEq(t, metadata.User, "1000:1000")
+						h.AssertEq(t, metadata.Prefetch, []string{
+							filepath.Join(appDir, "some-file"),
+							filepath.Join(layersDir, "A", "some-layer", "some-file"),
+							filepath.Join(appDir, "some-other-file"),
+						})
+					})
+
+					when("buildpacks provide conflicting values", func() {
+						it("should warn and use the value from the later buildpack", func() {
+							bpA := testmock.NewMockBuildpack(mockCtrl)
+							buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+							bpA.EXPECT().Build(gomock.Any(), config, gomock.Any()).Return(buildpack.BuildResult{
+								StopSignal: "SIGTERM",
+								User:       "1000:1000",
+							}, nil)
+							bpB := testmock.NewMockBuildpack(mockCtrl)
+							buildpackStore.EXPECT().Lookup("B", "v2").Return(bpB, nil)
+							bpB.EXPECT().Build(gomock.Any(), config, gomock.Any()).Return(buildpack.BuildResult{
+								StopSignal: "SIGINT",
+								User:       "1000:1000",
+							}, nil)
+
+							metadata, err := builder.Build()
+							h.AssertNil(t, err)
+							h.AssertEq(t, metadata.StopSignal, "SIGINT")
+							h.AssertEq(t, metadata.User, "1000:1000")
+							var warnings []string
+							for _, entry := range logHandler.Entries {
+								if entry.Level == log.WarnLevel {
+									warnings = append(warnings, entry.Message)
+								}
+							}
+							h.AssertEq(t, warnings, []string{"buildpack 'B' overrides stop signal 'SIGTERM' provided by buildpack 'A' with 'SIGINT'"})
+						})
+					})
+				})
 			})
 		})
 
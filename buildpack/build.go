@@ -42,6 +42,11 @@ type BuildResult struct {
 	MetRequires []string
 	Processes   []launch.Process
 	Slices      []layers.Slice
+	Ports       []Port
+	Volumes     []Volume
+	StopSignal  string
+	User        string
+	Prefetch    []string
 }
 
 func (bom *BOMEntry) ConvertMetadataToVersion() {
@@ -121,24 +126,30 @@ func renameLayerDirIfNeeded(layerMetadataFile LayerMetadataFile, layerDir string
 func (b *Descriptor) processLayers(layersDir string, logger Logger) (map[string]LayerMetadataFile, error) {
 	if api.MustParse(b.API).LessThan("0.6") {
 		return eachLayer(layersDir, b.API, func(path, buildpackAPI string) (LayerMetadataFile, error) {
-			layerMetadataFile, msg, err := DecodeLayerMetadataFile(path+".toml", buildpackAPI)
+			layerMetadataFile, msg, err := decodeLayerMetadataFile(path+".toml", buildpackAPI)
 			if err != nil {
 				return LayerMetadataFile{}, err
 			}
 			if msg != "" {
 				logger.Warn(msg)
 			}
+			if err := checkRestoreMode(&layerMetadataFile, buildpackAPI, logger); err != nil {
+				return LayerMetadataFile{}, fmt.Errorf("layer '%s': %w", filepath.Base(path), err)
+			}
 			return layerMetadataFile, nil
 		})
 	}
 	return eachLayer(layersDir, b.API, func(path, buildpackAPI string) (LayerMetadataFile, error) {
-		layerMetadataFile, msg, err := DecodeLayerMetadataFile(path+".toml", buildpackAPI)
+		layerMetadataFile, msg, err := decodeLayerMetadataFile(path+".toml", buildpackAPI)
 		if err != nil {
 			return LayerMetadataFile{}, err
 		}
 		if msg != "" {
 			return LayerMetadataFile{}, errors.New(msg)
 		}
+		if err := checkRestoreMode(&layerMetadataFile, buildpackAPI, logger); err != nil {
+			return LayerMetadataFile{}, fmt.Errorf("layer '%s': %w", filepath.Base(path), err)
+		}
 		if err := renameLayerDirIfNeeded(layerMetadataFile, path); err != nil {
 			return LayerMetadataFile{}, err
 		}
@@ -329,6 +340,33 @@ func (b *Descriptor) readOutputFiles(bpLayersDir, bpPlanPath string, bpPlanIn Pl
 	br.Processes = append([]launch.Process{}, launchTOML.Processes...)
 	br.Slices = append([]layers.Slice{}, launchTOML.Slices...)
 
+	br.Prefetch = launchTOML.Prefetch
+
+	// set image config from launch.toml
+	if api.MustParse(b.API).LessThan("0.8") {
+		if len(launchTOML.Ports) > 0 || len(launchTOML.Volumes) > 0 || launchTOML.StopSignal != "" || launchTOML.User != "" {
+			logger.Warn("Warning: image config isn't supported in this buildpack api version. Ignoring ports, volumes, stop-signal and user")
+		}
+		return br, nil
+	}
+	for _, port := range launchTOML.Ports {
+		if err := port.validate(); err != nil {
+			return BuildResult{}, fmt.Errorf("validating ports: %w", err)
+		}
+	}
+	for _, volume := range launchTOML.Volumes {
+		if err := volume.validate(); err != nil {
+			return BuildResult{}, fmt.Errorf("validating volumes: %w", err)
+		}
+	}
+	if err := validateStopSignal(launchTOML.StopSignal); err != nil {
+		return BuildResult{}, fmt.Errorf("validating stop-signal: %w", err)
+	}
+	br.Ports = launchTOML.Ports
+	br.Volumes = launchTOML.Volumes
+	br.StopSignal = launchTOML.StopSignal
+	br.User = launchTOML.User
+
 	return br, nil
 }
 
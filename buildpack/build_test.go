@@ -519,6 +519,73 @@ func testBuild(t *testing.T, when spec.G, it spec.S) {
 						t.Fatalf("Unexpected:\n%s\n", s)
 					}
 				})
+
+				it("should include image config", func() {
+					h.Mkfile(t,
+						"stop-signal = \"SIGINT\"\n"+
+							"user = \"1000:1000\"\n"+
+							"prefetch = [\"some-file\", \"/some/other-file\"]\n"+
+							"[[ports]]\n"+
+							"port = 8080\n"+
+							"[[ports]]\n"+
+							"port = 53\n"+
+							"protocol = \"udp\"\n"+
+							"[[volumes]]\n"+
+							"path = \"/data\"\n",
+						filepath.Join(appDir, "launch-A-v1.toml"),
+					)
+
+					br, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, br.Ports, []buildpack.Port{{Port: 8080}, {Port: 53, Protocol: "udp"}})
+					h.AssertEq(t, br.Volumes, []buildpack.Volume{{Path: "/data"}})
+					h.AssertEq(t, br.StopSignal, "SIGINT")
+					h.AssertEq(t, br.User, "1000:1000")
+					h.AssertEq(t, br.Prefetch, []string{"some-file", "/some/other-file"})
+				})
+
+				it("should error for an invalid port", func() {
+					h.Mkfile(t,
+						"[[ports]]\n"+
+							"port = 8080\n"+
+							"protocol = \"http\"\n",
+						filepath.Join(appDir, "launch-A-v1.toml"),
+					)
+
+					_, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+					h.AssertError(t, err, "validating ports: invalid protocol 'http' for port 8080")
+				})
+
+				it("should error for a relative volume path", func() {
+					h.Mkfile(t,
+						"[[volumes]]\n"+
+							"path = \"data\"\n",
+						filepath.Join(appDir, "launch-A-v1.toml"),
+					)
+
+					_, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+					h.AssertError(t, err, "validating volumes: path 'data' must be absolute")
+				})
+
+				it("should accept a stop signal name without the SIG prefix or a signal number", func() {
+					signals := []string{"TERM", "sigquit", "15"}
+					mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil).Times(len(signals) - 1)
+					for _, signal := range signals {
+						h.Mkfile(t, fmt.Sprintf("stop-signal = %q\n", signal), filepath.Join(appDir, "launch-A-v1.toml"))
+
+						br, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+						h.AssertNil(t, err)
+						h.AssertEq(t, br.StopSignal, signal)
+					}
+				})
+
+				it("should error for an unknown stop signal", func() {
+					h.Mkfile(t, "stop-signal = \"SIGFOO\"\n", filepath.Join(appDir, "launch-A-v1.toml"))
+
+					_, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+					h.AssertError(t, err, "validating stop-signal: unknown signal 'SIGFOO'")
+				})
 			})
 
 			when("the launch, cache and build flags are false", func() {
@@ -774,6 +841,44 @@ func testBuild(t *testing.T, when spec.G, it spec.S) {
 					h.AssertStringContains(t, err.Error(), expected)
 				})
 			})
+
+			when("the restore mode is invalid", func() {
+				it("should error", func() {
+					mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+					h.Mkdir(t,
+						filepath.Join(layersDir, "A"),
+						filepath.Join(appDir, "layers-A-v1", "layer"),
+					)
+					h.Mkfile(t,
+						"restore = \"sometimes\"\n[types]\ncache = true",
+						filepath.Join(appDir, "layers-A-v1", "layer.toml"),
+					)
+
+					_, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+					h.AssertNotNil(t, err)
+					expected := "layer 'layer': invalid restore mode 'sometimes', expected one of 'eager', 'lazy' or 'skip'"
+					h.AssertStringContains(t, err.Error(), expected)
+				})
+			})
+
+			when("a launch and cache layer requests a lazy restore", func() {
+				it("should error", func() {
+					mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+					h.Mkdir(t,
+						filepath.Join(layersDir, "A"),
+						filepath.Join(appDir, "layers-A-v1", "layer"),
+					)
+					h.Mkfile(t,
+						"restore = \"lazy\"\n[types]\nlaunch = true\ncache = true",
+						filepath.Join(appDir, "layers-A-v1", "layer.toml"),
+					)
+
+					_, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+					h.AssertNotNil(t, err)
+					expected := "layer 'layer': restore mode 'lazy' is not allowed for a layer that is both a launch and a cache layer"
+					h.AssertStringContains(t, err.Error(), expected)
+				})
+			})
 		})
 
 		when("buildpack api = 0.2", func() {
@@ -1213,6 +1318,41 @@ func testBuild(t *testing.T, when spec.G, it spec.S) {
 				h.AssertEq(t, br.Processes[0].WorkingDirectory, "")
 				assertLogEntry(t, logHandler, "Warning: process working directory isn't supported in this buildpack api version. Ignoring working directory for process 'some-type'")
 			})
+
+			it("should ignore the layer restore mode and warn", func() {
+				mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+				h.Mkdir(t,
+					filepath.Join(layersDir, "A"),
+					filepath.Join(appDir, "layers-A-v1", "layer"),
+				)
+				h.Mkfile(t,
+					"restore = \"sometimes\"\n[types]\ncache = true",
+					filepath.Join(appDir, "layers-A-v1", "layer.toml"),
+				)
+				_, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+				h.AssertNil(t, err)
+				assertLogEntry(t, logHandler, "Warning: restore isn't supported in this buildpack api version. Ignoring restore mode 'sometimes'")
+			})
+
+			it("should ignore image config and warn", func() {
+				mockEnv.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+				h.Mkfile(t,
+					"stop-signal = \"SIGINT\"\n"+
+						"user = \"1000:1000\"\n"+
+						"[[ports]]\n"+
+						"port = 8080\n"+
+						"[[volumes]]\n"+
+						"path = \"/data\"\n",
+					filepath.Join(appDir, "launch-A-v1.toml"),
+				)
+				br, err := bpTOML.Build(buildpack.Plan{}, config, mockEnv)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(br.Ports), 0)
+				h.AssertEq(t, len(br.Volumes), 0)
+				h.AssertEq(t, br.StopSignal, "")
+				h.AssertEq(t, br.User, "")
+				assertLogEntry(t, logHandler, "Warning: image config isn't supported in this buildpack api version. Ignoring ports, volumes, stop-signal and user")
+			})
 		})
 	})
 }
@@ -5,10 +5,11 @@ package buildpack
 import "github.com/BurntSushi/toml"
 
 type Descriptor struct {
-	API       string `toml:"api"`
-	Buildpack Info   `toml:"buildpack"`
-	Order     Order  `toml:"order"`
-	Dir       string `toml:"-"`
+	API       string  `toml:"api"`
+	Buildpack Info    `toml:"buildpack"`
+	Order     Order   `toml:"order"`
+	Stacks    []Stack `toml:"stacks"`
+	Dir       string  `toml:"-"`
 }
 
 func (b *Descriptor) ConfigFile() *Descriptor {
@@ -32,6 +33,13 @@ type Info struct {
 	SBOM     []string `toml:"sbom-formats,omitempty" json:"sbom-formats,omitempty"`
 }
 
+// Stack is a stack supported by a buildpack; an ID of "*" matches any stack.
+// Mixins prefixed with "build:" or "run:" are only required in the build or run image.
+type Stack struct {
+	ID     string   `toml:"id"`
+	Mixins []string `toml:"mixins,omitempty"`
+}
+
 type Order []Group
 
 type Group struct {
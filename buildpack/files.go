@@ -4,6 +4,9 @@ package buildpack
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
@@ -12,10 +15,15 @@ import (
 // launch.toml
 
 type LaunchTOML struct {
-	BOM       []BOMEntry
-	Labels    []Label
-	Processes []launch.Process `toml:"processes"`
-	Slices    []layers.Slice   `toml:"slices"`
+	BOM        []BOMEntry
+	Labels     []Label
+	Processes  []launch.Process `toml:"processes"`
+	Slices     []layers.Slice   `toml:"slices"`
+	Ports      []Port           `toml:"ports"`
+	Volumes    []Volume         `toml:"volumes"`
+	StopSignal string           `toml:"stop-signal"`
+	User       string           `toml:"user"`
+	Prefetch   []string         `toml:"prefetch"`
 }
 
 type BOMEntry struct {
@@ -68,6 +76,70 @@ type Label struct {
 	Value string `toml:"value"`
 }
 
+// Port is a port exposed by the app image.
+type Port struct {
+	Port     int    `toml:"port" json:"port"`
+	Protocol string `toml:"protocol,omitempty" json:"protocol,omitempty"` // defaults to tcp
+}
+
+// String returns the port in the format used by the image config, e.g. 8080/tcp.
+func (p Port) String() string {
+	protocol := p.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return fmt.Sprintf("%d/%s", p.Port, strings.ToLower(protocol))
+}
+
+func (p Port) validate() error {
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("invalid port %d", p.Port)
+	}
+	switch strings.ToLower(p.Protocol) {
+	case "", "tcp", "udp", "sctp":
+		return nil
+	default:
+		return fmt.Errorf("invalid protocol '%s' for port %d", p.Protocol, p.Port)
+	}
+}
+
+// Volume is a volume declared by the app image.
+type Volume struct {
+	Path string `toml:"path" json:"path"`
+}
+
+func (v Volume) validate() error {
+	if !filepath.IsAbs(v.Path) {
+		return fmt.Errorf("path '%s' must be absolute", v.Path)
+	}
+	return nil
+}
+
+// signals are the signal names accepted as a stop signal, without the SIG prefix.
+var signals = map[string]bool{
+	"ABRT": true, "ALRM": true, "BUS": true, "CHLD": true, "CONT": true, "FPE": true, "HUP": true, "ILL": true,
+	"INT": true, "IO": true, "KILL": true, "PIPE": true, "PROF": true, "PWR": true, "QUIT": true, "SEGV": true,
+	"STKFLT": true, "STOP": true, "SYS": true, "TERM": true, "TRAP": true, "TSTP": true, "TTIN": true, "TTOU": true,
+	"URG": true, "USR1": true, "USR2": true, "VTALRM": true, "WINCH": true, "XCPU": true, "XFSZ": true,
+}
+
+// validateStopSignal checks that the stop signal is empty, a signal name such as SIGTERM or TERM, or a signal number.
+func validateStopSignal(signal string) error {
+	if signal == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(signal); err == nil {
+		if n < 1 || n > 64 {
+			return fmt.Errorf("invalid signal number %d", n)
+		}
+		return nil
+	}
+	if name := strings.ToUpper(signal); signals[strings.TrimPrefix(name, "SIG")] {
+		return nil
+	}
+	return fmt.Errorf("unknown signal '%s'", signal)
+}
+
 // build.toml
 
 type BuildTOML struct {
@@ -202,4 +274,5 @@ type LayersMetadata struct {
 type LayerMetadata struct {
 	SHA string `json:"sha" toml:"sha"`
 	LayerMetadataFile
+	layers.LayerSize
 }
@@ -10,11 +10,48 @@ import (
 	"github.com/buildpacks/lifecycle/api"
 )
 
+// Restore modes for cached layers, set with the restore key in <layer>.toml for buildpack API 0.8 and later.
+// Lazy layers are not extracted automatically when they are first accessed: the buildpack must run restore-layer.
+// Layers that are both launch and cache layers are always restored eagerly, as the exporter needs their contents.
+const (
+	RestoreEager = "eager" // the restorer extracts the layer before the build (default)
+	RestoreLazy  = "lazy"  // the restorer only restores the layer metadata; the buildpack extracts the layer with the restore-layer helper if it needs it
+	RestoreSkip  = "skip"  // the restorer removes the layer so that the buildpack recreates it from scratch
+)
+
 type LayerMetadataFile struct {
-	Data   interface{} `json:"data" toml:"metadata"`
-	Build  bool        `json:"build" toml:"build"`
-	Launch bool        `json:"launch" toml:"launch"`
-	Cache  bool        `json:"cache" toml:"cache"`
+	Data    interface{} `json:"data" toml:"metadata"`
+	Build   bool        `json:"build" toml:"build"`
+	Launch  bool        `json:"launch" toml:"launch"`
+	Cache   bool        `json:"cache" toml:"cache"`
+	Restore string      `json:"restore,omitempty" toml:"restore,omitempty"`
+}
+
+// checkRestoreMode validates the restore mode of the layer, or ignores it when the buildpack API does not support it.
+func checkRestoreMode(lmf *LayerMetadataFile, buildpackAPI string, logger Logger) error {
+	if lmf.Restore == "" {
+		return nil
+	}
+	if !supportsRestoreMode(buildpackAPI) {
+		logger.Warn(fmt.Sprintf("Warning: restore isn't supported in this buildpack api version. Ignoring restore mode '%s'", lmf.Restore))
+		lmf.Restore = ""
+		return nil
+	}
+	switch lmf.Restore {
+	case RestoreEager:
+		return nil
+	case RestoreLazy, RestoreSkip:
+		if lmf.Launch && lmf.Cache {
+			return fmt.Errorf("restore mode '%s' is not allowed for a layer that is both a launch and a cache layer", lmf.Restore)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid restore mode '%s', expected one of '%s', '%s' or '%s'", lmf.Restore, RestoreEager, RestoreLazy, RestoreSkip)
+	}
+}
+
+func supportsRestoreMode(buildpackAPI string) bool {
+	return api.MustParse(buildpackAPI).AtLeast("0.8")
 }
 
 func EncodeLayerMetadataFile(lmf LayerMetadataFile, path, buildpackAPI string) error {
@@ -35,6 +72,14 @@ func EncodeLayerMetadataFile(lmf LayerMetadataFile, path, buildpackAPI string) e
 }
 
 func DecodeLayerMetadataFile(path, buildpackAPI string) (LayerMetadataFile, string, error) { // TODO: pass the logger and print the warning inside (instead of returning a message)
+	lmf, msg, err := decodeLayerMetadataFile(path, buildpackAPI)
+	if !supportsRestoreMode(buildpackAPI) {
+		lmf.Restore = ""
+	}
+	return lmf, msg, err
+}
+
+func decodeLayerMetadataFile(path, buildpackAPI string) (LayerMetadataFile, string, error) {
 	fh, err := os.Open(path)
 	if os.IsNotExist(err) {
 		return LayerMetadataFile{}, "", nil
@@ -75,9 +120,10 @@ func (d *defaultEncoderDecoder) IsSupported(buildpackAPI string) bool {
 func (d *defaultEncoderDecoder) Encode(file *os.File, lmf LayerMetadataFile) error {
 	// omit the types table - all the flags are set to false
 	type dataTomlFile struct {
-		Data interface{} `toml:"metadata"`
+		Data    interface{} `toml:"metadata"`
+		Restore string      `toml:"restore,omitempty"`
 	}
-	dtf := dataTomlFile{Data: lmf.Data}
+	dtf := dataTomlFile{Data: lmf.Data, Restore: lmf.Restore}
 	return toml.NewEncoder(file).Encode(dtf)
 }
 
@@ -88,8 +134,9 @@ func (d *defaultEncoderDecoder) Decode(path string) (LayerMetadataFile, string,
 		Cache  bool `toml:"cache"`
 	}
 	type layerMetadataTomlFile struct {
-		Data  interface{} `toml:"metadata"`
-		Types typesTable  `toml:"types"`
+		Data    interface{} `toml:"metadata"`
+		Types   typesTable  `toml:"types"`
+		Restore string      `toml:"restore"`
 	}
 
 	var lmtf layerMetadataTomlFile
@@ -101,7 +148,7 @@ func (d *defaultEncoderDecoder) Decode(path string) (LayerMetadataFile, string,
 	if isWrongFormat := typesInTopLevel(md); isWrongFormat {
 		msg = fmt.Sprintf("the launch, cache and build flags should be in the types table of %s", path)
 	}
-	return LayerMetadataFile{Data: lmtf.Data, Build: lmtf.Types.Build, Launch: lmtf.Types.Launch, Cache: lmtf.Types.Cache}, msg, nil
+	return LayerMetadataFile{Data: lmtf.Data, Build: lmtf.Types.Build, Launch: lmtf.Types.Launch, Cache: lmtf.Types.Cache, Restore: lmtf.Restore}, msg, nil
 }
 
 func typesInTopLevel(md toml.MetaData) bool {
@@ -26,7 +26,11 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	if err != nil {
 		return errors.Wrap(err, "metadata for previous cache")
 	}
-	meta := platform.CacheMetadata{}
+	meta := platform.CacheMetadata{FingerprintSettings: e.LayerFactory.FingerprintSettings()}
+	lazyLayers, err := platform.ReadLazyLayers(platform.LazyLayersPath(layersDir))
+	if err != nil {
+		return errors.Wrap(err, "reading lazy layers")
+	}
 
 	for _, bp := range e.Buildpacks {
 		bpDir, err := buildpack.ReadLayersDir(layersDir, bp, e.Logger)
@@ -42,6 +46,10 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 		for _, layer := range bpDir.FindLayers(buildpack.MadeCached) {
 			layer := layer
 			if !layer.HasLocalContents() {
+				if lmd, ok := e.reuseLazyCacheLayer(cacheStore, &layer, bp.ID, lazyLayers, origMeta); ok {
+					bpMD.Layers[layer.Name()] = lmd
+					continue
+				}
 				e.Logger.Warnf("Failed to cache layer '%s' because it has no contents", layer.Identifier())
 				continue
 			}
@@ -51,6 +59,17 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 				continue
 			}
 			origLayerMetadata := origMeta.MetadataForBuildpack(bp.ID).Layers[layer.Name()]
+			if unchanged, ok := e.LayerFactory.UnchangedDirLayer(layer.Identifier(), layer.Path()); ok && unchanged.Digest == origLayerMetadata.SHA {
+				e.Logger.Infof("Reusing unchanged cache layer '%s'\n", layer.Identifier())
+				e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.Identifier(), unchanged.Digest)
+				if err := cacheStore.ReuseLayer(unchanged.Digest); err != nil {
+					e.Logger.Warnf("Failed to cache layer '%s': %s", layer.Identifier(), err)
+					continue
+				}
+				lmd.SHA = unchanged.Digest
+				bpMD.Layers[layer.Name()] = lmd
+				continue
+			}
 			if lmd.SHA, err = e.addOrReuseCacheLayer(cacheStore, &layer, origLayerMetadata.SHA); err != nil {
 				e.Logger.Warnf("Failed to cache layer '%s': %s", layer.Identifier(), err)
 				continue
@@ -76,6 +95,25 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	return nil
 }
 
+// reuseLazyCacheLayer reuses the previous cache data for a lazy layer that the buildpack did not restore during the build.
+func (e *Exporter) reuseLazyCacheLayer(cacheStore Cache, layer *buildpack.Layer, bpID string, lazyLayers platform.LazyLayersMetadata, origMeta platform.CacheMetadata) (buildpack.LayerMetadata, bool) {
+	lazyLayer := lazyLayers.Find(bpID, layer.Name())
+	if lazyLayer == nil || lazyLayer.Restored || lazyLayer.SHA != origMeta.MetadataForBuildpack(bpID).Layers[layer.Name()].SHA {
+		return buildpack.LayerMetadata{}, false
+	}
+	lmd, err := layer.Read()
+	if err != nil {
+		return buildpack.LayerMetadata{}, false
+	}
+	e.Logger.Infof("Reusing cache layer '%s', it was not restored during the build\n", layer.Identifier())
+	if err := cacheStore.ReuseLayer(lazyLayer.SHA); err != nil {
+		e.Logger.Warnf("Failed to cache layer '%s': %s", layer.Identifier(), err)
+		return buildpack.LayerMetadata{}, false
+	}
+	lmd.SHA = lazyLayer.SHA
+	return lmd, true
+}
+
 type layerDir struct {
 	path       string
 	identifier string
@@ -9,8 +9,12 @@ import (
 	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/remote"
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/platform"
 )
@@ -18,9 +22,11 @@ import (
 const MetadataLabel = "io.buildpacks.lifecycle.cache.metadata"
 
 type ImageCache struct {
-	committed bool
-	origImage imgutil.Image
-	newImage  imgutil.Image
+	committed   bool
+	origImage   imgutil.Image
+	newImage    imgutil.Image
+	retryPolicy *image.RetryPolicy
+	keychain    authn.Keychain // set when the cache is created from a name
 }
 
 func NewImageCache(origImage imgutil.Image, newImage imgutil.Image) *ImageCache {
@@ -30,27 +36,40 @@ func NewImageCache(origImage imgutil.Image, newImage imgutil.Image) *ImageCache
 	}
 }
 
-func NewImageCacheFromName(name string, keychain authn.Keychain) (*ImageCache, error) {
-	origImage, err := remote.NewImage(
-		name,
-		keychain,
-		remote.FromBaseImage(name),
-		remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
-	)
-	if err != nil {
+// NewImageCacheFromName returns a cache backed by the image with the given name.
+// Registry reads and writes are retried according to retryPolicy.
+func NewImageCacheFromName(name string, keychain authn.Keychain, retryPolicy *image.RetryPolicy) (*ImageCache, error) {
+	var origImage *remote.Image
+	if err := retryPolicy.Do(fmt.Sprintf("reading cache image %q", name), func() error {
+		var err error
+		origImage, err = remote.NewImage(
+			name,
+			keychain,
+			remote.FromBaseImage(name),
+			remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
+		)
+		return err
+	}); err != nil {
 		return nil, fmt.Errorf("accessing cache image %q: %v", name, err)
 	}
-	emptyImage, err := remote.NewImage(
-		name,
-		keychain,
-		remote.WithPreviousImage(name),
-		remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
-	)
-	if err != nil {
+	var emptyImage *remote.Image
+	if err := retryPolicy.Do(fmt.Sprintf("creating new cache image %q", name), func() error {
+		var err error
+		emptyImage, err = remote.NewImage(
+			name,
+			keychain,
+			remote.WithPreviousImage(name),
+			remote.WithDefaultPlatform(imgutil.Platform{OS: runtime.GOOS}),
+		)
+		return err
+	}); err != nil {
 		return nil, fmt.Errorf("creating new cache image %q: %v", name, err)
 	}
 
-	return NewImageCache(origImage, emptyImage), nil
+	cache := NewImageCache(origImage, emptyImage)
+	cache.retryPolicy = retryPolicy
+	cache.keychain = keychain
+	return cache, nil
 }
 
 func (c *ImageCache) Exists() bool {
@@ -95,7 +114,66 @@ func (c *ImageCache) ReuseLayer(diffID string) error {
 }
 
 func (c *ImageCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
-	return c.origImage.GetLayer(diffID)
+	var rc io.ReadCloser
+	err := c.retryPolicy.Do(fmt.Sprintf("retrieving cache layer %s", diffID), func() error {
+		var err error
+		rc, err = c.origImage.GetLayer(diffID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// layers compressed with anything but gzip are returned by the registry as they are stored
+	drc, _, err := archive.NewDecompressingReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, errors.Wrapf(err, "decompressing cache layer %s", diffID)
+	}
+	return &layerReader{ReadCloser: drc, closer: rc}, nil
+}
+
+// SetLayerCompression sets the compression and level of the layers added to the cache image.
+// It must be called before any layer is added.
+func (c *ImageCache) SetLayerCompression(compression archive.Compression, level int) {
+	if compression == archive.CompressionGzip && level == 0 {
+		return
+	}
+	c.newImage = image.NewCompressedImage(c.newImage, image.CompressionOptions{
+		Compression:      compression,
+		Level:            level,
+		Keychain:         c.keychain,
+		PreviousImageRef: c.newImage.Name(),
+	})
+}
+
+// LayerDiffIDs returns the diff IDs of the layers in the cache image.
+func (c *ImageCache) LayerDiffIDs() ([]string, error) {
+	if c.keychain == nil {
+		return nil, errors.New("listing layers is only supported for cache images created from a name")
+	}
+	if !c.origImage.Found() {
+		return nil, nil
+	}
+	ref, err := name.ParseReference(c.origImage.Name(), name.WeakValidation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing reference '%s'", c.origImage.Name())
+	}
+	var configFile *v1.ConfigFile
+	if err := c.retryPolicy.Do(fmt.Sprintf("reading cache image config '%s'", c.origImage.Name()), func() error {
+		img, err := ggcrremote.Image(ref, ggcrremote.WithAuthFromKeychain(c.keychain))
+		if err != nil {
+			return err
+		}
+		configFile, err = img.ConfigFile()
+		return err
+	}); err != nil {
+		return nil, errors.Wrapf(err, "reading cache image config '%s'", c.origImage.Name())
+	}
+	var diffIDs []string
+	for _, diffID := range configFile.RootFS.DiffIDs {
+		diffIDs = append(diffIDs, diffID.String())
+	}
+	return diffIDs, nil
 }
 
 func (c *ImageCache) Commit() error {
@@ -106,7 +184,9 @@ func (c *ImageCache) Commit() error {
 	// Check if the cache image exists prior to saving the new cache at that same location
 	origImgExists := c.origImage.Found()
 
-	if err := c.newImage.Save(); err != nil {
+	if err := c.retryPolicy.Do(fmt.Sprintf("saving cache image '%s'", c.newImage.Name()), func() error {
+		return c.newImage.Save()
+	}); err != nil {
 		return errors.Wrapf(err, "saving image '%s'", c.newImage.Name())
 	}
 	c.committed = true
@@ -2,7 +2,9 @@ package cache
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -10,15 +12,22 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/platform"
 )
 
+// layerCompressions are the compressions of layers found in a volume cache, in the order they are looked up.
+var layerCompressions = []archive.Compression{archive.CompressionNone, archive.CompressionGzip, archive.CompressionZstd}
+
 type VolumeCache struct {
 	committed    bool
 	dir          string
 	backupDir    string
 	stagingDir   string
 	committedDir string
+
+	compression archive.Compression
+	level       int
 }
 
 func NewVolumeCache(dir string) (*VolumeCache, error) {
@@ -31,6 +40,7 @@ func NewVolumeCache(dir string) (*VolumeCache, error) {
 		backupDir:    filepath.Join(dir, "committed-backup"),
 		stagingDir:   filepath.Join(dir, "staging"),
 		committedDir: filepath.Join(dir, "committed"),
+		compression:  archive.CompressionNone,
 	}
 
 	if err := c.setupStagingDir(); err != nil {
@@ -48,6 +58,13 @@ func NewVolumeCache(dir string) (*VolumeCache, error) {
 	return c, nil
 }
 
+// SetLayerCompression stores the layers added to the cache compressed with the given compression and level.
+// Layers are read from the cache regardless of how they were stored.
+func (c *VolumeCache) SetLayerCompression(compression archive.Compression, level int) {
+	c.compression = compression
+	c.level = level
+}
+
 func (c *VolumeCache) Exists() bool {
 	if _, err := os.Stat(c.committedDir); err != nil {
 		return false
@@ -99,13 +116,17 @@ func (c *VolumeCache) AddLayerFile(tarPath string, diffID string) error {
 	if c.committed {
 		return errCacheCommitted
 	}
-	layerTar := diffIDPath(c.stagingDir, diffID)
-	if _, err := os.Stat(layerTar); err == nil {
+	if _, err := findLayerFile(c.stagingDir, diffID); err == nil {
 		// don't waste time rewriting an identical layer
 		return nil
 	}
 
-	if err := copyFile(tarPath, layerTar); err != nil {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return errors.Wrapf(err, "caching layer (%s)", diffID)
+	}
+	defer f.Close()
+	if err := c.writeLayer(f, diffID); err != nil {
 		return errors.Wrapf(err, "caching layer (%s)", diffID)
 	}
 	return nil
@@ -116,30 +137,64 @@ func (c *VolumeCache) AddLayer(rc io.ReadCloser, diffID string) error {
 		return errCacheCommitted
 	}
 
-	fh, err := os.Create(diffIDPath(c.stagingDir, diffID))
+	if err := c.writeLayer(rc, diffID); err != nil {
+		return errors.Wrap(err, "copying layer to tar file")
+	}
+	return nil
+}
+
+// writeLayer writes the layer read from r to the staging dir, compressed as configured for the cache,
+// replacing the layer if it was already staged. Layers that are read compressed, like eStargz layers, are recompressed.
+func (c *VolumeCache) writeLayer(r io.Reader, diffID string) error {
+	dr, _, err := archive.NewDecompressingReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	path := layerPath(c.stagingDir, diffID, c.compression)
+	fh, err := os.Create(path)
 	if err != nil {
 		return errors.Wrapf(err, "create layer file in cache")
 	}
 	defer fh.Close()
 
-	if _, err := io.Copy(fh, rc); err != nil {
-		return errors.Wrap(err, "copying layer to tar file")
+	cw, err := archive.NewCompressingWriter(fh, c.compression, c.level)
+	if err != nil {
+		return err
 	}
-	return nil
+	if _, err := io.Copy(cw, dr); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	for _, compression := range layerCompressions {
+		if other := layerPath(c.stagingDir, diffID, compression); other != path {
+			if err := os.Remove(other); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return fh.Close()
 }
 
 func (c *VolumeCache) ReuseLayer(diffID string) error {
 	if c.committed {
 		return errCacheCommitted
 	}
-	if err := os.Link(diffIDPath(c.committedDir, diffID), diffIDPath(c.stagingDir, diffID)); err != nil && !os.IsExist(err) {
+	committed, err := findLayerFile(c.committedDir, diffID)
+	if err != nil {
+		return errors.Wrapf(err, "reusing layer (%s)", diffID)
+	}
+	if err := os.Link(committed, filepath.Join(c.stagingDir, filepath.Base(committed))); err != nil && !os.IsExist(err) {
 		return errors.Wrapf(err, "reusing layer (%s)", diffID)
 	}
 	return nil
 }
 
+// RetrieveLayer returns a reader of the uncompressed contents of the layer.
 func (c *VolumeCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
-	path, err := c.RetrieveLayerFile(diffID)
+	path, err := c.retrieveLayerPath(diffID)
 	if err != nil {
 		return nil, err
 	}
@@ -147,11 +202,30 @@ func (c *VolumeCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "opening layer with SHA '%s'", diffID)
 	}
-	return file, nil
+	dr, _, err := archive.NewDecompressingReader(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "reading layer with SHA '%s'", diffID)
+	}
+	return &layerReader{ReadCloser: dr, closer: file}, nil
+}
+
+// layerReader reads a decompressed layer and closes the underlying compressed stream along with it.
+type layerReader struct {
+	io.ReadCloser
+	closer io.Closer
+}
+
+func (r *layerReader) Close() error {
+	if err := r.ReadCloser.Close(); err != nil {
+		r.closer.Close()
+		return err
+	}
+	return r.closer.Close()
 }
 
 func (c *VolumeCache) HasLayer(diffID string) (bool, error) {
-	if _, err := os.Stat(diffIDPath(c.committedDir, diffID)); err != nil {
+	if _, err := findLayerFile(c.committedDir, diffID); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
@@ -160,9 +234,22 @@ func (c *VolumeCache) HasLayer(diffID string) (bool, error) {
 	return true, nil
 }
 
+// RetrieveLayerFile returns the path of the uncompressed layer tarball.
+// It fails if the layer is stored compressed.
 func (c *VolumeCache) RetrieveLayerFile(diffID string) (string, error) {
-	path := diffIDPath(c.committedDir, diffID)
-	if _, err := os.Stat(path); err != nil {
+	path, err := c.retrieveLayerPath(diffID)
+	if err != nil {
+		return "", err
+	}
+	if path != diffIDPath(c.committedDir, diffID) {
+		return "", fmt.Errorf("layer with SHA '%s' is stored compressed", diffID)
+	}
+	return path, nil
+}
+
+func (c *VolumeCache) retrieveLayerPath(diffID string) (string, error) {
+	path, err := findLayerFile(c.committedDir, diffID)
+	if err != nil {
 		if os.IsNotExist(err) {
 			return "", errors.Wrapf(err, "layer with SHA '%s' not found", diffID)
 		}
@@ -171,6 +258,29 @@ func (c *VolumeCache) RetrieveLayerFile(diffID string) (string, error) {
 	return path, nil
 }
 
+// LayerDiffIDs returns the diff IDs of the committed layers in the cache.
+func (c *VolumeCache) LayerDiffIDs() ([]string, error) {
+	fis, err := ioutil.ReadDir(c.committedDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading committed directory '%s'", c.committedDir)
+	}
+	var diffIDs []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		diffID, ok := trimLayerExtension(fi.Name())
+		if !ok {
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			diffID = "sha256:" + diffID
+		}
+		diffIDs = append(diffIDs, diffID)
+	}
+	return diffIDs, nil
+}
+
 func (c *VolumeCache) Commit() error {
 	if c.committed {
 		return errCacheCommitted
@@ -199,27 +309,41 @@ func diffIDPath(basePath, diffID string) string {
 	return filepath.Join(basePath, diffID+".tar")
 }
 
-func (c *VolumeCache) setupStagingDir() error {
-	if err := os.RemoveAll(c.stagingDir); err != nil {
-		return err
+// layerPath returns the path of the layer stored with the given compression.
+func layerPath(basePath, diffID string, compression archive.Compression) string {
+	return diffIDPath(basePath, diffID) + compression.Extension()
+}
+
+// findLayerFile returns the path of the layer, however it is stored, or an error satisfying os.IsNotExist.
+func findLayerFile(basePath, diffID string) (string, error) {
+	var lastErr error
+	for _, compression := range layerCompressions {
+		path := layerPath(basePath, diffID, compression)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		lastErr = err
 	}
-	return os.MkdirAll(c.stagingDir, 0777)
+	return "", lastErr
 }
 
-func copyFile(from, to string) error {
-	in, err := os.Open(from)
-	if err != nil {
-		return err
+// trimLayerExtension returns the name of a layer file without its extension.
+func trimLayerExtension(name string) (string, bool) {
+	for i := len(layerCompressions) - 1; i >= 0; i-- {
+		if ext := ".tar" + layerCompressions[i].Extension(); strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
 	}
-	defer in.Close()
+	return "", false
+}
 
-	out, err := os.Create(to)
-	if err != nil {
+func (c *VolumeCache) setupStagingDir() error {
+	if err := os.RemoveAll(c.stagingDir); err != nil {
 		return err
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
-
-	return err
+	return os.MkdirAll(c.stagingDir, 0777)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/buildpack"
 	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/platform"
@@ -513,6 +514,87 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("layers are stored compressed", func() {
+				var (
+					layerPath string
+					layerSha  string
+					layerData []byte
+				)
+
+				it.Before(func() {
+					var err error
+					subject, err = cache.NewVolumeCache(volumeDir)
+					h.AssertNil(t, err)
+					subject.SetLayerCompression(archive.CompressionZstd, 0)
+					layerPath, layerSha, layerData = h.RandomLayer(t, tmpDir)
+					h.AssertNil(t, subject.AddLayerFile(layerPath, layerSha))
+					h.AssertNil(t, subject.Commit())
+				})
+
+				it("stores the compressed layer", func() {
+					h.AssertPathExists(t, filepath.Join(committedDir, layerSha+".tar.zst"))
+					h.AssertPathDoesNotExist(t, filepath.Join(committedDir, layerSha+".tar"))
+
+					diffIDs, err := subject.LayerDiffIDs()
+					h.AssertNil(t, err)
+					h.AssertEq(t, diffIDs, []string{layerSha})
+				})
+
+				it("retrieve returns the decompressed layer", func() {
+					rc, err := subject.RetrieveLayer(layerSha)
+					h.AssertNil(t, err)
+					defer rc.Close()
+
+					bytes, err := ioutil.ReadAll(rc)
+					h.AssertNil(t, err)
+					h.AssertEq(t, bytes, layerData)
+				})
+
+				it("reuses the compressed layer", func() {
+					next, err := cache.NewVolumeCache(volumeDir)
+					h.AssertNil(t, err)
+					h.AssertNil(t, next.ReuseLayer(layerSha))
+					h.AssertNil(t, next.Commit())
+
+					h.AssertPathExists(t, filepath.Join(committedDir, layerSha+".tar.zst"))
+					rc, err := next.RetrieveLayer(layerSha)
+					h.AssertNil(t, err)
+					defer rc.Close()
+					bytes, err := ioutil.ReadAll(rc)
+					h.AssertNil(t, err)
+					h.AssertEq(t, bytes, layerData)
+				})
+
+				it("retrieve file fails", func() {
+					_, err := subject.RetrieveLayerFile(layerSha)
+					h.AssertError(t, err, fmt.Sprintf("layer with SHA '%s' is stored compressed", layerSha))
+				})
+			})
+
+			when("the layer file is compressed", func() {
+				it("stores the layer in the compression of the cache", func() {
+					layerPath, layerSha, layerData := h.RandomLayer(t, tmpDir)
+					compressedPath := layerPath + ".gz"
+					f, err := os.Create(compressedPath)
+					h.AssertNil(t, err)
+					w, err := archive.NewCompressingWriter(f, archive.CompressionGzip, 0)
+					h.AssertNil(t, err)
+					_, err = w.Write(layerData)
+					h.AssertNil(t, err)
+					h.AssertNil(t, w.Close())
+					h.AssertNil(t, f.Close())
+
+					h.AssertNil(t, subject.AddLayerFile(compressedPath, layerSha))
+					h.AssertNil(t, subject.Commit())
+
+					path, err := subject.RetrieveLayerFile(layerSha)
+					h.AssertNil(t, err)
+					bytes, err := ioutil.ReadFile(path)
+					h.AssertNil(t, err)
+					h.AssertEq(t, bytes, layerData)
+				})
+			})
+
 			when("attempting to commit more than once", func() {
 				it("should fail", func() {
 					err := subject.Commit()
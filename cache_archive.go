@@ -0,0 +1,239 @@
+package lifecycle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+const (
+	// CacheArchiveSchemaVersion is the version of the cache archive format written by CacheArchiver.Export.
+	CacheArchiveSchemaVersion = 1
+
+	cacheArchiveMetadataFile = "metadata.json"
+	cacheArchiveLayersDir    = "layers"
+)
+
+// CacheArchiver serializes a cache, i.e. its metadata and the layers referenced by the metadata, to a single tar archive,
+// and restores caches from such archives. Any cache backend can be exported and imported,
+// so the archive can be used to convert between image and volume caches.
+//
+// The archive contains metadata.json, followed by one layers/<algorithm>/<hex>.tar entry for each layer.
+type CacheArchiver struct {
+	Logger Logger
+}
+
+type cacheArchiveMetadata struct {
+	SchemaVersion int                    `json:"schemaVersion"`
+	Metadata      platform.CacheMetadata `json:"metadata"`
+}
+
+// Export writes the cache to w. Layers are verified against their SHA as they are exported.
+func (a *CacheArchiver) Export(cache Cache, w io.Writer) error {
+	meta, err := cache.RetrieveMetadata()
+	if err != nil {
+		return errors.Wrap(err, "retrieving cache metadata")
+	}
+
+	tw := tar.NewWriter(w)
+	metadataJSON, err := json.Marshal(cacheArchiveMetadata{SchemaVersion: CacheArchiveSchemaVersion, Metadata: meta})
+	if err != nil {
+		return errors.Wrap(err, "serializing cache metadata")
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     cacheArchiveMetadataFile,
+		Mode:     0644,
+		Size:     int64(len(metadataJSON)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(metadataJSON); err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "lifecycle.cache-export.")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, sha := range referencedSHAs(meta) {
+		a.Logger.Infof("Exporting cache layer %s", sha)
+		if err := a.exportLayer(cache, tw, tmpDir, sha); err != nil {
+			return errors.Wrapf(err, "exporting cache layer %s", sha)
+		}
+	}
+	return tw.Close()
+}
+
+func (a *CacheArchiver) exportLayer(cache Cache, tw *tar.Writer, tmpDir, sha string) error {
+	name, err := cacheArchiveLayerPath(sha)
+	if err != nil {
+		return err
+	}
+	rc, err := cache.RetrieveLayer(sha)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// the size of the layer must be known before it is written to the archive
+	tmpPath := filepath.Join(tmpDir, "layer.tar")
+	size, err := copyVerified(rc, tmpPath, sha)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+	}); err != nil {
+		return err
+	}
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import replaces the contents of the cache with the contents of the archive read from r.
+// Layers are verified against their SHA as they are imported.
+func (a *CacheArchiver) Import(r io.Reader, cache Cache) error {
+	tmpDir, err := ioutil.TempDir("", "lifecycle.cache-import.")
+	if err != nil {
+		return err
+	}
+	// image caches read added layers when they are committed
+	defer os.RemoveAll(tmpDir)
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return errors.Wrap(err, "reading cache archive")
+	}
+	if hdr.Name != cacheArchiveMetadataFile {
+		return fmt.Errorf("invalid cache archive: expected %s as the first entry, got %s", cacheArchiveMetadataFile, hdr.Name)
+	}
+	var archiveMeta cacheArchiveMetadata
+	if err := json.NewDecoder(tr).Decode(&archiveMeta); err != nil {
+		return errors.Wrap(err, "parsing cache metadata")
+	}
+	if archiveMeta.SchemaVersion != CacheArchiveSchemaVersion {
+		return fmt.Errorf("unsupported cache archive schema version %d, expected %d", archiveMeta.SchemaVersion, CacheArchiveSchemaVersion)
+	}
+
+	expected := map[string]bool{}
+	for _, sha := range referencedSHAs(archiveMeta.Metadata) {
+		name, err := cacheArchiveLayerPath(sha)
+		if err != nil {
+			return err
+		}
+		expected[name] = false
+	}
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading cache archive")
+		}
+		imported, ok := expected[hdr.Name]
+		if !ok || imported {
+			return fmt.Errorf("invalid cache archive: unexpected entry %s", hdr.Name)
+		}
+		sha := cacheArchiveLayerSHA(hdr.Name)
+		a.Logger.Infof("Importing cache layer %s", sha)
+		tmpPath := filepath.Join(tmpDir, fmt.Sprintf("layer-%d.tar", i))
+		if _, err := copyVerified(tr, tmpPath, sha); err != nil {
+			return errors.Wrapf(err, "importing cache layer %s", sha)
+		}
+		if err := cache.AddLayerFile(tmpPath, sha); err != nil {
+			return errors.Wrapf(err, "importing cache layer %s", sha)
+		}
+		expected[hdr.Name] = true
+	}
+	for name, imported := range expected {
+		if !imported {
+			return fmt.Errorf("invalid cache archive: missing layer %s", cacheArchiveLayerSHA(name))
+		}
+	}
+
+	if err := cache.SetMetadata(archiveMeta.Metadata); err != nil {
+		return errors.Wrap(err, "setting cache metadata")
+	}
+	if err := cache.Commit(); err != nil {
+		return errors.Wrap(err, "committing cache")
+	}
+	return nil
+}
+
+// referencedSHAs returns the SHAs of the layers referenced by the cache metadata, without duplicates.
+func referencedSHAs(meta platform.CacheMetadata) []string {
+	var shas []string
+	seen := map[string]bool{}
+	add := func(sha string) {
+		if sha != "" && !seen[sha] {
+			seen[sha] = true
+			shas = append(shas, sha)
+		}
+	}
+	for _, bp := range meta.Buildpacks {
+		for _, name := range sortedLayerNames(bp.Layers) {
+			add(bp.Layers[name].SHA)
+		}
+	}
+	add(meta.BOM.SHA)
+	return shas
+}
+
+func cacheArchiveLayerPath(sha string) (string, error) {
+	parts := strings.SplitN(sha, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(parts[1], `/\`) {
+		return "", fmt.Errorf("invalid layer SHA '%s'", sha)
+	}
+	return path.Join(cacheArchiveLayersDir, parts[0], parts[1]+".tar"), nil
+}
+
+func cacheArchiveLayerSHA(name string) string {
+	algorithm := path.Base(path.Dir(name))
+	return algorithm + ":" + strings.TrimSuffix(path.Base(name), ".tar")
+}
+
+// copyVerified copies r to a new file at path and returns the number of bytes copied,
+// returning an error if the sha256 digest of the contents does not match sha.
+func copyVerified(r io.Reader, path, sha string) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hasher), r)
+	if err != nil {
+		return 0, err
+	}
+	if actual := fmt.Sprintf("sha256:%x", hasher.Sum(nil)); actual != sha {
+		return 0, fmt.Errorf("layer digest mismatch: expected %s, got %s", sha, actual)
+	}
+	return size, nil
+}
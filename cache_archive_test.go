@@ -0,0 +1,184 @@
+package lifecycle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCacheArchiver(t *testing.T) {
+	spec.Run(t, "CacheArchiver", testCacheArchiver, spec.Report(report.Terminal{}))
+}
+
+func testCacheArchiver(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir      string
+		srcCacheDir string
+		dstCacheDir string
+		srcCache    *cache.VolumeCache
+		archiver    *lifecycle.CacheArchiver
+		layerSHA    string
+		bomSHA      string
+		meta        platform.CacheMetadata
+	)
+
+	digest := func(contents string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(contents)))
+	}
+
+	addLayer := func(c *cache.VolumeCache, contents string) string {
+		path := filepath.Join(tmpDir, "layer.tar")
+		h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+		sha := digest(contents)
+		h.AssertNil(t, c.AddLayerFile(path, sha))
+		return sha
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache-archiver")
+		h.AssertNil(t, err)
+		srcCacheDir = filepath.Join(tmpDir, "src-cache")
+		dstCacheDir = filepath.Join(tmpDir, "dst-cache")
+		h.AssertNil(t, os.Mkdir(srcCacheDir, 0777))
+		h.AssertNil(t, os.Mkdir(dstCacheDir, 0777))
+
+		previousCache, err := cache.NewVolumeCache(srcCacheDir)
+		h.AssertNil(t, err)
+		layerSHA = addLayer(previousCache, "layer-contents")
+		bomSHA = addLayer(previousCache, "bom-contents")
+		meta = platform.CacheMetadata{
+			BOM: platform.LayerMetadata{SHA: bomSHA},
+			Buildpacks: []buildpack.LayersMetadata{{
+				ID:      "some.buildpack.id",
+				Version: "1.2.3",
+				Layers: map[string]buildpack.LayerMetadata{
+					"some-layer":  {SHA: layerSHA, LayerMetadataFile: buildpack.LayerMetadataFile{Cache: true}},
+					"other-layer": {SHA: layerSHA, LayerMetadataFile: buildpack.LayerMetadataFile{Cache: true}},
+				},
+			}},
+		}
+		h.AssertNil(t, previousCache.SetMetadata(meta))
+		h.AssertNil(t, previousCache.Commit())
+
+		srcCache, err = cache.NewVolumeCache(srcCacheDir)
+		h.AssertNil(t, err)
+
+		archiver = &lifecycle.CacheArchiver{Logger: &log.Logger{Handler: memory.New()}}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#Export", func() {
+		it("writes the metadata followed by each referenced layer once", func() {
+			var buf bytes.Buffer
+			h.AssertNil(t, archiver.Export(srcCache, &buf))
+
+			var names []string
+			tr := tar.NewReader(&buf)
+			for {
+				hdr, err := tr.Next()
+				if err != nil {
+					break
+				}
+				names = append(names, hdr.Name)
+			}
+			h.AssertEq(t, names, []string{
+				"metadata.json",
+				"layers/sha256/" + layerSHA[len("sha256:"):] + ".tar",
+				"layers/sha256/" + bomSHA[len("sha256:"):] + ".tar",
+			})
+		})
+
+		it("fails when a layer does not match its digest", func() {
+			layerPath, err := srcCache.RetrieveLayerFile(layerSHA)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ioutil.WriteFile(layerPath, []byte("corrupt"), 0600))
+
+			err = archiver.Export(srcCache, ioutil.Discard)
+			h.AssertError(t, err, "layer digest mismatch")
+		})
+	})
+
+	when("#Import", func() {
+		it("restores an exported cache", func() {
+			var buf bytes.Buffer
+			h.AssertNil(t, archiver.Export(srcCache, &buf))
+
+			dstCache, err := cache.NewVolumeCache(dstCacheDir)
+			h.AssertNil(t, err)
+			h.AssertNil(t, archiver.Import(&buf, dstCache))
+
+			importedCache, err := cache.NewVolumeCache(dstCacheDir)
+			h.AssertNil(t, err)
+			importedMeta, err := importedCache.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, importedMeta, meta)
+			diffIDs, err := importedCache.LayerDiffIDs()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(diffIDs), 2)
+			h.AssertContains(t, diffIDs, layerSHA, bomSHA)
+
+			result, err := (&lifecycle.CacheVerifier{Logger: archiver.Logger}).Verify(importedCache)
+			h.AssertNil(t, err)
+			h.AssertEq(t, result.Changed(), false)
+		})
+
+		it("fails on an unsupported schema version", func() {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			contents, err := json.Marshal(map[string]interface{}{"schemaVersion": 99})
+			h.AssertNil(t, err)
+			h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "metadata.json", Mode: 0644, Size: int64(len(contents))}))
+			_, err = tw.Write(contents)
+			h.AssertNil(t, err)
+			h.AssertNil(t, tw.Close())
+
+			dstCache, err := cache.NewVolumeCache(dstCacheDir)
+			h.AssertNil(t, err)
+			err = archiver.Import(&buf, dstCache)
+			h.AssertError(t, err, "unsupported cache archive schema version 99")
+		})
+
+		it("fails when a referenced layer is missing and leaves the cache unchanged", func() {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			contents, err := json.Marshal(map[string]interface{}{"schemaVersion": lifecycle.CacheArchiveSchemaVersion, "metadata": meta})
+			h.AssertNil(t, err)
+			h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "metadata.json", Mode: 0644, Size: int64(len(contents))}))
+			_, err = tw.Write(contents)
+			h.AssertNil(t, err)
+			h.AssertNil(t, tw.Close())
+
+			dstCache, err := cache.NewVolumeCache(dstCacheDir)
+			h.AssertNil(t, err)
+			err = archiver.Import(&buf, dstCache)
+			h.AssertError(t, err, "invalid cache archive: missing layer")
+
+			unchangedCache, err := cache.NewVolumeCache(dstCacheDir)
+			h.AssertNil(t, err)
+			unchangedMeta, err := unchangedCache.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, unchangedMeta, platform.CacheMetadata{})
+		})
+	})
+}
@@ -21,7 +21,9 @@ import (
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/buildpack"
 	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/internal/encoding"
 	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/platform"
 	h "github.com/buildpacks/lifecycle/testhelpers"
 	"github.com/buildpacks/lifecycle/testmock"
 )
@@ -42,6 +44,7 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 			mockCtrl     *gomock.Controller
 			testCache    lifecycle.Cache
 			tmpDir       string
+			unchanged    map[string]bool // IDs of layers with unchanged fingerprints
 		)
 
 		it.Before(func() {
@@ -59,6 +62,14 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 			testCache, err = cache.NewVolumeCache(cacheDir)
 			h.AssertNil(t, err)
 
+			unchanged = map[string]bool{}
+			layerFactory.EXPECT().FingerprintSettings().Return("some-settings").AnyTimes()
+			layerFactory.EXPECT().
+				UnchangedDirLayer(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(id string, dir string) (layers.Layer, bool) {
+					return layers.Layer{ID: id, Digest: testLayerDigest(id)}, unchanged[id]
+				}).AnyTimes()
+
 			logHandler = memory.New()
 			level, err := log.ParseLevel("info")
 			h.AssertNil(t, err)
@@ -105,6 +116,7 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 
 					metadata, err := testCache.RetrieveMetadata()
 					h.AssertNil(t, err)
+					h.AssertEq(t, metadata.FingerprintSettings, "some-settings")
 
 					t.Log("adds layer shas to metadata")
 					h.AssertEq(t, metadata.Buildpacks[0].ID, "buildpack.id")
@@ -187,6 +199,26 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 						h.AssertEq(t, previousLayers, reusedLayers)
 					})
 
+					when("the fingerprint of a layer is unchanged", func() {
+						it.Before(func() {
+							unchanged["buildpack.id:cache-true-layer"] = true
+						})
+
+						it("reuses the layer without hashing it", func() {
+							h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+							assertLogEntry(t, logHandler, "Reusing unchanged cache layer 'buildpack.id:cache-true-layer'")
+							assertCacheHasLayer(t, testCache, "buildpack.id:cache-true-layer")
+
+							metadata, err := testCache.RetrieveMetadata()
+							h.AssertNil(t, err)
+							h.AssertEq(t, metadata.Buildpacks[0].Layers["cache-true-layer"].SHA, "cache-true-layer-digest")
+							h.AssertEq(t, metadata.Buildpacks[0].Layers["cache-true-layer"].Data, map[string]interface{}{
+								"cache-true-key": "cache-true-val",
+							})
+						})
+					})
+
 					it("sets cache metadata", func() {
 						err := exporter.Cache(layersDir, testCache)
 						h.AssertNil(t, err)
@@ -289,6 +321,60 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("there is a lazy layer that was not restored during the build", func() {
+			var lazyLayer platform.LazyLayer
+
+			it.Before(func() {
+				layersDir = filepath.Join(tmpDir, "layers")
+				h.AssertNil(t, os.MkdirAll(filepath.Join(layersDir, "buildpack.id"), 0777))
+				h.AssertNil(t, ioutil.WriteFile(
+					filepath.Join(layersDir, "buildpack.id", "cache-true-no-contents.toml"),
+					h.MustReadFile(t, filepath.Join("testdata", "cacher", "invalid-layers", "buildpack.id", "cache-true-no-contents.toml")),
+					0600,
+				))
+				exporter.Buildpacks = []buildpack.GroupBuildpack{{ID: "buildpack.id", API: api.Buildpack.Latest().String()}}
+
+				h.AssertNil(t, os.MkdirAll(filepath.Join(cacheDir, "committed"), 0777))
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(cacheDir, "committed", "lazy-layer-digest.tar"), []byte("some data"), 0600))
+				h.AssertNil(t, ioutil.WriteFile(
+					filepath.Join(cacheDir, "committed", "io.buildpacks.lifecycle.cache.metadata"),
+					[]byte(`{"buildpacks": [{"key": "buildpack.id", "layers": {"cache-true-no-contents": {"cache": true, "restore": "lazy", "sha": "lazy-layer-digest"}}}]}`),
+					0600,
+				))
+				lazyLayer = platform.LazyLayer{Buildpack: "buildpack.id", Name: "cache-true-no-contents", SHA: "lazy-layer-digest"}
+			})
+
+			writeLazyLayers := func() {
+				h.AssertNil(t, encoding.WriteTOML(platform.LazyLayersPath(layersDir), platform.LazyLayersMetadata{
+					CacheDir: cacheDir,
+					Layers:   []platform.LazyLayer{lazyLayer},
+				}))
+			}
+
+			it("reuses the previous cache layer", func() {
+				writeLazyLayers()
+
+				h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+				h.AssertPathExists(t, filepath.Join(cacheDir, "committed", "lazy-layer-digest.tar"))
+				metadata, err := testCache.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, metadata.Buildpacks[0].Layers["cache-true-no-contents"].SHA, "lazy-layer-digest")
+				h.AssertEq(t, metadata.Buildpacks[0].Layers["cache-true-no-contents"].Cache, true)
+			})
+
+			when("the layer was restored by the buildpack", func() {
+				it("warns that the layer has no contents", func() {
+					lazyLayer.Restored = true
+					writeLazyLayers()
+
+					h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+					h.AssertStringContains(t, logHandler.Entries[0].Message, "Failed to cache layer 'buildpack.id:cache-true-no-contents' because it has no contents")
+				})
+			})
+		})
+
 		when("buildpack API < 0.6", func() {
 			it.Before(func() {
 				exporter.Buildpacks = []buildpack.GroupBuildpack{{ID: "old.buildpack.id", API: "0.5"}}
@@ -0,0 +1,176 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+// CacheVerifier checks that every layer referenced by the cache metadata is present in the cache and matches its digest.
+type CacheVerifier struct {
+	Logger Logger
+}
+
+// CacheVerifyResult lists the problems found in a cache.
+type CacheVerifyResult struct {
+	Invalid []InvalidCacheLayer
+	Orphans []string // diff IDs of layers in the cache that are not referenced by the cache metadata
+}
+
+type InvalidCacheLayer struct {
+	Identifier string // e.g. "buildpack.id:layer-name", or "sbom" for the cached SBOM layer
+	SHA        string
+	Reason     string
+}
+
+// Changed returns true if repairing the cache would change it.
+func (r CacheVerifyResult) Changed() bool {
+	return len(r.Invalid) > 0 || len(r.Orphans) > 0
+}
+
+func (r CacheVerifyResult) invalidSHAs() map[string]bool {
+	shas := map[string]bool{}
+	for _, l := range r.Invalid {
+		shas[l.SHA] = true
+	}
+	return shas
+}
+
+// layerLister is implemented by caches that can list the layers they contain.
+type layerLister interface {
+	LayerDiffIDs() ([]string, error)
+}
+
+// Verify reads every layer referenced by the cache metadata and compares it to its digest.
+// When the cache can list its layers, layers that are not referenced by the metadata are reported as orphans.
+func (v *CacheVerifier) Verify(cache Cache) (CacheVerifyResult, error) {
+	meta, err := cache.RetrieveMetadata()
+	if err != nil {
+		return CacheVerifyResult{}, errors.Wrap(err, "retrieving cache metadata")
+	}
+
+	var result CacheVerifyResult
+	checked := map[string]string{} // sha -> reason the layer is invalid, empty if it is valid
+	verify := func(identifier, sha string) {
+		reason, ok := checked[sha]
+		if !ok {
+			v.Logger.Debugf("Verifying cache layer '%s' with SHA %s", identifier, sha)
+			reason = v.verifyLayer(cache, sha)
+			checked[sha] = reason
+		}
+		if reason != "" {
+			result.Invalid = append(result.Invalid, InvalidCacheLayer{Identifier: identifier, SHA: sha, Reason: reason})
+		}
+	}
+	for _, bp := range meta.Buildpacks {
+		for _, name := range sortedLayerNames(bp.Layers) {
+			verify(fmt.Sprintf("%s:%s", bp.ID, name), bp.Layers[name].SHA)
+		}
+	}
+	if meta.BOM.SHA != "" {
+		verify("sbom", meta.BOM.SHA)
+	}
+
+	lister, ok := cache.(layerLister)
+	if !ok {
+		v.Logger.Debugf("Cache '%s' can't list its layers, not checking for orphaned layers", cache.Name())
+		return result, nil
+	}
+	diffIDs, err := lister.LayerDiffIDs()
+	if err != nil {
+		return CacheVerifyResult{}, errors.Wrap(err, "listing cache layers")
+	}
+	for _, diffID := range diffIDs {
+		if _, referenced := checked[diffID]; !referenced {
+			result.Orphans = append(result.Orphans, diffID)
+		}
+	}
+	sort.Strings(result.Orphans)
+	return result, nil
+}
+
+// verifyLayer returns the reason the layer is invalid, or an empty string if it is valid.
+func (v *CacheVerifier) verifyLayer(cache Cache, sha string) string {
+	rc, err := cache.RetrieveLayer(sha)
+	if err != nil {
+		return fmt.Sprintf("missing: %s", err)
+	}
+	defer rc.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, rc); err != nil {
+		return fmt.Sprintf("unreadable: %s", err)
+	}
+	if actual := fmt.Sprintf("sha256:%x", hasher.Sum(nil)); actual != sha {
+		return fmt.Sprintf("digest mismatch: got %s", actual)
+	}
+	return ""
+}
+
+// Repair commits the cache without the invalid layers, dropping their entries from the cache metadata.
+// Orphaned layers are not carried over to the new cache.
+func (v *CacheVerifier) Repair(cache Cache, result CacheVerifyResult) error {
+	meta, err := cache.RetrieveMetadata()
+	if err != nil {
+		return errors.Wrap(err, "retrieving cache metadata")
+	}
+
+	invalid := result.invalidSHAs()
+	reused := map[string]bool{}
+	reuse := func(sha string) error {
+		if reused[sha] {
+			return nil
+		}
+		reused[sha] = true
+		return cache.ReuseLayer(sha)
+	}
+
+	repaired := platform.CacheMetadata{}
+	for _, bp := range meta.Buildpacks {
+		for _, name := range sortedLayerNames(bp.Layers) {
+			sha := bp.Layers[name].SHA
+			if invalid[sha] {
+				v.Logger.Infof("Removing cache layer '%s:%s'", bp.ID, name)
+				delete(bp.Layers, name)
+				continue
+			}
+			if err := reuse(sha); err != nil {
+				return errors.Wrapf(err, "reusing cache layer '%s:%s'", bp.ID, name)
+			}
+		}
+		repaired.Buildpacks = append(repaired.Buildpacks, bp)
+	}
+	if meta.BOM.SHA != "" {
+		if invalid[meta.BOM.SHA] {
+			v.Logger.Info("Removing cache layer 'sbom'")
+		} else {
+			if err := reuse(meta.BOM.SHA); err != nil {
+				return errors.Wrap(err, "reusing cache layer 'sbom'")
+			}
+			repaired.BOM = meta.BOM
+		}
+	}
+
+	if err := cache.SetMetadata(repaired); err != nil {
+		return errors.Wrap(err, "setting cache metadata")
+	}
+	if err := cache.Commit(); err != nil {
+		return errors.Wrap(err, "committing cache")
+	}
+	return nil
+}
+
+func sortedLayerNames(layers map[string]buildpack.LayerMetadata) []string {
+	var names []string
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,135 @@
+package lifecycle_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCacheVerifier(t *testing.T) {
+	spec.Run(t, "CacheVerifier", testCacheVerifier, spec.Report(report.Terminal{}))
+}
+
+func testCacheVerifier(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir     string
+		cacheDir   string
+		testCache  *cache.VolumeCache
+		verifier   *lifecycle.CacheVerifier
+		validSHA   string
+		corruptSHA string
+		missingSHA string
+		orphanSHA  string
+	)
+
+	digest := func(contents string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(contents)))
+	}
+
+	addLayer := func(c *cache.VolumeCache, contents string) string {
+		path := filepath.Join(tmpDir, "layer.tar")
+		h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+		sha := digest(contents)
+		h.AssertNil(t, c.AddLayerFile(path, sha))
+		return sha
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache-verifier")
+		h.AssertNil(t, err)
+		cacheDir = filepath.Join(tmpDir, "cache")
+		h.AssertNil(t, os.Mkdir(cacheDir, 0777))
+
+		previousCache, err := cache.NewVolumeCache(cacheDir)
+		h.AssertNil(t, err)
+		validSHA = addLayer(previousCache, "valid-contents")
+		corruptSHA = addLayer(previousCache, "corrupt-contents")
+		orphanSHA = addLayer(previousCache, "orphan-contents")
+		missingSHA = digest("missing-contents")
+		h.AssertNil(t, previousCache.SetMetadata(platform.CacheMetadata{
+			Buildpacks: []buildpack.LayersMetadata{{
+				ID: "some.buildpack.id",
+				Layers: map[string]buildpack.LayerMetadata{
+					"valid-layer":   {SHA: validSHA},
+					"corrupt-layer": {SHA: corruptSHA},
+					"missing-layer": {SHA: missingSHA},
+				},
+			}},
+		}))
+		h.AssertNil(t, previousCache.Commit())
+
+		corruptPath, err := previousCache.RetrieveLayerFile(corruptSHA)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ioutil.WriteFile(corruptPath, []byte("corrupt-con"), 0600))
+
+		testCache, err = cache.NewVolumeCache(cacheDir)
+		h.AssertNil(t, err)
+
+		verifier = &lifecycle.CacheVerifier{Logger: &log.Logger{Handler: memory.New()}}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#Verify", func() {
+		it("reports missing and corrupt layers", func() {
+			result, err := verifier.Verify(testCache)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, len(result.Invalid), 2)
+			h.AssertEq(t, result.Invalid[0].Identifier, "some.buildpack.id:corrupt-layer")
+			h.AssertEq(t, result.Invalid[0].SHA, corruptSHA)
+			h.AssertEq(t, result.Invalid[0].Reason, "digest mismatch: got "+digest("corrupt-con"))
+			h.AssertEq(t, result.Invalid[1].Identifier, "some.buildpack.id:missing-layer")
+			h.AssertStringContains(t, result.Invalid[1].Reason, "missing: ")
+		})
+
+		it("reports orphaned layers", func() {
+			result, err := verifier.Verify(testCache)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, result.Orphans, []string{orphanSHA})
+			h.AssertEq(t, result.Changed(), true)
+		})
+	})
+
+	when("#Repair", func() {
+		it("drops invalid entries from the metadata and removes invalid and orphaned layers", func() {
+			result, err := verifier.Verify(testCache)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, verifier.Repair(testCache, result))
+
+			repairedCache, err := cache.NewVolumeCache(cacheDir)
+			h.AssertNil(t, err)
+			meta, err := repairedCache.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, meta.Buildpacks[0].Layers, map[string]buildpack.LayerMetadata{
+				"valid-layer": {SHA: validSHA},
+			})
+			diffIDs, err := repairedCache.LayerDiffIDs()
+			h.AssertNil(t, err)
+			h.AssertEq(t, diffIDs, []string{validSHA})
+
+			result, err = verifier.Verify(repairedCache)
+			h.AssertNil(t, err)
+			h.AssertEq(t, result.Changed(), false)
+		})
+	})
+}
@@ -22,33 +22,54 @@ type Command interface {
 }
 
 func Run(c Command, asSubcommand bool) {
+	if asSubcommand {
+		RunArgs(c, os.Args[2:])
+	} else {
+		RunArgs(c, os.Args[1:])
+	}
+}
+
+// RunArgs runs the command with the given arguments, e.g. for nested subcommands such as `lifecycle cache verify`.
+func RunArgs(c Command, args []string) {
 	var (
 		printVersion bool
 		logLevel     string
 		noColor      bool
+		configPath   string
+		printConfig  bool
 	)
 
 	log.SetOutput(ioutil.Discard)
 	FlagVersion(&printVersion)
 	FlagLogLevel(&logLevel)
 	FlagNoColor(&noColor)
+	FlagConfigPath(&configPath)
+	FlagPrintConfig(&printConfig)
 	c.DefineFlags()
-	if asSubcommand {
-		if err := flagSet.Parse(os.Args[2:]); err != nil {
-			// flagSet exits on error, we shouldn't get here
-			Exit(err)
-		}
-	} else {
-		if err := flagSet.Parse(os.Args[1:]); err != nil {
-			// flagSet exits on error, we shouldn't get here
-			Exit(err)
-		}
+	if err := flagSet.Parse(args); err != nil {
+		// flagSet exits on error, we shouldn't get here
+		Exit(err)
 	}
-	DisableColor(noColor)
 
 	if printVersion {
 		ExitWithVersion()
 	}
+	var config *ConfigFile
+	if configPath != "" {
+		var err error
+		if config, err = ReadConfigFile(configPath); err != nil {
+			Exit(FailErrCode(err, CodeInvalidArgs, "read config file"))
+		}
+		if err := ApplyConfigFile(flagSet, config); err != nil {
+			Exit(FailErrCode(err, CodeInvalidArgs, "apply config file"))
+		}
+	}
+	DisableColor(noColor)
+	if printConfig {
+		if err := PrintConfig(os.Stdout, flagSet, config); err != nil {
+			Exit(FailErr(err, "print config"))
+		}
+	}
 	if err := SetLogLevel(logLevel); err != nil {
 		Exit(err)
 	}
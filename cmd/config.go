@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// ConfigSchemaVersion is the version of the config file schema supported by this lifecycle.
+const ConfigSchemaVersion = 1
+
+// ConfigFile provides flag values to a phase through the -config flag, e.g.
+//
+//	schema-version = 1
+//
+//	[flags]
+//	layers = "/layers"
+//	tag = ["registry.example.com/app:latest"]
+//	daemon = false
+//
+// Keys in [flags] are flag names without the leading dash; every lifecycle flag except
+// -config, -print-config and -version may be given. A phase ignores the flags it does not define,
+// so that a single file can be shared by all phases.
+//
+// Values are resolved in order of precedence: flags, then env vars, then the config file, then defaults.
+type ConfigFile struct {
+	SchemaVersion int                    `toml:"schema-version"`
+	Flags         map[string]interface{} `toml:"flags"`
+}
+
+// ReadConfigFile reads and validates the config file at path.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	config := &ConfigFile{}
+	if _, err := toml.DecodeFile(path, config); err != nil {
+		return nil, err
+	}
+	if config.SchemaVersion != ConfigSchemaVersion {
+		return nil, fmt.Errorf("unsupported schema-version %d, expected %d", config.SchemaVersion, ConfigSchemaVersion)
+	}
+	for name := range config.Flags {
+		if _, ok := flagEnvs[name]; !ok {
+			return nil, fmt.Errorf("unknown flag '%s'", name)
+		}
+	}
+	return config, nil
+}
+
+// ApplyConfigFile sets each flag in fs that is given in the config file,
+// unless the flag was provided on the command line or through its env var.
+// It must be called after fs has been parsed.
+func ApplyConfigFile(fs *flag.FlagSet, config *ConfigFile) error {
+	provided := providedFlags(fs)
+	for _, name := range sortedKeys(config.Flags) {
+		f := fs.Lookup(name)
+		if _, ok := provided[name]; f == nil || ok {
+			continue
+		}
+		if err := setFlag(f, config.Flags[name]); err != nil {
+			return errors.Wrapf(err, "setting flag '%s'", name)
+		}
+	}
+	return nil
+}
+
+// PrintConfig writes the resolved value of each flag in fs to w in the config file format,
+// annotated with where the value came from. It must be called after ApplyConfigFile.
+func PrintConfig(w io.Writer, fs *flag.FlagSet, config *ConfigFile) error {
+	provided := providedFlags(fs)
+	if _, err := fmt.Fprintf(w, "schema-version = %d\n\n[flags]\n", ConfigSchemaVersion); err != nil {
+		return err
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagEnvs[f.Name]; !ok || err != nil {
+			return
+		}
+		source := provided[f.Name]
+		if source == "" {
+			source = "default"
+			if config != nil && config.Flags[f.Name] != nil {
+				source = "config"
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s = %s # %s\n", f.Name, formatFlagValue(f.Value), source)
+	})
+	return err
+}
+
+// providedFlags returns the names of the flags provided on the command line or through their env var,
+// mapped to where each value came from.
+func providedFlags(fs *flag.FlagSet) map[string]string {
+	provided := map[string]string{}
+	for name, env := range flagEnvs {
+		if env != "" && fs.Lookup(name) != nil && os.Getenv(env) != "" {
+			provided[name] = "env"
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		provided[f.Name] = "flag"
+	})
+	return provided
+}
+
+func setFlag(f *flag.Flag, value interface{}) error {
+	values, isList := value.([]interface{})
+	_, isSlice := f.Value.(*StringSlice)
+	switch {
+	case isSlice && isList:
+		for _, v := range values {
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case isList:
+		return errors.New("expected a single value, got a list")
+	default:
+		return f.Value.Set(fmt.Sprint(value))
+	}
+}
+
+func formatFlagValue(v flag.Value) string {
+	if s, ok := v.(*StringSlice); ok {
+		quoted := make([]string, 0, len(*s))
+		for _, e := range *s {
+			quoted = append(quoted, strconv.Quote(e))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(quoted, ", "))
+	}
+	if g, ok := v.(flag.Getter); ok {
+		switch value := g.Get().(type) {
+		case bool, int:
+			return fmt.Sprint(value)
+		}
+	}
+	return strconv.Quote(v.String())
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
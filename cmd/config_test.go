@@ -0,0 +1,144 @@
+package cmd_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/cmd"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestConfigFile(t *testing.T) {
+	spec.Run(t, "ConfigFile", testConfigFile, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testConfigFile(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir     string
+		configPath string
+		fs         *flag.FlagSet
+		layersDir  string
+		runImage   string
+		uid        int
+		useDaemon  bool
+		tags       cmd.StringSlice
+	)
+
+	// defineFlags reads env vars for flag defaults the same way the cmd.Flag* helpers do
+	defineFlags := func() {
+		fs = flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.StringVar(&layersDir, "layers", cmd.EnvOrDefault(cmd.EnvLayersDir, "/default-layers"), "")
+		fs.StringVar(&runImage, "run-image", os.Getenv(cmd.EnvRunImage), "")
+		fs.IntVar(&uid, "uid", 0, "")
+		fs.BoolVar(&useDaemon, "daemon", cmd.BoolEnv(cmd.EnvUseDaemon), "")
+		fs.Var(&tags, "tag", "")
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.config.")
+		h.AssertNil(t, err)
+		configPath = filepath.Join(tmpDir, "config.toml")
+		defineFlags()
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.Unsetenv(cmd.EnvLayersDir))
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#ReadConfigFile", func() {
+		it("rejects an unsupported schema version", func() {
+			h.Mkfile(t, "schema-version = 2\n", configPath)
+			_, err := cmd.ReadConfigFile(configPath)
+			h.AssertError(t, err, "unsupported schema-version 2, expected 1")
+		})
+
+		it("rejects unknown flags", func() {
+			h.Mkfile(t, "schema-version = 1\n[flags]\nsome-flag = \"some-value\"\n", configPath)
+			_, err := cmd.ReadConfigFile(configPath)
+			h.AssertError(t, err, "unknown flag 'some-flag'")
+		})
+	})
+
+	when("#ApplyConfigFile", func() {
+		it.Before(func() {
+			h.Mkfile(t, `schema-version = 1
+
+[flags]
+layers = "/config-layers"
+run-image = "config/run-image"
+uid = 1234
+daemon = true
+tag = ["some/tag", "other/tag"]
+stack = "/ignored/by/this/phase"
+`, configPath)
+		})
+
+		it("gives flags precedence over env over the config file over defaults", func() {
+			h.AssertNil(t, os.Setenv(cmd.EnvLayersDir, "/env-layers"))
+			defineFlags()
+			h.AssertNil(t, fs.Parse([]string{"-run-image", "flag/run-image"}))
+
+			config, err := cmd.ReadConfigFile(configPath)
+			h.AssertNil(t, err)
+			h.AssertNil(t, cmd.ApplyConfigFile(fs, config))
+
+			h.AssertEq(t, runImage, "flag/run-image")
+			h.AssertEq(t, layersDir, "/env-layers")
+			h.AssertEq(t, uid, 1234)
+			h.AssertEq(t, useDaemon, true)
+			h.AssertEq(t, []string(tags), []string{"some/tag", "other/tag"})
+		})
+
+		it("does not merge list values with the command line", func() {
+			h.AssertNil(t, fs.Parse([]string{"-tag", "flag/tag"}))
+
+			config, err := cmd.ReadConfigFile(configPath)
+			h.AssertNil(t, err)
+			h.AssertNil(t, cmd.ApplyConfigFile(fs, config))
+
+			h.AssertEq(t, []string(tags), []string{"flag/tag"})
+		})
+
+		it("rejects a list for a single value flag", func() {
+			h.AssertNil(t, fs.Parse(nil))
+
+			err := cmd.ApplyConfigFile(fs, &cmd.ConfigFile{
+				SchemaVersion: 1,
+				Flags:         map[string]interface{}{"layers": []interface{}{"a", "b"}},
+			})
+			h.AssertError(t, err, "setting flag 'layers': expected a single value, got a list")
+		})
+	})
+
+	when("#PrintConfig", func() {
+		it("prints each value with its source", func() {
+			h.Mkfile(t, "schema-version = 1\n[flags]\nuid = 1234\n", configPath)
+			h.AssertNil(t, fs.Parse([]string{"-tag", "some/tag"}))
+			config, err := cmd.ReadConfigFile(configPath)
+			h.AssertNil(t, err)
+			h.AssertNil(t, cmd.ApplyConfigFile(fs, config))
+
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, cmd.PrintConfig(buf, fs, config))
+
+			h.AssertEq(t, buf.String(), `schema-version = 1
+
+[flags]
+daemon = false # default
+layers = "/default-layers" # default
+run-image = "" # default
+tag = ["some/tag"] # flag
+uid = 1234 # config
+`)
+		})
+	})
+}
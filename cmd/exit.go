@@ -18,8 +18,18 @@ const (
 	// API errors
 	CodeIncompatiblePlatformAPI  = 11
 	CodeIncompatibleBuildpackAPI = 12
+
+	// cache errors
+	CodeCacheChanged = 13 // CodeCacheChanged indicates that `cache verify -repair` removed invalid or orphaned layers from the cache
 )
 
+// ExitCode is returned by a command that succeeded but reports its outcome with a non-zero exit code.
+type ExitCode int
+
+func (c ExitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
 type ErrorFail struct {
 	Err    error
 	Code   int
@@ -54,6 +64,9 @@ func Exit(err error) {
 	if err == nil {
 		os.Exit(0)
 	}
+	if code, ok := err.(ExitCode); ok {
+		os.Exit(int(code))
+	}
 	DefaultLogger.Errorf("%s\n", err)
 	if err, ok := err.(*ErrorFail); ok {
 		os.Exit(err.Code)
@@ -11,16 +11,18 @@ import (
 )
 
 var (
-	DefaultAppDir          = filepath.Join(rootDir, "workspace")
-	DefaultBuildpacksDir   = filepath.Join(rootDir, "cnb", "buildpacks")
-	DefaultDeprecationMode = DeprecationModeWarn
-	DefaultLauncherPath    = filepath.Join(rootDir, "cnb", "lifecycle", "launcher"+execExt)
-	DefaultLayersDir       = filepath.Join(rootDir, "layers")
-	DefaultLogLevel        = "info"
-	DefaultPlatformAPI     = "0.3"
-	DefaultPlatformDir     = filepath.Join(rootDir, "platform")
-	DefaultProcessType     = "web"
-	DefaultStackPath       = filepath.Join(rootDir, "cnb", "stack.toml")
+	DefaultAppDir           = filepath.Join(rootDir, "workspace")
+	DefaultBuildpacksDir    = filepath.Join(rootDir, "cnb", "buildpacks")
+	DefaultCacheCompression = "none"
+	DefaultDeprecationMode  = DeprecationModeWarn
+	DefaultLauncherPath     = filepath.Join(rootDir, "cnb", "lifecycle", "launcher"+execExt)
+	DefaultLayerCompression = "gzip"
+	DefaultLayersDir        = filepath.Join(rootDir, "layers")
+	DefaultLogLevel         = "info"
+	DefaultPlatformAPI      = "0.3"
+	DefaultPlatformDir      = filepath.Join(rootDir, "platform")
+	DefaultProcessType      = "web"
+	DefaultStackPath        = filepath.Join(rootDir, "cnb", "stack.toml")
 
 	DefaultAnalyzedFile        = "analyzed.toml"
 	DefaultGroupFile           = "group.toml"
@@ -38,36 +40,110 @@ var (
 )
 
 const (
-	EnvAnalyzedPath        = "CNB_ANALYZED_PATH"
-	EnvAppDir              = "CNB_APP_DIR"
-	EnvBuildpacksDir       = "CNB_BUILDPACKS_DIR"
-	EnvCacheDir            = "CNB_CACHE_DIR"
-	EnvCacheImage          = "CNB_CACHE_IMAGE"
-	EnvDeprecationMode     = "CNB_DEPRECATION_MODE"
-	EnvGID                 = "CNB_GROUP_ID"
-	EnvGroupPath           = "CNB_GROUP_PATH"
-	EnvLaunchCacheDir      = "CNB_LAUNCH_CACHE_DIR"
-	EnvLayersDir           = "CNB_LAYERS_DIR"
-	EnvLogLevel            = "CNB_LOG_LEVEL"
-	EnvNoColor             = "CNB_NO_COLOR" // defaults to false
-	EnvOrderPath           = "CNB_ORDER_PATH"
-	EnvPlanPath            = "CNB_PLAN_PATH"
-	EnvPlatformAPI         = "CNB_PLATFORM_API"
-	EnvPlatformDir         = "CNB_PLATFORM_DIR"
-	EnvPreviousImage       = "CNB_PREVIOUS_IMAGE"
-	EnvProcessType         = "CNB_PROCESS_TYPE"
-	EnvProjectMetadataPath = "CNB_PROJECT_METADATA_PATH"
-	EnvReportPath          = "CNB_REPORT_PATH"
-	EnvRunImage            = "CNB_RUN_IMAGE"
-	EnvSkipLayers          = "CNB_ANALYZE_SKIP_LAYERS" // defaults to false
-	EnvSkipRestore         = "CNB_SKIP_RESTORE"        // defaults to false
-	EnvStackPath           = "CNB_STACK_PATH"
-	EnvUID                 = "CNB_USER_ID"
-	EnvUseDaemon           = "CNB_USE_DAEMON" // defaults to false
+	EnvAnalyzedPath          = "CNB_ANALYZED_PATH"
+	EnvAnnotationFile        = "CNB_ANNOTATION_FILE"
+	EnvAppDir                = "CNB_APP_DIR"
+	EnvBuildpacksDir         = "CNB_BUILDPACKS_DIR"
+	EnvCacheCompression      = "CNB_CACHE_COMPRESSION"
+	EnvCacheDir              = "CNB_CACHE_DIR"
+	EnvCacheImage            = "CNB_CACHE_IMAGE"
+	EnvCacheURL              = "CNB_CACHE_URL"
+	EnvCapabilities          = "CNB_CAPABILITIES"
+	EnvConfigPath            = "CNB_CONFIG_PATH"
+	EnvDeprecationMode       = "CNB_DEPRECATION_MODE"
+	EnvEstargz               = "CNB_ESTARGZ"          // defaults to false
+	EnvForceLayerHash        = "CNB_FORCE_LAYER_HASH" // defaults to false
+	EnvGID                   = "CNB_GROUP_ID"
+	EnvGroupPath             = "CNB_GROUP_PATH"
+	EnvKeepCapabilities      = "CNB_KEEP_CAPABILITIES" // defaults to false
+	EnvLabelFile             = "CNB_LABEL_FILE"
+	EnvLaunchCacheDir        = "CNB_LAUNCH_CACHE_DIR"
+	EnvLaunchDebugEnv        = "CNB_LAUNCH_DEBUG_ENV" // defaults to false
+	EnvLayerCompression      = "CNB_LAYER_COMPRESSION"
+	EnvLayerCompressionLevel = "CNB_LAYER_COMPRESSION_LEVEL"
+	EnvLayersDir             = "CNB_LAYERS_DIR"
+	EnvLogLevel              = "CNB_LOG_LEVEL"
+	EnvNoColor               = "CNB_NO_COLOR" // defaults to false
+	EnvOrderPath             = "CNB_ORDER_PATH"
+	EnvPlanPath              = "CNB_PLAN_PATH"
+	EnvPlatformAPI           = "CNB_PLATFORM_API"
+	EnvPlatformDir           = "CNB_PLATFORM_DIR"
+	EnvPrefetchProfile       = "CNB_PREFETCH_PROFILE"
+	EnvPreviousImage         = "CNB_PREVIOUS_IMAGE"
+	EnvProcessType           = "CNB_PROCESS_TYPE"
+	EnvProjectMetadataPath   = "CNB_PROJECT_METADATA_PATH"
+	EnvProtectLabels         = "CNB_PROTECT_LABELS" // defaults to false
+	EnvReportPath            = "CNB_REPORT_PATH"
+	EnvRetryAttempts         = "CNB_RETRY_ATTEMPTS"
+	EnvRetryBackoff          = "CNB_RETRY_BACKOFF"
+	EnvRetryStatusCodes      = "CNB_RETRY_STATUS_CODES"
+	EnvRunImage              = "CNB_RUN_IMAGE"
+	EnvSizePolicyPath        = "CNB_SIZE_POLICY"
+	EnvSkipLayers            = "CNB_ANALYZE_SKIP_LAYERS" // defaults to false
+	EnvSkipRestore           = "CNB_SKIP_RESTORE"        // defaults to false
+	EnvSourceDateEpoch       = "SOURCE_DATE_EPOCH"
+	EnvStackID               = "CNB_STACK_ID"
+	EnvStackMixins           = "CNB_STACK_MIXINS"
+	EnvStackPath             = "CNB_STACK_PATH"
+	EnvSupplementaryGroups   = "CNB_SUPPLEMENTARY_GROUP_IDS"
+	EnvUID                   = "CNB_USER_ID"
+	EnvUseDaemon             = "CNB_USE_DAEMON"          // defaults to false
+	EnvVerifyReproducible    = "CNB_VERIFY_REPRODUCIBLE" // defaults to false
 )
 
 var flagSet = flag.NewFlagSet("lifecycle", flag.ExitOnError)
 
+// flagEnvs maps the name of each flag that may be given in a config file to the env var read by the flag, if any.
+var flagEnvs = map[string]string{
+	"analyzed":                EnvAnalyzedPath,
+	"annotation":              "",
+	"annotation-file":         EnvAnnotationFile,
+	"app":                     EnvAppDir,
+	"buildpacks":              EnvBuildpacksDir,
+	"cache-compression":       EnvCacheCompression,
+	"cache-dir":               EnvCacheDir,
+	"cache-image":             EnvCacheImage,
+	"cache-url":               EnvCacheURL,
+	"capabilities":            EnvCapabilities,
+	"daemon":                  EnvUseDaemon,
+	"estargz":                 EnvEstargz,
+	"force-layer-hash":        EnvForceLayerHash,
+	"gid":                     EnvGID,
+	"group":                   EnvGroupPath,
+	"image":                   "",
+	"keep-capabilities":       EnvKeepCapabilities,
+	"label":                   "",
+	"label-file":              EnvLabelFile,
+	"launch-cache":            EnvLaunchCacheDir,
+	"launcher":                "",
+	"layer-compression":       EnvLayerCompression,
+	"layer-compression-level": EnvLayerCompressionLevel,
+	"layers":                  EnvLayersDir,
+	"log-level":               EnvLogLevel,
+	"no-color":                EnvNoColor,
+	"order":                   EnvOrderPath,
+	"plan":                    EnvPlanPath,
+	"platform":                EnvPlatformDir,
+	"prefetch-profile":        EnvPrefetchProfile,
+	"previous-image":          EnvPreviousImage,
+	"process-type":            EnvProcessType,
+	"project-metadata":        EnvProjectMetadataPath,
+	"protect-labels":          EnvProtectLabels,
+	"report":                  EnvReportPath,
+	"retry-attempts":          EnvRetryAttempts,
+	"retry-backoff":           EnvRetryBackoff,
+	"retry-status-codes":      EnvRetryStatusCodes,
+	"run-image":               EnvRunImage,
+	"size-policy":             EnvSizePolicyPath,
+	"skip-layers":             EnvSkipLayers,
+	"skip-restore":            EnvSkipRestore,
+	"stack":                   EnvStackPath,
+	"supplementary-gids":      EnvSupplementaryGroups,
+	"tag":                     "",
+	"uid":                     EnvUID,
+	"verify-reproducible":     EnvVerifyReproducible,
+}
+
 func FlagAnalyzedPath(analyzedPath *string) {
 	flagSet.StringVar(analyzedPath, "analyzed", EnvOrDefault(EnvAnalyzedPath, PlaceholderAnalyzedPath), "path to analyzed.toml")
 }
@@ -76,6 +152,14 @@ func DefaultAnalyzedPath(platformAPI, layersDir string) string {
 	return defaultPath(DefaultAnalyzedFile, platformAPI, layersDir)
 }
 
+func FlagAnnotations(annotations *StringSlice) {
+	flagSet.Var(annotations, "annotation", "manifest annotation to add to the app image, as key=value (may be repeated)")
+}
+
+func FlagAnnotationFile(annotationFile *string) {
+	flagSet.StringVar(annotationFile, "annotation-file", os.Getenv(EnvAnnotationFile), "path to a file of manifest annotations to add to the app image, one key=value per line")
+}
+
 func FlagAppDir(appDir *string) {
 	flagSet.StringVar(appDir, "app", EnvOrDefault(EnvAppDir, DefaultAppDir), "path to app directory")
 }
@@ -84,14 +168,42 @@ func FlagBuildpacksDir(buildpacksDir *string) {
 	flagSet.StringVar(buildpacksDir, "buildpacks", EnvOrDefault(EnvBuildpacksDir, DefaultBuildpacksDir), "path to buildpacks directory")
 }
 
+func FlagCacheCompression(compression *string) {
+	flagSet.StringVar(compression, "cache-compression", EnvOrDefault(EnvCacheCompression, DefaultCacheCompression), "compression of the layers stored in a cache directory (none, gzip or zstd)")
+}
+
 func FlagCacheDir(cacheDir *string) {
 	flagSet.StringVar(cacheDir, "cache-dir", os.Getenv(EnvCacheDir), "path to cache directory")
 }
 
+func FlagCacheRepair(repair *bool) {
+	flagSet.BoolVar(repair, "repair", false, "remove invalid and orphaned layers from the cache")
+}
+
 func FlagCacheImage(cacheImage *string) {
 	flagSet.StringVar(cacheImage, "cache-image", os.Getenv(EnvCacheImage), "cache image tag name")
 }
 
+func FlagCacheURL(cacheURL *string) {
+	flagSet.StringVar(cacheURL, "cache-url", os.Getenv(EnvCacheURL), "URL of a cache blob store")
+}
+
+func FlagCapabilities(capabilities *string) {
+	flagSet.StringVar(capabilities, "capabilities", os.Getenv(EnvCapabilities), "comma separated Linux capabilities to keep after dropping privileges, all others are dropped")
+}
+
+func FlagConfigPath(configPath *string) {
+	flagSet.StringVar(configPath, "config", os.Getenv(EnvConfigPath), "path to a config file providing flag values")
+}
+
+func FlagEstargz(estargz *bool) {
+	flagSet.BoolVar(estargz, "estargz", BoolEnv(EnvEstargz), "write the layers of the app image in eStargz format for lazy pulling")
+}
+
+func FlagForceLayerHash(force *bool) {
+	flagSet.BoolVar(force, "force-layer-hash", BoolEnv(EnvForceLayerHash), "hash every layer instead of reusing layers whose recorded fingerprint is unchanged")
+}
+
 func FlagGID(gid *int) {
 	flagSet.IntVar(gid, "gid", intEnv(EnvGID), "GID of user's group in the stack's build and run images")
 }
@@ -104,6 +216,18 @@ func DefaultGroupPath(platformAPI, layersDir string) string {
 	return defaultPath(DefaultGroupFile, platformAPI, layersDir)
 }
 
+func FlagKeepCapabilities(keepCapabilities *bool) {
+	flagSet.BoolVar(keepCapabilities, "keep-capabilities", BoolEnv(EnvKeepCapabilities), "leave Linux capabilities to the kernel when dropping privileges, instead of dropping those not in -capabilities")
+}
+
+func FlagLabels(labels *StringSlice) {
+	flagSet.Var(labels, "label", "label to add to the app image, as key=value (may be repeated)")
+}
+
+func FlagLabelFile(labelFile *string) {
+	flagSet.StringVar(labelFile, "label-file", os.Getenv(EnvLabelFile), "path to a file of labels to add to the app image, one key=value per line")
+}
+
 func FlagLaunchCacheDir(launchCacheDir *string) {
 	flagSet.StringVar(launchCacheDir, "launch-cache", os.Getenv(EnvLaunchCacheDir), "path to launch cache directory")
 }
@@ -112,6 +236,14 @@ func FlagLauncherPath(launcherPath *string) {
 	flagSet.StringVar(launcherPath, "launcher", DefaultLauncherPath, "path to launcher binary")
 }
 
+func FlagLayerCompression(compression *string) {
+	flagSet.StringVar(compression, "layer-compression", EnvOrDefault(EnvLayerCompression, DefaultLayerCompression), "compression of the layers of the app image and cache image (gzip or zstd)")
+}
+
+func FlagLayerCompressionLevel(level *int) {
+	flagSet.IntVar(level, "layer-compression-level", intEnv(EnvLayerCompressionLevel), "compression level of the layers of the app image and cache image (defaults to the fastest gzip level or the default zstd level)")
+}
+
 func FlagLayersDir(layersDir *string) {
 	flagSet.StringVar(layersDir, "layers", EnvOrDefault(EnvLayersDir, DefaultLayersDir), "path to layers directory")
 }
@@ -152,6 +284,14 @@ func FlagPlatformDir(platformDir *string) {
 	flagSet.StringVar(platformDir, "platform", EnvOrDefault(EnvPlatformDir, DefaultPlatformDir), "path to platform directory")
 }
 
+func FlagPrefetchProfile(prefetchProfile *string) {
+	flagSet.StringVar(prefetchProfile, "prefetch-profile", os.Getenv(EnvPrefetchProfile), "path to a file listing the files read at startup, one per line, to place first in eStargz layers")
+}
+
+func FlagProtectLabels(protect *bool) {
+	flagSet.BoolVar(protect, "protect-labels", BoolEnv(EnvProtectLabels), "do not let buildpacks or the platform override io.buildpacks.* labels")
+}
+
 func FlagPreviousImage(image *string) {
 	flagSet.StringVar(image, "previous-image", os.Getenv(EnvPreviousImage), "reference to previous image")
 }
@@ -164,10 +304,26 @@ func DefaultReportPath(platformAPI, layersDir string) string {
 	return defaultPath(DefaultReportFile, platformAPI, layersDir)
 }
 
+func FlagRetryAttempts(attempts *int) {
+	flagSet.IntVar(attempts, "retry-attempts", intEnv(EnvRetryAttempts), "maximum number of attempts for each registry read or write (defaults to 3)")
+}
+
+func FlagRetryBackoff(backoff *string) {
+	flagSet.StringVar(backoff, "retry-backoff", os.Getenv(EnvRetryBackoff), "delay before the first retry of a registry read or write, doubled for each subsequent retry (defaults to 1s)")
+}
+
+func FlagRetryStatusCodes(codes *string) {
+	flagSet.StringVar(codes, "retry-status-codes", os.Getenv(EnvRetryStatusCodes), "comma separated registry response status codes to retry (defaults to 408,429,500,502,503,504)")
+}
+
 func FlagRunImage(runImage *string) {
 	flagSet.StringVar(runImage, "run-image", os.Getenv(EnvRunImage), "reference to run image")
 }
 
+func FlagSizePolicyPath(sizePolicyPath *string) {
+	flagSet.StringVar(sizePolicyPath, "size-policy", os.Getenv(EnvSizePolicyPath), "path to a size policy toml file limiting the size of the exported layers")
+}
+
 func FlagSkipLayers(skip *bool) {
 	flagSet.BoolVar(skip, "skip-layers", BoolEnv(EnvSkipLayers), "do not provide layer metadata to buildpacks")
 }
@@ -180,6 +336,10 @@ func FlagStackPath(stackPath *string) {
 	flagSet.StringVar(stackPath, "stack", EnvOrDefault(EnvStackPath, DefaultStackPath), "path to stack.toml")
 }
 
+func FlagSupplementaryGroups(groups *string) {
+	flagSet.StringVar(groups, "supplementary-gids", os.Getenv(EnvSupplementaryGroups), "comma separated supplementary group IDs of the user in the stack's build and run images")
+}
+
 func FlagTags(tags *StringSlice) {
 	flagSet.Var(tags, "tag", "additional tags")
 }
@@ -192,6 +352,10 @@ func FlagUseDaemon(use *bool) {
 	flagSet.BoolVar(use, "daemon", BoolEnv(EnvUseDaemon), "export to docker daemon")
 }
 
+func FlagVerifyReproducible(verify *bool) {
+	flagSet.BoolVar(verify, "verify-reproducible", BoolEnv(EnvVerifyReproducible), "compare layer digests against the previous image and report non-reproducible layers")
+}
+
 func FlagVersion(version *bool) {
 	flagSet.BoolVar(version, "version", false, "show version")
 }
@@ -200,6 +364,10 @@ func FlagLogLevel(level *string) {
 	flagSet.StringVar(level, "log-level", EnvOrDefault(EnvLogLevel, DefaultLogLevel), "logging level")
 }
 
+func FlagPrintConfig(print *bool) {
+	flagSet.BoolVar(print, "print-config", false, "print the resolved configuration before running")
+}
+
 func FlagProjectMetadataPath(projectMetadataPath *string) {
 	flagSet.StringVar(projectMetadataPath, "project-metadata", EnvOrDefault(EnvProjectMetadataPath, PlaceholderProjectMetadataPath), "path to project-metadata.toml")
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+const (
+	flagListProcesses = "--list-processes"
+	flagDescribe      = "--describe"
+	flagExplainEnv    = "--explain-env"
+	flagJSON          = "--json"
+)
+
+// introspect handles the introspection flags:
+//
+//	launcher --list-processes [--json]
+//	launcher --describe <type> [--json]
+//	launcher --explain-env <type>
+//
+// The flags are only honored when the launcher is invoked as launcher, e.g. /cnb/lifecycle/launcher.
+// When it is invoked as a process type, e.g. /cnb/process/web, all arguments belong to the process.
+// It returns false when args do not request introspection.
+// --list-processes and --describe do not modify the environment or run any profile or exec.d scripts;
+// --explain-env runs the exec.d executables of the process, see launch.Launcher.ExplainEnv.
+func introspect(launcher *launch.Launcher, p *platform.Platform, argv0 string, args []string) (bool, error) {
+	if len(args) == 0 || !invokedAsLauncher(argv0) {
+		return false, nil
+	}
+	switch args[0] {
+	case flagListProcesses:
+		asJSON, err := parseJSONFlag(args[1:])
+		if err != nil {
+			return true, err
+		}
+		if err := launch.WriteProcessDescriptions(os.Stdout, launcher.DescribeProcesses(), asJSON); err != nil {
+			return true, cmd.FailErr(err, "list processes")
+		}
+		return true, nil
+	case flagDescribe:
+		if len(args) < 2 {
+			return true, cmd.FailErrCode(errors.New(flagDescribe+" requires a process type"), cmd.CodeInvalidArgs, "parse arguments")
+		}
+		asJSON, err := parseJSONFlag(args[2:])
+		if err != nil {
+			return true, err
+		}
+		description, err := launcher.DescribeProcess(args[1])
+		if err != nil {
+			return true, cmd.FailErrCode(err, p.CodeFor(platform.LaunchError), "describe process")
+		}
+		if err := launch.WriteProcessDescription(os.Stdout, description, asJSON); err != nil {
+			return true, cmd.FailErr(err, "describe process")
+		}
+		return true, nil
+	case flagExplainEnv:
+		if len(args) != 2 {
+			return true, cmd.FailErrCode(errors.New(flagExplainEnv+" requires a process type"), cmd.CodeInvalidArgs, "parse arguments")
+		}
+		fmt.Fprintln(os.Stderr, "Note: profile scripts are not run, the variables they set are not shown")
+		if err := launcher.ExplainEnv(args[1], os.Stdout); err != nil {
+			return true, cmd.FailErrCode(err, p.CodeFor(platform.LaunchError), "explain env")
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func invokedAsLauncher(argv0 string) bool {
+	return strings.TrimSuffix(filepath.Base(argv0), filepath.Ext(argv0)) == "launcher"
+}
+
+func parseJSONFlag(args []string) (bool, error) {
+	switch {
+	case len(args) == 0:
+		return false, nil
+	case len(args) == 1 && args[0] == flagJSON:
+		return true, nil
+	default:
+		return false, cmd.FailErrCode(errors.New("received unexpected arguments"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+}
@@ -39,6 +39,11 @@ func runLaunch() error {
 
 	defaultProcessType := defaultProcessType(p.API(), md)
 
+	launchEnv := env.NewLaunchEnv(os.Environ(), launch.ProcessDir, launch.LifecycleDir)
+	launchEnv.Provenance = &env.Provenance{}
+	execD := launch.NewExecDRunner()
+	execD.Provenance = launchEnv.Provenance
+
 	launcher := &launch.Launcher{
 		DefaultProcessType: defaultProcessType,
 		LayersDir:          cmd.EnvOrDefault(cmd.EnvLayersDir, cmd.DefaultLayersDir),
@@ -46,13 +51,22 @@ func runLaunch() error {
 		PlatformAPI:        p.API(),
 		Processes:          md.Processes,
 		Buildpacks:         md.Buildpacks,
-		Env:                env.NewLaunchEnv(os.Environ(), launch.ProcessDir, launch.LifecycleDir),
+		Env:                launchEnv,
+		EnvProvenance:      launchEnv.Provenance,
 		Exec:               launch.OSExecFunc,
-		ExecD:              launch.NewExecDRunner(),
+		ExecD:              execD,
 		Shell:              launch.DefaultShell,
 		Setenv:             os.Setenv,
 	}
 
+	if handled, err := introspect(launcher, p, os.Args[0], os.Args[1:]); handled {
+		return err
+	}
+
+	if cmd.BoolEnv(cmd.EnvLaunchDebugEnv) {
+		launcher.EnvDebug = os.Stderr
+	}
+
 	if err := launcher.Launch(os.Args[0], os.Args[1:]); err != nil {
 		return cmd.FailErrCode(err, p.CodeFor(platform.LaunchError), "launch")
 	}
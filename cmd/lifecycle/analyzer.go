@@ -18,6 +18,7 @@ import (
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/internal/encoding"
+	"github.com/buildpacks/lifecycle/internal/git"
 	"github.com/buildpacks/lifecycle/internal/layer"
 	"github.com/buildpacks/lifecycle/platform"
 	"github.com/buildpacks/lifecycle/priv"
@@ -25,6 +26,10 @@ import (
 
 type analyzeCmd struct {
 	analyzeArgs
+	retryArgs
+
+	user priv.User
+	userArgs
 	additionalTags  cmd.StringSlice
 	analyzedPath    string
 	cacheImageRef   string
@@ -32,33 +37,40 @@ type analyzeCmd struct {
 	legacyGroupPath string
 	outputImageRef  string
 	stackPath       string
+	stackMD         platform.StackMetadata
 	uid, gid        int
 }
 
 // analyzeArgs contains inputs needed when run by creator.
 type analyzeArgs struct {
+	appDir           string
 	launchCacheDir   string
 	layersDir        string
 	previousImageRef string
 	runImageRef      string
 	skipLayers       bool
 	useDaemon        bool
+	buildStack       *lifecycle.BuildStack
 
 	docker      client.CommonAPIClient // construct if necessary before dropping privileges
 	keychain    authn.Keychain         // construct if necessary before dropping privileges
 	legacyCache lifecycle.Cache
 	legacyGroup buildpack.Group
 	platform    Platform
+	retryPolicy *image.RetryPolicy
 }
 
 // DefineFlags defines the flags that are considered valid and reads their values (if provided).
 func (a *analyzeCmd) DefineFlags() {
 	cmd.FlagAnalyzedPath(&a.analyzedPath)
+	cmd.FlagAppDir(&a.appDir)
 	cmd.FlagCacheImage(&a.cacheImageRef)
 	cmd.FlagGID(&a.gid)
 	cmd.FlagLayersDir(&a.layersDir)
 	cmd.FlagUID(&a.uid)
 	cmd.FlagUseDaemon(&a.useDaemon)
+	a.retryArgs.defineFlags()
+	a.userArgs.defineFlags()
 	if a.platform.API().AtLeast("0.9") {
 		cmd.FlagLaunchCacheDir(&a.launchCacheDir)
 		cmd.FlagSkipLayers(&a.skipLayers)
@@ -108,25 +120,35 @@ func (a *analyzeCmd) Args(nargs int, args []string) error {
 		}
 	}
 
-	if !a.useDaemon {
-		if err := a.ensurePreviousAndTargetHaveSameRegistry(); err != nil {
-			return errors.Wrap(err, "ensuring images are on same registry")
-		}
-	}
-
 	if a.launchCacheDir != "" && !a.useDaemon {
 		cmd.DefaultLogger.Warn("Ignoring -launch-cache, only intended for use with -daemon")
 		a.launchCacheDir = ""
 	}
 
-	if err := image.ValidateDestinationTags(a.useDaemon, append(a.additionalTags, a.outputImageRef)...); err != nil {
+	if err := image.ValidateDestinationTags(append(a.additionalTags, a.outputImageRef)...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
+	var err error
+	if a.supportsRunImage() {
+		if a.stackMD, err = readStack(a.stackPath); err != nil {
+			return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse stack metadata")
+		}
+		stack := buildStack(a.stackMD)
+		a.buildStack = &stack
+	}
+
 	if err := a.populateRunImageIfNeeded(); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "populate run image")
 	}
 
+	if a.retryPolicy, err = a.newRetryPolicy(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	if a.user, err = a.newUser(a.uid, a.gid); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse user")
+	}
+
 	return nil
 }
 
@@ -153,14 +175,14 @@ func (a *analyzeCmd) Privileges() error {
 		}
 	}
 	if a.platformAPIVersionGreaterThan06() {
-		if err := image.VerifyRegistryAccess(a, a.keychain); err != nil {
+		if err := image.VerifyRegistryAccess(a, a.keychain, a.retryPolicy); err != nil {
 			return cmd.FailErr(err)
 		}
 	}
 	if err := priv.EnsureOwner(a.uid, a.gid, a.layersDir, a.legacyCacheDir); err != nil {
 		return cmd.FailErr(err, "chown volumes")
 	}
-	if err := priv.RunAs(a.uid, a.gid); err != nil {
+	if err := priv.RunAs(a.user); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", a.uid, a.gid))
 	}
 	return nil
@@ -186,7 +208,7 @@ func (a *analyzeCmd) Exec() error {
 		if err := verifyBuildpackApis(group); err != nil {
 			return err
 		}
-		cacheStore, err = initCache(a.cacheImageRef, a.legacyCacheDir, a.keychain)
+		cacheStore, err = initCache(a.cacheImageRef, a.legacyCacheDir, "", a.keychain, a.retryPolicy)
 		if err != nil {
 			return cmd.FailErr(err, "initialize cache")
 		}
@@ -195,6 +217,7 @@ func (a *analyzeCmd) Exec() error {
 	}
 
 	analyzedMD, err := a.analyze()
+	reportRetries(a.retryPolicy)
 	if err != nil {
 		return err
 	}
@@ -226,6 +249,7 @@ func (aa analyzeArgs) analyze() (platform.AnalyzedMetadata, error) {
 
 	analyzedMD, err := (&lifecycle.Analyzer{
 		Buildpacks:            aa.legacyGroup.Group,
+		BuildStack:            aa.buildStack,
 		Cache:                 aa.legacyCache,
 		Logger:                cmd.DefaultLogger,
 		Platform:              aa.platform,
@@ -241,10 +265,21 @@ func (aa analyzeArgs) analyze() (platform.AnalyzedMetadata, error) {
 	if err != nil {
 		return platform.AnalyzedMetadata{}, cmd.FailErrCode(err, aa.platform.CodeFor(platform.AnalyzeError), "analyzer")
 	}
+	analyzedMD.ProjectSource = aa.projectSource()
 
 	return analyzedMD, nil
 }
 
+// projectSource reads the git checkout of the app, which is read before the build so that it is not affected by
+// changes that buildpacks make to the app dir.
+func (aa analyzeArgs) projectSource() *platform.ProjectSource {
+	source, err := git.ProjectSource(aa.appDir)
+	if err != nil {
+		cmd.DefaultLogger.Warnf("Failed to read git metadata from '%s': %s", aa.appDir, err)
+	}
+	return source
+}
+
 func (aa analyzeArgs) localOrRemote(fromImage string) (imgutil.Image, error) {
 	if fromImage == "" {
 		return nil, nil
@@ -258,7 +293,8 @@ func (aa analyzeArgs) localOrRemote(fromImage string) (imgutil.Image, error) {
 		)
 	}
 
-	return remote.NewImage(
+	return newRemoteImage(
+		aa.retryPolicy,
 		fromImage,
 		aa.keychain,
 		remote.FromBaseImage(fromImage),
@@ -287,12 +323,7 @@ func (a *analyzeCmd) populateRunImageIfNeeded() error {
 		return err
 	}
 
-	stackMD, err := readStack(a.stackPath)
-	if err != nil {
-		return err
-	}
-
-	a.runImageRef, err = stackMD.BestRunImageMirror(targetRegistry)
+	a.runImageRef, err = a.stackMD.BestRunImageMirror(targetRegistry)
 	if err != nil {
 		return errors.New("-run-image is required when there is no stack metadata available")
 	}
@@ -300,24 +331,6 @@ func (a *analyzeCmd) populateRunImageIfNeeded() error {
 	return nil
 }
 
-func (a *analyzeCmd) ensurePreviousAndTargetHaveSameRegistry() error {
-	if a.previousImageRef == a.outputImageRef {
-		return nil
-	}
-	targetRegistry, err := parseRegistry(a.outputImageRef)
-	if err != nil {
-		return err
-	}
-	previousRegistry, err := parseRegistry(a.previousImageRef)
-	if err != nil {
-		return err
-	}
-	if previousRegistry != targetRegistry {
-		return fmt.Errorf("previous image is on a different registry %s from the exported image %s", previousRegistry, targetRegistry)
-	}
-	return nil
-}
-
 func (a *analyzeCmd) ReadableRegistryImages() []string {
 	var readableImages []string
 	if !a.useDaemon {
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/priv"
+)
+
+func cacheSubcommand(platform Platform) {
+	if len(os.Args) < 3 {
+		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "parse arguments"))
+	}
+	switch os.Args[2] {
+	case "verify":
+		cmd.RunArgs(&cacheVerifyCmd{platform: platform}, os.Args[3:])
+	case "export":
+		cmd.RunArgs(&cacheExportCmd{platform: platform}, os.Args[3:])
+	case "import":
+		cmd.RunArgs(&cacheImportCmd{platform: platform}, os.Args[3:])
+	default:
+		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown cache command:", os.Args[2]))
+	}
+}
+
+// cacheArgs select the cache that a cache command operates on.
+type cacheArgs struct {
+	cacheDir      string
+	cacheImageTag string
+	cacheURL      string
+	uid, gid      int
+
+	retryPolicy *image.RetryPolicy
+	retryArgs
+	user priv.User
+	userArgs
+
+	// construct if necessary
+	keychain authn.Keychain
+}
+
+func (c *cacheArgs) defineFlags() {
+	cmd.FlagCacheDir(&c.cacheDir)
+	cmd.FlagCacheImage(&c.cacheImageTag)
+	cmd.FlagCacheURL(&c.cacheURL)
+	cmd.FlagUID(&c.uid)
+	cmd.FlagGID(&c.gid)
+	c.retryArgs.defineFlags()
+	c.userArgs.defineFlags()
+}
+
+func (c *cacheArgs) validate() error {
+	if len(appendNotEmpty(nil, c.cacheDir, c.cacheImageTag, c.cacheURL)) != 1 {
+		return cmd.FailErrCode(errors.New("exactly one of -cache-dir, -cache-image or -cache-url is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	var err error
+	if c.retryPolicy, err = c.newRetryPolicy(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	if c.user, err = c.newUser(c.uid, c.gid); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse user")
+	}
+	return nil
+}
+
+// privileges resolves the keychain, then drops privileges after making the cache directory (if any) writable by the user.
+func (c *cacheArgs) privileges() error {
+	var err error
+	c.keychain, err = auth.DefaultKeychain(appendNotEmpty(nil, c.cacheImageTag)...)
+	if err != nil {
+		return cmd.FailErr(err, "resolve keychain")
+	}
+	if err := priv.EnsureOwner(c.uid, c.gid, c.cacheDir); err != nil {
+		return cmd.FailErr(err, "chown volumes")
+	}
+	if err := priv.RunAs(c.user); err != nil {
+		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", c.uid, c.gid))
+	}
+	return nil
+}
+
+func (c *cacheArgs) initCache() (lifecycle.Cache, error) {
+	return initCache(c.cacheImageTag, c.cacheDir, c.cacheURL, c.keychain, c.retryPolicy)
+}
+
+type cacheVerifyCmd struct {
+	// flags: inputs
+	repair bool
+	cacheArgs
+
+	platform Platform
+}
+
+// DefineFlags defines the flags that are considered valid and reads their values (if provided).
+func (v *cacheVerifyCmd) DefineFlags() {
+	v.cacheArgs.defineFlags()
+	cmd.FlagCacheRepair(&v.repair)
+}
+
+// Args validates arguments and flags, and fills in default values.
+func (v *cacheVerifyCmd) Args(nargs int, args []string) error {
+	if nargs != 0 {
+		return cmd.FailErrCode(errors.New("received unexpected arguments"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	return v.cacheArgs.validate()
+}
+
+func (v *cacheVerifyCmd) Privileges() error {
+	return v.privileges()
+}
+
+func (v *cacheVerifyCmd) Exec() error {
+	cacheStore, err := v.initCache()
+	if err != nil {
+		return err
+	}
+
+	verifier := &lifecycle.CacheVerifier{Logger: cmd.DefaultLogger}
+	result, err := verifier.Verify(cacheStore)
+	if err != nil {
+		return cmd.FailErr(err, "verify cache")
+	}
+	for _, l := range result.Invalid {
+		cmd.DefaultLogger.Warnf("Cache layer '%s' (%s) is invalid: %s", l.Identifier, l.SHA, l.Reason)
+	}
+	for _, diffID := range result.Orphans {
+		cmd.DefaultLogger.Infof("Cache layer %s is not referenced by the cache metadata", diffID)
+	}
+	if !result.Changed() {
+		cmd.DefaultLogger.Infof("Cache '%s' is valid", cacheStore.Name())
+		return nil
+	}
+
+	if !v.repair {
+		if len(result.Invalid) > 0 {
+			return cmd.FailErr(fmt.Errorf("found %d invalid layer(s), run with -repair to remove them", len(result.Invalid)), "verify cache")
+		}
+		return nil
+	}
+	if err := verifier.Repair(cacheStore, result); err != nil {
+		return cmd.FailErr(err, "repair cache")
+	}
+	cmd.DefaultLogger.Infof("Repaired cache '%s': removed %d invalid and %d orphaned layer(s)", cacheStore.Name(), len(result.Invalid), len(result.Orphans))
+	return cmd.ExitCode(cmd.CodeCacheChanged)
+}
+
+type cacheExportCmd struct {
+	archivePath string
+	cacheArgs
+
+	platform Platform
+}
+
+// DefineFlags defines the flags that are considered valid and reads their values (if provided).
+func (e *cacheExportCmd) DefineFlags() {
+	e.cacheArgs.defineFlags()
+}
+
+// Args validates arguments and flags, and fills in default values.
+func (e *cacheExportCmd) Args(nargs int, args []string) error {
+	if nargs != 1 {
+		return cmd.FailErrCode(fmt.Errorf("received %d arguments, but expected 1: <file.tar>", nargs), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	e.archivePath = args[0]
+	return e.cacheArgs.validate()
+}
+
+func (e *cacheExportCmd) Privileges() error {
+	return e.privileges()
+}
+
+func (e *cacheExportCmd) Exec() error {
+	cacheStore, err := e.initCache()
+	if err != nil {
+		return err
+	}
+	if !cacheStore.Exists() {
+		return cmd.FailErr(fmt.Errorf("cache '%s' does not exist", cacheStore.Name()), "export cache")
+	}
+
+	f, err := os.Create(e.archivePath)
+	if err != nil {
+		return cmd.FailErr(err, "create cache archive")
+	}
+	defer f.Close()
+
+	archiver := &lifecycle.CacheArchiver{Logger: cmd.DefaultLogger}
+	if err := archiver.Export(cacheStore, f); err != nil {
+		return cmd.FailErr(err, "export cache")
+	}
+	if err := f.Close(); err != nil {
+		return cmd.FailErr(err, "write cache archive")
+	}
+	return nil
+}
+
+type cacheImportCmd struct {
+	archivePath string
+	cacheArgs
+
+	platform Platform
+}
+
+// DefineFlags defines the flags that are considered valid and reads their values (if provided).
+func (i *cacheImportCmd) DefineFlags() {
+	i.cacheArgs.defineFlags()
+}
+
+// Args validates arguments and flags, and fills in default values.
+func (i *cacheImportCmd) Args(nargs int, args []string) error {
+	if nargs != 1 {
+		return cmd.FailErrCode(fmt.Errorf("received %d arguments, but expected 1: <file.tar>", nargs), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	i.archivePath = args[0]
+	return i.cacheArgs.validate()
+}
+
+func (i *cacheImportCmd) Privileges() error {
+	// create the cache directory before dropping privileges, so that it is owned by the user
+	if i.cacheDir != "" {
+		if err := os.MkdirAll(i.cacheDir, 0777); err != nil {
+			return cmd.FailErr(err, "create cache directory")
+		}
+	}
+	return i.privileges()
+}
+
+func (i *cacheImportCmd) Exec() error {
+	cacheStore, err := i.initCache()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(i.archivePath)
+	if err != nil {
+		return cmd.FailErr(err, "open cache archive")
+	}
+	defer f.Close()
+
+	archiver := &lifecycle.CacheArchiver{Logger: cmd.DefaultLogger}
+	if err := archiver.Import(f, cacheStore); err != nil {
+		return cmd.FailErr(err, "import cache")
+	}
+	return nil
+}
@@ -23,6 +23,7 @@ type createCmd struct {
 	buildpacksDir       string
 	cacheDir            string
 	cacheImageRef       string
+	cacheURL            string
 	launchCacheDir      string
 	launcherPath        string
 	layersDir           string
@@ -34,17 +35,29 @@ type createCmd struct {
 	projectMetadataPath string
 	reportPath          string
 	runImageRef         string
+	sizePolicyPath      string
 	stackPath           string
 	targetRegistry      string
 	uid, gid            int
+	forceLayerHash      bool
 	skipRestore         bool
+	sourceDateEpoch     time.Time
 	useDaemon           bool
+	verifyReproducible  bool
 
 	additionalTags cmd.StringSlice
 	docker         client.CommonAPIClient // construct if necessary before dropping privileges
 	keychain       authn.Keychain
 	platform       Platform
+	retryPolicy    *image.RetryPolicy
 	stackMD        platform.StackMetadata
+
+	compressionArgs
+	labelArgs
+	retryArgs
+
+	user priv.User
+	userArgs
 }
 
 // DefineFlags defines the flags that are considered valid and reads their values (if provided).
@@ -53,6 +66,8 @@ func (c *createCmd) DefineFlags() {
 	cmd.FlagBuildpacksDir(&c.buildpacksDir)
 	cmd.FlagCacheDir(&c.cacheDir)
 	cmd.FlagCacheImage(&c.cacheImageRef)
+	cmd.FlagCacheURL(&c.cacheURL)
+	cmd.FlagForceLayerHash(&c.forceLayerHash)
 	cmd.FlagGID(&c.gid)
 	cmd.FlagLaunchCacheDir(&c.launchCacheDir)
 	cmd.FlagLauncherPath(&c.launcherPath)
@@ -62,13 +77,19 @@ func (c *createCmd) DefineFlags() {
 	cmd.FlagPreviousImage(&c.previousImageRef)
 	cmd.FlagReportPath(&c.reportPath)
 	cmd.FlagRunImage(&c.runImageRef)
+	cmd.FlagSizePolicyPath(&c.sizePolicyPath)
 	cmd.FlagSkipRestore(&c.skipRestore)
 	cmd.FlagStackPath(&c.stackPath)
 	cmd.FlagUID(&c.uid)
 	cmd.FlagUseDaemon(&c.useDaemon)
+	cmd.FlagVerifyReproducible(&c.verifyReproducible)
 	cmd.FlagTags(&c.additionalTags)
 	cmd.FlagProjectMetadataPath(&c.projectMetadataPath)
 	cmd.FlagProcessType(&c.processType)
+	c.compressionArgs.defineFlags()
+	c.labelArgs.defineFlags()
+	c.retryArgs.defineFlags()
+	c.userArgs.defineFlags()
 }
 
 // Args validates arguments and flags, and fills in default values.
@@ -82,8 +103,10 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		cmd.DefaultLogger.Warn("Ignoring -launch-cache, only intended for use with -daemon")
 		c.launchCacheDir = ""
 	}
+	c.ignoreUnsupported(c.useDaemon)
+	c.ignoreUnsupportedAnnotations(c.useDaemon)
 
-	if c.cacheImageRef == "" && c.cacheDir == "" {
+	if c.cacheImageRef == "" && c.cacheDir == "" && c.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Not restoring or caching layer data, no cache flag specified.")
 	}
 
@@ -91,7 +114,7 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		c.previousImageRef = c.outputImageRef
 	}
 
-	if err := image.ValidateDestinationTags(c.useDaemon, append(c.additionalTags, c.outputImageRef)...); err != nil {
+	if err := image.ValidateDestinationTags(append(c.additionalTags, c.outputImageRef)...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
@@ -108,6 +131,12 @@ func (c *createCmd) Args(nargs int, args []string) error {
 	}
 
 	var err error
+	c.sourceDateEpoch, err = parseSourceDateEpoch()
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse source date epoch")
+	}
+	ignoreUnsupportedCreatedAt(c.useDaemon, c.sourceDateEpoch)
+
 	c.stackMD, err = readStack(c.stackPath)
 	if err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse stack metadata")
@@ -122,6 +151,20 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "populate run image")
 	}
 
+	c.retryPolicy, err = c.newRetryPolicy()
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	if err := c.compressionArgs.validate(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse layer compression")
+	}
+	if err := c.labelArgs.validate(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse labels and annotations")
+	}
+	if c.user, err = c.newUser(c.uid, c.gid); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse user")
+	}
+
 	return nil
 }
 
@@ -140,24 +183,28 @@ func (c *createCmd) Privileges() error {
 		}
 	}
 	if c.platformAPIVersionGreaterThan06() {
-		if err := image.VerifyRegistryAccess(c, c.keychain); err != nil {
+		if err := image.VerifyRegistryAccess(c, c.keychain, c.retryPolicy); err != nil {
 			return cmd.FailErr(err)
 		}
 	}
 	if err := priv.EnsureOwner(c.uid, c.gid, c.cacheDir, c.launchCacheDir, c.layersDir); err != nil {
 		return cmd.FailErr(err, "chown volumes")
 	}
-	if err := priv.RunAs(c.uid, c.gid); err != nil {
+	if err := priv.RunAs(c.user); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", c.uid, c.gid))
 	}
 	if err := priv.SetEnvironmentForUser(c.uid); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("set environment for user %d", c.uid))
 	}
+	// like the detector and builder, buildpacks should never be run with privileges
+	if priv.IsPrivileged() {
+		return cmd.FailErr(errors.New("refusing to run buildpacks as root, -uid must be a non-root user"), "create")
+	}
 	return nil
 }
 
 func (c *createCmd) Exec() error {
-	cacheStore, err := initCache(c.cacheImageRef, c.cacheDir, c.keychain)
+	cacheStore, err := initCache(c.cacheImageRef, c.cacheDir, c.cacheURL, c.keychain, c.retryPolicy)
 	if err != nil {
 		return err
 	}
@@ -168,14 +215,18 @@ func (c *createCmd) Exec() error {
 		plan       platform.BuildPlan
 	)
 	if c.platform.API().AtLeast("0.7") {
+		stack := buildStack(c.stackMD)
 		cmd.DefaultLogger.Phase("ANALYZING")
 		analyzedMD, err = analyzeArgs{
+			appDir:           c.appDir,
+			buildStack:       &stack,
 			docker:           c.docker,
 			keychain:         c.keychain,
 			layersDir:        c.layersDir,
 			launchCacheDir:   c.launchCacheForAnalyzer(),
 			platform:         c.platform,
 			previousImageRef: c.previousImageRef,
+			retryPolicy:      c.retryPolicy,
 			runImageRef:      c.runImageRef,
 			skipLayers:       c.skipRestore,
 			useDaemon:        c.useDaemon,
@@ -192,6 +243,7 @@ func (c *createCmd) Exec() error {
 			platform:      c.platform,
 			platformDir:   c.platformDir,
 			orderPath:     c.orderPath,
+			stack:         analyzedMD.Stack,
 		}.detect()
 		if err != nil {
 			return err
@@ -212,6 +264,7 @@ func (c *createCmd) Exec() error {
 
 		cmd.DefaultLogger.Phase("ANALYZING")
 		analyzedMD, err = analyzeArgs{
+			appDir:           c.appDir,
 			docker:           c.docker,
 			keychain:         c.keychain,
 			layersDir:        c.layersDir,
@@ -220,6 +273,7 @@ func (c *createCmd) Exec() error {
 			skipLayers:       c.skipRestore,
 			platform:         c.platform,
 			previousImageRef: c.previousImageRef,
+			retryPolicy:      c.retryPolicy,
 			useDaemon:        c.useDaemon,
 		}.analyze()
 		if err != nil {
@@ -230,11 +284,18 @@ func (c *createCmd) Exec() error {
 	if !c.skipRestore {
 		cmd.DefaultLogger.Phase("RESTORING")
 		err := restoreArgs{
-			keychain:   c.keychain,
-			layersDir:  c.layersDir,
-			platform:   c.platform,
-			skipLayers: c.skipRestore,
-		}.restore(analyzedMD.Metadata, group, cacheStore)
+			cacheDir:       c.cacheDir,
+			cacheImageTag:  c.cacheImageRef,
+			cacheURL:       c.cacheURL,
+			docker:         c.docker,
+			keychain:       c.keychain,
+			launchCacheDir: c.launchCacheForAnalyzer(),
+			layersDir:      c.layersDir,
+			platform:       c.platform,
+			retryPolicy:    c.retryPolicy,
+			skipLayers:     c.skipRestore,
+			useDaemon:      c.useDaemon,
+		}.restore(analyzedMD, group, cacheStore)
 		if err != nil {
 			return err
 		}
@@ -259,8 +320,11 @@ func (c *createCmd) Exec() error {
 	cmd.DefaultLogger.Phase("EXPORTING")
 	return exportArgs{
 		appDir:              c.appDir,
+		compressionArgs:     c.compressionArgs,
 		docker:              c.docker,
+		forceLayerHash:      c.forceLayerHash,
 		gid:                 c.gid,
+		labelArgs:           c.labelArgs,
 		imageNames:          append([]string{c.outputImageRef}, c.additionalTags...),
 		keychain:            c.keychain,
 		launchCacheDir:      c.launchCacheDir,
@@ -270,12 +334,16 @@ func (c *createCmd) Exec() error {
 		processType:         c.processType,
 		projectMetadataPath: c.projectMetadataPath,
 		reportPath:          c.reportPath,
+		retryPolicy:         c.retryPolicy,
 		runImageRef:         c.runImageRef,
+		sizePolicyPath:      c.sizePolicyPath,
+		sourceDateEpoch:     c.sourceDateEpoch,
 		stackMD:             c.stackMD,
 		stackPath:           c.stackPath,
 		targetRegistry:      c.targetRegistry,
 		uid:                 c.uid,
 		useDaemon:           c.useDaemon,
+		verifyReproducible:  c.verifyReproducible,
 	}.export(group, cacheStore, analyzedMD)
 }
 
@@ -3,6 +3,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/buildpack"
@@ -14,6 +17,7 @@ import (
 
 type detectCmd struct {
 	// flags: inputs
+	analyzedPath string
 	detectArgs
 
 	// flags: paths to write outputs
@@ -29,11 +33,14 @@ type detectArgs struct {
 	platformDir   string
 	orderPath     string
 
+	// stack is the stack recorded in analyzed.toml, or nil if it is not known
+	stack    *platform.AnalyzedStack
 	platform Platform
 }
 
 // DefineFlags defines the flags that are considered valid and reads their values (if provided).
 func (d *detectCmd) DefineFlags() {
+	cmd.FlagAnalyzedPath(&d.analyzedPath)
 	cmd.FlagBuildpacksDir(&d.buildpacksDir)
 	cmd.FlagAppDir(&d.appDir)
 	cmd.FlagLayersDir(&d.layersDir)
@@ -61,6 +68,18 @@ func (d *detectCmd) Args(nargs int, args []string) error {
 		d.orderPath = cmd.DefaultOrderPath(d.platform.API().String(), d.layersDir)
 	}
 
+	if d.platform.API().AtLeast("0.7") {
+		// the analyzer runs before the detector and records the stack of the build and run images
+		if d.analyzedPath == cmd.PlaceholderAnalyzedPath {
+			d.analyzedPath = cmd.DefaultAnalyzedPath(d.platform.API().String(), d.layersDir)
+		}
+		var analyzedMD platform.AnalyzedMetadata
+		if _, err := toml.DecodeFile(d.analyzedPath, &analyzedMD); err != nil && !os.IsNotExist(err) {
+			return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse analyzed metadata")
+		}
+		d.stack = analyzedMD.Stack
+	}
+
 	return nil
 }
 
@@ -120,10 +139,28 @@ func (da detectArgs) detect() (buildpack.Group, platform.BuildPlan, error) {
 			return buildpack.Group{}, platform.BuildPlan{}, cmd.FailErrCode(err, da.platform.CodeFor(platform.DetectError), "detect")
 		}
 	}
+	if err := da.validateBuildpackStacks(group); err != nil {
+		return buildpack.Group{}, platform.BuildPlan{}, err
+	}
 
 	return group, plan, nil
 }
 
+// validateBuildpackStacks fails before building if the detected buildpacks require mixins that the stack does not provide.
+func (da detectArgs) validateBuildpackStacks(group buildpack.Group) error {
+	if da.stack == nil {
+		return nil
+	}
+	store, err := buildpack.NewBuildpackStore(da.buildpacksDir)
+	if err != nil {
+		return cmd.FailErr(err, "initialize buildpack store")
+	}
+	if err := lifecycle.ValidateBuildpackStacks(*da.stack, group.Group, store); err != nil {
+		return cmd.FailErrCode(err, da.platform.CodeFor(platform.DetectError), "validate stack")
+	}
+	return nil
+}
+
 func (da detectArgs) verifyBuildpackApis(order buildpack.Order) error {
 	store, err := buildpack.NewBuildpackStore(da.buildpacksDir)
 	if err != nil {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
@@ -31,12 +33,18 @@ type exportCmd struct {
 	//flags: inputs
 	cacheDir              string
 	cacheImageTag         string
+	cacheURL              string
 	groupPath             string
 	deprecatedRunImageRef string
 	exportArgs
 
 	//flags: paths to write outputs
 	analyzedPath string
+
+	retryArgs
+
+	user priv.User
+	userArgs
 }
 
 type exportArgs struct {
@@ -49,16 +57,25 @@ type exportArgs struct {
 	projectMetadataPath string
 	reportPath          string
 	runImageRef         string
+	sizePolicyPath      string
 	stackPath           string
 	targetRegistry      string
 	imageNames          []string
 	stackMD             platform.StackMetadata
 
-	useDaemon bool
-	uid, gid  int
+	forceLayerHash     bool
+	sourceDateEpoch    time.Time
+	useDaemon          bool
+	verifyReproducible bool
+	uid, gid           int
 
 	platform Platform
 
+	retryPolicy *image.RetryPolicy
+
+	compressionArgs
+	labelArgs
+
 	// construct if necessary before dropping privileges
 	docker   client.CommonAPIClient
 	keychain authn.Keychain
@@ -70,6 +87,8 @@ func (e *exportCmd) DefineFlags() {
 	cmd.FlagAppDir(&e.appDir)
 	cmd.FlagCacheDir(&e.cacheDir)
 	cmd.FlagCacheImage(&e.cacheImageTag)
+	cmd.FlagCacheURL(&e.cacheURL)
+	cmd.FlagForceLayerHash(&e.forceLayerHash)
 	cmd.FlagGID(&e.gid)
 	cmd.FlagGroupPath(&e.groupPath)
 	cmd.FlagLaunchCacheDir(&e.launchCacheDir)
@@ -79,9 +98,15 @@ func (e *exportCmd) DefineFlags() {
 	cmd.FlagProjectMetadataPath(&e.projectMetadataPath)
 	cmd.FlagReportPath(&e.reportPath)
 	cmd.FlagRunImage(&e.runImageRef)
+	cmd.FlagSizePolicyPath(&e.sizePolicyPath)
 	cmd.FlagStackPath(&e.stackPath)
 	cmd.FlagUID(&e.uid)
 	cmd.FlagUseDaemon(&e.useDaemon)
+	cmd.FlagVerifyReproducible(&e.verifyReproducible)
+	e.compressionArgs.defineFlags()
+	e.labelArgs.defineFlags()
+	e.retryArgs.defineFlags()
+	e.userArgs.defineFlags()
 
 	cmd.DeprecatedFlagRunImage(&e.deprecatedRunImageRef)
 }
@@ -97,12 +122,14 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 		cmd.DefaultLogger.Warn("Ignoring -launch-cache, only intended for use with -daemon")
 		e.launchCacheDir = ""
 	}
+	e.ignoreUnsupported(e.useDaemon)
+	e.ignoreUnsupportedAnnotations(e.useDaemon)
 
-	if e.cacheImageTag == "" && e.cacheDir == "" {
+	if e.cacheImageTag == "" && e.cacheDir == "" && e.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Will not cache data, no cache flag specified.")
 	}
 
-	if err := image.ValidateDestinationTags(e.useDaemon, e.imageNames...); err != nil {
+	if err := image.ValidateDestinationTags(e.imageNames...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
@@ -131,6 +158,12 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 	}
 
 	var err error
+	e.sourceDateEpoch, err = parseSourceDateEpoch()
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse source date epoch")
+	}
+	ignoreUnsupportedCreatedAt(e.useDaemon, e.sourceDateEpoch)
+
 	e.analyzedMD, err = parseAnalyzedMD(cmd.DefaultLogger, e.analyzedPath)
 	if err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse analyzed metadata")
@@ -150,6 +183,20 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "populate run image")
 	}
 
+	e.retryPolicy, err = e.newRetryPolicy()
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	if err := e.compressionArgs.validate(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse layer compression")
+	}
+	if err := e.labelArgs.validate(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse labels and annotations")
+	}
+	if e.user, err = e.newUser(e.uid, e.gid); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse user")
+	}
+
 	return nil
 }
 
@@ -169,6 +216,51 @@ func readStack(stackPath string) (platform.StackMetadata, error) {
 	return stackMD, nil
 }
 
+// buildStack returns the stack of the build image from CNB_STACK_ID and CNB_STACK_MIXINS (a comma separated list),
+// falling back to the id and build-image mixins in stack.toml.
+func buildStack(stackMD platform.StackMetadata) lifecycle.BuildStack {
+	stack := lifecycle.BuildStack{ID: stackMD.ID}
+	if stackMD.BuildImage != nil {
+		stack.Mixins = stackMD.BuildImage.Mixins
+	}
+	if id := os.Getenv(cmd.EnvStackID); id != "" {
+		stack.ID = id
+	}
+	if mixins, ok := os.LookupEnv(cmd.EnvStackMixins); ok {
+		stack.Mixins = append([]string{}, splitList(mixins)...)
+	}
+	return stack
+}
+
+// parseSourceDateEpoch returns the time given by SOURCE_DATE_EPOCH, or the zero time when it is unset.
+func parseSourceDateEpoch() (time.Time, error) {
+	epoch := os.Getenv(cmd.EnvSourceDateEpoch)
+	if epoch == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "%s must be a number of seconds since the Unix epoch", cmd.EnvSourceDateEpoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// ignoreUnsupportedCreatedAt warns that SOURCE_DATE_EPOCH only sets the layer timestamps of daemon images, as imgutil
+// cannot write the created time of an image loaded into the daemon.
+func ignoreUnsupportedCreatedAt(useDaemon bool, sourceDateEpoch time.Time) {
+	if useDaemon && !sourceDateEpoch.IsZero() {
+		cmd.DefaultLogger.Warnf("Ignoring %s for the image created time, not supported with -daemon", cmd.EnvSourceDateEpoch)
+	}
+}
+
+// createdAt returns the created time of the app image, which is not set on daemon images.
+func (ea exportArgs) createdAt() time.Time {
+	if ea.useDaemon {
+		return time.Time{}
+	}
+	return ea.sourceDateEpoch
+}
+
 func (e *exportCmd) supportsRunImage() bool {
 	return e.platform.API().LessThan("0.7")
 }
@@ -190,7 +282,7 @@ func (e *exportCmd) Privileges() error {
 	if err := priv.EnsureOwner(e.uid, e.gid, e.cacheDir, e.launchCacheDir); err != nil {
 		return cmd.FailErr(err, "chown volumes")
 	}
-	if err := priv.RunAs(e.uid, e.gid); err != nil {
+	if err := priv.RunAs(e.user); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", e.uid, e.gid))
 	}
 	return nil
@@ -205,7 +297,7 @@ func (e *exportCmd) Exec() error {
 		return err
 	}
 
-	cacheStore, err := initCache(e.cacheImageTag, e.cacheDir, e.keychain)
+	cacheStore, err := initCache(e.cacheImageTag, e.cacheDir, e.cacheURL, e.keychain, e.retryPolicy)
 	if err != nil {
 		cmd.DefaultLogger.Infof("no stack metadata found at path '%s', stack metadata will not be exported\n", e.stackPath)
 	}
@@ -270,19 +362,52 @@ func (ea exportArgs) export(group buildpack.Group, cacheStore lifecycle.Cache, a
 		if !os.IsNotExist(err) {
 			return err
 		}
-		cmd.DefaultLogger.Debugf("no project metadata found at path '%s', project metadata will not be exported\n", ea.projectMetadataPath)
+		cmd.DefaultLogger.Debugf("no project metadata found at path '%s'\n", ea.projectMetadataPath)
+	}
+	projectMD.AddSourceDefaults(analyzedMD.ProjectSource)
+
+	labels, err := ea.imageLabels()
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read labels")
+	}
+	annotations, err := ea.imageAnnotations(projectMD, ea.useDaemon)
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read annotations")
+	}
+
+	var sizePolicy *platform.SizePolicy
+	if ea.sizePolicyPath != "" {
+		if sizePolicy, err = platform.ReadSizePolicy(ea.sizePolicyPath); err != nil {
+			return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read size policy")
+		}
+	}
+
+	layerFactory := &layers.Factory{
+		ArtifactsDir: artifactsDir,
+		UID:          ea.uid,
+		GID:          ea.gid,
+		ModTime:      ea.sourceDateEpoch,
+		Logger:       cmd.DefaultLogger,
+		ForceHash:    ea.forceLayerHash,
+		Fingerprints: layers.NewFingerprints(layers.FingerprintsPath(ea.layersDir)),
+	}
+	converter, err := ea.estargzConverter(ea.layersDir, ea.appDir)
+	if err != nil {
+		return cmd.FailErr(err, "read prefetch list")
+	}
+	if converter != nil {
+		layerFactory.Converter = converter
 	}
 
 	exporter := &lifecycle.Exporter{
-		Buildpacks: group.Group,
-		LayerFactory: &layers.Factory{
-			ArtifactsDir: artifactsDir,
-			UID:          ea.uid,
-			GID:          ea.gid,
-			Logger:       cmd.DefaultLogger,
-		},
-		Logger:      cmd.DefaultLogger,
-		PlatformAPI: ea.platform.API(),
+		Buildpacks:   group.Group,
+		LayerFactory: layerFactory,
+		Logger:       cmd.DefaultLogger,
+		PlatformAPI:  ea.platform.API(),
+		RetryPolicy:  ea.retryPolicy,
+	}
+	if cacheStore != nil {
+		ea.setCacheCompression(cacheStore)
 	}
 
 	var appImage imgutil.Image
@@ -295,21 +420,41 @@ func (ea exportArgs) export(group buildpack.Group, cacheStore lifecycle.Cache, a
 	if err != nil {
 		return err
 	}
+	// the run image may have been given to the exporter rather than validated by the analyzer
+	if _, err := lifecycle.ValidateRunImageStack(buildStack(ea.stackMD), appImage); err != nil {
+		return cmd.FailErrCode(err, ea.platform.CodeFor(platform.ExportError), "validate stack")
+	}
 
 	report, err := exporter.Export(lifecycle.ExportOptions{
 		AdditionalNames:    ea.imageNames[1:],
+		Annotations:        annotations,
 		AppDir:             ea.appDir,
 		DefaultProcessType: ea.processType,
+		Labels:             labels,
 		LauncherConfig:     launcherConfig(ea.launcherPath),
 		LayersDir:          ea.layersDir,
 		OrigMetadata:       analyzedMD.Metadata,
 		Project:            projectMD,
+		ProtectLabels:      ea.protectLabels,
 		RunImageRef:        runImageID,
+		SizePolicy:         sizePolicy,
+		SourceDateEpoch:    ea.createdAt(),
 		Stack:              ea.stackMD,
+		VerifyReproducible: ea.verifyReproducible,
 		WorkingImage:       appImage,
 	})
 	if err != nil {
-		return cmd.FailErrCode(err, ea.platform.CodeFor(platform.ExportError), "export")
+		code := ea.platform.CodeFor(platform.ExportError)
+		switch err.(type) {
+		case imgutil.SaveError:
+			// record the tags that were saved and the failures for each registry
+			ea.writeFailedReport(report)
+		case *lifecycle.SizeBudgetError:
+			// record the layer sizes that exceeded the budget
+			ea.writeFailedReport(report)
+			code = ea.platform.CodeFor(platform.ExportSizeError)
+		}
+		return cmd.FailErrCode(err, code, "export")
 	}
 
 	if err := encoding.WriteTOML(ea.reportPath, &report); err != nil {
@@ -324,6 +469,12 @@ func (ea exportArgs) export(group buildpack.Group, cacheStore lifecycle.Cache, a
 	return nil
 }
 
+func (ea exportArgs) writeFailedReport(report platform.ExportReport) {
+	if err := encoding.WriteTOML(ea.reportPath, &report); err != nil {
+		cmd.DefaultLogger.Warnf("Failed to write export report: %v\n", err)
+	}
+}
+
 func (ea exportArgs) initDaemonAppImage(analyzedMD platform.AnalyzedMetadata) (imgutil.Image, string, error) {
 	var opts = []local.ImageOption{
 		local.FromBaseImage(ea.runImageRef),
@@ -360,8 +511,18 @@ func (ea exportArgs) initDaemonAppImage(analyzedMD platform.AnalyzedMetadata) (i
 }
 
 func (ea exportArgs) initRemoteAppImage(analyzedMD platform.AnalyzedMetadata) (imgutil.Image, string, error) {
+	runImage, err := newRemoteImage(ea.retryPolicy, ea.runImageRef, ea.keychain, remote.FromBaseImage(ea.runImageRef))
+	if err != nil {
+		return nil, "", cmd.FailErr(err, "access run image")
+	}
+	runImageID, err := runImage.Identifier()
+	if err != nil {
+		return nil, "", cmd.FailErr(err, "get run image reference")
+	}
+	// the app image is built on the run image by digest, so that it matches the run image recorded in its metadata
+	// even if the run image tag moves during the export
 	var opts = []remote.ImageOption{
-		remote.FromBaseImage(ea.runImageRef),
+		remote.FromBaseImage(runImageID.String()),
 	}
 
 	if analyzedMD.PreviousImage != nil {
@@ -377,7 +538,8 @@ func (ea exportArgs) initRemoteAppImage(analyzedMD platform.AnalyzedMetadata) (i
 		opts = append(opts, remote.WithPreviousImage(analyzedMD.PreviousImage.Reference))
 	}
 
-	appImage, err := remote.NewImage(
+	remoteImage, err := newRemoteImage(
+		ea.retryPolicy,
 		ea.imageNames[0],
 		ea.keychain,
 		opts...,
@@ -385,16 +547,12 @@ func (ea exportArgs) initRemoteAppImage(analyzedMD platform.AnalyzedMetadata) (i
 	if err != nil {
 		return nil, "", cmd.FailErr(err, "create new app image")
 	}
-
-	runImage, err := remote.NewImage(ea.runImageRef, ea.keychain, remote.FromBaseImage(ea.runImageRef))
-	if err != nil {
-		return nil, "", cmd.FailErr(err, "access run image")
-	}
-	runImageID, err := runImage.Identifier()
-	if err != nil {
-		return nil, "", cmd.FailErr(err, "get run image reference")
+	var previousImageRef string
+	if analyzedMD.PreviousImage != nil {
+		previousImageRef = analyzedMD.PreviousImage.Reference
 	}
-	return appImage, runImageID.String(), nil
+	appImage := ea.compressedImage(remoteImage, ea.keychain, runImageID.String(), previousImageRef)
+	return image.NewConfigurableImage(appImage, appImage), runImageID.String(), nil
 }
 
 func launcherConfig(launcherPath string) lifecycle.LauncherConfig {
@@ -1,18 +1,32 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/buildpack"
 	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/layers/stargz"
 	lplatform "github.com/buildpacks/lifecycle/platform"
+	"github.com/buildpacks/lifecycle/priv"
 )
 
 type Platform interface {
@@ -71,6 +85,10 @@ func subcommand(platform Platform) {
 		cmd.Run(&rebaseCmd{platform: platform}, true)
 	case "create":
 		cmd.Run(&createCmd{platform: platform}, true)
+	case "restore-layer":
+		cmd.Run(&restoreLayerCmd{platform: platform}, true)
+	case "cache":
+		cacheSubcommand(platform)
 	default:
 		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown phase:", phase))
 	}
@@ -90,16 +108,21 @@ func verifyBuildpackApis(group buildpack.Group) error {
 	return nil
 }
 
-func initCache(cacheImageTag, cacheDir string, keychain authn.Keychain) (lifecycle.Cache, error) {
+func initCache(cacheImageTag, cacheDir, cacheURL string, keychain authn.Keychain, retryPolicy *image.RetryPolicy) (lifecycle.Cache, error) {
 	var (
 		cacheStore lifecycle.Cache
 		err        error
 	)
 	if cacheImageTag != "" {
-		cacheStore, err = cache.NewImageCacheFromName(cacheImageTag, keychain)
+		cacheStore, err = cache.NewImageCacheFromName(cacheImageTag, keychain, retryPolicy)
 		if err != nil {
 			return nil, cmd.FailErr(err, "create image cache")
 		}
+	} else if cacheURL != "" {
+		cacheStore, err = cache.NewBlobCache(cacheURL, retryPolicy)
+		if err != nil {
+			return nil, cmd.FailErr(err, "create blob cache")
+		}
 	} else if cacheDir != "" {
 		cacheStore, err = cache.NewVolumeCache(cacheDir)
 		if err != nil {
@@ -117,3 +140,327 @@ func appendNotEmpty(slice []string, elems ...string) []string {
 	}
 	return slice
 }
+
+// retryArgs configure the retry policy for registry reads and writes.
+type retryArgs struct {
+	retryAttempts    int
+	retryBackoff     string
+	retryStatusCodes string
+}
+
+func (r *retryArgs) defineFlags() {
+	cmd.FlagRetryAttempts(&r.retryAttempts)
+	cmd.FlagRetryBackoff(&r.retryBackoff)
+	cmd.FlagRetryStatusCodes(&r.retryStatusCodes)
+}
+
+func (r *retryArgs) newRetryPolicy() (*image.RetryPolicy, error) {
+	policy := image.DefaultRetryPolicy(cmd.DefaultLogger)
+	if r.retryAttempts < 0 {
+		return nil, fmt.Errorf("retry attempts must not be negative, got %d", r.retryAttempts)
+	}
+	if r.retryAttempts > 0 {
+		policy.Attempts = r.retryAttempts
+	}
+	if r.retryBackoff != "" {
+		backoff, err := time.ParseDuration(r.retryBackoff)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing retry backoff")
+		}
+		policy.Backoff = backoff
+	}
+	if r.retryStatusCodes != "" {
+		policy.StatusCodes = nil
+		for _, code := range strings.Split(r.retryStatusCodes, ",") {
+			c, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing retry status code '%s'", code)
+			}
+			policy.StatusCodes = append(policy.StatusCodes, c)
+		}
+	}
+	return policy, nil
+}
+
+// reportRetries logs the number of registry and cache operations that were retried, for phases without a report.
+func reportRetries(retryPolicy *image.RetryPolicy) {
+	if retries := retryPolicy.Retries(); retries > 0 {
+		cmd.DefaultLogger.Infof("Retried %d registry or cache operation(s)", retries)
+	}
+}
+
+// userArgs configure the user that a phase runs as after dropping privileges, in addition to -uid and -gid.
+type userArgs struct {
+	capabilities        string
+	keepCapabilities    bool
+	supplementaryGroups string
+}
+
+func (u *userArgs) defineFlags() {
+	cmd.FlagCapabilities(&u.capabilities)
+	cmd.FlagKeepCapabilities(&u.keepCapabilities)
+	cmd.FlagSupplementaryGroups(&u.supplementaryGroups)
+}
+
+func (u *userArgs) newUser(uid, gid int) (priv.User, error) {
+	user := priv.User{UID: uid, GID: gid, Groups: []int{}, KeepCapabilities: u.keepCapabilities}
+	for _, group := range splitList(u.supplementaryGroups) {
+		id, err := strconv.Atoi(group)
+		if err != nil {
+			return priv.User{}, errors.Wrapf(err, "parsing supplementary group ID '%s'", group)
+		}
+		user.Groups = append(user.Groups, id)
+	}
+	for _, name := range splitList(u.capabilities) {
+		c, err := priv.ParseCapability(name)
+		if err != nil {
+			return priv.User{}, err
+		}
+		user.Capabilities = append(user.Capabilities, c)
+	}
+	return user, nil
+}
+
+// labelArgs configure the labels and manifest annotations that the platform adds to the app image.
+type labelArgs struct {
+	labels         cmd.StringSlice
+	labelFile      string
+	annotations    cmd.StringSlice
+	annotationFile string
+	protectLabels  bool
+}
+
+func (l *labelArgs) defineFlags() {
+	cmd.FlagAnnotationFile(&l.annotationFile)
+	cmd.FlagAnnotations(&l.annotations)
+	cmd.FlagLabelFile(&l.labelFile)
+	cmd.FlagLabels(&l.labels)
+	cmd.FlagProtectLabels(&l.protectLabels)
+}
+
+// ignoreUnsupportedAnnotations drops the platform-provided annotations if they cannot be added to the image.
+func (l *labelArgs) ignoreUnsupportedAnnotations(useDaemon bool) {
+	if useDaemon && (len(l.annotations) > 0 || l.annotationFile != "") {
+		cmd.DefaultLogger.Warn("Ignoring -annotation and -annotation-file, not supported with -daemon")
+		l.annotations, l.annotationFile = nil, ""
+	}
+}
+
+func (l *labelArgs) validate() error {
+	for _, label := range l.labels {
+		if _, _, err := parseKeyValue(label); err != nil {
+			return errors.Wrap(err, "parsing label")
+		}
+	}
+	for _, annotation := range l.annotations {
+		if _, _, err := parseKeyValue(annotation); err != nil {
+			return errors.Wrap(err, "parsing annotation")
+		}
+	}
+	return nil
+}
+
+// imageLabels returns the labels given by the platform. Labels given as flags override those in the label file.
+func (l *labelArgs) imageLabels() (map[string]string, error) {
+	return keyValues(l.labelFile, l.labels)
+}
+
+// imageAnnotations returns the annotations to add to the manifest of the app image.
+// Annotations given as flags override those in the annotation file, which override those generated from the project metadata.
+// No annotations are returned if the manifest is not kept, i.e. when exporting to a docker daemon.
+func (l *labelArgs) imageAnnotations(projectMD lplatform.ProjectMetadata, useDaemon bool) (map[string]string, error) {
+	if useDaemon {
+		return nil, nil
+	}
+	annotations, err := keyValues(l.annotationFile, l.annotations)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range projectMD.OCIAnnotations() {
+		if _, ok := annotations[key]; !ok {
+			annotations[key] = value
+		}
+	}
+	return annotations, nil
+}
+
+// keyValues reads key=value pairs from the file at path, one per line, and then from values.
+// Blank lines and lines starting with # are skipped.
+func keyValues(path string, values []string) (map[string]string, error) {
+	var pairs []string
+	if path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading '%s'", path)
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			pairs = append(pairs, line)
+		}
+	}
+	result := map[string]string{}
+	for _, pair := range append(pairs, values...) {
+		key, value, err := parseKeyValue(pair)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func parseKeyValue(pair string) (string, string, error) {
+	parts := strings.SplitN(pair, "=", 2)
+	key := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || key == "" {
+		return "", "", fmt.Errorf("'%s' must be of the form key=value", pair)
+	}
+	return key, parts[1], nil
+}
+
+// compressionArgs configure the compression of the layers written to the app image and the cache.
+type compressionArgs struct {
+	layerCompression      string
+	layerCompressionLevel int
+	cacheCompression      string
+	estargz               bool
+	prefetchProfile       string
+}
+
+func (c *compressionArgs) defineFlags() {
+	cmd.FlagCacheCompression(&c.cacheCompression)
+	cmd.FlagEstargz(&c.estargz)
+	cmd.FlagLayerCompression(&c.layerCompression)
+	cmd.FlagLayerCompressionLevel(&c.layerCompressionLevel)
+	cmd.FlagPrefetchProfile(&c.prefetchProfile)
+}
+
+// ignoreUnsupported resets the options that do not apply to the given export, warning about each of them.
+func (c *compressionArgs) ignoreUnsupported(useDaemon bool) {
+	if useDaemon && (c.layerCompression != cmd.DefaultLayerCompression || c.layerCompressionLevel != 0) {
+		cmd.DefaultLogger.Warn("Ignoring -layer-compression and -layer-compression-level, not supported with -daemon")
+		c.layerCompression, c.layerCompressionLevel = cmd.DefaultLayerCompression, 0
+	}
+	if useDaemon && c.estargz {
+		cmd.DefaultLogger.Warn("Ignoring -estargz, not supported with -daemon")
+		c.estargz = false
+	}
+	if c.prefetchProfile != "" && !c.estargz {
+		cmd.DefaultLogger.Warn("Ignoring -prefetch-profile, only intended for use with -estargz")
+		c.prefetchProfile = ""
+	}
+}
+
+func (c *compressionArgs) validate() error {
+	layerCompression, err := archive.ParseCompression(c.layerCompression)
+	if err != nil {
+		return errors.Wrap(err, "parsing layer compression")
+	}
+	if layerCompression == archive.CompressionNone {
+		return errors.New("layer compression must be one of: gzip, zstd")
+	}
+	if err := layerCompression.ValidateLevel(c.layerCompressionLevel); err != nil {
+		return err
+	}
+	if _, err := archive.ParseCompression(c.cacheCompression); err != nil {
+		return errors.Wrap(err, "parsing cache compression")
+	}
+	if c.estargz {
+		if runtime.GOOS == "windows" {
+			return errors.New("eStargz layers are not supported on Windows")
+		}
+		if layerCompression != archive.CompressionGzip {
+			return errors.New("eStargz layers must be compressed with gzip")
+		}
+	}
+	return nil
+}
+
+// compressedImage wraps a remote image so that its layers are compressed as configured.
+func (c *compressionArgs) compressedImage(img imgutil.Image, keychain authn.Keychain, baseImageRef, previousImageRef string) *image.CompressedImage {
+	compression := archive.Compression(c.layerCompression)
+	cmd.DefaultLogger.Debugf("Compressing layers with %s", compression)
+	return image.NewCompressedImage(img, image.CompressionOptions{
+		Compression:      compression,
+		Level:            c.layerCompressionLevel,
+		Keychain:         keychain,
+		Estargz:          c.estargz,
+		BaseImageRef:     baseImageRef,
+		PreviousImageRef: previousImageRef,
+	})
+}
+
+// estargzConverter returns the converter of the eStargz layers written by the exporter, or nil if eStargz is disabled.
+// The files listed by buildpacks in launch.toml are prefetched first, followed by the files in the prefetch profile.
+// Relative paths in the profile are resolved against the app dir.
+func (c *compressionArgs) estargzConverter(layersDir, appDir string) (*stargz.Converter, error) {
+	if !c.estargz {
+		return nil, nil
+	}
+	var buildMD lplatform.BuildMetadata
+	if _, err := toml.DecodeFile(launch.GetMetadataFilePath(layersDir), &buildMD); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "reading build metadata")
+	}
+	prefetch := buildMD.Prefetch
+	if c.prefetchProfile != "" {
+		profile, err := ioutil.ReadFile(c.prefetchProfile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading prefetch profile")
+		}
+		seen := map[string]bool{}
+		for _, path := range prefetch {
+			seen[path] = true
+		}
+		for _, line := range strings.Split(string(profile), "\n") {
+			path := strings.TrimSpace(line)
+			if path == "" || strings.HasPrefix(path, "#") {
+				continue
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(appDir, path)
+			}
+			if path = filepath.Clean(path); !seen[path] {
+				seen[path] = true
+				prefetch = append(prefetch, path)
+			}
+		}
+	}
+	return &stargz.Converter{Level: c.layerCompressionLevel, Prefetch: prefetch}, nil
+}
+
+// setCacheCompression configures the compression of the layers added to caches that support it.
+// Image cache layers are compressed like app image layers, while -cache-compression applies to cache directories.
+func (c *compressionArgs) setCacheCompression(cacheStore lifecycle.Cache) {
+	switch cacheStore := cacheStore.(type) {
+	case *cache.ImageCache:
+		cacheStore.SetLayerCompression(archive.Compression(c.layerCompression), c.layerCompressionLevel)
+	case *cache.VolumeCache:
+		compression, _ := archive.ParseCompression(c.cacheCompression)
+		cacheStore.SetLayerCompression(compression, 0)
+	}
+}
+
+// splitList splits a comma separated list, ignoring empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// newRemoteImage returns the image from the registry, retrying transient failures to read it according to retryPolicy.
+func newRemoteImage(retryPolicy *image.RetryPolicy, repoName string, keychain authn.Keychain, ops ...remote.ImageOption) (*remote.Image, error) {
+	var img *remote.Image
+	err := retryPolicy.Do(fmt.Sprintf("reading image '%s'", repoName), func() error {
+		var err error
+		img, err = remote.NewImage(repoName, keychain, ops...)
+		return err
+	})
+	return img, err
+}
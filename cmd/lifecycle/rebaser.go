@@ -30,7 +30,13 @@ type rebaseCmd struct {
 	useDaemon             bool
 	uid, gid              int
 
-	platform Platform
+	platform    Platform
+	retryPolicy *image.RetryPolicy
+
+	retryArgs
+
+	user priv.User
+	userArgs
 
 	// set if necessary before dropping privileges
 	docker   client.CommonAPIClient
@@ -44,6 +50,8 @@ func (r *rebaseCmd) DefineFlags() {
 	cmd.FlagRunImage(&r.runImageRef)
 	cmd.FlagUID(&r.uid)
 	cmd.FlagUseDaemon(&r.useDaemon)
+	r.retryArgs.defineFlags()
+	r.userArgs.defineFlags()
 
 	cmd.DeprecatedFlagRunImage(&r.deprecatedRunImageRef)
 }
@@ -54,7 +62,7 @@ func (r *rebaseCmd) Args(nargs int, args []string) error {
 		return cmd.FailErrCode(errors.New("at least one image argument is required"), cmd.CodeInvalidArgs, "parse arguments")
 	}
 	r.imageNames = args
-	if err := image.ValidateDestinationTags(r.useDaemon, r.imageNames...); err != nil {
+	if err := image.ValidateDestinationTags(r.imageNames...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
@@ -69,6 +77,14 @@ func (r *rebaseCmd) Args(nargs int, args []string) error {
 		r.reportPath = cmd.DefaultReportPath(r.platform.API().String(), "")
 	}
 
+	var err error
+	if r.retryPolicy, err = r.newRetryPolicy(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	if r.user, err = r.newUser(r.uid, r.gid); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse user")
+	}
+
 	if err := r.setAppImage(); err != nil {
 		return cmd.FailErrCode(errors.New(err.Error()), r.platform.CodeFor(platform.RebaseError), "set app image")
 	}
@@ -90,7 +106,7 @@ func (r *rebaseCmd) Privileges() error {
 			return cmd.FailErr(err, "initialize docker client")
 		}
 	}
-	if err := priv.RunAs(r.uid, r.gid); err != nil {
+	if err := priv.RunAs(r.user); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", r.uid, r.gid))
 	}
 	return nil
@@ -106,7 +122,8 @@ func (r *rebaseCmd) Exec() error {
 			local.FromBaseImage(r.runImageRef),
 		)
 	} else {
-		newBaseImage, err = remote.NewImage(
+		newBaseImage, err = newRemoteImage(
+			r.retryPolicy,
 			r.runImageRef,
 			r.keychain,
 			remote.FromBaseImage(r.runImageRef),
@@ -119,9 +136,16 @@ func (r *rebaseCmd) Exec() error {
 	rebaser := &lifecycle.Rebaser{
 		Logger:      cmd.DefaultLogger,
 		PlatformAPI: r.platform.API(),
+		RetryPolicy: r.retryPolicy,
 	}
 	report, err := rebaser.Rebase(r.appImage, newBaseImage, r.imageNames[1:])
 	if err != nil {
+		if _, isSaveErr := err.(imgutil.SaveError); isSaveErr {
+			// record the tags that were saved and the failures for each registry
+			if writeErr := encoding.WriteTOML(r.reportPath, &report); writeErr != nil {
+				cmd.DefaultLogger.Warnf("Failed to write rebase report: %v\n", writeErr)
+			}
+		}
 		return cmd.FailErrCode(err, r.platform.CodeFor(platform.RebaseError), "rebase")
 	}
 
@@ -158,7 +182,8 @@ func (r *rebaseCmd) setAppImage() error {
 		if err != nil {
 			return err
 		}
-		r.appImage, err = remote.NewImage(
+		r.appImage, err = newRemoteImage(
+			r.retryPolicy,
 			r.imageNames[0],
 			keychain,
 			remote.FromBaseImage(r.imageNames[0]),
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/internal/encoding"
+	"github.com/buildpacks/lifecycle/platform"
+	"github.com/buildpacks/lifecycle/priv"
+)
+
+// restoreLayerCmd is run by buildpacks during the build to restore layers that the restorer deferred
+// because the buildpack requested restore = "lazy", e.g. `/cnb/lifecycle/lifecycle restore-layer "$CNB_LAYERS_DIR/m2"`.
+type restoreLayerCmd struct {
+	// flags: inputs
+	cacheURL  string
+	layersDir string
+
+	layerPaths  []string
+	lazyLayers  platform.LazyLayersMetadata
+	platform    Platform
+	retryPolicy *image.RetryPolicy
+
+	retryArgs
+
+	// construct if necessary
+	keychain authn.Keychain
+}
+
+// DefineFlags defines the flags that are considered valid and reads their values (if provided).
+func (r *restoreLayerCmd) DefineFlags() {
+	cmd.FlagCacheURL(&r.cacheURL)
+	cmd.FlagLayersDir(&r.layersDir)
+	r.retryArgs.defineFlags()
+}
+
+// Args validates arguments and flags, and fills in default values.
+func (r *restoreLayerCmd) Args(nargs int, args []string) error {
+	if nargs == 0 {
+		return cmd.FailErrCode(errors.New("at least one layer directory is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	r.layerPaths = args
+
+	var err error
+	r.lazyLayers, err = platform.ReadLazyLayers(platform.LazyLayersPath(r.layersDir))
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read lazy layers")
+	}
+	if len(r.lazyLayers.Layers) == 0 {
+		return cmd.FailErrCode(errors.New("no layers were deferred by the restorer"), cmd.CodeInvalidArgs, "read lazy layers")
+	}
+	// the lazy layers file records the blob store without credentials, so the URL with credentials may be given again;
+	// it is not written back to the file
+	if r.cacheURL != "" {
+		if recorded := r.lazyLayers.CacheURL; cache.URLWithoutCredentials(r.cacheURL) != recorded {
+			return cmd.FailErrCode(fmt.Errorf("cache URL does not match '%s' used by the restorer", recorded), cmd.CodeInvalidArgs, "parse arguments")
+		}
+	} else {
+		r.cacheURL = r.lazyLayers.CacheURL
+	}
+
+	if r.retryPolicy, err = r.newRetryPolicy(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	return nil
+}
+
+func (r *restoreLayerCmd) Privileges() error {
+	// layers are restored as the build user
+	if priv.IsPrivileged() {
+		return cmd.FailErr(errors.New("refusing to run as root"), "restore layer")
+	}
+
+	var err error
+	r.keychain, err = auth.DefaultKeychain(appendNotEmpty(nil, r.lazyLayers.CacheImage)...)
+	if err != nil {
+		return cmd.FailErr(err, "resolve keychain")
+	}
+	return nil
+}
+
+func (r *restoreLayerCmd) Exec() error {
+	cacheStore, err := initCache(r.lazyLayers.CacheImage, r.lazyLayers.CacheDir, r.cacheURL, r.keychain, r.retryPolicy)
+	if err != nil {
+		return err
+	}
+
+	restorer := &lifecycle.Restorer{
+		LayersDir: r.layersDir,
+		Logger:    cmd.DefaultLogger,
+		Platform:  r.platform,
+	}
+	restoreErr := restorer.RestoreLazyLayers(cacheStore, &r.lazyLayers, r.layerPaths...)
+
+	// record the layers that were restored, even if restoring a later layer failed
+	if err := encoding.WriteTOML(platform.LazyLayersPath(r.layersDir), &r.lazyLayers); err != nil {
+		return cmd.FailErrCode(err, r.platform.CodeFor(platform.RestoreError), "write lazy layers")
+	}
+	if restoreErr != nil {
+		return cmd.FailErrCode(restoreErr, r.platform.CodeFor(platform.RestoreError), "restore layer")
+	}
+	return nil
+}
@@ -5,12 +5,19 @@ import (
 	"fmt"
 
 	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/local"
+	"github.com/buildpacks/imgutil/remote"
+	"github.com/docker/docker/client"
 	"github.com/google/go-containerregistry/pkg/authn"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/auth"
 	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/internal/encoding"
 	"github.com/buildpacks/lifecycle/internal/layer"
 	"github.com/buildpacks/lifecycle/platform"
 	"github.com/buildpacks/lifecycle/priv"
@@ -18,21 +25,33 @@ import (
 
 type restoreCmd struct {
 	// flags: inputs
-	analyzedPath  string
-	cacheDir      string
-	cacheImageTag string
-	groupPath     string
-	uid, gid      int
+	analyzedPath string
+	groupPath    string
+	uid, gid     int
+
+	analyzedMD platform.AnalyzedMetadata
 
 	restoreArgs
+	retryArgs
+
+	user priv.User
+	userArgs
 }
 
 type restoreArgs struct {
-	layersDir  string
-	platform   Platform
-	skipLayers bool
+	cacheDir       string
+	cacheImageTag  string
+	cacheURL       string
+	launchCacheDir string
+	layersDir      string
+	platform       Platform
+	skipLayers     bool
+	useDaemon      bool
+
+	retryPolicy *image.RetryPolicy
 
 	// construct if necessary before dropping privileges
+	docker   client.CommonAPIClient
 	keychain authn.Keychain
 }
 
@@ -40,13 +59,20 @@ type restoreArgs struct {
 func (r *restoreCmd) DefineFlags() {
 	cmd.FlagCacheDir(&r.cacheDir)
 	cmd.FlagCacheImage(&r.cacheImageTag)
+	cmd.FlagCacheURL(&r.cacheURL)
 	cmd.FlagGroupPath(&r.groupPath)
 	cmd.FlagLayersDir(&r.layersDir)
 	cmd.FlagUID(&r.uid)
 	cmd.FlagGID(&r.gid)
+	r.retryArgs.defineFlags()
+	r.userArgs.defineFlags()
 	if r.restoresLayerMetadata() {
 		cmd.FlagAnalyzedPath(&r.analyzedPath)
 		cmd.FlagSkipLayers(&r.skipLayers)
+		cmd.FlagUseDaemon(&r.useDaemon)
+	}
+	if r.platform.API().AtLeast("0.9") {
+		cmd.FlagLaunchCacheDir(&r.launchCacheDir)
 	}
 }
 
@@ -55,7 +81,7 @@ func (r *restoreCmd) Args(nargs int, args []string) error {
 	if nargs > 0 {
 		return cmd.FailErrCode(errors.New("received unexpected Args"), cmd.CodeInvalidArgs, "parse arguments")
 	}
-	if r.cacheImageTag == "" && r.cacheDir == "" {
+	if r.cacheImageTag == "" && r.cacheDir == "" && r.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Not restoring cached layer data, no cache flag specified.")
 	}
 
@@ -67,6 +93,26 @@ func (r *restoreCmd) Args(nargs int, args []string) error {
 		r.analyzedPath = cmd.DefaultAnalyzedPath(r.platform.API().String(), r.layersDir)
 	}
 
+	if r.restoresLayerMetadata() {
+		// the previous image is read to restore layers that are missing from the cache
+		if _, err := toml.DecodeFile(r.analyzedPath, &r.analyzedMD); err != nil {
+			r.analyzedMD = platform.AnalyzedMetadata{}
+		}
+	}
+
+	if r.launchCacheDir != "" && !r.useDaemon {
+		cmd.DefaultLogger.Warn("Ignoring -launch-cache, only intended for use with -daemon")
+		r.launchCacheDir = ""
+	}
+
+	var err error
+	if r.retryPolicy, err = r.newRetryPolicy(); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse retry policy")
+	}
+	if r.user, err = r.newUser(r.uid, r.gid); err != nil {
+		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse user")
+	}
+
 	return nil
 }
 
@@ -77,10 +123,16 @@ func (r *restoreCmd) Privileges() error {
 		return cmd.FailErr(err, "resolve keychain")
 	}
 
+	if r.useDaemon {
+		r.docker, err = priv.DockerClient()
+		if err != nil {
+			return cmd.FailErr(err, "initialize docker client")
+		}
+	}
 	if err := priv.EnsureOwner(r.uid, r.gid, r.layersDir, r.cacheDir); err != nil {
 		return cmd.FailErr(err, "chown volumes")
 	}
-	if err := priv.RunAs(r.uid, r.gid); err != nil {
+	if err := priv.RunAs(r.user); err != nil {
 		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", r.uid, r.gid))
 	}
 	return nil
@@ -94,49 +146,90 @@ func (r *restoreCmd) Exec() error {
 	if err := verifyBuildpackApis(group); err != nil {
 		return err
 	}
-	cacheStore, err := initCache(r.cacheImageTag, r.cacheDir, r.keychain)
+	cacheStore, err := initCache(r.cacheImageTag, r.cacheDir, r.cacheURL, r.keychain, r.retryPolicy)
 	if err != nil {
 		return err
 	}
 
-	var appMeta platform.LayersMetadata
-	if r.restoresLayerMetadata() {
-		var analyzedMd platform.AnalyzedMetadata
-		if _, err := toml.DecodeFile(r.analyzedPath, &analyzedMd); err == nil {
-			appMeta = analyzedMd.Metadata
-		}
-	}
-
-	return r.restore(appMeta, group, cacheStore)
+	err = r.restore(r.analyzedMD, group, cacheStore)
+	reportRetries(r.retryPolicy)
+	return err
 }
 
 func (r *restoreCmd) registryImages() []string {
-	if r.cacheImageTag != "" {
-		return []string{r.cacheImageTag}
+	var registryImages []string
+	registryImages = appendNotEmpty(registryImages, r.cacheImageTag)
+	if !r.useDaemon && r.analyzedMD.PreviousImage != nil {
+		registryImages = appendNotEmpty(registryImages, r.analyzedMD.PreviousImage.Reference)
 	}
-	return []string{}
+	return registryImages
 }
 
-func (r restoreArgs) restore(layerMetadata platform.LayersMetadata, group buildpack.Group, cacheStore lifecycle.Cache) error {
+func (r restoreArgs) restore(analyzedMD platform.AnalyzedMetadata, group buildpack.Group, cacheStore lifecycle.Cache) error {
+	previousImage, err := r.previousImage(analyzedMD)
+	if err != nil {
+		return err
+	}
+
+	lazyLayers := &platform.LazyLayersMetadata{CacheDir: r.cacheDir, CacheImage: r.cacheImageTag, CacheURL: cache.URLWithoutCredentials(r.cacheURL)}
 	restorer := &lifecycle.Restorer{
 		LayersDir:             r.layersDir,
 		Buildpacks:            group.Group,
 		Logger:                cmd.DefaultLogger,
 		Platform:              r.platform,
 		LayerMetadataRestorer: layer.NewMetadataRestorer(cmd.DefaultLogger, r.layersDir, r.skipLayers),
-		LayersMetadata:        layerMetadata,
+		LayersMetadata:        analyzedMD.Metadata,
+		PreviousImage:         previousImage,
 		SBOMRestorer: layer.NewSBOMRestorer(layer.SBOMRestorerOpts{
 			LayersDir: r.layersDir,
 			Logger:    cmd.DefaultLogger,
 		}, r.platform.API()),
+		LazyLayers: lazyLayers,
 	}
 
 	if err := restorer.Restore(cacheStore); err != nil {
 		return cmd.FailErrCode(err, r.platform.CodeFor(platform.RestoreError), "restore")
 	}
+	if len(lazyLayers.Layers) > 0 {
+		if err := encoding.WriteTOML(platform.LazyLayersPath(r.layersDir), lazyLayers); err != nil {
+			return cmd.FailErrCode(err, r.platform.CodeFor(platform.RestoreError), "write lazy layers")
+		}
+	}
 	return nil
 }
 
+// previousImage returns the previous image from analyzed.toml, which provides the data for launch=true, cache=true layers
+// that are missing from the cache. It returns nil if there is no previous image or it can't be read.
+func (r restoreArgs) previousImage(analyzedMD platform.AnalyzedMetadata) (imgutil.Image, error) {
+	if !r.restoresLayerMetadata() || r.skipLayers || analyzedMD.PreviousImage == nil || analyzedMD.PreviousImage.Reference == "" {
+		return nil, nil
+	}
+	ref := analyzedMD.PreviousImage.Reference
+
+	var (
+		previousImage imgutil.Image
+		err           error
+	)
+	if r.useDaemon {
+		previousImage, err = local.NewImage(ref, r.docker, local.FromBaseImage(ref))
+	} else {
+		previousImage, err = newRemoteImage(r.retryPolicy, ref, r.keychain, remote.FromBaseImage(ref))
+	}
+	if err != nil {
+		// the cache can still be used
+		cmd.DefaultLogger.Warnf("Not restoring layers from previous image '%s': %s", ref, err)
+		return nil, nil
+	}
+	if r.launchCacheDir != "" {
+		volumeCache, err := cache.NewVolumeCache(r.launchCacheDir)
+		if err != nil {
+			return nil, cmd.FailErr(err, "create launch cache")
+		}
+		previousImage = cache.NewCachingImage(previousImage, volumeCache)
+	}
+	return previousImage, nil
+}
+
 func (r *restoreArgs) restoresLayerMetadata() bool {
 	return r.platform.API().AtLeast("0.7")
 }
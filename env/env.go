@@ -16,6 +16,8 @@ type Env struct {
 	// RootDirMap maps directories in a posix root filesystem to a slice of environment variables that
 	RootDirMap map[string][]string
 	Vars       *Vars
+	// Provenance, when non-nil, records the modifications made by AddRootDir and AddEnvDir.
+	Provenance *Provenance
 }
 
 // AddRootDir modifies the environment given a root dir. If the root dir contains a directory that matches a key in
@@ -35,6 +37,7 @@ func (p *Env) AddRootDir(dir string) error {
 		}
 		for _, key := range vars {
 			p.Vars.Set(key, childDir+prefix(p.Vars.Get(key), os.PathListSeparator))
+			p.Provenance.Record(key, ActionTypePrepend, childDir, childDir)
 		}
 	}
 	return nil
@@ -97,7 +100,10 @@ func (p *Env) AddEnvDir(envDir string, defaultAction ActionType) error {
 			p.Vars.Set(name, v)
 		case ActionTypePrependPath:
 			p.Vars.Set(name, v+prefix(p.Vars.Get(name), delim(envDir, name, os.PathListSeparator)...))
+		default:
+			return nil
 		}
+		p.Provenance.Record(name, action, v, filepath.Join(envDir, k))
 		return nil
 	}); err != nil {
 		return errors.Wrapf(err, "apply env files from dir '%s'", envDir)
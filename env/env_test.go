@@ -151,6 +151,41 @@ func testEnv(t *testing.T, when spec.G, it spec.S) {
 					t.Fatalf("Unexpected env:\n%s\n", s)
 				}
 			})
+
+			it("records the provenance of each modification", func() {
+				envv.Provenance = &env.Provenance{}
+				envv.Vars = env.NewVars(map[string]string{
+					"VAR_DEFAULT": "value-default-orig",
+				}, false)
+				if err := envv.AddEnvDir(tmpDir, ""); err != nil {
+					t.Fatalf("Error: %s\n", err)
+				}
+
+				if s := cmp.Diff(envv.Provenance.For("VAR_APPEND_DELIM"), []env.Modification{{
+					Name:   "VAR_APPEND_DELIM",
+					Action: env.ActionTypeAppend,
+					Value:  "value-append-delim",
+					Source: filepath.Join(tmpDir, "VAR_APPEND_DELIM.append"),
+				}}); s != "" {
+					t.Fatalf("Unexpected provenance:\n%s\n", s)
+				}
+				if s := cmp.Diff(envv.Provenance.For("VAR_DEFAULT_NEW"), []env.Modification{{
+					Name:   "VAR_DEFAULT_NEW",
+					Action: env.ActionTypeDefault,
+					Value:  "value-default",
+					Source: filepath.Join(tmpDir, "VAR_DEFAULT_NEW.default"),
+				}}); s != "" {
+					t.Fatalf("Unexpected provenance:\n%s\n", s)
+				}
+
+				// defaults that do not change the env and ignored files are not recorded
+				if m := envv.Provenance.For("VAR_DEFAULT"); len(m) != 0 {
+					t.Fatalf("Unexpected provenance: %+v", m)
+				}
+				if m := envv.Provenance.For("VAR_IGNORE"); len(m) != 0 {
+					t.Fatalf("Unexpected provenance: %+v", m)
+				}
+			})
 		})
 
 		when("env files have no suffix", func() {
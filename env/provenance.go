@@ -0,0 +1,41 @@
+package env
+
+// Modification describes a change made to an environment variable.
+type Modification struct {
+	Name   string
+	Action ActionType
+	Value  string
+	Source string // Source is the env file, layer directory or exec.d executable that made the change
+}
+
+// Provenance records the modifications made to an Env, in the order they were made.
+type Provenance struct {
+	Modifications []Modification
+}
+
+// Record adds a modification. It is safe to call on a nil Provenance.
+func (p *Provenance) Record(name string, action ActionType, value, source string) {
+	if p == nil {
+		return
+	}
+	p.Modifications = append(p.Modifications, Modification{
+		Name:   name,
+		Action: action,
+		Value:  value,
+		Source: source,
+	})
+}
+
+// For returns the modifications made to the variable with the given name.
+func (p *Provenance) For(name string) []Modification {
+	if p == nil {
+		return nil
+	}
+	var out []Modification
+	for _, m := range p.Modifications {
+		if matches(name, m.Name) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -6,7 +6,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
@@ -15,6 +17,7 @@ import (
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/buildpack"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
@@ -36,14 +39,18 @@ type Exporter struct {
 	LayerFactory LayerFactory
 	Logger       Logger
 	PlatformAPI  *api.Version
+	RetryPolicy  *image.RetryPolicy // RetryPolicy, when non-nil, is used to retry saving the image
 }
 
 //go:generate mockgen -package testmock -destination testmock/layer_factory.go github.com/buildpacks/lifecycle LayerFactory
 type LayerFactory interface {
 	DirLayer(id string, dir string) (layers.Layer, error)
+	FingerprintedDirLayer(id string, dir string) (layers.Layer, error)
+	FingerprintSettings() string
 	LauncherLayer(path string) (layers.Layer, error)
 	ProcessTypesLayer(metadata launch.Metadata) (layers.Layer, error)
 	SliceLayers(dir string, slices []layers.Slice) ([]layers.Layer, error)
+	UnchangedDirLayer(id string, dir string) (layers.Layer, bool)
 }
 
 type LauncherConfig struct {
@@ -62,6 +69,28 @@ type ExportOptions struct {
 	Stack              platform.StackMetadata
 	Project            platform.ProjectMetadata
 	DefaultProcessType string
+	SourceDateEpoch    time.Time            // SourceDateEpoch, when non-zero, is used as the image creation time
+	VerifyReproducible bool                 // VerifyReproducible compares buildpack layer digests against OrigMetadata
+	SizePolicy         *platform.SizePolicy // SizePolicy, when non-nil, limits the compressed size of the exported layers
+	Labels             map[string]string    // Labels are provided by the platform and override buildpack-provided labels
+	Annotations        map[string]string    // Annotations are added to the manifest of the image
+	ProtectLabels      bool                 // ProtectLabels prevents buildpacks and the platform from setting io.buildpacks.* labels
+}
+
+// maxLayerGrowth is the number of layers that grew the most since the previous image to list in the size report.
+const maxLayerGrowth = 5
+
+// SizeBudgetError is returned by Export when the layers exceed a budget of a size policy whose action is fail.
+type SizeBudgetError struct {
+	Violations []platform.SizeViolation
+}
+
+func (e *SizeBudgetError) Error() string {
+	var msgs []string
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+	return fmt.Sprintf("image size budget exceeded: %s", strings.Join(msgs, "; "))
 }
 
 func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
@@ -91,8 +120,13 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		return platform.ExportReport{}, errors.Wrap(err, "read build metadata")
 	}
 
+	var reproducibility *platform.ReproducibilityReport
+	if opts.VerifyReproducible {
+		reproducibility = &platform.ReproducibilityReport{}
+	}
+
 	// buildpack-provided layers
-	if err := e.addBuildpackLayers(opts, &meta); err != nil {
+	if err := e.addBuildpackLayers(opts, &meta, reproducibility); err != nil {
 		return platform.ExportReport{}, err
 	}
 
@@ -112,10 +146,17 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		return platform.ExportReport{}, err
 	}
 
+	// the sizes are recorded in the layers metadata label
+	compressed := e.setCompressedSizes(opts, &meta)
+
 	if err := e.setLabels(opts, meta, buildMD); err != nil {
 		return platform.ExportReport{}, err
 	}
 
+	if err := e.setAnnotations(opts); err != nil {
+		return platform.ExportReport{}, err
+	}
+
 	if err := e.setEnv(opts, buildMD.ToLaunchMD()); err != nil {
 		return platform.ExportReport{}, err
 	}
@@ -127,6 +168,10 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		}
 	}
 
+	if err := e.setImageConfig(opts, buildMD); err != nil {
+		return platform.ExportReport{}, err
+	}
+
 	entrypoint, err := e.entrypoint(buildMD.ToLaunchMD(), opts.DefaultProcessType, buildMD.BuildpackDefaultProcessType)
 	if err != nil {
 		return platform.ExportReport{}, errors.Wrap(err, "determining entrypoint")
@@ -140,24 +185,39 @@ func (e *Exporter) Export(opts ExportOptions) (platform.ExportReport, error) {
 		return platform.ExportReport{}, errors.Wrap(err, "setting cmd")
 	}
 
-	report := platform.ExportReport{}
+	if !opts.SourceDateEpoch.IsZero() {
+		if err := e.setCreatedAt(opts); err != nil {
+			return platform.ExportReport{}, err
+		}
+	}
+
+	sizes := e.sizeReport(opts, meta, compressed)
+	report := platform.ExportReport{Reproducibility: reproducibility, Sizes: &sizes}
 	report.Build, err = e.makeBuildReport(opts.LayersDir)
 	if err != nil {
 		return platform.ExportReport{}, err
 	}
-	report.Image, err = saveImage(opts.WorkingImage, opts.AdditionalNames, e.Logger)
+	if len(sizes.Violations) > 0 && opts.SizePolicy.Action == platform.SizePolicyFail {
+		// return the report so the sizes can be recorded
+		return report, &SizeBudgetError{Violations: sizes.Violations}
+	}
+	report.Image, err = saveImage(opts.WorkingImage, opts.AdditionalNames, e.RetryPolicy, e.Logger)
 	if err != nil {
-		return platform.ExportReport{}, err
+		if _, isSaveErr := err.(imgutil.SaveError); !isSaveErr {
+			return platform.ExportReport{}, err
+		}
+		// the image was saved to some of the tags; return the report so the failures can be recorded
 	}
+	report.Retries = e.RetryPolicy.Retries()
 	if !e.supportsManifestSize() {
 		// unset manifest size in report.toml for old platform API versions
 		report.Image.ManifestSize = 0
 	}
 
-	return report, nil
+	return report, err
 }
 
-func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersMetadata) error {
+func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersMetadata, reproducibility *platform.ReproducibilityReport) error {
 	for _, bp := range e.Buildpacks {
 		bpDir, err := buildpack.ReadLayersDir(opts.LayersDir, bp, e.Logger)
 		e.Logger.Debugf("Processing buildpack directory: %s", bpDir.Path)
@@ -179,15 +239,32 @@ func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersM
 			}
 
 			if fsLayer.HasLocalContents() {
-				layer, err := e.LayerFactory.DirLayer(fsLayer.Identifier(), fsLayer.Path())
+				origLayerMetadata := opts.OrigMetadata.MetadataForBuildpack(bp.ID).Layers[fsLayer.Name()]
+				// layers are always hashed when verifying reproducibility
+				if unchanged, ok := e.LayerFactory.UnchangedDirLayer(fsLayer.Identifier(), fsLayer.Path()); ok && reproducibility == nil && unchanged.Digest == origLayerMetadata.SHA {
+					e.Logger.Infof("Reusing unchanged layer '%s'\n", fsLayer.Identifier())
+					e.Logger.Debugf("Layer '%s' SHA: %s\n", fsLayer.Identifier(), unchanged.Digest)
+					if err := opts.WorkingImage.ReuseLayer(unchanged.Digest); err != nil {
+						return errors.Wrapf(err, "reusing layer: '%s'", fsLayer.Identifier())
+					}
+					addHistory(opts.WorkingImage, unchanged.Digest, layerCreatedBy(bp, fsLayer.Name()))
+					lmd.SHA = unchanged.Digest
+					lmd.LayerSize = origLayerMetadata.LayerSize
+					bpMD.Layers[fsLayer.Name()] = lmd
+					continue
+				}
+				layer, err := e.LayerFactory.FingerprintedDirLayer(fsLayer.Identifier(), fsLayer.Path())
 				if err != nil {
 					return errors.Wrapf(err, "creating layer")
 				}
-				origLayerMetadata := opts.OrigMetadata.MetadataForBuildpack(bp.ID).Layers[fsLayer.Name()]
-				lmd.SHA, err = e.addOrReuseLayer(opts.WorkingImage, layer, origLayerMetadata.SHA)
+				layer, err = e.addOrReuseLayer(opts.WorkingImage, layer, origLayerMetadata.SHA, layerCreatedBy(bp, fsLayer.Name()))
 				if err != nil {
 					return err
 				}
+				lmd.SHA, lmd.LayerSize = layer.Digest, layer.LayerSize
+				if reproducibility != nil && origLayerMetadata.SHA != "" {
+					e.verifyReproducible(reproducibility, bp, fsLayer.Name(), lmd.SHA, origLayerMetadata.SHA)
+				}
 			} else {
 				if lmd.Cache {
 					return fmt.Errorf("layer '%s' is cache=true but has no contents", fsLayer.Identifier())
@@ -202,7 +279,9 @@ func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *platform.LayersM
 				if err := opts.WorkingImage.ReuseLayer(origLayerMetadata.SHA); err != nil {
 					return errors.Wrapf(err, "reusing layer: '%s'", fsLayer.Identifier())
 				}
+				addHistory(opts.WorkingImage, origLayerMetadata.SHA, layerCreatedBy(bp, fsLayer.Name()))
 				lmd.SHA = origLayerMetadata.SHA
+				lmd.LayerSize = origLayerMetadata.LayerSize
 			}
 			bpMD.Layers[fsLayer.Name()] = lmd
 		}
@@ -224,18 +303,20 @@ func (e *Exporter) addLauncherLayers(opts ExportOptions, buildMD *platform.Build
 	if err != nil {
 		return errors.Wrap(err, "creating launcher layers")
 	}
-	meta.Launcher.SHA, err = e.addOrReuseLayer(opts.WorkingImage, launcherLayer, opts.OrigMetadata.Launcher.SHA)
+	launcherLayer, err = e.addOrReuseLayer(opts.WorkingImage, launcherLayer, opts.OrigMetadata.Launcher.SHA, historyLauncher)
 	if err != nil {
 		return errors.Wrap(err, "exporting launcher configLayer")
 	}
+	meta.Launcher = layerMetadata(launcherLayer)
 	configLayer, err := e.LayerFactory.DirLayer("config", filepath.Join(opts.LayersDir, "config"))
 	if err != nil {
 		return errors.Wrapf(err, "creating layer '%s'", configLayer.ID)
 	}
-	meta.Config.SHA, err = e.addOrReuseLayer(opts.WorkingImage, configLayer, opts.OrigMetadata.Config.SHA)
+	configLayer, err = e.addOrReuseLayer(opts.WorkingImage, configLayer, opts.OrigMetadata.Config.SHA, historyConfig)
 	if err != nil {
 		return errors.Wrap(err, "exporting config layer")
 	}
+	meta.Config = layerMetadata(configLayer)
 
 	if err := e.launcherConfig(opts, buildMD, meta); err != nil {
 		return err
@@ -251,7 +332,7 @@ func (e *Exporter) addAppLayers(opts ExportOptions, slices []layers.Slice, meta
 	}
 
 	var numberOfReusedLayers int
-	for _, slice := range sliceLayers {
+	for i, slice := range sliceLayers {
 		var err error
 
 		found := false
@@ -270,8 +351,9 @@ func (e *Exporter) addAppLayers(opts ExportOptions, slices []layers.Slice, meta
 		if err != nil {
 			return err
 		}
+		addHistory(opts.WorkingImage, slice.Digest, fmt.Sprintf("Application slice %d", i+1))
 		e.Logger.Debugf("Layer '%s' SHA: %s\n", slice.ID, slice.Digest)
-		meta.App = append(meta.App, platform.LayerMetadata{SHA: slice.Digest})
+		meta.App = append(meta.App, layerMetadata(slice))
 	}
 
 	delta := len(sliceLayers) - numberOfReusedLayers
@@ -317,14 +399,63 @@ func (e *Exporter) setLabels(opts ExportOptions, meta platform.LayersMetadata, b
 	}
 
 	for _, label := range buildMD.Labels {
+		if _, ok := opts.Labels[label.Key]; ok {
+			e.Logger.Debugf("Platform-provided label '%s' overrides buildpack-provided label", label.Key)
+			continue
+		}
+		if !e.labelAllowed(opts, label.Key) {
+			continue
+		}
 		e.Logger.Infof("Adding label '%s'", label.Key)
 		if err := opts.WorkingImage.SetLabel(label.Key, label.Value); err != nil {
 			return errors.Wrapf(err, "set buildpack-provided label '%s'", label.Key)
 		}
 	}
+
+	for _, key := range sortedKeys(opts.Labels) {
+		if !e.labelAllowed(opts, key) {
+			continue
+		}
+		e.Logger.Infof("Adding label '%s'", key)
+		if err := opts.WorkingImage.SetLabel(key, opts.Labels[key]); err != nil {
+			return errors.Wrapf(err, "set platform-provided label '%s'", key)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) labelAllowed(opts ExportOptions, key string) bool {
+	if opts.ProtectLabels && strings.HasPrefix(key, platform.ReservedLabelPrefix) {
+		e.Logger.Warnf("Skipping label '%s', labels prefixed with '%s' are reserved", key, platform.ReservedLabelPrefix)
+		return false
+	}
+	return true
+}
+
+func (e *Exporter) setAnnotations(opts ExportOptions) error {
+	if len(opts.Annotations) == 0 {
+		return nil
+	}
+	configurable, ok := e.configurableImage(opts, "annotations")
+	if !ok {
+		return nil
+	}
+	for _, key := range sortedKeys(opts.Annotations) {
+		e.Logger.Infof("Adding annotation '%s'", key)
+		configurable.SetAnnotation(key, opts.Annotations[key])
+	}
 	return nil
 }
 
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (e *Exporter) setEnv(opts ExportOptions, launchMD launch.Metadata) error {
 	e.Logger.Debugf("Setting %s=%s", cmd.EnvLayersDir, opts.LayersDir)
 	if err := opts.WorkingImage.SetEnv(cmd.EnvLayersDir, opts.LayersDir); err != nil {
@@ -368,6 +499,67 @@ func (e *Exporter) setEnv(opts ExportOptions, launchMD launch.Metadata) error {
 	return nil
 }
 
+func (e *Exporter) verifyReproducible(report *platform.ReproducibilityReport, bp buildpack.GroupBuildpack, layerName, sha, previousSHA string) {
+	report.Compared++
+	if sha == previousSHA {
+		return
+	}
+	e.Logger.Warnf("Layer '%s:%s' is not reproducible: SHA %s does not match previous SHA %s", bp.ID, layerName, sha, previousSHA)
+	report.NonReproducible = append(report.NonReproducible, platform.NonReproducibleLayer{
+		Buildpack:   bp.ID,
+		Layer:       layerName,
+		SHA:         sha,
+		PreviousSHA: previousSHA,
+	})
+}
+
+func (e *Exporter) setCreatedAt(opts ExportOptions) error {
+	configurable, ok := e.configurableImage(opts, "created time")
+	if !ok {
+		return nil
+	}
+	e.Logger.Debugf("Setting created time: '%s'", opts.SourceDateEpoch.UTC().Format(time.RFC3339))
+	configurable.SetCreatedAt(opts.SourceDateEpoch)
+	return nil
+}
+
+// configurableImage returns the working image if its config can be written, and otherwise warns that what is not set.
+func (e *Exporter) configurableImage(opts ExportOptions, what string) (*image.ConfigurableImage, bool) {
+	configurable, ok := opts.WorkingImage.(*image.ConfigurableImage)
+	if !ok {
+		e.Logger.Warnf("Skipping %s, the image config is not writable", what)
+	}
+	return configurable, ok
+}
+
+// setImageConfig applies the ports, volumes, stop signal and user provided by buildpacks
+func (e *Exporter) setImageConfig(opts ExportOptions, buildMD *platform.BuildMetadata) error {
+	if len(buildMD.Ports) == 0 && len(buildMD.Volumes) == 0 && buildMD.StopSignal == "" && buildMD.User == "" {
+		return nil
+	}
+	configurable, ok := e.configurableImage(opts, "buildpack-provided image config")
+	if !ok {
+		return nil
+	}
+	for _, port := range buildMD.Ports {
+		e.Logger.Infof("Exposing port '%s'", port)
+		configurable.AddExposedPort(port.String())
+	}
+	for _, volume := range buildMD.Volumes {
+		e.Logger.Infof("Adding volume '%s'", volume.Path)
+		configurable.AddVolume(volume.Path)
+	}
+	if buildMD.StopSignal != "" {
+		e.Logger.Infof("Setting stop signal '%s'", buildMD.StopSignal)
+		configurable.SetStopSignal(buildMD.StopSignal)
+	}
+	if buildMD.User != "" {
+		e.Logger.Infof("Setting user '%s'", buildMD.User)
+		configurable.SetUser(buildMD.User)
+	}
+	return nil
+}
+
 func (e *Exporter) setWorkingDir(opts ExportOptions) error {
 	return opts.WorkingImage.SetWorkingDir(opts.AppDir)
 }
@@ -414,10 +606,11 @@ func (e *Exporter) launcherConfig(opts ExportOptions, buildMD *platform.BuildMet
 			if err != nil {
 				return errors.Wrapf(err, "creating layer '%s'", processTypesLayer.ID)
 			}
-			meta.ProcessTypes.SHA, err = e.addOrReuseLayer(opts.WorkingImage, processTypesLayer, opts.OrigMetadata.ProcessTypes.SHA)
+			processTypesLayer, err = e.addOrReuseLayer(opts.WorkingImage, processTypesLayer, opts.OrigMetadata.ProcessTypes.SHA, historyProcessTypes)
 			if err != nil {
 				return errors.Wrapf(err, "exporting layer '%s'", processTypesLayer.ID)
 			}
+			meta.ProcessTypes = layerMetadata(processTypesLayer)
 		}
 	}
 	return nil
@@ -443,19 +636,177 @@ func processTypeWarning(launchMD launch.Metadata, defaultProcessType string) str
 	return fmt.Sprintf("default process type '%s' not present in list %+v", defaultProcessType, typeList)
 }
 
-func (e *Exporter) addOrReuseLayer(image imgutil.Image, layer layers.Layer, previousSHA string) (string, error) {
+func (e *Exporter) addOrReuseLayer(img imgutil.Image, layer layers.Layer, previousSHA, createdBy string) (layers.Layer, error) {
 	layer, err := e.LayerFactory.DirLayer(layer.ID, layer.TarPath)
 	if err != nil {
-		return "", errors.Wrapf(err, "creating layer '%s'", layer.ID)
+		return layers.Layer{}, errors.Wrapf(err, "creating layer '%s'", layer.ID)
 	}
 	if layer.Digest == previousSHA {
 		e.Logger.Infof("Reusing layer '%s'\n", layer.ID)
 		e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-		return layer.Digest, image.ReuseLayer(previousSHA)
+		err = img.ReuseLayer(previousSHA)
+	} else {
+		e.Logger.Infof("Adding layer '%s'\n", layer.ID)
+		e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
+		err = img.AddLayerWithDiffID(layer.TarPath, layer.Digest)
+	}
+	if err != nil {
+		return layer, err
+	}
+	addHistory(img, layer.Digest, createdBy)
+	return layer, nil
+}
+
+func layerMetadata(layer layers.Layer) platform.LayerMetadata {
+	return platform.LayerMetadata{SHA: layer.Digest, LayerSize: layer.LayerSize}
+}
+
+// compressedSizer is implemented by images that compress the layers added to them, like image.CompressedImage.
+type compressedSizer interface {
+	CompressedLayerSize(diffID string) (int64, bool)
+}
+
+// setCompressedSizes records the compressed size of each exported layer as it is written to the working image.
+// Reused layers keep the compressed size recorded in the previous image.
+// It returns false if the working image does not compress its layers, like an image exported to the daemon,
+// in which case no compressed sizes are recorded.
+func (e *Exporter) setCompressedSizes(opts ExportOptions, meta *platform.LayersMetadata) bool {
+	img := opts.WorkingImage
+	if configurable, ok := img.(*image.ConfigurableImage); ok {
+		img = configurable.Image
+	}
+	sizer, ok := img.(compressedSizer)
+	previous := map[string]int64{}
+	forEachLayerSize(&opts.OrigMetadata, func(sha string, size *layers.LayerSize) {
+		previous[sha] = size.CompressedSize
+	})
+	forEachLayerSize(meta, func(sha string, size *layers.LayerSize) {
+		size.CompressedSize = 0
+		if !ok {
+			return
+		}
+		if compressedSize, added := sizer.CompressedLayerSize(sha); added {
+			size.CompressedSize = compressedSize
+		} else {
+			size.CompressedSize = previous[sha]
+		}
+	})
+	return ok
+}
+
+// forEachLayerSize calls fn with the SHA and the size of each layer in the layers metadata.
+func forEachLayerSize(meta *platform.LayersMetadata, fn func(sha string, size *layers.LayerSize)) {
+	for _, bpMD := range meta.Buildpacks {
+		for name, lmd := range bpMD.Layers {
+			if lmd.SHA == "" {
+				continue
+			}
+			fn(lmd.SHA, &lmd.LayerSize)
+			bpMD.Layers[name] = lmd
+		}
 	}
-	e.Logger.Infof("Adding layer '%s'\n", layer.ID)
-	e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-	return layer.Digest, image.AddLayerWithDiffID(layer.TarPath, layer.Digest)
+	for i := range meta.App {
+		fn(meta.App[i].SHA, &meta.App[i].LayerSize)
+	}
+	for _, lmd := range []*platform.LayerMetadata{&meta.Launcher, &meta.Config, &meta.ProcessTypes, meta.BOM} {
+		if lmd != nil && lmd.SHA != "" {
+			fn(lmd.SHA, &lmd.LayerSize)
+		}
+	}
+}
+
+func (e *Exporter) sizeReport(opts ExportOptions, meta platform.LayersMetadata, compressed bool) platform.SizeReport {
+	sizes := layerSizeReport(meta)
+	if !compressed {
+		e.Logger.Infof("Exported layers are %s uncompressed", platform.ByteSize(sizes.Size))
+		if opts.SizePolicy != nil {
+			e.Logger.Warn("Skipping image size budgets, the layers of the image are not compressed")
+		}
+		return sizes
+	}
+	sizes.SetGrowth(layerSizeReport(opts.OrigMetadata), maxLayerGrowth)
+	e.Logger.Infof("Exported layers are %s compressed (%s uncompressed)", platform.ByteSize(sizes.CompressedSize), platform.ByteSize(sizes.Size))
+	for _, growth := range sizes.Growth {
+		e.Logger.Infof("Layer '%s' grew from %s to %s compressed", growth.Layer, platform.ByteSize(growth.PreviousCompressedSize), platform.ByteSize(growth.CompressedSize))
+	}
+	if opts.SizePolicy != nil {
+		sizes.Violations = opts.SizePolicy.Check(sizes)
+		for _, violation := range sizes.Violations {
+			e.Logger.Warnf("Image size budget exceeded: %s", violation)
+		}
+	}
+	return sizes
+}
+
+// layerSizeReport groups the sizes recorded in the layers metadata by buildpack, app slices, launcher layers and SBOM layer.
+func layerSizeReport(meta platform.LayersMetadata) platform.SizeReport {
+	var report platform.SizeReport
+	for _, bpMD := range meta.Buildpacks {
+		group := platform.LayerGroupSize{Group: platform.LayerGroupBuildpack, Buildpack: bpMD.ID}
+		for name, lmd := range bpMD.Layers {
+			if lmd.SHA == "" {
+				continue
+			}
+			group.Layers = append(group.Layers, platform.NamedLayerSize{Name: name, SHA: lmd.SHA, LayerSize: lmd.LayerSize})
+		}
+		sort.Slice(group.Layers, func(i, j int) bool {
+			return group.Layers[i].Name < group.Layers[j].Name
+		})
+		addLayerGroup(&report, group)
+	}
+
+	app := platform.LayerGroupSize{Group: platform.LayerGroupApp}
+	for i, lmd := range meta.App {
+		app.Layers = append(app.Layers, platform.NamedLayerSize{Name: fmt.Sprintf("slice-%d", i+1), SHA: lmd.SHA, LayerSize: lmd.LayerSize})
+	}
+	addLayerGroup(&report, app)
+
+	launcher := platform.LayerGroupSize{Group: platform.LayerGroupLauncher}
+	for _, named := range []struct {
+		name string
+		lmd  platform.LayerMetadata
+	}{
+		{"launcher", meta.Launcher},
+		{"config", meta.Config},
+		{"process-types", meta.ProcessTypes},
+	} {
+		if named.lmd.SHA != "" {
+			launcher.Layers = append(launcher.Layers, platform.NamedLayerSize{Name: named.name, SHA: named.lmd.SHA, LayerSize: named.lmd.LayerSize})
+		}
+	}
+	addLayerGroup(&report, launcher)
+
+	if meta.BOM != nil && meta.BOM.SHA != "" {
+		addLayerGroup(&report, platform.LayerGroupSize{
+			Group:  platform.LayerGroupSBOM,
+			Layers: []platform.NamedLayerSize{{Name: "sbom", SHA: meta.BOM.SHA, LayerSize: meta.BOM.LayerSize}},
+		})
+	}
+	return report
+}
+
+func addLayerGroup(report *platform.SizeReport, group platform.LayerGroupSize) {
+	if len(group.Layers) > 0 {
+		report.AddGroup(group)
+	}
+}
+
+const (
+	historyLauncher     = "Buildpacks Launcher"
+	historyConfig       = "Buildpacks Launcher Config"
+	historyProcessTypes = "Buildpacks Process Types"
+	historySBOM         = "Software Bill-of-Materials"
+)
+
+// addHistory records the history entry for the layer with the given diffID when the image config is writable.
+func addHistory(img imgutil.Image, diffID, createdBy string) {
+	if configurable, ok := img.(*image.ConfigurableImage); ok {
+		configurable.AddHistory(diffID, createdBy)
+	}
+}
+
+func layerCreatedBy(bp buildpack.GroupBuildpack, layerName string) string {
+	return fmt.Sprintf("%s@%s:%s", bp.ID, bp.Version, layerName)
 }
 
 func (e *Exporter) makeBuildReport(layersDir string) (platform.BuildReport, error) {
@@ -494,12 +845,13 @@ func (e *Exporter) addSBOMLaunchLayer(opts ExportOptions, meta *platform.LayersM
 			originalSHA = opts.OrigMetadata.BOM.SHA
 		}
 
-		sha, err := e.addOrReuseLayer(opts.WorkingImage, layer, originalSHA)
+		layer, err = e.addOrReuseLayer(opts.WorkingImage, layer, originalSHA, historySBOM)
 		if err != nil {
 			return errors.Wrapf(err, "exporting layer '%s'", layer.ID)
 		}
 
-		meta.BOM = &platform.LayerMetadata{SHA: sha}
+		bomMD := layerMetadata(layer)
+		meta.BOM = &bomMD
 	}
 
 	return nil
@@ -5,26 +5,31 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/memory"
+	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/fakes"
 	"github.com/buildpacks/imgutil/local"
 	"github.com/buildpacks/imgutil/remote"
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/sclevine/spec"
 	specreport "github.com/sclevine/spec/report"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
@@ -45,6 +50,8 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 		layerFactory *testmock.MockLayerFactory
 		fakeAppImage *fakes.Image
 		logHandler   = memory.New()
+		unchanged    map[string]bool // IDs of layers with unchanged fingerprints
+		hashed       []string        // IDs of layers passed to FingerprintedDirLayer
 		opts         = lifecycle.ExportOptions{
 			RunImageRef:     "run-image-reference",
 			AdditionalNames: []string{},
@@ -99,6 +106,20 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 				return createTestLayer(id, tmpDir)
 			}).AnyTimes()
 
+		unchanged = map[string]bool{}
+		hashed = nil
+		layerFactory.EXPECT().
+			FingerprintedDirLayer(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(id string, dir string) (layers.Layer, error) {
+				hashed = append(hashed, id)
+				return createTestLayer(id, tmpDir)
+			}).AnyTimes()
+		layerFactory.EXPECT().
+			UnchangedDirLayer(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(id string, dir string) (layers.Layer, bool) {
+				return layers.Layer{ID: id, Digest: testLayerDigest(id)}, unchanged[id]
+			}).AnyTimes()
+
 		layerFactory.EXPECT().
 			LauncherLayer(launcherPath).
 			DoAndReturn(func(path string) (layers.Layer, error) { return createTestLayer("launcher", tmpDir) }).
@@ -288,6 +309,42 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 				assertReuseLayerLog(t, logHandler, "other.buildpack.id:local-reusable-layer")
 			})
 
+			when("the fingerprint of a launch layer is unchanged", func() {
+				it.Before(func() {
+					unchanged["other.buildpack.id:local-reusable-layer"] = true
+				})
+
+				it("reuses the layer without hashing it", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertContains(t, fakeAppImage.ReusedLayers(), "local-reusable-layer-digest")
+					h.AssertContains(t, hashed, "buildpack.id:new-launch-layer")
+					h.AssertStringDoesNotContain(t, strings.Join(hashed, " "), "other.buildpack.id:local-reusable-layer")
+					assertLogEntry(t, logHandler, "Reusing unchanged layer 'other.buildpack.id:local-reusable-layer'")
+				})
+
+				it("hashes the layer if the recorded digest does not match the previous image", func() {
+					opts.OrigMetadata.Buildpacks[1].Layers["local-reusable-layer"] = buildpack.LayerMetadata{SHA: "some-other-digest"}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertContains(t, hashed, "other.buildpack.id:local-reusable-layer")
+					assertAddLayerLog(t, logHandler, "other.buildpack.id:local-reusable-layer")
+				})
+
+				it("hashes the layer when verifying reproducibility", func() {
+					opts.VerifyReproducible = true
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertContains(t, hashed, "other.buildpack.id:local-reusable-layer")
+					h.AssertEq(t, report.Reproducibility, &platform.ReproducibilityReport{Compared: 1})
+				})
+			})
+
 			when("the launch flag is in the top level table", func() {
 				it.Before(func() {
 					exporter.Buildpacks = []buildpack.GroupBuildpack{{ID: "bad.buildpack.id", API: api.Buildpack.Latest().String()}}
@@ -705,6 +762,25 @@ version = "4.5.6"
 				})
 			})
 
+			when("saving fails for some names with a transient error", func() {
+				it("saves only the names that failed again", func() {
+					flaky := &flakyImage{Image: fakeAppImage, flaky: map[string]bool{opts.AdditionalNames[0]: true}}
+					opts.WorkingImage = flaky
+					exporter.RetryPolicy = image.DefaultRetryPolicy(nil)
+					exporter.RetryPolicy.Backoff = 0
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					h.AssertEq(t, flaky.saves, [][]string{
+						append([]string{fakeAppImage.Name()}, opts.AdditionalNames...),
+						{opts.AdditionalNames[0]},
+					})
+					h.AssertEq(t, report.Retries, 1)
+					h.AssertEq(t, report.Image.Tags, append([]string{"some-repo/app-image"}, opts.AdditionalNames...))
+					h.AssertEq(t, fakeAppImage.Name(), "some-repo/app-image")
+				})
+			})
+
 			when("previous image metadata is missing buildpack for reused layer", func() {
 				it.Before(func() {
 					opts.OrigMetadata = platform.LayersMetadata{
@@ -764,6 +840,312 @@ version = "4.5.6"
 				h.AssertNil(t, err)
 				h.AssertEq(t, label, "other-label-value")
 			})
+
+			when("the platform provides labels", func() {
+				it.Before(func() {
+					opts.Labels = map[string]string{
+						"other.label.key":    "platform-label-value",
+						"platform.label.key": "some-platform-value",
+					}
+				})
+
+				it.After(func() {
+					opts.Labels = nil
+				})
+
+				it("adds the labels, overriding buildpack-provided labels", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					for key, expected := range map[string]string{
+						"some.label.key":     "some-label-value",
+						"other.label.key":    "platform-label-value",
+						"platform.label.key": "some-platform-value",
+					} {
+						label, err := fakeAppImage.Label(key)
+						h.AssertNil(t, err)
+						h.AssertEq(t, label, expected)
+					}
+				})
+
+				when("a label is prefixed with io.buildpacks.", func() {
+					it.Before(func() {
+						opts.Labels[platform.ProjectMetadataLabel] = "some-project-metadata"
+					})
+
+					it.After(func() {
+						opts.ProtectLabels = false
+					})
+
+					it("overrides the lifecycle label", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						label, err := fakeAppImage.Label(platform.ProjectMetadataLabel)
+						h.AssertNil(t, err)
+						h.AssertEq(t, label, "some-project-metadata")
+					})
+
+					when("labels are protected", func() {
+						it.Before(func() {
+							opts.ProtectLabels = true
+						})
+
+						it("skips the label", func() {
+							_, err := exporter.Export(opts)
+							h.AssertNil(t, err)
+							label, err := fakeAppImage.Label(platform.ProjectMetadataLabel)
+							h.AssertNil(t, err)
+							h.AssertEq(t, label, "{}")
+							assertLogEntry(t, logHandler, "Skipping label 'io.buildpacks.project.metadata', labels prefixed with 'io.buildpacks.' are reserved")
+
+							label, err = fakeAppImage.Label("platform.label.key")
+							h.AssertNil(t, err)
+							h.AssertEq(t, label, "some-platform-value")
+						})
+					})
+				})
+			})
+
+			when("the platform provides annotations", func() {
+				it.Before(func() {
+					opts.Annotations = map[string]string{platform.OCIRevisionAnnotation: "some-commit"}
+				})
+
+				it.After(func() {
+					opts.Annotations = nil
+				})
+
+				when("the image manifest is writable", func() {
+					var configWriter *fakeConfigWriter
+
+					it.Before(func() {
+						configWriter = &fakeConfigWriter{}
+						opts.WorkingImage = image.NewConfigurableImage(fakeAppImage, configWriter)
+					})
+
+					it("adds the annotations to the saved image", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						h.AssertEq(t, configWriter.config.Annotations, opts.Annotations)
+						assertLogEntry(t, logHandler, "Adding annotation 'org.opencontainers.image.revision'")
+					})
+				})
+
+				when("the image manifest is not writable", func() {
+					it("warns and saves the image without the annotations", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						assertLogEntry(t, logHandler, "Skipping annotations, the image config is not writable")
+						h.AssertContains(t, fakeAppImage.SavedNames(), fakeAppImage.Name())
+					})
+				})
+			})
+
+			when("VerifyReproducible is set", func() {
+				it.Before(func() {
+					opts.VerifyReproducible = true
+				})
+
+				it("reports the compared layers", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					h.AssertEq(t, report.Reproducibility, &platform.ReproducibilityReport{Compared: 1})
+				})
+
+				when("a layer digest differs from the previous image", func() {
+					it.Before(func() {
+						opts.OrigMetadata.Buildpacks[1].Layers["local-reusable-layer"] = buildpack.LayerMetadata{SHA: "some-other-digest"}
+					})
+
+					it("reports the non-reproducible layer", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						h.AssertEq(t, report.Reproducibility, &platform.ReproducibilityReport{
+							Compared: 1,
+							NonReproducible: []platform.NonReproducibleLayer{{
+								Buildpack:   "other.buildpack.id",
+								Layer:       "local-reusable-layer",
+								SHA:         "local-reusable-layer-digest",
+								PreviousSHA: "some-other-digest",
+							}},
+						})
+						assertLogEntry(t, logHandler, "Layer 'other.buildpack.id:local-reusable-layer' is not reproducible")
+					})
+				})
+			})
+
+			when("VerifyReproducible is not set", func() {
+				it("does not report reproducibility", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					h.AssertNil(t, report.Reproducibility)
+				})
+			})
+
+			when("the layers have sizes", func() {
+				it.Before(func() {
+					exporter.LayerFactory = &sizedLayerFactory{LayerFactory: layerFactory}
+					opts.WorkingImage = &compressingImage{Image: fakeAppImage}
+					opts.OrigMetadata.Buildpacks[0].Layers["launch-layer-no-local-dir"] = buildpack.LayerMetadata{
+						SHA:       "launch-layer-no-local-dir-digest",
+						LayerSize: layers.LayerSize{Size: 500, CompressedSize: 50},
+					}
+					// reused layers keep the sizes recorded in the previous image
+					reusable := opts.OrigMetadata.Buildpacks[1].Layers["local-reusable-layer"]
+					reusable.LayerSize = layers.LayerSize{Size: 1000, CompressedSize: 100}
+					opts.OrigMetadata.Buildpacks[1].Layers["local-reusable-layer"] = reusable
+					opts.OrigMetadata.Launcher.LayerSize = layers.LayerSize{Size: 1000, CompressedSize: 100}
+					opts.OrigMetadata.ProcessTypes.LayerSize = layers.LayerSize{Size: 1000, CompressedSize: 100}
+					opts.OrigMetadata.BOM.LayerSize = layers.LayerSize{Size: 1000, CompressedSize: 100}
+				})
+
+				it.After(func() {
+					opts.SizePolicy = nil
+				})
+
+				it("reports the size of the layers by group", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					type groupSize struct {
+						Group, Buildpack string
+						Layers           []string
+						Size             layers.LayerSize
+					}
+					var groups []groupSize
+					for _, group := range report.Sizes.Groups {
+						var names []string
+						for _, layer := range group.Layers {
+							names = append(names, layer.Name)
+						}
+						groups = append(groups, groupSize{group.Group, group.Buildpack, names, group.LayerSize})
+					}
+					h.AssertEq(t, groups, []groupSize{
+						{platform.LayerGroupBuildpack, "buildpack.id", []string{"launch-layer-no-local-dir", "new-launch-layer"}, layers.LayerSize{Size: 1500, CompressedSize: 150}},
+						{platform.LayerGroupBuildpack, "other.buildpack.id", []string{"local-reusable-layer", "new-launch-layer"}, layers.LayerSize{Size: 2000, CompressedSize: 200}},
+						{platform.LayerGroupApp, "", []string{"slice-1"}, layers.LayerSize{Size: 1000, CompressedSize: 100}},
+						{platform.LayerGroupLauncher, "", []string{"launcher", "config", "process-types"}, layers.LayerSize{Size: 3000, CompressedSize: 300}},
+						{platform.LayerGroupSBOM, "", []string{"sbom"}, layers.LayerSize{Size: 1000, CompressedSize: 100}},
+					})
+					h.AssertEq(t, report.Sizes.LayerSize, layers.LayerSize{Size: 8500, CompressedSize: 850})
+					assertLogEntry(t, logHandler, "Exported layers are 850 B compressed (8.5 KB uncompressed)")
+				})
+
+				it("records the sizes in the layers metadata label", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					metadataJSON, err := fakeAppImage.Label("io.buildpacks.lifecycle.metadata")
+					h.AssertNil(t, err)
+					var metadata platform.LayersMetadata
+					h.AssertNil(t, json.Unmarshal([]byte(metadataJSON), &metadata))
+					h.AssertEq(t, metadata.Launcher.LayerSize, layers.LayerSize{Size: 1000, CompressedSize: 100})
+					h.AssertEq(t, metadata.App[0].LayerSize, layers.LayerSize{Size: 1000, CompressedSize: 100})
+					h.AssertEq(t, metadata.Buildpacks[0].Layers["launch-layer-no-local-dir"].LayerSize, layers.LayerSize{Size: 500, CompressedSize: 50})
+					h.AssertEq(t, metadata.Buildpacks[1].Layers["local-reusable-layer"].LayerSize, layers.LayerSize{Size: 1000, CompressedSize: 100})
+				})
+
+				when("a layer grew since the previous image", func() {
+					it.Before(func() {
+						opts.OrigMetadata.Buildpacks[1].Layers["new-launch-layer"] = buildpack.LayerMetadata{
+							SHA:       "some-other-digest",
+							LayerSize: layers.LayerSize{Size: 400, CompressedSize: 40},
+						}
+					})
+
+					it("reports the growth", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						h.AssertEq(t, report.Sizes.Growth, []platform.LayerGrowth{{
+							Layer:                  "other.buildpack.id:new-launch-layer",
+							CompressedSize:         100,
+							PreviousCompressedSize: 40,
+						}})
+						assertLogEntry(t, logHandler, "Layer 'other.buildpack.id:new-launch-layer' grew from 40 B to 100 B compressed")
+					})
+				})
+
+				when("the size policy warns", func() {
+					it.Before(func() {
+						opts.SizePolicy = &platform.SizePolicy{Action: platform.SizePolicyWarn, MaxBuildpackSize: 150}
+					})
+
+					it("reports the exceeded budgets and saves the image", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						h.AssertEq(t, report.Sizes.Violations, []platform.SizeViolation{
+							{Budget: "other.buildpack.id", MaxSize: 150, CompressedSize: 200},
+						})
+						assertLogEntry(t, logHandler, "Image size budget exceeded: layers of buildpack 'other.buildpack.id' are 200 B compressed, exceeding the budget of 150 B")
+						h.AssertEq(t, fakeAppImage.IsSaved(), true)
+					})
+				})
+
+				when("the size policy fails", func() {
+					it.Before(func() {
+						opts.SizePolicy = &platform.SizePolicy{Action: platform.SizePolicyFail, MaxSize: 800}
+					})
+
+					it("returns a size budget error and the report without saving the image", func() {
+						report, err := exporter.Export(opts)
+						budgetErr, ok := err.(*lifecycle.SizeBudgetError)
+						h.AssertEq(t, ok, true)
+						h.AssertEq(t, budgetErr.Violations, []platform.SizeViolation{
+							{Budget: "total", MaxSize: 800, CompressedSize: 850},
+						})
+						h.AssertEq(t, report.Sizes.Violations, budgetErr.Violations)
+						h.AssertEq(t, fakeAppImage.IsSaved(), false)
+					})
+				})
+
+				when("the image does not compress its layers", func() {
+					it.Before(func() {
+						opts.WorkingImage = fakeAppImage
+						opts.SizePolicy = &platform.SizePolicy{Action: platform.SizePolicyFail, MaxSize: 800}
+					})
+
+					it("reports the uncompressed sizes and skips the size budgets", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+						h.AssertEq(t, report.Sizes.LayerSize, layers.LayerSize{Size: 8500})
+						h.AssertEq(t, len(report.Sizes.Violations), 0)
+						assertLogEntry(t, logHandler, "Exported layers are 8.5 KB uncompressed")
+						assertLogEntry(t, logHandler, "Skipping image size budgets, the layers of the image are not compressed")
+						h.AssertEq(t, fakeAppImage.IsSaved(), true)
+					})
+				})
+			})
+		})
+
+		when("SourceDateEpoch is set", func() {
+			var configWriter *fakeConfigWriter
+
+			it.Before(func() {
+				h.RecursiveCopy(t, filepath.Join("testdata", "exporter", "previous-image-not-exist", "layers"), opts.LayersDir)
+				configWriter = &fakeConfigWriter{}
+				opts.SourceDateEpoch = time.Unix(1234567890, 0).UTC()
+			})
+
+			when("the image config is writable", func() {
+				it.Before(func() {
+					opts.WorkingImage = image.NewConfigurableImage(fakeAppImage, configWriter)
+				})
+
+				it("writes the created time to the saved image", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					h.AssertEq(t, configWriter.config.CreatedAt, opts.SourceDateEpoch)
+					h.AssertContains(t, fakeAppImage.SavedNames(), append([]string{fakeAppImage.Name()}, opts.AdditionalNames...)...)
+				})
+			})
+
+			when("the image config is not writable", func() {
+				it("warns and saves the image without the created time", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					assertLogEntry(t, logHandler, "Skipping created time, the image config is not writable")
+					h.AssertContains(t, fakeAppImage.SavedNames(), fakeAppImage.Name())
+				})
+			})
 		})
 
 		when("previous image doesn't exist", func() {
@@ -778,7 +1160,7 @@ version = "4.5.6"
 				h.AssertNil(t, err)
 
 				// TODO : this is an hacky way to create a non-existing image and should be improved in imgutil
-				nonExistingOriginalImage = fakes.NewImage("app/original-image", "", nil)
+				nonExistingOriginalImage = fakes.NewImage("some-repo/app-image", "", nil)
 				h.AssertNil(t, nonExistingOriginalImage.Delete())
 			})
 
@@ -1019,6 +1401,67 @@ version = "4.5.6"
 				h.AssertNil(t, err)
 				h.AssertContains(t, fakeAppImage.SavedNames(), append(opts.AdditionalNames, fakeAppImage.Name())...)
 			})
+
+			when("the image config is writable", func() {
+				var configWriter *fakeConfigWriter
+
+				it.Before(func() {
+					configWriter = &fakeConfigWriter{}
+					opts.WorkingImage = image.NewConfigurableImage(fakeAppImage, configWriter)
+				})
+
+				it("writes a history entry keyed by diffID for each layer", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					var createdBy []string
+					for diffID, history := range configWriter.config.History {
+						rc, err := fakeAppImage.GetLayer(diffID)
+						h.AssertNil(t, err)
+						h.AssertNil(t, rc.Close())
+						createdBy = append(createdBy, history.CreatedBy)
+					}
+					sort.Strings(createdBy)
+					h.AssertEq(t, createdBy, []string{
+						"Application slice 1",
+						"Buildpacks Launcher",
+						"Buildpacks Launcher Config",
+						"Buildpacks Process Types",
+						"Software Bill-of-Materials",
+						"buildpack.id@1.2.3:layer1",
+						"buildpack.id@1.2.3:layer2",
+					})
+				})
+
+				when("buildpacks provide image config", func() {
+					it.Before(func() {
+						metadataPath := filepath.Join(opts.LayersDir, "config", "metadata.toml")
+						contents, err := ioutil.ReadFile(metadataPath)
+						h.AssertNil(t, err)
+						h.AssertNil(t, ioutil.WriteFile(metadataPath, append([]byte(`stop-signal = "SIGINT"
+user = "1000:1000"
+
+[[ports]]
+  port = 8080
+
+[[volumes]]
+  path = "/data"
+
+`), contents...), 0600))
+					})
+
+					it("writes the image config", func() {
+						_, err := exporter.Export(opts)
+						h.AssertNil(t, err)
+
+						h.AssertEq(t, configWriter.config.ExposedPorts, []string{"8080/tcp"})
+						h.AssertEq(t, configWriter.config.Volumes, []string{"/data"})
+						h.AssertEq(t, configWriter.config.StopSignal, "SIGINT")
+						h.AssertEq(t, configWriter.config.User, "1000:1000")
+						assertLogEntry(t, logHandler, "Exposing port '8080/tcp'")
+					})
+				})
+			})
 		})
 
 		when("default process", func() {
@@ -1259,6 +1702,27 @@ version = "4.5.6"
 
 					h.AssertEq(t, report.Image.Digest, fakeRemoteDigest)
 				})
+
+				when("the tags are on multiple registries", func() {
+					it("reports the digest and failures for each registry", func() {
+						opts.AdditionalNames = []string{"some-repo/app-image:foo", "mirror.example.com/app-image", "other.example.com/not.a.tag@reference"}
+
+						report, err := exporter.Export(opts)
+						h.AssertError(t, err, "failed to write image to the following tags: [other.example.com/not.a.tag@reference:")
+
+						h.AssertContains(t, report.Image.Tags, fakeAppImage.Name(), "some-repo/app-image:foo", "mirror.example.com/app-image")
+						h.AssertEq(t, len(report.Image.Registries), 3)
+						h.AssertEq(t, report.Image.Registries[0].Registry, "index.docker.io")
+						h.AssertEq(t, report.Image.Registries[0].Digest, fakeRemoteDigest)
+						h.AssertEq(t, report.Image.Registries[0].Tags, []string{fakeAppImage.Name(), "some-repo/app-image:foo"})
+						h.AssertEq(t, report.Image.Registries[1].Registry, "mirror.example.com")
+						h.AssertEq(t, report.Image.Registries[1].Digest, fakeRemoteDigest)
+						h.AssertEq(t, report.Image.Registries[1].Tags, []string{"mirror.example.com/app-image"})
+						h.AssertEq(t, report.Image.Registries[2].Digest, "")
+						h.AssertEq(t, len(report.Image.Registries[2].Failures), 1)
+						h.AssertEq(t, report.Image.Registries[2].Failures[0].Tag, "other.example.com/not.a.tag@reference")
+					})
+				})
 			})
 
 			when("image has an ID identifier", func() {
@@ -1369,7 +1833,7 @@ version = "4.5.6"
 				h.AssertNil(t, err)
 
 				// TODO : this is an hacky way to create a non-existing image and should be improved in imgutil
-				nonExistingOriginalImage = fakes.NewImage("app/original-image", "", nil)
+				nonExistingOriginalImage = fakes.NewImage("some-repo/app-image", "", nil)
 				h.AssertNil(t, nonExistingOriginalImage.Delete())
 			})
 
@@ -1472,6 +1936,65 @@ func createTestLayer(id string, tmpDir string) (layers.Layer, error) {
 	}, nil
 }
 
+// sizedLayerFactory gives every layer created by the wrapped factory the same size.
+type sizedLayerFactory struct {
+	lifecycle.LayerFactory
+}
+
+var testLayerSize = layers.LayerSize{Size: 1000}
+
+// compressingImage compresses every layer added to it to the same size.
+type compressingImage struct {
+	*fakes.Image
+	added map[string]bool
+}
+
+const testCompressedLayerSize = 100
+
+func (i *compressingImage) AddLayerWithDiffID(path, diffID string) error {
+	if i.added == nil {
+		i.added = map[string]bool{}
+	}
+	i.added[diffID] = true
+	return i.Image.AddLayerWithDiffID(path, diffID)
+}
+
+func (i *compressingImage) CompressedLayerSize(diffID string) (int64, bool) {
+	return testCompressedLayerSize, i.added[diffID]
+}
+
+func (f *sizedLayerFactory) DirLayer(id string, dir string) (layers.Layer, error) {
+	layer, err := f.LayerFactory.DirLayer(id, dir)
+	layer.LayerSize = testLayerSize
+	return layer, err
+}
+
+func (f *sizedLayerFactory) FingerprintedDirLayer(id string, dir string) (layers.Layer, error) {
+	layer, err := f.LayerFactory.FingerprintedDirLayer(id, dir)
+	layer.LayerSize = testLayerSize
+	return layer, err
+}
+
+func (f *sizedLayerFactory) LauncherLayer(path string) (layers.Layer, error) {
+	layer, err := f.LayerFactory.LauncherLayer(path)
+	layer.LayerSize = testLayerSize
+	return layer, err
+}
+
+func (f *sizedLayerFactory) ProcessTypesLayer(metadata launch.Metadata) (layers.Layer, error) {
+	layer, err := f.LayerFactory.ProcessTypesLayer(metadata)
+	layer.LayerSize = testLayerSize
+	return layer, err
+}
+
+func (f *sizedLayerFactory) SliceLayers(dir string, slices []layers.Slice) ([]layers.Layer, error) {
+	sliceLayers, err := f.LayerFactory.SliceLayers(dir, slices)
+	for i := range sliceLayers {
+		sliceLayers[i].LayerSize = testLayerSize
+	}
+	return sliceLayers, err
+}
+
 func assertHasLayer(t *testing.T, fakeAppImage *fakes.Image, id string) {
 	t.Helper()
 
@@ -1523,3 +2046,37 @@ func assertLogEntry(t *testing.T, logHandler *memory.Handler, expected string) {
 	}
 	t.Fatalf("Expected log entries %+v to contain %s", messages, expected)
 }
+
+// flakyImage fails to save each of the flaky names with a transient error the first time it is saved.
+type flakyImage struct {
+	*fakes.Image
+	flaky map[string]bool
+	saves [][]string
+}
+
+func (i *flakyImage) Save(additionalNames ...string) error {
+	names := append([]string{i.Name()}, additionalNames...)
+	i.saves = append(i.saves, names)
+	var diagnostics []imgutil.SaveDiagnostic
+	for _, n := range names {
+		if i.flaky[n] {
+			delete(i.flaky, n)
+			diagnostics = append(diagnostics, imgutil.SaveDiagnostic{ImageName: n, Cause: &transport.Error{StatusCode: http.StatusServiceUnavailable}})
+		}
+	}
+	if err := i.Image.Save(additionalNames...); err != nil {
+		return err
+	}
+	if len(diagnostics) > 0 {
+		return imgutil.SaveError{Errors: diagnostics}
+	}
+	return nil
+}
+
+type fakeConfigWriter struct {
+	config image.Config
+}
+
+func (w *fakeConfigWriter) SetConfig(config image.Config) {
+	w.config = config
+}
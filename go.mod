@@ -4,11 +4,14 @@ require (
 	github.com/BurntSushi/toml v1.0.0
 	github.com/apex/log v1.9.0
 	github.com/buildpacks/imgutil v0.0.0-20211203200417-76206845baac
+	github.com/containerd/stargz-snapshotter/estargz v0.10.1
 	github.com/docker/docker v20.10.12+incompatible
 	github.com/golang/mock v1.6.0
 	github.com/google/go-cmp v0.5.7
 	github.com/google/go-containerregistry v0.8.0
 	github.com/heroku/color v0.0.6
+	github.com/klauspost/compress v1.13.6
+	github.com/opencontainers/go-digest v1.0.0
 	github.com/pkg/errors v0.9.1
 	github.com/sclevine/spec v1.4.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
@@ -0,0 +1,658 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/archive"
+	"github.com/buildpacks/lifecycle/auth"
+)
+
+// OCILayerZstd is the media type of zstd compressed OCI layers.
+const OCILayerZstd types.MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+
+// CompressionOptions configure how a CompressedImage compresses the layers added to it.
+type CompressionOptions struct {
+	Compression archive.Compression
+	Level       int
+	Keychain    authn.Keychain
+
+	// Estargz annotates eStargz layers with the digest of their TOC and their uncompressed size.
+	// The annotations can only be written to OCI images, so the layers are held back as they are with zstd.
+	Estargz bool
+
+	// BaseImageRef and PreviousImageRef are the base image of the wrapped image and the image it reuses layers from.
+	// They are only read when the image is built, so BaseImageRef should be the digest reference that the wrapped image
+	// was opened with: a tag may point to another image by then.
+	BaseImageRef     string
+	PreviousImageRef string
+}
+
+// CompressedImage wraps a remote imgutil.Image so that added layers are compressed with the given compression and level,
+// and so that config values that imgutil cannot set are written into the image as it is saved.
+// Gzip layers are compressed before they are handed to the wrapped image, which uploads them as they are.
+// imgutil cannot write zstd layers, so with zstd the layers are held back from the wrapped image.
+// When the layers are held back or config values are set, the image is built when it is saved instead of being saved by
+// the wrapped image, as imgutil cannot write the config values, e.g. history: it starts from the base image, takes the
+// config set on the wrapped image and the config values, and ends with the added layers.
+// Layers that are added already compressed, like eStargz layers, are used as they are.
+type CompressedImage struct {
+	imgutil.Image
+	opts   CompressionOptions
+	config Config
+	tmpDir string
+
+	// used when the image is built
+	layers       []compressedLayer
+	env          []string
+	cmd          *[]string
+	workingDir   *string
+	identifier   imgutil.Identifier
+	manifestSize int64
+}
+
+type compressedLayer struct {
+	diffID      v1.Hash
+	path        string // empty when the layer is reused from the previous image
+	digest      v1.Hash
+	size        int64
+	mediaType   types.MediaType
+	annotations map[string]string
+}
+
+func NewCompressedImage(image imgutil.Image, opts CompressionOptions) *CompressedImage {
+	return &CompressedImage{
+		Image: image,
+		opts:  opts,
+	}
+}
+
+func (i *CompressedImage) AddLayer(path string) error {
+	diffID, err := sha256File(path)
+	if err != nil {
+		return errors.Wrapf(err, "hashing layer '%s'", path)
+	}
+	return i.AddLayerWithDiffID(path, diffID)
+}
+
+func (i *CompressedImage) AddLayerWithDiffID(path, diffID string) error {
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return errors.Wrapf(err, "parsing diff ID '%s'", diffID)
+	}
+	layer, err := i.compress(path, hash)
+	if err != nil {
+		return errors.Wrapf(err, "compressing layer '%s'", path)
+	}
+	if !i.holdsLayers() {
+		if err := i.Image.AddLayerWithDiffID(layer.path, diffID); err != nil {
+			return err
+		}
+	}
+	i.layers = append(i.layers, layer)
+	return nil
+}
+
+func (i *CompressedImage) ReuseLayer(diffID string) error {
+	if err := i.Image.ReuseLayer(diffID); err != nil {
+		return err
+	}
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return errors.Wrapf(err, "parsing diff ID '%s'", diffID)
+	}
+	i.layers = append(i.layers, compressedLayer{diffID: hash})
+	return nil
+}
+
+// GetLayer returns the uncompressed contents of a layer, including layers that are held back until the image is saved.
+func (i *CompressedImage) GetLayer(diffID string) (io.ReadCloser, error) {
+	for _, layer := range i.layers {
+		if layer.diffID.String() == diffID && layer.path != "" {
+			return openDecompressed(layer.path)
+		}
+	}
+	return i.Image.GetLayer(diffID)
+}
+
+// CompressedLayerSize returns the size of a layer added to the image as it is written to the registry.
+// It returns false for layers that are reused from the previous image.
+func (i *CompressedImage) CompressedLayerSize(diffID string) (int64, bool) {
+	for _, layer := range i.layers {
+		if layer.diffID.String() == diffID && layer.path != "" {
+			return layer.size, true
+		}
+	}
+	return 0, false
+}
+
+func (i *CompressedImage) TopLayer() (string, error) {
+	if len(i.layers) > 0 {
+		return i.layers[len(i.layers)-1].diffID.String(), nil
+	}
+	return i.Image.TopLayer()
+}
+
+func (i *CompressedImage) SetEnv(key, val string) error {
+	i.env = append(i.env, key)
+	return i.Image.SetEnv(key, val)
+}
+
+func (i *CompressedImage) SetCmd(cmd ...string) error {
+	i.cmd = &cmd
+	return i.Image.SetCmd(cmd...)
+}
+
+func (i *CompressedImage) SetWorkingDir(dir string) error {
+	i.workingDir = &dir
+	return i.Image.SetWorkingDir(dir)
+}
+
+// SetConfig sets the config values that are written into the image when it is saved.
+func (i *CompressedImage) SetConfig(config Config) {
+	i.config = config
+}
+
+func (i *CompressedImage) Identifier() (imgutil.Identifier, error) {
+	if i.identifier != nil {
+		return i.identifier, nil
+	}
+	return i.Image.Identifier()
+}
+
+func (i *CompressedImage) ManifestSize() (int64, error) {
+	if i.identifier != nil {
+		return i.manifestSize, nil
+	}
+	return i.Image.ManifestSize()
+}
+
+// Save saves the image under each name. The compressed layers are removed once the image has been saved under all names.
+// A built image is pushed once per name with the config values already applied, so it is never rewritten after saving.
+func (i *CompressedImage) Save(additionalNames ...string) error {
+	var err error
+	if i.holdsLayers() || !i.config.IsEmpty() {
+		err = i.save(append([]string{i.Name()}, additionalNames...))
+	} else {
+		err = i.Image.Save(additionalNames...)
+	}
+	if err == nil && i.tmpDir != "" {
+		if err := os.RemoveAll(i.tmpDir); err != nil {
+			return errors.Wrap(err, "removing compressed layers")
+		}
+		i.tmpDir = ""
+	}
+	return err
+}
+
+// holdsLayers returns true if the layers are held back from the wrapped image.
+func (i *CompressedImage) holdsLayers() bool {
+	return i.opts.Compression == archive.CompressionZstd || i.opts.Estargz
+}
+
+func (i *CompressedImage) save(names []string) error {
+	img, err := i.build()
+	if err != nil {
+		return err
+	}
+
+	var diagnostics []imgutil.SaveDiagnostic
+	for _, n := range names {
+		if err := i.write(n, img); err != nil {
+			diagnostics = append(diagnostics, imgutil.SaveDiagnostic{ImageName: n, Cause: errors.Wrapf(err, "writing image '%s'", n)})
+		}
+	}
+	if len(diagnostics) == len(names) {
+		return imgutil.SaveError{Errors: diagnostics}
+	}
+
+	ref, _, err := auth.ReferenceForRepoName(i.opts.Keychain, names[0])
+	if err != nil {
+		return err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return errors.Wrap(err, "getting image digest")
+	}
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return errors.Wrap(err, "getting image manifest")
+	}
+	i.identifier = remote.DigestIdentifier{Digest: ref.Context().Digest(digest.String())}
+	i.manifestSize = int64(len(manifest))
+	if len(diagnostics) > 0 {
+		return imgutil.SaveError{Errors: diagnostics}
+	}
+	return nil
+}
+
+func (i *CompressedImage) write(imageName string, img v1.Image) error {
+	ref, authr, err := auth.ReferenceForRepoName(i.opts.Keychain, imageName)
+	if err != nil {
+		return err
+	}
+	return ggcrremote.Write(ref, img, ggcrremote.WithAuth(authr))
+}
+
+// build assembles the image that is saved instead of the wrapped image.
+func (i *CompressedImage) build() (v1.Image, error) {
+	base, err := i.baseImage()
+	if err != nil {
+		return nil, err
+	}
+	baseConfig, err := base.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading base image config")
+	}
+	baseManifest, err := base.Manifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading base image manifest")
+	}
+
+	var addenda []mutate.Addendum
+	for _, desc := range baseManifest.Layers {
+		layer, err := base.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading base image layer '%s'", desc.Digest)
+		}
+		addenda = append(addenda, mutate.Addendum{
+			Layer:       layer,
+			URLs:        desc.URLs,
+			Annotations: desc.Annotations,
+			MediaType:   i.layerMediaType(desc.MediaType),
+		})
+	}
+	var (
+		previous         v1.Image
+		previousManifest *v1.Manifest
+	)
+	for _, l := range i.layers {
+		if l.path != "" {
+			addenda = append(addenda, mutate.Addendum{Layer: &fileLayer{l}, Annotations: l.annotations, MediaType: i.layerMediaType(l.mediaType)})
+			continue
+		}
+		if previous == nil {
+			if previous, err = i.remoteImage(i.opts.PreviousImageRef, baseConfig); err != nil {
+				return nil, errors.Wrapf(err, "reading previous image '%s'", i.opts.PreviousImageRef)
+			}
+			if previousManifest, err = previous.Manifest(); err != nil {
+				return nil, errors.Wrapf(err, "reading previous image manifest '%s'", i.opts.PreviousImageRef)
+			}
+		}
+		layer, err := previous.LayerByDiffID(l.diffID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading previous image layer '%s'", l.diffID)
+		}
+		digest, err := layer.Digest()
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading digest of layer '%s'", l.diffID)
+		}
+		// the descriptor keeps the annotations of the layer, e.g. those of eStargz layers
+		desc, ok := layerDescriptor(previousManifest, digest)
+		if !ok {
+			return nil, fmt.Errorf("previous image layer '%s' is not in the manifest", l.diffID)
+		}
+		addenda = append(addenda, mutate.Addendum{Layer: layer, Annotations: desc.Annotations, MediaType: i.layerMediaType(desc.MediaType)})
+	}
+
+	img := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.DockerManifestSchema2), types.DockerConfigJSON)
+	if i.oci() {
+		img = mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+	}
+	img, err = mutate.Append(img, addenda...)
+	if err != nil {
+		return nil, errors.Wrap(err, "appending layers")
+	}
+	appended, err := img.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading image config")
+	}
+	config, err := i.imageConfig(baseConfig, appended.RootFS)
+	if err != nil {
+		return nil, err
+	}
+	img, err = mutate.ConfigFile(img, i.config.Apply(config))
+	if err != nil {
+		return nil, errors.Wrap(err, "setting image config")
+	}
+	if len(i.config.Annotations) > 0 {
+		img = mutate.Annotations(img, i.config.Annotations).(v1.Image)
+	}
+	return img, nil
+}
+
+// imageConfig returns the base image config updated with the values set on the wrapped image.
+func (i *CompressedImage) imageConfig(base *v1.ConfigFile, rootFS v1.RootFS) (*v1.ConfigFile, error) {
+	cfg := base.DeepCopy()
+	cfg.RootFS = rootFS
+	cfg.Created = v1.Time{Time: imgutil.NormalizedDateTime}
+	cfg.History = make([]v1.History, len(rootFS.DiffIDs))
+	for idx := range cfg.History {
+		cfg.History[idx] = v1.History{Created: v1.Time{Time: imgutil.NormalizedDateTime}}
+	}
+	cfg.DockerVersion = ""
+	cfg.Container = ""
+
+	labels, err := i.Image.Labels()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading labels")
+	}
+	cfg.Config.Labels = labels
+	entrypoint, err := i.Image.Entrypoint()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading entrypoint")
+	}
+	cfg.Config.Entrypoint = entrypoint
+	for _, key := range i.env {
+		val, err := i.Image.Env(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading env var '%s'", key)
+		}
+		cfg.Config.Env = setEnv(cfg.Config.Env, key, val, cfg.OS == "windows")
+	}
+	if i.cmd != nil {
+		cfg.Config.Cmd = *i.cmd
+	}
+	if i.workingDir != nil {
+		cfg.Config.WorkingDir = *i.workingDir
+	}
+	return cfg, nil
+}
+
+func (i *CompressedImage) baseImage() (v1.Image, error) {
+	platform := &v1.ConfigFile{}
+	var err error
+	if platform.OS, err = i.Image.OS(); err != nil {
+		return nil, errors.Wrap(err, "reading image os")
+	}
+	if platform.Architecture, err = i.Image.Architecture(); err != nil {
+		return nil, errors.Wrap(err, "reading image architecture")
+	}
+	if platform.OSVersion, err = i.Image.OSVersion(); err != nil {
+		return nil, errors.Wrap(err, "reading image os version")
+	}
+	if i.opts.BaseImageRef == "" {
+		platform.RootFS = v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{}}
+		return mutate.ConfigFile(empty.Image, platform)
+	}
+	base, err := i.remoteImage(i.opts.BaseImageRef, platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading base image '%s'", i.opts.BaseImageRef)
+	}
+	return base, nil
+}
+
+func (i *CompressedImage) remoteImage(imageName string, platform *v1.ConfigFile) (v1.Image, error) {
+	ref, authr, err := auth.ReferenceForRepoName(i.opts.Keychain, imageName)
+	if err != nil {
+		return nil, err
+	}
+	return ggcrremote.Image(ref, ggcrremote.WithAuth(authr), ggcrremote.WithPlatform(v1.Platform{
+		OS:           platform.OS,
+		Architecture: platform.Architecture,
+		OSVersion:    platform.OSVersion,
+	}))
+}
+
+// compress writes the layer tar at path to a temporary file compressed with the configured compression.
+// A layer that is already compressed is used as it is.
+func (i *CompressedImage) compress(path string, diffID v1.Hash) (compressedLayer, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return compressedLayer{}, err
+	}
+	defer in.Close()
+	inHasher := sha256.New()
+	inCounter := &countingWriter{w: inHasher}
+	tee := io.TeeReader(in, inCounter)
+	dr, compression, err := archive.NewDecompressingReader(tee)
+	if err != nil {
+		return compressedLayer{}, err
+	}
+	defer dr.Close()
+	if compression != archive.CompressionNone {
+		uncompressedSize, err := io.Copy(ioutil.Discard, dr)
+		if err != nil {
+			return compressedLayer{}, err
+		}
+		if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+			return compressedLayer{}, err
+		}
+		layer := compressedLayer{
+			diffID:    diffID,
+			path:      path,
+			digest:    v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(inHasher.Sum(nil))},
+			size:      inCounter.n,
+			mediaType: layerMediaType(compression),
+		}
+		if i.opts.Estargz {
+			layer.annotations = estargzAnnotations(path, uncompressedSize)
+		}
+		return layer, nil
+	}
+
+	if i.tmpDir == "" {
+		tmpDir, err := ioutil.TempDir("", "lifecycle.image.layers")
+		if err != nil {
+			return compressedLayer{}, err
+		}
+		i.tmpDir = tmpDir
+	}
+	layerPath := filepath.Join(i.tmpDir, diffID.Hex+".tar"+i.opts.Compression.Extension())
+	out, err := os.Create(layerPath)
+	if err != nil {
+		return compressedLayer{}, err
+	}
+	defer out.Close()
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(out, hasher)}
+	cw, err := archive.NewCompressingWriter(counter, i.opts.Compression, i.opts.Level)
+	if err != nil {
+		return compressedLayer{}, err
+	}
+	if _, err := io.Copy(cw, dr); err != nil {
+		return compressedLayer{}, err
+	}
+	if err := cw.Close(); err != nil {
+		return compressedLayer{}, err
+	}
+	if err := out.Close(); err != nil {
+		return compressedLayer{}, err
+	}
+	return compressedLayer{
+		diffID:    diffID,
+		path:      layerPath,
+		digest:    v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(hasher.Sum(nil))},
+		size:      counter.n,
+		mediaType: layerMediaType(i.opts.Compression),
+	}, nil
+}
+
+// estargzAnnotations returns the annotations of the layer at path if it is an eStargz layer, and nil otherwise.
+func estargzAnnotations(path string, uncompressedSize int64) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	r, err := estargz.Open(io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		return nil
+	}
+	return map[string]string{
+		estargz.TOCJSONDigestAnnotation:         r.TOCDigest().String(),
+		estargz.StoreUncompressedSizeAnnotation: strconv.FormatInt(uncompressedSize, 10),
+	}
+}
+
+// fileLayer is a layer whose compressed contents are stored in a file.
+type fileLayer struct {
+	compressedLayer
+}
+
+func (l *fileLayer) Digest() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+func (l *fileLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *fileLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(l.path)
+}
+
+func (l *fileLayer) Uncompressed() (io.ReadCloser, error) {
+	return openDecompressed(l.path)
+}
+
+func (l *fileLayer) Size() (int64, error) {
+	return l.size, nil
+}
+
+func (l *fileLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
+
+// oci returns true if the image must be an OCI image, which it must to hold zstd layers or annotations.
+// Otherwise it is a docker image, like the images saved by imgutil.
+func (i *CompressedImage) oci() bool {
+	return i.holdsLayers() || len(i.config.Annotations) > 0
+}
+
+// layerMediaType returns the equivalent of the given layer media type in the manifest format of the image.
+func (i *CompressedImage) layerMediaType(mediaType types.MediaType) types.MediaType {
+	if i.oci() {
+		return ociLayerMediaType(mediaType)
+	}
+	return dockerLayerMediaType(mediaType)
+}
+
+func layerDescriptor(manifest *v1.Manifest, digest v1.Hash) (v1.Descriptor, bool) {
+	for _, desc := range manifest.Layers {
+		if desc.Digest == digest {
+			return desc, true
+		}
+	}
+	return v1.Descriptor{}, false
+}
+
+// layerMediaType returns the media type of OCI layers compressed with c.
+func layerMediaType(c archive.Compression) types.MediaType {
+	if c == archive.CompressionZstd {
+		return OCILayerZstd
+	}
+	return types.OCILayer
+}
+
+// ociLayerMediaType returns the OCI equivalent of a docker layer media type.
+func ociLayerMediaType(mediaType types.MediaType) types.MediaType {
+	switch mediaType {
+	case types.DockerLayer:
+		return types.OCILayer
+	case types.DockerForeignLayer:
+		return types.OCIRestrictedLayer
+	case types.DockerUncompressedLayer:
+		return types.OCIUncompressedLayer
+	default:
+		return mediaType
+	}
+}
+
+// dockerLayerMediaType returns the docker equivalent of an OCI layer media type.
+func dockerLayerMediaType(mediaType types.MediaType) types.MediaType {
+	switch mediaType {
+	case types.OCILayer:
+		return types.DockerLayer
+	case types.OCIRestrictedLayer:
+		return types.DockerForeignLayer
+	case types.OCIUncompressedLayer:
+		return types.DockerUncompressedLayer
+	default:
+		return mediaType
+	}
+}
+
+// setEnv sets key to val in env the way imgutil does, replacing an existing value of key.
+func setEnv(env []string, key, val string, ignoreCase bool) []string {
+	for idx, e := range env {
+		foundKey := strings.Split(e, "=")[0]
+		if foundKey == key || (ignoreCase && strings.EqualFold(foundKey, key)) {
+			env[idx] = fmt.Sprintf("%s=%s", key, val)
+			return env
+		}
+	}
+	return append(env, fmt.Sprintf("%s=%s", key, val))
+}
+
+func openDecompressed(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := archive.NewDecompressingReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decompressedReader{ReadCloser: rc, file: f}, nil
+}
+
+type decompressedReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *decompressedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if fileErr := r.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
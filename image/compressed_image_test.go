@@ -0,0 +1,434 @@
+package image_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/buildpacks/imgutil/remote"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle/archive"
+	"github.com/buildpacks/lifecycle/image"
+	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/layers/stargz"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCompressedImage(t *testing.T) {
+	spec.Run(t, "CompressedImage", testCompressedImage)
+}
+
+func testCompressedImage(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server       *httptest.Server
+		tmpDir       string
+		baseName     string
+		appName      string
+		layerPath    string
+		layerDiffID  string
+		layerContent []byte
+
+		pushesMu sync.Mutex
+		pushes   map[string]int // manifest uploads by path
+	)
+
+	manifestPushes := func(imageName string) int {
+		t.Helper()
+		ref, err := name.ParseReference(imageName)
+		h.AssertNil(t, err)
+		pushesMu.Lock()
+		defer pushesMu.Unlock()
+		return pushes[fmt.Sprintf("/v2/%s/manifests/%s", ref.Context().RepositoryStr(), ref.Identifier())]
+	}
+
+	readImage := func(imageName string) v1.Image {
+		t.Helper()
+		ref, err := name.ParseReference(imageName)
+		h.AssertNil(t, err)
+		img, err := ggcrremote.Image(ref)
+		h.AssertNil(t, err)
+		return img
+	}
+
+	newImage := func(opts image.CompressionOptions, imageOpts ...remote.ImageOption) *image.CompressedImage {
+		t.Helper()
+		img, err := remote.NewImage(appName, authn.DefaultKeychain, append([]remote.ImageOption{remote.FromBaseImage(baseName)}, imageOpts...)...)
+		h.AssertNil(t, err)
+		opts.Keychain = authn.DefaultKeychain
+		opts.BaseImageRef = baseName
+		return image.NewCompressedImage(img, opts)
+	}
+
+	it.Before(func() {
+		pushes = map[string]int{}
+		handler := registry.New()
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+				pushesMu.Lock()
+				pushes[r.URL.Path]++
+				pushesMu.Unlock()
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		serverURL, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		baseName = fmt.Sprintf("%s/some/run-image", serverURL.Host)
+		appName = fmt.Sprintf("%s/some/app-image", serverURL.Host)
+
+		base, err := random.Image(10, 2)
+		h.AssertNil(t, err)
+		baseConfig, err := base.ConfigFile()
+		h.AssertNil(t, err)
+		baseConfig.OS = "linux"
+		baseConfig.Architecture = "amd64"
+		base, err = mutate.ConfigFile(base, baseConfig)
+		h.AssertNil(t, err)
+		ref, err := name.ParseReference(baseName)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(ref, base))
+
+		tmpDir, err = ioutil.TempDir("", "compressed-image-test")
+		h.AssertNil(t, err)
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		contents := bytes.Repeat([]byte("some-file-contents"), 100)
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "some-file", Mode: 0644, Size: int64(len(contents))}))
+		_, err = tw.Write(contents)
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+		layerContent = buf.Bytes()
+		layerPath = filepath.Join(tmpDir, "layer.tar")
+		h.AssertNil(t, ioutil.WriteFile(layerPath, layerContent, 0600))
+		layerDiffID = fmt.Sprintf("sha256:%x", sha256.Sum256(layerContent))
+	})
+
+	it.After(func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	when("the compression is zstd", func() {
+		it("saves an OCI image with zstd layers and the config of the wrapped image", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionZstd, Level: 19})
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, layerDiffID))
+			h.AssertNil(t, img.SetLabel("some-label", "some-value"))
+			h.AssertNil(t, img.SetEnv("SOME_KEY", "some-value"))
+			h.AssertNil(t, img.SetEntrypoint("some-entrypoint"))
+			h.AssertNil(t, img.SetCmd("some-cmd"))
+			h.AssertNil(t, img.SetWorkingDir("/some/dir"))
+			topLayer, err := img.TopLayer()
+			h.AssertNil(t, err)
+			h.AssertEq(t, topLayer, layerDiffID)
+
+			h.AssertNil(t, img.Save(appName+":other"))
+
+			for _, n := range []string{appName, appName + ":other"} {
+				saved := readImage(n)
+				mediaType, err := saved.MediaType()
+				h.AssertNil(t, err)
+				h.AssertEq(t, mediaType, types.OCIManifestSchema1)
+
+				manifest, err := saved.Manifest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(manifest.Layers), 3)
+				h.AssertEq(t, manifest.Layers[0].MediaType, types.OCILayer)
+				h.AssertEq(t, manifest.Layers[2].MediaType, image.OCILayerZstd)
+				size, ok := img.CompressedLayerSize(layerDiffID)
+				h.AssertEq(t, ok, true)
+				h.AssertEq(t, size, manifest.Layers[2].Size)
+
+				cfg, err := saved.ConfigFile()
+				h.AssertNil(t, err)
+				h.AssertEq(t, cfg.RootFS.DiffIDs[2].String(), layerDiffID)
+				h.AssertEq(t, len(cfg.History), 3)
+				h.AssertEq(t, cfg.Config.Labels["some-label"], "some-value")
+				h.AssertContains(t, cfg.Config.Env, "SOME_KEY=some-value")
+				h.AssertEq(t, cfg.Config.Entrypoint, []string{"some-entrypoint"})
+				h.AssertEq(t, cfg.Config.Cmd, []string{"some-cmd"})
+				h.AssertEq(t, cfg.Config.WorkingDir, "/some/dir")
+
+				layer, err := saved.LayerByDiffID(cfg.RootFS.DiffIDs[2])
+				h.AssertNil(t, err)
+				compressed, err := layer.Compressed()
+				h.AssertNil(t, err)
+				rc, compression, err := archive.NewDecompressingReader(compressed)
+				h.AssertNil(t, err)
+				h.AssertEq(t, compression, archive.CompressionZstd)
+				actual, err := ioutil.ReadAll(rc)
+				h.AssertNil(t, err)
+				h.AssertNil(t, rc.Close())
+				h.AssertNil(t, compressed.Close())
+				h.AssertEq(t, actual, layerContent)
+
+				digest, err := saved.Digest()
+				h.AssertNil(t, err)
+				identifier, err := img.Identifier()
+				h.AssertNil(t, err)
+				h.AssertEq(t, identifier.String(), fmt.Sprintf("%s@%s", appName, digest))
+			}
+		})
+
+		it("reuses layers from the previous image", func() {
+			previous := newImage(image.CompressionOptions{Compression: archive.CompressionZstd})
+			h.AssertNil(t, previous.AddLayerWithDiffID(layerPath, layerDiffID))
+			h.AssertNil(t, previous.Save())
+
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionZstd, PreviousImageRef: appName}, remote.WithPreviousImage(appName))
+			h.AssertNil(t, img.ReuseLayer(layerDiffID))
+			_, ok := img.CompressedLayerSize(layerDiffID)
+			h.AssertEq(t, ok, false)
+			h.AssertNil(t, img.Save())
+
+			manifest, err := readImage(appName).Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(manifest.Layers), 3)
+			h.AssertEq(t, manifest.Layers[2].MediaType, image.OCILayerZstd)
+		})
+
+		it("fails to reuse a layer that is not in the previous image", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionZstd, PreviousImageRef: appName}, remote.WithPreviousImage(appName))
+			h.AssertNotNil(t, img.ReuseLayer(layerDiffID))
+		})
+	})
+
+	when("eStargz is enabled", func() {
+		var (
+			estargzPath   string
+			estargzDiffID string
+		)
+
+		it.Before(func() {
+			h.SkipIf(t, runtime.GOOS == "windows", "eStargz layers are not supported on Windows")
+			dir := filepath.Join(tmpDir, "some-dir")
+			h.AssertNil(t, os.MkdirAll(dir, 0755))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(dir, "some-file"), layerContent, 0600))
+			factory := &layers.Factory{ArtifactsDir: tmpDir, Logger: &log.Logger{Handler: memory.New()}, Converter: &stargz.Converter{}}
+			layer, err := factory.DirLayer("some-layer", dir)
+			h.AssertNil(t, err)
+			estargzPath, estargzDiffID = layer.TarPath, layer.Digest
+		})
+
+		it("saves the eStargz layers as they are with their TOC digest", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionGzip, Estargz: true})
+			h.AssertNil(t, img.AddLayerWithDiffID(estargzPath, estargzDiffID))
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, layerDiffID))
+			h.AssertNil(t, img.Save())
+
+			manifest, err := readImage(appName).Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(manifest.Layers), 4)
+
+			blob, err := ioutil.ReadFile(estargzPath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[2].MediaType, types.OCILayer)
+			h.AssertEq(t, manifest.Layers[2].Digest.String(), fmt.Sprintf("sha256:%x", sha256.Sum256(blob)))
+			r, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[2].Annotations[estargz.TOCJSONDigestAnnotation], r.TOCDigest().String())
+			rc, _, err := archive.NewDecompressingReader(bytes.NewReader(blob))
+			h.AssertNil(t, err)
+			uncompressed, err := io.Copy(ioutil.Discard, rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[2].Annotations[estargz.StoreUncompressedSizeAnnotation], strconv.FormatInt(uncompressed, 10))
+
+			h.AssertEq(t, manifest.Layers[3].MediaType, types.OCILayer)
+			h.AssertEq(t, len(manifest.Layers[3].Annotations), 0)
+		})
+
+		it("keeps the annotations of layers reused from the previous image", func() {
+			previous := newImage(image.CompressionOptions{Compression: archive.CompressionGzip, Estargz: true})
+			h.AssertNil(t, previous.AddLayerWithDiffID(estargzPath, estargzDiffID))
+			h.AssertNil(t, previous.Save())
+			previousManifest, err := readImage(appName).Manifest()
+			h.AssertNil(t, err)
+
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionGzip, Estargz: true, PreviousImageRef: appName}, remote.WithPreviousImage(appName))
+			h.AssertNil(t, img.ReuseLayer(estargzDiffID))
+			h.AssertNil(t, img.Save())
+
+			manifest, err := readImage(appName).Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[2], previousManifest.Layers[2])
+		})
+	})
+
+	when("the config is set", func() {
+		var createdAt = time.Unix(1234567890, 0).UTC()
+
+		it("saves the image once with the config applied", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionGzip})
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, layerDiffID))
+			h.AssertNil(t, img.SetLabel("some-label", "some-value"))
+			img.SetConfig(image.Config{
+				CreatedAt: createdAt,
+				History:   map[string]v1.History{layerDiffID: {CreatedBy: "some-buildpack"}},
+				User:      "some-user",
+			})
+			h.AssertNil(t, img.Save(appName+":other"))
+
+			for _, n := range []string{appName, appName + ":other"} {
+				h.AssertEq(t, manifestPushes(n), 1)
+				saved := readImage(n)
+				mediaType, err := saved.MediaType()
+				h.AssertNil(t, err)
+				h.AssertEq(t, mediaType, types.DockerManifestSchema2)
+				manifest, err := saved.Manifest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, manifest.Layers[2].MediaType, types.DockerLayer)
+
+				cfg, err := saved.ConfigFile()
+				h.AssertNil(t, err)
+				h.AssertEq(t, cfg.Created.Time.UTC(), createdAt)
+				h.AssertEq(t, cfg.Config.User, "some-user")
+				h.AssertEq(t, cfg.Config.Labels["some-label"], "some-value")
+				h.AssertEq(t, len(cfg.History), 3)
+				h.AssertEq(t, cfg.History[2].CreatedBy, "some-buildpack")
+				h.AssertEq(t, cfg.History[2].Created.Time.UTC(), createdAt)
+			}
+		})
+
+		it("builds on the base image it was opened with when the base image tag moves before it is saved", func() {
+			runImage, err := remote.NewImage(baseName, authn.DefaultKeychain, remote.FromBaseImage(baseName))
+			h.AssertNil(t, err)
+			runImageID, err := runImage.Identifier()
+			h.AssertNil(t, err)
+			wrapped, err := remote.NewImage(appName, authn.DefaultKeychain, remote.FromBaseImage(runImageID.String()))
+			h.AssertNil(t, err)
+			img := image.NewCompressedImage(wrapped, image.CompressionOptions{
+				Compression:  archive.CompressionGzip,
+				Keychain:     authn.DefaultKeychain,
+				BaseImageRef: runImageID.String(),
+			})
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, layerDiffID))
+			img.SetConfig(image.Config{History: map[string]v1.History{layerDiffID: {CreatedBy: "some-buildpack"}}})
+
+			moved, err := random.Image(10, 2)
+			h.AssertNil(t, err)
+			ref, err := name.ParseReference(baseName)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(ref, moved))
+			h.AssertNil(t, img.Save())
+
+			baseLayers, err := readImage(runImageID.String()).Layers()
+			h.AssertNil(t, err)
+			savedLayers, err := readImage(appName).Layers()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(savedLayers), len(baseLayers)+1)
+			for idx, layer := range baseLayers {
+				expected, err := layer.Digest()
+				h.AssertNil(t, err)
+				actual, err := savedLayers[idx].Digest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, actual, expected)
+			}
+		})
+
+		it("applies the config to an image with held back layers", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionZstd})
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, layerDiffID))
+			h.AssertNil(t, img.SetLabel("some-label", "some-value"))
+			img.SetConfig(image.Config{
+				CreatedAt:    createdAt,
+				History:      map[string]v1.History{layerDiffID: {CreatedBy: "some-buildpack"}},
+				ExposedPorts: []string{"8080/tcp"},
+				User:         "some-user",
+			})
+			h.AssertNil(t, img.Save(appName+":other"))
+
+			for _, n := range []string{appName, appName + ":other"} {
+				h.AssertEq(t, manifestPushes(n), 1)
+				saved := readImage(n)
+				mediaType, err := saved.MediaType()
+				h.AssertNil(t, err)
+				h.AssertEq(t, mediaType, types.OCIManifestSchema1)
+
+				cfg, err := saved.ConfigFile()
+				h.AssertNil(t, err)
+				h.AssertEq(t, cfg.Created.Time.UTC(), createdAt)
+				h.AssertEq(t, cfg.Config.User, "some-user")
+				h.AssertEq(t, cfg.Config.ExposedPorts, map[string]struct{}{"8080/tcp": {}})
+				h.AssertEq(t, cfg.Config.Labels["some-label"], "some-value")
+				h.AssertEq(t, len(cfg.History), 3)
+				h.AssertEq(t, cfg.History[2].CreatedBy, "some-buildpack")
+			}
+		})
+
+		it("saves an OCI image with the annotations", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionGzip})
+			annotations := map[string]string{"org.opencontainers.image.revision": "some-commit"}
+			img.SetConfig(image.Config{Annotations: annotations})
+			h.AssertNil(t, img.Save())
+
+			saved := readImage(appName)
+			mediaType, err := saved.MediaType()
+			h.AssertNil(t, err)
+			h.AssertEq(t, mediaType, types.OCIManifestSchema1)
+			manifest, err := saved.Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Annotations, annotations)
+		})
+	})
+
+	when("the compression is gzip", func() {
+		it("saves the layers compressed at the given level", func() {
+			img := newImage(image.CompressionOptions{Compression: archive.CompressionGzip, Level: 9})
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, layerDiffID))
+			h.AssertNil(t, img.Save())
+
+			saved := readImage(appName)
+			cfg, err := saved.ConfigFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, cfg.RootFS.DiffIDs[2].String(), layerDiffID)
+
+			layer, err := saved.LayerByDiffID(cfg.RootFS.DiffIDs[2])
+			h.AssertNil(t, err)
+			mediaType, err := layer.MediaType()
+			h.AssertNil(t, err)
+			h.AssertEq(t, mediaType, types.DockerLayer)
+			size, err := layer.Size()
+			h.AssertNil(t, err)
+			compressedSize, ok := img.CompressedLayerSize(layerDiffID)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, compressedSize, size)
+
+			compressed, err := layer.Compressed()
+			h.AssertNil(t, err)
+			defer compressed.Close()
+			expected, err := ioutil.ReadAll(compressed)
+			h.AssertNil(t, err)
+			var buf bytes.Buffer
+			w, err := archive.NewCompressingWriter(&buf, archive.CompressionGzip, 9)
+			h.AssertNil(t, err)
+			_, err = w.Write(layerContent)
+			h.AssertNil(t, err)
+			h.AssertNil(t, w.Close())
+			h.AssertEq(t, expected, buf.Bytes())
+		})
+	})
+}
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Config holds image config values that cannot be set through imgutil.Image.
+// They are written to the image config when the image is saved.
+type Config struct {
+	// CreatedAt, when non-zero, is used as the creation time of the image and of every history entry.
+	CreatedAt time.Time
+	// History holds the history entries of the layers added to the base image, keyed by layer diffID.
+	// Layers without an entry keep the history they have in the base image.
+	History map[string]v1.History
+	// ExposedPorts and Volumes are added to those of the base image, e.g. 8080/tcp and /data.
+	ExposedPorts []string
+	Volumes      []string
+	// StopSignal and User, when non-empty, override those of the base image.
+	StopSignal string
+	User       string
+	// Annotations are added to the manifest of the image. They are not kept by the docker daemon.
+	Annotations map[string]string
+}
+
+// IsEmpty returns true if the config does not modify the image.
+func (c Config) IsEmpty() bool {
+	return c.CreatedAt.IsZero() &&
+		len(c.History) == 0 &&
+		len(c.ExposedPorts) == 0 &&
+		len(c.Volumes) == 0 &&
+		c.StopSignal == "" &&
+		c.User == "" &&
+		len(c.Annotations) == 0
+}
+
+// Apply returns a copy of the given config file with the config values applied.
+func (c Config) Apply(cfg *v1.ConfigFile) *v1.ConfigFile {
+	cfg = cfg.DeepCopy()
+	if len(c.History) > 0 {
+		cfg.History = layerHistory(cfg)
+		layer := 0
+		for i := range cfg.History {
+			if cfg.History[i].EmptyLayer {
+				continue
+			}
+			if history, ok := c.History[cfg.RootFS.DiffIDs[layer].String()]; ok {
+				if history.Created.IsZero() {
+					history.Created = cfg.Created
+				}
+				cfg.History[i] = history
+			}
+			layer++
+		}
+	}
+	for _, port := range c.ExposedPorts {
+		if cfg.Config.ExposedPorts == nil {
+			cfg.Config.ExposedPorts = map[string]struct{}{}
+		}
+		cfg.Config.ExposedPorts[port] = struct{}{}
+	}
+	for _, volume := range c.Volumes {
+		if cfg.Config.Volumes == nil {
+			cfg.Config.Volumes = map[string]struct{}{}
+		}
+		cfg.Config.Volumes[volume] = struct{}{}
+	}
+	if c.StopSignal != "" {
+		cfg.Config.StopSignal = c.StopSignal
+	}
+	if c.User != "" {
+		cfg.Config.User = c.User
+	}
+	if !c.CreatedAt.IsZero() {
+		cfg.Created = v1.Time{Time: c.CreatedAt.UTC()}
+		for i := range cfg.History {
+			cfg.History[i].Created = v1.Time{Time: c.CreatedAt.UTC()}
+		}
+	}
+	return cfg
+}
+
+// layerHistory returns the history of the image, with one entry that is not an empty layer for each layer.
+// When the existing history does not match the layers, an empty entry is returned for each layer.
+func layerHistory(cfg *v1.ConfigFile) []v1.History {
+	var nonEmpty int
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			nonEmpty++
+		}
+	}
+	if nonEmpty != len(cfg.RootFS.DiffIDs) {
+		return make([]v1.History, len(cfg.RootFS.DiffIDs))
+	}
+	return cfg.History
+}
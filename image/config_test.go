@@ -0,0 +1,126 @@
+package image_test
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestConfig(t *testing.T) {
+	spec.Run(t, "Config", testConfig)
+}
+
+func testConfig(t *testing.T, when spec.G, it spec.S) {
+	when("#Apply", func() {
+		var cfg *v1.ConfigFile
+
+		it.Before(func() {
+			cfg = &v1.ConfigFile{
+				Created: v1.Time{Time: time.Date(1980, time.January, 1, 0, 0, 1, 0, time.UTC)},
+				History: []v1.History{{CreatedBy: "some-layer"}, {CreatedBy: "other-layer"}},
+			}
+		})
+
+		when("CreatedAt is set", func() {
+			it("sets the created time of the image and all history entries", func() {
+				createdAt := time.Unix(1234567890, 0).UTC()
+				applied := image.Config{CreatedAt: createdAt}.Apply(cfg)
+
+				h.AssertEq(t, applied.Created.Time, createdAt)
+				h.AssertEq(t, len(applied.History), 2)
+				for _, history := range applied.History {
+					h.AssertEq(t, history.Created.Time, createdAt)
+				}
+			})
+
+			it("does not modify the given config", func() {
+				image.Config{CreatedAt: time.Unix(1234567890, 0)}.Apply(cfg)
+				h.AssertEq(t, cfg.Created.Time, time.Date(1980, time.January, 1, 0, 0, 1, 0, time.UTC))
+			})
+		})
+
+		when("History is set", func() {
+			it.Before(func() {
+				cfg.RootFS.DiffIDs = []v1.Hash{{Algorithm: "sha256", Hex: "1"}, {Algorithm: "sha256", Hex: "2"}, {Algorithm: "sha256", Hex: "3"}}
+				cfg.History = []v1.History{
+					{CreatedBy: "some-base-layer"},
+					{CreatedBy: "some-base-env", EmptyLayer: true},
+					{CreatedBy: "other-base-layer"},
+					{CreatedBy: "some-layer"},
+				}
+			})
+
+			it("replaces the history of the layers with an entry", func() {
+				applied := image.Config{History: map[string]v1.History{
+					"sha256:3": {CreatedBy: "some-buildpack@1.2.3:some-layer"},
+				}}.Apply(cfg)
+
+				var createdBy []string
+				for _, history := range applied.History {
+					createdBy = append(createdBy, history.CreatedBy)
+				}
+				h.AssertEq(t, createdBy, []string{"some-base-layer", "some-base-env", "other-base-layer", "some-buildpack@1.2.3:some-layer"})
+				h.AssertEq(t, applied.History[3].Created, cfg.Created)
+			})
+
+			it("matches entries to layers by diffID", func() {
+				applied := image.Config{History: map[string]v1.History{
+					"sha256:2": {CreatedBy: "some-buildpack@1.2.3:some-layer"},
+					"sha256:4": {CreatedBy: "some-buildpack@1.2.3:missing-layer"},
+				}}.Apply(cfg)
+
+				var createdBy []string
+				for _, history := range applied.History {
+					createdBy = append(createdBy, history.CreatedBy)
+				}
+				h.AssertEq(t, createdBy, []string{"some-base-layer", "some-base-env", "some-buildpack@1.2.3:some-layer", "some-layer"})
+			})
+
+			when("the base history does not match the layers", func() {
+				it("adds empty entries for the layers without an entry", func() {
+					cfg.History = nil
+					applied := image.Config{History: map[string]v1.History{
+						"sha256:3": {CreatedBy: "some-buildpack@1.2.3:some-layer"},
+					}}.Apply(cfg)
+
+					h.AssertEq(t, len(applied.History), 3)
+					h.AssertEq(t, applied.History[0].CreatedBy, "")
+					h.AssertEq(t, applied.History[1].CreatedBy, "")
+					h.AssertEq(t, applied.History[2].CreatedBy, "some-buildpack@1.2.3:some-layer")
+				})
+			})
+		})
+
+		when("container config is set", func() {
+			it("adds exposed ports and volumes and overrides the stop signal and user", func() {
+				cfg.Config.ExposedPorts = map[string]struct{}{"80/tcp": {}}
+				cfg.Config.User = "root"
+
+				applied := image.Config{
+					ExposedPorts: []string{"8080/tcp"},
+					Volumes:      []string{"/data"},
+					StopSignal:   "SIGINT",
+					User:         "1000:1000",
+				}.Apply(cfg)
+
+				h.AssertEq(t, applied.Config.ExposedPorts, map[string]struct{}{"80/tcp": {}, "8080/tcp": {}})
+				h.AssertEq(t, applied.Config.Volumes, map[string]struct{}{"/data": {}})
+				h.AssertEq(t, applied.Config.StopSignal, "SIGINT")
+				h.AssertEq(t, applied.Config.User, "1000:1000")
+				h.AssertEq(t, cfg.Config.ExposedPorts, map[string]struct{}{"80/tcp": {}})
+			})
+		})
+
+		when("the config is empty", func() {
+			it("returns an equal config", func() {
+				h.AssertEq(t, image.Config{}.IsEmpty(), true)
+				h.AssertEq(t, image.Config{}.Apply(cfg), cfg)
+			})
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"time"
+
+	"github.com/buildpacks/imgutil"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ConfigWriter writes config values into an image while it is saved, so that the image is only written once.
+type ConfigWriter interface {
+	SetConfig(config Config)
+}
+
+// ConfigurableImage wraps an imgutil.Image so that config values not supported by imgutil.Image can be set.
+type ConfigurableImage struct {
+	imgutil.Image
+	config Config
+	writer ConfigWriter
+}
+
+func NewConfigurableImage(image imgutil.Image, writer ConfigWriter) *ConfigurableImage {
+	return &ConfigurableImage{
+		Image:  image,
+		writer: writer,
+	}
+}
+
+// Config returns the config values that will be written when the image is saved.
+func (i *ConfigurableImage) Config() Config {
+	return i.config
+}
+
+func (i *ConfigurableImage) SetCreatedAt(t time.Time) {
+	i.config.CreatedAt = t
+}
+
+func (i *ConfigurableImage) AddExposedPort(port string) {
+	i.config.ExposedPorts = append(i.config.ExposedPorts, port)
+}
+
+func (i *ConfigurableImage) AddVolume(path string) {
+	i.config.Volumes = append(i.config.Volumes, path)
+}
+
+func (i *ConfigurableImage) SetStopSignal(signal string) {
+	i.config.StopSignal = signal
+}
+
+func (i *ConfigurableImage) SetUser(user string) {
+	i.config.User = user
+}
+
+func (i *ConfigurableImage) SetAnnotation(key, value string) {
+	if i.config.Annotations == nil {
+		i.config.Annotations = map[string]string{}
+	}
+	i.config.Annotations[key] = value
+}
+
+// AddHistory records the history entry for the layer with the given diffID.
+func (i *ConfigurableImage) AddHistory(diffID, createdBy string) {
+	if i.config.History == nil {
+		i.config.History = map[string]v1.History{}
+	}
+	i.config.History[diffID] = v1.History{CreatedBy: createdBy}
+}
+
+// Save hands the config values to the writer and saves the underlying image.
+func (i *ConfigurableImage) Save(additionalNames ...string) error {
+	i.writer.SetConfig(i.config)
+	return i.Image.Save(additionalNames...)
+}
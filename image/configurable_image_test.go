@@ -0,0 +1,63 @@
+package image_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/buildpacks/imgutil/fakes"
+	"github.com/buildpacks/imgutil/local"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestConfigurableImage(t *testing.T) {
+	spec.Run(t, "ConfigurableImage", testConfigurableImage)
+}
+
+func testConfigurableImage(t *testing.T, when spec.G, it spec.S) {
+	var (
+		fakeImage    *fakes.Image
+		configWriter *fakeConfigWriter
+		subject      *image.ConfigurableImage
+	)
+
+	it.Before(func() {
+		fakeImage = fakes.NewImage("some-repo/app-image", "", local.IDIdentifier{ImageID: "some-image-id"})
+		configWriter = &fakeConfigWriter{}
+		subject = image.NewConfigurableImage(fakeImage, configWriter)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, fakeImage.Cleanup())
+	})
+
+	when("#Save", func() {
+		it("hands the config to the writer before saving the image", func() {
+			subject.SetCreatedAt(time.Unix(1234567890, 0))
+			subject.AddExposedPort("8080/tcp")
+
+			h.AssertNil(t, subject.Save("some-repo/app-image:other"))
+			h.AssertEq(t, configWriter.calls, 1)
+			h.AssertEq(t, configWriter.config.CreatedAt, time.Unix(1234567890, 0))
+			h.AssertEq(t, configWriter.config.ExposedPorts, []string{"8080/tcp"})
+			h.AssertContains(t, fakeImage.SavedNames(), "some-repo/app-image", "some-repo/app-image:other")
+		})
+
+		it("saves the image only once", func() {
+			h.AssertNil(t, subject.Save())
+			h.AssertEq(t, len(fakeImage.SavedNames()), 1)
+		})
+	})
+}
+
+type fakeConfigWriter struct {
+	calls  int
+	config image.Config
+}
+
+func (w *fakeConfigWriter) SetConfig(config image.Config) {
+	w.calls++
+	w.config = config
+}
@@ -1,9 +1,12 @@
 package image
 
 import (
-	"github.com/buildpacks/imgutil/remote"
+	"net/http"
+
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/pkg/errors"
 )
 
@@ -12,39 +15,28 @@ type RegistryInputs interface {
 	WriteableRegistryImages() []string
 }
 
-// ValidateDestinationTags ensures all tags are valid
-// daemon - when false (exporting to a registry), ensures all tags are on the same registry
-func ValidateDestinationTags(daemon bool, repoNames ...string) error {
-	var (
-		reg        string
-		registries = map[string]struct{}{}
-	)
-
+// ValidateDestinationTags ensures all tags are valid.
+// Tags may be on different registries: the image is saved to each of them.
+func ValidateDestinationTags(repoNames ...string) error {
 	for _, repoName := range repoNames {
-		ref, err := name.ParseReference(repoName, name.WeakValidation)
-		if err != nil {
+		if _, err := name.ParseReference(repoName, name.WeakValidation); err != nil {
 			return err
 		}
-		reg = ref.Context().RegistryStr()
-		registries[reg] = struct{}{}
-	}
-
-	if !daemon && len(registries) != 1 {
-		return errors.New("writing to multiple registries is unsupported")
 	}
-
 	return nil
 }
 
-func VerifyRegistryAccess(regInputs RegistryInputs, keychain authn.Keychain) error {
+// VerifyRegistryAccess ensures the keychain provides read access to the readable images and read/write access to the writeable images.
+// Transient failures checking read access and push permission are retried according to retryPolicy.
+func VerifyRegistryAccess(regInputs RegistryInputs, keychain authn.Keychain, retryPolicy *RetryPolicy) error {
 	for _, imageRef := range regInputs.ReadableRegistryImages() {
-		err := verifyReadAccess(imageRef, keychain)
+		err := verifyReadAccess(imageRef, keychain, retryPolicy)
 		if err != nil {
 			return err
 		}
 	}
 	for _, imageRef := range regInputs.WriteableRegistryImages() {
-		err := verifyReadWriteAccess(imageRef, keychain)
+		err := verifyReadWriteAccess(imageRef, keychain, retryPolicy)
 		if err != nil {
 			return err
 		}
@@ -52,18 +44,46 @@ func VerifyRegistryAccess(regInputs RegistryInputs, keychain authn.Keychain) err
 	return nil
 }
 
-func verifyReadAccess(imageRef string, keychain authn.Keychain) error {
-	img, _ := remote.NewImage(imageRef, keychain)
-	if !img.CheckReadAccess() {
+func verifyReadAccess(imageRef string, keychain authn.Keychain, retryPolicy *RetryPolicy) error {
+	if !checkReadAccess(imageRef, keychain, retryPolicy) {
 		return errors.Errorf("ensure registry read access to %s", imageRef)
 	}
 	return nil
 }
 
-func verifyReadWriteAccess(imageRef string, keychain authn.Keychain) error {
-	img, _ := remote.NewImage(imageRef, keychain)
-	if !img.CheckReadWriteAccess() {
+func verifyReadWriteAccess(imageRef string, keychain authn.Keychain, retryPolicy *RetryPolicy) error {
+	if !checkReadAccess(imageRef, keychain, retryPolicy) {
+		return errors.Errorf("ensure registry read/write access to %s", imageRef)
+	}
+	ref, err := name.ParseReference(imageRef, name.WeakValidation)
+	if err != nil {
+		return errors.Errorf("ensure registry read/write access to %s", imageRef)
+	}
+	if err := retryPolicy.Do("checking push permission for "+imageRef, func() error {
+		return ggcrremote.CheckPushPermission(ref, keychain, http.DefaultTransport)
+	}); err != nil {
 		return errors.Errorf("ensure registry read/write access to %s", imageRef)
 	}
 	return nil
 }
+
+// checkReadAccess returns true if the keychain provides read access to the image, like remote.Image#CheckReadAccess:
+// an image that does not exist yet is readable unless the registry denies access.
+func checkReadAccess(imageRef string, keychain authn.Keychain, retryPolicy *RetryPolicy) bool {
+	ref, err := name.ParseReference(imageRef, name.WeakValidation)
+	if err != nil {
+		return false
+	}
+	err = retryPolicy.Do("checking read access to "+imageRef, func() error {
+		_, err := ggcrremote.Head(ref, ggcrremote.WithAuthFromKeychain(keychain), ggcrremote.WithTransport(http.DefaultTransport))
+		return err
+	})
+	if err == nil {
+		return true
+	}
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.StatusCode != http.StatusUnauthorized && transportErr.StatusCode != http.StatusForbidden
+	}
+	return false
+}
@@ -1,8 +1,13 @@
 package image_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/sclevine/spec"
 
 	"github.com/buildpacks/lifecycle/image"
@@ -16,32 +21,76 @@ func TestImage(t *testing.T) {
 func testImage(t *testing.T, when spec.G, it spec.S) {
 	when("#ValidateDestinationTags", func() {
 		when("multiple registries are provided", func() {
-			when("daemon", func() {
-				it("does not return an error", func() {
-					err := image.ValidateDestinationTags(true, "some/repo", "gcr.io/other-repo:latest", "example.com/final-repo")
-					h.AssertNil(t, err)
-				})
-			})
-			when("registry", func() {
-				it("errors as unsupported", func() {
-					err := image.ValidateDestinationTags(false, "some/repo", "gcr.io/other-repo:latest", "example.com/final-repo")
-					h.AssertError(t, err, "writing to multiple registries is unsupported")
-				})
+			it("does not return an error", func() {
+				err := image.ValidateDestinationTags("some/repo", "gcr.io/other-repo:latest", "example.com/final-repo")
+				h.AssertNil(t, err)
 			})
 		})
 
 		when("a single registry is provided", func() {
 			it("does not return an error", func() {
-				err := image.ValidateDestinationTags(false, "gcr.io/some/repo", "gcr.io/other-repo:latest", "gcr.io/final-repo")
+				err := image.ValidateDestinationTags("gcr.io/some/repo", "gcr.io/other-repo:latest", "gcr.io/final-repo")
 				h.AssertNil(t, err)
 			})
 		})
 
 		when("the tag reference is invalid", func() {
 			it("errors", func() {
-				err := image.ValidateDestinationTags(false, "some/Repo")
+				err := image.ValidateDestinationTags("some/Repo")
 				h.AssertError(t, err, "could not parse reference: some/Repo")
 			})
 		})
 	})
+	when("#VerifyRegistryAccess", func() {
+		var (
+			server    *httptest.Server
+			imageName string
+			heads     int
+		)
+
+		it.Before(func() {
+			heads = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v2/" {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				heads++
+				if heads == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			serverURL, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			imageName = fmt.Sprintf("%s/some/run-image", serverURL.Host)
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		it("retries transient failures checking read access", func() {
+			policy := image.DefaultRetryPolicy(nil)
+			policy.Backoff = 0
+
+			h.AssertNil(t, image.VerifyRegistryAccess(registryInputs{readable: []string{imageName}}, authn.DefaultKeychain, policy))
+			h.AssertEq(t, heads, 2)
+			h.AssertEq(t, policy.Retries(), 1)
+		})
+	})
+}
+
+type registryInputs struct {
+	readable  []string
+	writeable []string
+}
+
+func (r registryInputs) ReadableRegistryImages() []string {
+	return r.readable
+}
+
+func (r registryInputs) WriteableRegistryImages() []string {
+	return r.writeable
 }
@@ -0,0 +1,125 @@
+package image
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+var (
+	DefaultRetryAttempts    = 3
+	DefaultRetryBackoff     = time.Second
+	DefaultRetryStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+type RetryLogger interface {
+	Warnf(fmt string, v ...interface{})
+}
+
+// RetryPolicy determines how registry (and cache blob store) reads and writes are retried when they fail with a transient error.
+// A nil *RetryPolicy runs each operation once.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times an operation is run, including the first attempt.
+	Attempts int
+	// Backoff is the delay before the first retry; it is doubled before each subsequent retry.
+	Backoff time.Duration
+	// StatusCodes are the registry response status codes that are retried.
+	// Timeouts and connections closed before a response is received are always retried.
+	StatusCodes []int
+	Logger      RetryLogger
+
+	retries int32
+}
+
+func DefaultRetryPolicy(logger RetryLogger) *RetryPolicy {
+	return &RetryPolicy{
+		Attempts:    DefaultRetryAttempts,
+		Backoff:     DefaultRetryBackoff,
+		StatusCodes: DefaultRetryStatusCodes,
+		Logger:      logger,
+	}
+}
+
+// Do runs fn until it succeeds, it fails with an error that is not retryable, or the attempts are exhausted.
+// The operation describes fn in log messages.
+func (p *RetryPolicy) Do(operation string, fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !p.retryable(err) {
+			return err
+		}
+		atomic.AddInt32(&p.retries, 1)
+		if p.Logger != nil {
+			p.Logger.Warnf("Retrying %s (attempt %d of %d) after %s: %s", operation, attempt+1, p.Attempts, backoff, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Retries returns the number of times an operation has been retried.
+func (p *RetryPolicy) Retries() int {
+	if p == nil {
+		return 0
+	}
+	return int(atomic.LoadInt32(&p.retries))
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	var saveErr imgutil.SaveError
+	if errors.As(err, &saveErr) {
+		for _, d := range saveErr.Errors {
+			if p.retryable(d.Cause) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return p.retryableStatus(transportErr.StatusCode)
+	}
+
+	var statusErr statusCoder
+	if errors.As(err, &statusErr) {
+		return p.retryableStatus(statusErr.HTTPStatusCode())
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (p *RetryPolicy) retryableStatus(statusCode int) bool {
+	for _, code := range p.StatusCodes {
+		if statusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// statusCoder is implemented by errors for HTTP responses other than registry responses, e.g. from a cache blob store.
+type statusCoder interface {
+	HTTPStatusCode() int
+}
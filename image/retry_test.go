@@ -0,0 +1,149 @@
+package image_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	spec.Run(t, "RetryPolicy", testRetryPolicy)
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Warnf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func testRetryPolicy(t *testing.T, when spec.G, it spec.S) {
+	var (
+		policy *image.RetryPolicy
+		logger *recordingLogger
+		calls  int
+	)
+
+	it.Before(func() {
+		logger = &recordingLogger{}
+		policy = image.DefaultRetryPolicy(logger)
+		policy.Backoff = 0
+		calls = 0
+	})
+
+	failWith := func(errs ...error) func() error {
+		return func() error {
+			calls++
+			if calls > len(errs) {
+				return nil
+			}
+			return errs[calls-1]
+		}
+	}
+
+	when("#Do", func() {
+		it("retries retryable status codes and counts the retries", func() {
+			badGateway := &transport.Error{StatusCode: http.StatusBadGateway}
+
+			err := policy.Do("saving some/image", failWith(badGateway, badGateway))
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, calls, 3)
+			h.AssertEq(t, policy.Retries(), 2)
+			h.AssertEq(t, len(logger.messages), 2)
+			h.AssertStringContains(t, logger.messages[0], "Retrying saving some/image (attempt 2 of 3)")
+			h.AssertStringContains(t, logger.messages[1], "Retrying saving some/image (attempt 3 of 3)")
+		})
+
+		it("returns the last error once the attempts are exhausted", func() {
+			unavailable := &transport.Error{StatusCode: http.StatusServiceUnavailable}
+
+			err := policy.Do("saving some/image", failWith(unavailable, unavailable, unavailable, unavailable))
+			h.AssertSameInstance(t, err, error(unavailable))
+
+			h.AssertEq(t, calls, 3)
+			h.AssertEq(t, policy.Retries(), 2)
+		})
+
+		it("does not retry status codes that are not configured", func() {
+			unauthorized := &transport.Error{StatusCode: http.StatusUnauthorized}
+
+			err := policy.Do("saving some/image", failWith(unauthorized))
+			h.AssertSameInstance(t, err, error(unauthorized))
+
+			h.AssertEq(t, calls, 1)
+			h.AssertEq(t, policy.Retries(), 0)
+			h.AssertEq(t, len(logger.messages), 0)
+		})
+
+		it("does not retry other errors", func() {
+			err := policy.Do("saving some/image", failWith(errors.New("some-error")))
+			h.AssertError(t, err, "some-error")
+
+			h.AssertEq(t, calls, 1)
+		})
+
+		it("retries save errors with a retryable cause", func() {
+			saveErr := imgutil.SaveError{Errors: []imgutil.SaveDiagnostic{
+				{ImageName: "some/image", Cause: errors.New("some-error")},
+				{ImageName: "some/image:tag", Cause: &transport.Error{StatusCode: http.StatusTooManyRequests}},
+			}}
+
+			err := policy.Do("saving some/image", failWith(saveErr))
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, calls, 2)
+		})
+
+		it("retries errors that report a retryable HTTP status code", func() {
+			wrapped := fmt.Errorf("uploading layer: %w", statusError(http.StatusServiceUnavailable))
+
+			err := policy.Do("uploading to some-cache", failWith(wrapped))
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, calls, 2)
+			h.AssertEq(t, policy.Retries(), 1)
+		})
+
+		it("does not retry errors that report another HTTP status code", func() {
+			notFound := statusError(http.StatusNotFound)
+
+			err := policy.Do("uploading to some-cache", failWith(notFound))
+			h.AssertSameInstance(t, err, error(notFound))
+
+			h.AssertEq(t, calls, 1)
+		})
+
+		when("the policy is nil", func() {
+			it("runs the operation once", func() {
+				var nilPolicy *image.RetryPolicy
+
+				err := nilPolicy.Do("saving some/image", failWith(&transport.Error{StatusCode: http.StatusBadGateway}))
+				h.AssertNotNil(t, err)
+
+				h.AssertEq(t, calls, 1)
+				h.AssertEq(t, nilPolicy.Retries(), 0)
+			})
+		})
+	})
+}
+
+// statusError is an error for an HTTP response that is not a registry response, like those returned by a cache blob store.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", int(e))
+}
+
+func (e statusError) HTTPStatusCode() int {
+	return int(e)
+}
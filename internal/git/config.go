@@ -0,0 +1,129 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// config holds the values of a git config file, keyed by section, subsection and key.
+// Includes are not followed.
+type config struct {
+	values  map[string]string
+	remotes []string // remotes are the names of the remotes, in the order they are configured
+}
+
+func readConfig(path string) (config, error) {
+	cfg := config{values: map[string]string{}}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+
+	var section, subsection string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.LastIndex(line, "]")
+			if end < 0 {
+				continue
+			}
+			section, subsection = parseSection(line[1:end])
+			if section == "remote" && subsection != "" && !contains(cfg.remotes, subsection) {
+				cfg.remotes = append(cfg.remotes, subsection)
+			}
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		value := "true" // a key without a value is a boolean
+		if len(parts) == 2 {
+			value = parseValue(parts[1])
+		}
+		cfg.values[configKey(section, subsection, strings.TrimSpace(parts[0]))] = value
+	}
+	return cfg, nil
+}
+
+// parseSection parses a section header, e.g. `remote "origin"` or the deprecated `remote.origin`.
+func parseSection(header string) (section, subsection string) {
+	if i := strings.Index(header, `"`); i >= 0 {
+		subsection = strings.TrimSuffix(header[i+1:], `"`)
+		subsection = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(subsection)
+		return strings.ToLower(strings.TrimSpace(header[:i])), subsection
+	}
+	parts := strings.SplitN(strings.TrimSpace(header), ".", 2)
+	if len(parts) == 2 {
+		return strings.ToLower(parts[0]), strings.ToLower(parts[1])
+	}
+	return strings.ToLower(parts[0]), ""
+}
+
+// parseValue removes quotes, escapes and trailing comments from a value.
+func parseValue(raw string) string {
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(raw[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
+
+func configKey(section, subsection, key string) string {
+	return strings.ToLower(section) + "\x00" + subsection + "\x00" + strings.ToLower(key)
+}
+
+func (c config) get(section, subsection, key string) string {
+	return c.values[configKey(section, subsection, key)]
+}
+
+// remoteURL returns the URL of the remote that branch tracks, else of origin, else of the first remote.
+func (c config) remoteURL(branch string) string {
+	if branch != "" {
+		if remote := c.get("branch", branch, "remote"); remote != "" {
+			if u := c.get("remote", remote, "url"); u != "" {
+				return u
+			}
+		}
+	}
+	if u := c.get("remote", "origin", "url"); u != "" {
+		return u
+	}
+	for _, remote := range c.remotes {
+		if u := c.get("remote", remote, "url"); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+func contains(vs []string, v string) bool {
+	for _, s := range vs {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
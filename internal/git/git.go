@@ -0,0 +1,401 @@
+// Package git reads the state of a git checkout directly from its .git directory, without a git binary.
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1" // #nosec G505 -- git object IDs
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+const SourceType = "git"
+
+type repository struct {
+	workTree  string
+	gitDir    string // gitDir holds HEAD and the index
+	commonDir string // commonDir holds the refs, objects and config, and differs from gitDir in linked worktrees
+	config    config
+	newHash   func() hash.Hash
+}
+
+// ProjectSource returns the project source describing the git checkout at dir: the commit of HEAD, the branch and
+// tags pointing at it, the URL of the remote without credentials, and whether tracked files have changed, which is
+// omitted when it can't be determined.
+// It returns nil if dir is not a git checkout or HEAD has no commits.
+func ProjectSource(dir string) (*platform.ProjectSource, error) {
+	repo, err := open(dir)
+	if err != nil || repo == nil {
+		return nil, err
+	}
+	branch, commit, err := repo.head()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading HEAD")
+	}
+	if commit == "" {
+		return nil, nil
+	}
+	tags, err := repo.tagsAt(commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading tags")
+	}
+	dirty, known, err := repo.dirty(commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "comparing the working tree with the index")
+	}
+
+	source := &platform.ProjectSource{
+		Type:     SourceType,
+		Version:  map[string]interface{}{"commit": commit},
+		Metadata: map[string]interface{}{},
+	}
+	if known {
+		source.Metadata["dirty"] = dirty
+	}
+	refs := tags
+	if branch != "" {
+		refs = append([]string{branch}, tags...)
+	}
+	if len(refs) > 0 {
+		source.Metadata["refs"] = refs
+	}
+	if remote := repo.config.remoteURL(branch); remote != "" {
+		source.Metadata["repository"] = stripCredentials(remote)
+	}
+	return source, nil
+}
+
+func open(dir string) (*repository, error) {
+	dotGit := filepath.Join(dir, ".git")
+	fi, err := os.Stat(dotGit)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	gitDir := dotGit
+	if !fi.IsDir() {
+		// linked worktrees and submodules point to their git dir
+		contents, err := ioutil.ReadFile(dotGit)
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSpace(string(contents))
+		if !strings.HasPrefix(line, "gitdir:") {
+			return nil, fmt.Errorf("invalid .git file '%s'", dotGit)
+		}
+		gitDir = resolvePath(dir, strings.TrimSpace(strings.TrimPrefix(line, "gitdir:")))
+	}
+	commonDir := gitDir
+	if contents, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = resolvePath(gitDir, strings.TrimSpace(string(contents)))
+	}
+
+	cfg, err := readConfig(filepath.Join(commonDir, "config"))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading git config")
+	}
+	repo := &repository{
+		workTree:  dir,
+		gitDir:    gitDir,
+		commonDir: commonDir,
+		config:    cfg,
+	}
+	switch format := cfg.get("extensions", "", "objectformat"); format {
+	case "", "sha1":
+		repo.newHash = sha1.New
+	case "sha256":
+		repo.newHash = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported object format '%s'", format)
+	}
+	return repo, nil
+}
+
+func resolvePath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+// head returns the branch checked out, which is empty when HEAD is detached, and the commit of HEAD,
+// which is empty when the branch has no commits.
+func (r *repository) head() (branch, commit string, err error) {
+	contents, err := ioutil.ReadFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	head := strings.TrimSpace(string(contents))
+	if !strings.HasPrefix(head, "ref: ") {
+		return "", head, nil
+	}
+	ref := strings.TrimSpace(strings.TrimPrefix(head, "ref: "))
+	commit, err = r.resolve(ref)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), commit, nil
+}
+
+// resolve returns the object that ref points to, following symbolic refs, or an empty string if ref does not exist.
+func (r *repository) resolve(ref string) (string, error) {
+	for i := 0; i < 5; i++ {
+		contents, err := ioutil.ReadFile(filepath.Join(r.commonDir, filepath.FromSlash(ref)))
+		if err == nil {
+			target := strings.TrimSpace(string(contents))
+			if strings.HasPrefix(target, "ref: ") {
+				ref = strings.TrimSpace(strings.TrimPrefix(target, "ref: "))
+				continue
+			}
+			return target, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		packed, err := r.packedRefs()
+		if err != nil {
+			return "", err
+		}
+		return packed[ref].target, nil
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs for '%s'", ref)
+}
+
+type packedRef struct {
+	target string
+	peeled string // peeled is the object that an annotated tag points to
+}
+
+func (r *repository) packedRefs() (map[string]packedRef, error) {
+	refs := map[string]packedRef{}
+	contents, err := ioutil.ReadFile(filepath.Join(r.commonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return refs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var last string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "^"):
+			if ref, ok := refs[last]; ok {
+				ref.peeled = strings.TrimPrefix(line, "^")
+				refs[last] = ref
+			}
+		default:
+			fields := strings.Fields(line)
+			if len(fields) == 2 {
+				last = fields[1]
+				refs[last] = packedRef{target: fields[0]}
+			}
+		}
+	}
+	return refs, nil
+}
+
+// tagsAt returns the names of the tags that point at commit, either directly or through an annotated tag.
+func (r *repository) tagsAt(commit string) ([]string, error) {
+	tags := map[string]string{} // loose refs take precedence over packed refs
+	tagsDir := filepath.Join(r.commonDir, "refs", "tags")
+	err := filepath.Walk(tagsDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(tagsDir, path)
+		if err != nil {
+			return err
+		}
+		tags[filepath.ToSlash(rel)] = strings.TrimSpace(string(contents))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	packed, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for ref, p := range packed {
+		name := strings.TrimPrefix(ref, "refs/tags/")
+		if _, loose := tags[name]; name == ref || loose {
+			continue
+		}
+		if p.target == commit || p.peeled == commit {
+			names = append(names, name)
+		}
+	}
+	for name, target := range tags {
+		peeled, err := r.peel(target)
+		if err != nil {
+			return nil, err
+		}
+		if peeled == commit {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// peel returns the object that the annotated tag with the given ID points to, or the ID if it is not a tag object.
+func (r *repository) peel(id string) (string, error) {
+	for i := 0; i < 5; i++ {
+		kind, body, err := r.readObject(id)
+		if err != nil || kind != "tag" {
+			return id, err
+		}
+		target := header(body, "object")
+		if target == "" {
+			return id, nil
+		}
+		id = target
+	}
+	return id, nil
+}
+
+// readObject reads a loose or packed object. It returns an empty kind if the object is not in the repository,
+// e.g. when it is only in an alternate object store.
+func (r *repository) readObject(id string) (kind string, body []byte, err error) {
+	return r.readObjectAt(id, 0)
+}
+
+// readObjectAt reads an object that is the base of a chain of depth deltas.
+func (r *repository) readObjectAt(id string, depth int) (kind string, body []byte, err error) {
+	kind, body, err = r.readLooseObject(id)
+	if err != nil || kind != "" {
+		return kind, body, err
+	}
+	return r.readPackedObject(id, depth)
+}
+
+// readLooseObject reads a loose object. It returns an empty kind if the object is not loose.
+func (r *repository) readLooseObject(id string) (kind string, body []byte, err error) {
+	if len(id) < 3 {
+		return "", nil, nil
+	}
+	f, err := os.Open(filepath.Join(r.commonDir, "objects", id[:2], id[2:]))
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "reading object '%s'", id)
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "reading object '%s'", id)
+	}
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return "", nil, fmt.Errorf("invalid object '%s'", id)
+	}
+	kind = strings.SplitN(string(data[:nul]), " ", 2)[0]
+	return kind, data[nul+1:], nil
+}
+
+// header returns the value of the given header of a commit or tag object.
+func header(body []byte, name string) string {
+	for _, line := range strings.Split(string(body), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimPrefix(line, name+" ")
+		}
+	}
+	return ""
+}
+
+// dirty returns true if the index has changes that are not committed, or if tracked files in the working tree differ
+// from the index. Untracked files are ignored. Staged changes are only detected when the index records the tree it
+// was last written from. known is false when there is no index, or when the commit can't be read to compare its tree
+// with the index.
+func (r *repository) dirty(commit string) (dirty, known bool, err error) {
+	idx, err := readIndex(filepath.Join(r.gitDir, "index"), r.newHash().Size())
+	if os.IsNotExist(err) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	staged, known, err := r.staged(idx, commit)
+	if err != nil || !known || staged {
+		return staged, known, err
+	}
+	fileMode := r.config.get("core", "", "filemode") != "false"
+	for _, entry := range idx.entries {
+		changed, err := r.changed(entry, fileMode)
+		if err != nil || changed {
+			return changed, err == nil, err
+		}
+	}
+	return false, true, nil
+}
+
+func (r *repository) staged(idx *index, commit string) (staged, known bool, err error) {
+	if idx.tree == nil {
+		return false, true, nil
+	}
+	if idx.tree.invalid {
+		return true, true, nil
+	}
+	kind, body, err := r.readObject(commit)
+	if err != nil || kind != "commit" {
+		return false, false, err
+	}
+	return header(body, "tree") != idx.tree.id, true, nil
+}
+
+// hashBlob returns the ID of a blob with the given contents.
+func (r *repository) hashBlob(contents []byte) string {
+	h := r.newHash()
+	fmt.Fprintf(h, "blob %d\x00", len(contents))
+	h.Write(contents)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stripCredentials removes the user info from http(s) URLs, which may hold a token, and the password from other URLs.
+// scp-like addresses, e.g. git@github.com:org/repo.git, are returned as they are.
+func stripCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.Scheme == "" || u.User == nil {
+		return remote
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		u.User = nil
+	} else {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
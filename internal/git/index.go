@@ -0,0 +1,248 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	modeTypeMask = 0170000
+	modeSymlink  = 0120000
+	modeGitlink  = 0160000
+)
+
+var errTruncatedIndex = errors.New("index is truncated")
+
+// index holds the entries of the index and the cached tree of its root, see
+// https://git-scm.com/docs/index-format.
+type index struct {
+	entries []indexEntry
+	tree    *cachedTree // tree is nil when the index has no TREE extension
+}
+
+type indexEntry struct {
+	path         string
+	mtimeSec     uint32
+	mtimeNsec    uint32
+	mode         uint32
+	size         uint32
+	id           string
+	stage        uint16
+	skipWorktree bool
+}
+
+type cachedTree struct {
+	invalid bool // invalid is true when entries were added or changed since the tree was computed
+	id      string
+}
+
+type indexReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *indexReader) next(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.err = errTruncatedIndex
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *indexReader) uint32() uint32 {
+	return binary.BigEndian.Uint32(r.next(4))
+}
+
+func (r *indexReader) uint16() uint16 {
+	return binary.BigEndian.Uint16(r.next(2))
+}
+
+// untilNUL returns the bytes up to the next NUL and skips the NUL.
+func (r *indexReader) untilNUL() []byte {
+	if r.err != nil {
+		return nil
+	}
+	n := bytes.IndexByte(r.data[r.pos:], 0)
+	if n < 0 {
+		r.err = errTruncatedIndex
+		return nil
+	}
+	b := r.next(n)
+	r.pos++
+	return b
+}
+
+// varint reads the offset encoding used by index version 4.
+func (r *indexReader) varint() int {
+	c := r.next(1)[0]
+	value := int(c & 0x7f)
+	for c&0x80 != 0 && r.err == nil {
+		c = r.next(1)[0]
+		value = ((value + 1) << 7) | int(c&0x7f)
+	}
+	return value
+}
+
+func readIndex(path string, hashSize int) (*index, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &indexReader{data: data}
+	if string(r.next(4)) != "DIRC" {
+		return nil, errors.New("invalid index signature")
+	}
+	version := r.uint32()
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+
+	idx := &index{}
+	count := r.uint32()
+	var previous string
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		start := r.pos
+		entry := indexEntry{}
+		r.next(8) // ctime
+		entry.mtimeSec = r.uint32()
+		entry.mtimeNsec = r.uint32()
+		r.next(8) // dev, ino
+		entry.mode = r.uint32()
+		r.next(8) // uid, gid
+		entry.size = r.uint32()
+		entry.id = hex.EncodeToString(r.next(hashSize))
+		flags := r.uint16()
+		entry.stage = (flags >> 12) & 0x3
+		if flags&0x4000 != 0 {
+			extended := r.uint16()
+			entry.skipWorktree = extended&0x4000 != 0
+		}
+		if version == 4 {
+			// paths are prefix-compressed against the previous entry
+			strip := r.varint()
+			if strip > len(previous) {
+				return nil, errors.New("invalid index entry path")
+			}
+			entry.path = previous[:len(previous)-strip] + string(r.untilNUL())
+		} else {
+			entry.path = string(r.untilNUL())
+			// entries are padded with 1-8 NULs to a multiple of 8 bytes
+			r.next((8 - (r.pos-start)%8) % 8)
+		}
+		previous = entry.path
+		idx.entries = append(idx.entries, entry)
+	}
+
+	for r.err == nil && r.pos+8 <= len(data)-hashSize {
+		signature := string(r.next(4))
+		size := int(r.uint32())
+		body := r.next(size)
+		if signature == "TREE" {
+			idx.tree = readCachedTree(body, hashSize)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return idx, nil
+}
+
+// readCachedTree reads the root of the TREE extension, which comes first.
+func readCachedTree(body []byte, hashSize int) *cachedTree {
+	r := &indexReader{data: body}
+	if path := r.untilNUL(); len(path) != 0 || r.err != nil {
+		return nil
+	}
+	line := r.data[r.pos:]
+	n := bytes.IndexByte(line, '\n')
+	if n < 0 {
+		return nil
+	}
+	var entries, subtrees int
+	if _, err := fmt.Sscanf(string(line[:n]), "%d %d", &entries, &subtrees); err != nil {
+		return nil
+	}
+	r.next(n + 1)
+	if entries < 0 {
+		return &cachedTree{invalid: true}
+	}
+	id := r.next(hashSize)
+	if r.err != nil {
+		return nil
+	}
+	return &cachedTree{id: hex.EncodeToString(id)}
+}
+
+// changed returns true if the file of the entry in the working tree differs from the index.
+// The file is hashed only when its size and mode match the entry, but its modification time does not.
+func (r *repository) changed(entry indexEntry, fileMode bool) (bool, error) {
+	if entry.stage != 0 {
+		return true, nil // unmerged
+	}
+	if entry.skipWorktree || entry.mode&modeTypeMask == modeGitlink {
+		return false, nil
+	}
+	path := filepath.Join(r.workTree, filepath.FromSlash(entry.path))
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if entry.mode&modeTypeMask == modeSymlink {
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return true, nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false, err
+		}
+		return r.hashBlob([]byte(filepath.ToSlash(target))) != entry.id, nil
+	}
+
+	if !fi.Mode().IsRegular() {
+		return true, nil
+	}
+	if fileMode && runtime.GOOS != "windows" && (fi.Mode()&0100 != 0) != (entry.mode&0100 != 0) {
+		return true, nil
+	}
+	if uint32(fi.Size()) != entry.size {
+		return true, nil
+	}
+	mtime := fi.ModTime()
+	if uint32(mtime.Unix()) == entry.mtimeSec && uint32(mtime.Nanosecond()) == entry.mtimeNsec {
+		return false, nil
+	}
+	id, err := r.hashFile(path, fi.Size())
+	if err != nil {
+		return false, err
+	}
+	return id != entry.id, nil
+}
+
+func (r *repository) hashFile(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := r.newHash()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
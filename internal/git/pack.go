@@ -0,0 +1,301 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// object types in pack files, see https://git-scm.com/docs/pack-format.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// maxDeltaDepth bounds the delta chains that are followed, which git limits to 4095.
+const maxDeltaDepth = 4095
+
+var packKinds = map[byte]string{
+	packCommit: "commit",
+	packTree:   "tree",
+	packBlob:   "blob",
+	packTag:    "tag",
+}
+
+// readPackedObject reads an object from the pack files of the repository.
+// It returns an empty kind if the object is not in a pack file.
+func (r *repository) readPackedObject(id string, depth int) (kind string, body []byte, err error) {
+	name, err := hex.DecodeString(id)
+	if err != nil || len(name) != r.newHash().Size() {
+		return "", nil, nil
+	}
+	indexes, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "pack-*.idx"))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, idxPath := range indexes {
+		offset, ok, err := findPackOffset(idxPath, name)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "reading pack index '%s'", idxPath)
+		}
+		if !ok {
+			continue
+		}
+		kind, body, err := r.readPackEntry(strings.TrimSuffix(idxPath, ".idx")+".pack", offset, depth)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "reading object '%s'", id)
+		}
+		return kind, body, nil
+	}
+	return "", nil, nil
+}
+
+// findPackOffset returns the offset of the object with the given name in the pack of the version 2 index at idxPath.
+func findPackOffset(idxPath string, name []byte) (int64, bool, error) {
+	f, err := os.Open(idxPath)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	readAt := func(n int, off int64) ([]byte, error) {
+		b := make([]byte, n)
+		if _, err := f.ReadAt(b, off); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("pack index is truncated")
+			}
+			return nil, err
+		}
+		return b, nil
+	}
+
+	header, err := readAt(8, 0)
+	if err != nil {
+		return 0, false, err
+	}
+	if !bytes.Equal(header[:4], []byte("\377tOc")) {
+		return 0, false, errors.New("unsupported pack index version 1")
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != 2 {
+		return 0, false, fmt.Errorf("unsupported pack index version %d", version)
+	}
+	fanout, err := readAt(256*4, 8)
+	if err != nil {
+		return 0, false, err
+	}
+	var lo uint32
+	if name[0] > 0 {
+		lo = binary.BigEndian.Uint32(fanout[(int(name[0])-1)*4:])
+	}
+	hi := binary.BigEndian.Uint32(fanout[int(name[0])*4:])
+	count := int64(binary.BigEndian.Uint32(fanout[255*4:]))
+	namesStart := int64(8 + 256*4)
+	hashSize := int64(len(name))
+
+	// the names are sorted, and the fanout gives the range of the names starting with the first byte
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		candidate, err := readAt(len(name), namesStart+int64(mid)*hashSize)
+		if err != nil {
+			return 0, false, err
+		}
+		switch cmp := bytes.Compare(candidate, name); {
+		case cmp < 0:
+			lo = mid + 1
+		case cmp > 0:
+			hi = mid
+		default:
+			offsetsStart := namesStart + count*hashSize + count*4 // the names are followed by their CRC32s
+			b, err := readAt(4, offsetsStart+int64(mid)*4)
+			if err != nil {
+				return 0, false, err
+			}
+			offset := binary.BigEndian.Uint32(b)
+			if offset&0x80000000 == 0 {
+				return int64(offset), true, nil
+			}
+			// large offsets are stored in a table after the offsets
+			b, err = readAt(8, offsetsStart+count*4+int64(offset&0x7fffffff)*8)
+			if err != nil {
+				return 0, false, err
+			}
+			return int64(binary.BigEndian.Uint64(b)), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// readPackEntry reads the object at offset in the pack at packPath, resolving deltas against their base objects.
+func (r *repository) readPackEntry(packPath string, offset int64, depth int) (kind string, body []byte, err error) {
+	if depth > maxDeltaDepth {
+		return "", nil, errors.New("delta chain is too long")
+	}
+	f, err := os.Open(packPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	c, err := br.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	typ := (c >> 4) & 0x7
+	for c&0x80 != 0 { // the rest of the size, which is not needed as the data is zlib compressed
+		if c, err = br.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseKind string
+	var base []byte
+	switch typ {
+	case packCommit, packTree, packBlob, packTag:
+	case packOfsDelta:
+		rel, err := readOffset(br)
+		if err != nil {
+			return "", nil, err
+		}
+		if rel <= 0 || rel > offset {
+			return "", nil, errors.New("invalid delta base offset")
+		}
+		if baseKind, base, err = r.readPackEntry(packPath, offset-rel, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		name := make([]byte, r.newHash().Size())
+		if _, err := io.ReadFull(br, name); err != nil {
+			return "", nil, err
+		}
+		baseID := hex.EncodeToString(name)
+		if baseKind, base, err = r.readObjectAt(baseID, depth+1); err != nil {
+			return "", nil, err
+		}
+		if baseKind == "" {
+			return "", nil, fmt.Errorf("missing delta base '%s'", baseID)
+		}
+	default:
+		return "", nil, fmt.Errorf("invalid object type %d", typ)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+	if base == nil {
+		return packKinds[typ], data, nil
+	}
+	data, err = applyDelta(base, data)
+	if err != nil {
+		return "", nil, err
+	}
+	return baseKind, data, nil
+}
+
+// readOffset reads the negative offset of the base of an offset delta.
+func readOffset(br io.ByteReader) (int64, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	value := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+		value = ((value + 1) << 7) | int64(c&0x7f)
+	}
+	return value, nil
+}
+
+// applyDelta returns the object that the delta builds from base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	r := bytes.NewReader(delta)
+	size := func() (int, error) {
+		var value, shift int
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return 0, errInvalid
+			}
+			value |= int(c&0x7f) << shift
+			if c&0x80 == 0 {
+				return value, nil
+			}
+			shift += 7
+		}
+	}
+	baseSize, err := size()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, errInvalid
+	}
+	targetSize, err := size()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, targetSize)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		if op&0x80 == 0 {
+			// insert the next op bytes of the delta
+			if op == 0 || int(op) > r.Len() {
+				return nil, errInvalid
+			}
+			b := make([]byte, op)
+			_, _ = r.Read(b)
+			out = append(out, b...)
+			continue
+		}
+		// copy from base: the bits of op tell which bytes of the offset and size follow
+		var offset, n int
+		for i := uint(0); i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, errInvalid
+			}
+			if i < 4 {
+				offset |= int(c) << (8 * i)
+			} else {
+				n |= int(c) << (8 * (i - 4))
+			}
+		}
+		if n == 0 {
+			n = 0x10000
+		}
+		if offset+n > len(base) {
+			return nil, errInvalid
+		}
+		out = append(out, base[offset:offset+n]...)
+	}
+	if len(out) != targetSize {
+		return nil, errInvalid
+	}
+	return out, nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/buildpack"
 	io2 "github.com/buildpacks/lifecycle/internal/io"
 	"github.com/buildpacks/lifecycle/launch"
@@ -69,7 +70,7 @@ func (r *DefaultSBOMRestorer) RestoreFromPrevious(image imgutil.Image, layerDige
 	}
 	defer rc.Close()
 
-	return layers.Extract(rc, "")
+	return layers.ExtractVerified(rc, "", layerDigest, archive.ExtractOptions{Root: r.layersDir})
 }
 
 func (r *DefaultSBOMRestorer) RestoreFromCache(cache Cache, layerDigest string) error {
@@ -85,7 +86,7 @@ func (r *DefaultSBOMRestorer) RestoreFromCache(cache Cache, layerDigest string)
 	}
 	defer rc.Close()
 
-	return layers.Extract(rc, "")
+	return layers.ExtractVerified(rc, "", layerDigest, archive.ExtractOptions{Root: r.layersDir})
 }
 
 func (r *DefaultSBOMRestorer) RestoreToBuildpackLayers(detectedBps []buildpack.GroupBuildpack) error {
@@ -0,0 +1,173 @@
+package launch
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ProcessDescription describes a process type as it would be launched.
+type ProcessDescription struct {
+	Type             string   `json:"type"`
+	Command          string   `json:"command"`
+	Args             []string `json:"args"`
+	Direct           bool     `json:"direct"`
+	WorkingDirectory string   `json:"workingDirectory"`
+	BuildpackID      string   `json:"buildpackID"`
+	Default          bool     `json:"default"`
+}
+
+// DescribeProcesses returns a description of each process type.
+// It does not modify the environment or run any profile or exec.d scripts.
+func (l *Launcher) DescribeProcesses() []ProcessDescription {
+	descriptions := make([]ProcessDescription, 0, len(l.Processes))
+	for _, proc := range l.Processes {
+		descriptions = append(descriptions, l.describe(proc))
+	}
+	return descriptions
+}
+
+// DescribeProcess returns a description of the given process type.
+// It does not modify the environment or run any profile or exec.d scripts.
+func (l *Launcher) DescribeProcess(procType string) (ProcessDescription, error) {
+	proc, ok := l.findProcessType(procType)
+	if !ok {
+		return ProcessDescription{}, fmt.Errorf("process type %s was not found", procType)
+	}
+	return l.describe(proc), nil
+}
+
+func (l *Launcher) describe(proc Process) ProcessDescription {
+	args := proc.Args
+	if args == nil {
+		args = []string{}
+	}
+	return ProcessDescription{
+		Type:             proc.Type,
+		Command:          proc.Command,
+		Args:             args,
+		Direct:           proc.Direct,
+		WorkingDirectory: getProcessWorkingDirectory(proc, l.AppDir),
+		BuildpackID:      proc.BuildpackID,
+		Default:          proc.Type != "" && proc.Type == l.DefaultProcessType,
+	}
+}
+
+// WriteProcessDescriptions writes the descriptions to w as JSON when asJSON is true and as text otherwise.
+func WriteProcessDescriptions(w io.Writer, descriptions []ProcessDescription, asJSON bool) error {
+	if asJSON {
+		var b strings.Builder
+		b.WriteString("[")
+		for i, d := range descriptions {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n  ")
+			d.writeJSON(&b, "  ")
+		}
+		if len(descriptions) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("]\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	for i, d := range descriptions {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if err := d.writeText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteProcessDescription writes the description to w as JSON when asJSON is true and as text otherwise.
+func WriteProcessDescription(w io.Writer, description ProcessDescription, asJSON bool) error {
+	if asJSON {
+		var b strings.Builder
+		description.writeJSON(&b, "")
+		b.WriteString("\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return description.writeText(w)
+}
+
+func (d ProcessDescription) writeText(w io.Writer) error {
+	title := d.Type
+	if d.Default {
+		title += " (default)"
+	}
+	_, err := fmt.Fprintf(w, "%s\n  command: %s\n  args: %q\n  direct: %t\n  working directory: %s\n  buildpack: %s\n",
+		title,
+		d.Command,
+		d.Args,
+		d.Direct,
+		d.WorkingDirectory,
+		d.BuildpackID,
+	)
+	return err
+}
+
+// writeJSON writes the description as a JSON object indented by two spaces, starting at the given indent.
+// The JSON is written by hand, as encoding/json would add most of a megabyte to the launcher.
+func (d ProcessDescription) writeJSON(b *strings.Builder, indent string) {
+	field := func(name, value string, last bool) {
+		b.WriteString("\n" + indent + "  " + jsonString(name) + ": " + value)
+		if !last {
+			b.WriteString(",")
+		}
+	}
+	args := "[]"
+	if len(d.Args) > 0 {
+		var ab strings.Builder
+		ab.WriteString("[")
+		for i, arg := range d.Args {
+			if i > 0 {
+				ab.WriteString(",")
+			}
+			ab.WriteString("\n" + indent + "    " + jsonString(arg))
+		}
+		ab.WriteString("\n" + indent + "  ]")
+		args = ab.String()
+	}
+	b.WriteString("{")
+	field("type", jsonString(d.Type), false)
+	field("command", jsonString(d.Command), false)
+	field("args", args, false)
+	field("direct", strconv.FormatBool(d.Direct), false)
+	field("workingDirectory", jsonString(d.WorkingDirectory), false)
+	field("buildpackID", jsonString(d.BuildpackID), false)
+	field("default", strconv.FormatBool(d.Default), true)
+	b.WriteString("\n" + indent + "}")
+}
+
+// jsonString returns s as a JSON string. Invalid UTF-8 is replaced with U+FFFD, as encoding/json does.
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s { // ranging over a string yields utf8.RuneError for invalid bytes
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package launch_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/launch/testmock"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestDescribe(t *testing.T) {
+	spec.Run(t, "Describe", testDescribe, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testDescribe(t *testing.T, when spec.G, it spec.S) {
+	var (
+		launcher *launch.Launcher
+		mockCtrl *gomock.Controller
+	)
+
+	it.Before(func() {
+		mockCtrl = gomock.NewController(t)
+		// no calls are expected: describing processes must not modify the env or run exec.d
+		launcher = &launch.Launcher{
+			DefaultProcessType: "web",
+			AppDir:             "/some-app",
+			Processes: []launch.Process{
+				{Type: "web", Command: "web-cmd", Args: []string{"some arg"}, Direct: true, BuildpackID: "some/buildpack"},
+				{Type: "worker", Command: "worker-cmd", WorkingDirectory: "/some-dir", BuildpackID: "other/buildpack"},
+			},
+			Env:   testmock.NewMockEnv(mockCtrl),
+			ExecD: testmock.NewMockExecD(mockCtrl),
+		}
+	})
+
+	it.After(func() {
+		mockCtrl.Finish()
+	})
+
+	when("#DescribeProcesses", func() {
+		it("describes each process", func() {
+			h.AssertEq(t, launcher.DescribeProcesses(), []launch.ProcessDescription{
+				{
+					Type:             "web",
+					Command:          "web-cmd",
+					Args:             []string{"some arg"},
+					Direct:           true,
+					WorkingDirectory: "/some-app",
+					BuildpackID:      "some/buildpack",
+					Default:          true,
+				},
+				{
+					Type:             "worker",
+					Command:          "worker-cmd",
+					Args:             []string{},
+					WorkingDirectory: "/some-dir",
+					BuildpackID:      "other/buildpack",
+				},
+			})
+		})
+	})
+
+	when("#DescribeProcess", func() {
+		it("describes the process", func() {
+			description, err := launcher.DescribeProcess("worker")
+			h.AssertNil(t, err)
+			h.AssertEq(t, description.Command, "worker-cmd")
+			h.AssertEq(t, description.Default, false)
+		})
+
+		it("returns an error for an unknown process type", func() {
+			_, err := launcher.DescribeProcess("missing")
+			h.AssertError(t, err, "process type missing was not found")
+		})
+	})
+
+	when("#WriteProcessDescriptions", func() {
+		it("writes text", func() {
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, launch.WriteProcessDescriptions(buf, launcher.DescribeProcesses(), false))
+			h.AssertEq(t, buf.String(), `web (default)
+  command: web-cmd
+  args: ["some arg"]
+  direct: true
+  working directory: /some-app
+  buildpack: some/buildpack
+
+worker
+  command: worker-cmd
+  args: []
+  direct: false
+  working directory: /some-dir
+  buildpack: other/buildpack
+`)
+		})
+
+		it("writes JSON", func() {
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, launch.WriteProcessDescriptions(buf, launcher.DescribeProcesses(), true))
+			var descriptions []launch.ProcessDescription
+			h.AssertNil(t, json.Unmarshal(buf.Bytes(), &descriptions))
+			h.AssertEq(t, descriptions, launcher.DescribeProcesses())
+			h.AssertStringContains(t, buf.String(), `"workingDirectory": "/some-app"`)
+		})
+
+		it("writes the same JSON as encoding/json", func() {
+			descriptions := []launch.ProcessDescription{
+				{Type: "web", Command: `say "hi" \ <there> & bye`, Args: []string{"a\nb\tc\r", "\x01\x1f", "\u2028é😀"}, Default: true},
+				{Type: "worker", Args: []string{}},
+			}
+			for _, list := range [][]launch.ProcessDescription{descriptions, {}} {
+				buf := &bytes.Buffer{}
+				h.AssertNil(t, launch.WriteProcessDescriptions(buf, list, true))
+				h.AssertEq(t, buf.String(), encodeJSON(t, list))
+			}
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, launch.WriteProcessDescription(buf, descriptions[0], true))
+			h.AssertEq(t, buf.String(), encodeJSON(t, descriptions[0]))
+		})
+
+		it("replaces invalid UTF-8 in JSON", func() {
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, launch.WriteProcessDescription(buf, launch.ProcessDescription{Command: "some\xffcmd", Args: []string{}}, true))
+			var description launch.ProcessDescription
+			h.AssertNil(t, json.Unmarshal(buf.Bytes(), &description))
+			h.AssertEq(t, description.Command, "some\ufffdcmd")
+		})
+	})
+}
+
+func encodeJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	h.AssertNil(t, enc.Encode(v))
+	return buf.String()
+}
@@ -5,14 +5,18 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"sort"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/env"
 )
 
 // ExecDRunner is responsible for running ExecD binaries.
 type ExecDRunner struct {
-	Out, Err io.Writer // Out and Err can be used to configure Stdout and Stderr processes run by ExecDRunner.
+	Out, Err   io.Writer       // Out and Err can be used to configure Stdout and Stderr processes run by ExecDRunner.
+	Provenance *env.Provenance // Provenance, when non-nil, records the variables set by each ExecD binary.
 }
 
 // NewExecDRunner creates an ExecDRunner with Out and Err set to stdout and stderr
@@ -25,7 +29,7 @@ func NewExecDRunner() *ExecDRunner {
 
 // ExecD executes the executable file at path and sets the returned variables in env. The executable at path
 // should implement the ExecD interface in the buildpack specification https://github.com/buildpacks/spec/blob/main/buildpack.md#execd
-func (e *ExecDRunner) ExecD(path string, env Env) error {
+func (e *ExecDRunner) ExecD(path string, launchEnv Env) error {
 	pr, pw, err := os.Pipe()
 	if err != nil {
 		return errors.Wrap(err, "failed to create pipe")
@@ -36,7 +40,7 @@ func (e *ExecDRunner) ExecD(path string, env Env) error {
 		cmd := exec.Command(path)
 		cmd.Stdout = e.Out
 		cmd.Stderr = e.Err
-		cmd.Env = env.List()
+		cmd.Env = launchEnv.List()
 		if err := setHandle(cmd, pw); err != nil {
 			errChan <- err
 		} else {
@@ -57,8 +61,14 @@ func (e *ExecDRunner) ExecD(path string, env Env) error {
 	if _, err := toml.Decode(string(out), &envVars); err != nil {
 		return errors.Wrapf(err, "failed to decode output from exec.d file at path '%s'", path)
 	}
-	for k, v := range envVars {
-		env.Set(k, v)
+	var keys []string
+	for k := range envVars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		launchEnv.Set(k, envVars[k])
+		e.Provenance.Record(k, env.ActionTypeOverride, envVars[k], path)
 	}
 	return nil
 }
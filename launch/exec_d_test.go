@@ -15,6 +15,7 @@ import (
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
+	lenv "github.com/buildpacks/lifecycle/env"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/launch/testmock"
 	h "github.com/buildpacks/lifecycle/testhelpers"
@@ -86,6 +87,17 @@ func testExecD(t *testing.T, when spec.G, it spec.S) {
 			h.AssertNil(t, runner.ExecD(path, env))
 		})
 
+		it("records the provenance of each variable", func() {
+			runner.Provenance = &lenv.Provenance{}
+			env.EXPECT().List().Return([]string{})
+			env.EXPECT().Set(gomock.Any(), gomock.Any()).AnyTimes()
+			h.AssertNil(t, runner.ExecD(path, env))
+			h.AssertEq(t, runner.Provenance.Modifications, []lenv.Modification{
+				{Name: "APPEND_VAR", Action: lenv.ActionTypeOverride, Value: "SOME_VAL", Source: path},
+				{Name: "OTHER_VAR", Action: lenv.ActionTypeOverride, Value: "OTHER_VAL", Source: path},
+			})
+		})
+
 		it("sets stdout to out", func() {
 			env.EXPECT().List().Return([]string{})
 			env.EXPECT().Set(gomock.Any(), gomock.Any()).AnyTimes()
@@ -0,0 +1,87 @@
+package launch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/env"
+)
+
+// EnvModification is an env.Modification attributed to the buildpack that made it.
+type EnvModification struct {
+	env.Modification
+	BuildpackID string
+}
+
+// ExplainEnv builds the environment for the given process type, without launching it,
+// and writes the final environment with the provenance of each modified variable to w.
+// It is not free of side effects: exec.d executables are run to determine the variables they set.
+// It is not complete either: profile scripts are only run by the shell of a launched process,
+// so the variables they set are neither shown nor attributed.
+func (l *Launcher) ExplainEnv(procType string, w io.Writer) error {
+	if _, ok := l.findProcessType(procType); !ok {
+		return fmt.Errorf("process type %s was not found", procType)
+	}
+	if err := os.Chdir(l.AppDir); err != nil {
+		return errors.Wrap(err, "change to app directory")
+	}
+	if err := l.doEnv(procType); err != nil {
+		return errors.Wrap(err, "modify env")
+	}
+	if err := l.doExecD(procType); err != nil {
+		return errors.Wrap(err, "exec.d")
+	}
+	return l.writeEnv(w)
+}
+
+// EnvModifications returns the recorded modifications to the variable with the given name.
+func (l *Launcher) EnvModifications(name string) []EnvModification {
+	var out []EnvModification
+	for _, m := range l.EnvProvenance.For(name) {
+		out = append(out, EnvModification{
+			Modification: m,
+			BuildpackID:  l.buildpackFor(m.Source),
+		})
+	}
+	return out
+}
+
+func (l *Launcher) writeEnv(w io.Writer) error {
+	vars := l.Env.List()
+	sort.Strings(vars)
+	for _, kv := range vars {
+		parts := strings.SplitN(kv, "=", 2)
+		if _, err := fmt.Fprintln(w, kv); err != nil {
+			return err
+		}
+		for _, m := range l.EnvModifications(parts[0]) {
+			if _, err := fmt.Fprintf(w, "  %s %q from %s (buildpack: %s)\n", actionName(m.Action), m.Value, m.Source, m.BuildpackID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Launcher) buildpackFor(source string) string {
+	for _, bp := range l.Buildpacks {
+		bpDir := filepath.Join(l.LayersDir, EscapeID(bp.ID))
+		if strings.HasPrefix(source, bpDir+string(filepath.Separator)) {
+			return bp.ID
+		}
+	}
+	return ""
+}
+
+func actionName(action env.ActionType) string {
+	if action == env.ActionTypePrependPath {
+		return "prepend-path"
+	}
+	return string(action)
+}
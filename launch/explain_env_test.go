@@ -0,0 +1,94 @@
+package launch_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/env"
+	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/launch/testmock"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestExplainEnv(t *testing.T) {
+	spec.Run(t, "ExplainEnv", testExplainEnv, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+func testExplainEnv(t *testing.T, when spec.G, it spec.S) {
+	var (
+		launcher *launch.Launcher
+		mockCtrl *gomock.Controller
+		tmpDir   string
+		wd       string
+	)
+
+	it.Before(func() {
+		mockCtrl = gomock.NewController(t)
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.explain-env.")
+		h.AssertNil(t, err)
+		tmpDir, err = filepath.EvalSymlinks(tmpDir)
+		h.AssertNil(t, err)
+		layersDir := filepath.Join(tmpDir, "launch")
+		h.AssertNil(t, os.MkdirAll(filepath.Join(layersDir, "app"), 0755))
+		h.Mkdir(t, filepath.Join(layersDir, "some_buildpack", "some-layer", "env.launch", "web"))
+		h.Mkfile(t, "some-override", filepath.Join(layersDir, "some_buildpack", "some-layer", "env.launch", "SOME_VAR.override"))
+		h.Mkfile(t, "some-web-value", filepath.Join(layersDir, "some_buildpack", "some-layer", "env.launch", "web", "WEB_VAR.default"))
+
+		provenance := &env.Provenance{}
+		launchEnv := env.NewLaunchEnv([]string{"SOME_VAR=some-orig", "OTHER_VAR=other-value"}, "", "")
+		launchEnv.Provenance = provenance
+
+		launcher = &launch.Launcher{
+			LayersDir: layersDir,
+			AppDir:    filepath.Join(layersDir, "app"),
+			Buildpacks: []launch.Buildpack{
+				{API: "0.5", ID: "some/buildpack"},
+			},
+			Processes: []launch.Process{
+				{Type: "web", Command: "some-command"},
+			},
+			Env:           launchEnv,
+			EnvProvenance: provenance,
+			ExecD:         testmock.NewMockExecD(mockCtrl),
+		}
+		wd, err = os.Getwd()
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.Chdir(wd))
+		mockCtrl.Finish()
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("writes the env with the provenance of each modified variable", func() {
+		buf := &bytes.Buffer{}
+		h.AssertNil(t, launcher.ExplainEnv("web", buf))
+
+		overrideSource := filepath.Join(tmpDir, "launch", "some_buildpack", "some-layer", "env.launch", "SOME_VAR.override")
+		defaultSource := filepath.Join(tmpDir, "launch", "some_buildpack", "some-layer", "env.launch", "web", "WEB_VAR.default")
+		h.AssertStringContains(t, buf.String(), "OTHER_VAR=other-value\n")
+		h.AssertStringContains(t, buf.String(), "SOME_VAR=some-override\n"+
+			`  override "some-override" from `+overrideSource+" (buildpack: some/buildpack)\n")
+		h.AssertStringContains(t, buf.String(), "WEB_VAR=some-web-value\n"+
+			`  default "some-web-value" from `+defaultSource+" (buildpack: some/buildpack)\n")
+		if strings.Contains(buf.String(), "OTHER_VAR=other-value\n  ") {
+			t.Fatalf("expected no provenance for unmodified variable, got:\n%s", buf.String())
+		}
+	})
+
+	it("returns an error for an unknown process type", func() {
+		err := launcher.ExplainEnv("missing", &bytes.Buffer{})
+		h.AssertError(t, err, "process type missing was not found")
+	})
+}
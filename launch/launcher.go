@@ -1,6 +1,7 @@
 package launch
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -23,6 +24,8 @@ type Launcher struct {
 	Buildpacks         []Buildpack
 	DefaultProcessType string
 	Env                Env
+	EnvProvenance      *env.Provenance // EnvProvenance, when non-nil, holds the modifications made to Env
+	EnvDebug           io.Writer       // EnvDebug, when non-nil, receives the final env and its provenance before launch
 	Exec               ExecFunc
 	ExecD              ExecD
 	Shell              Shell
@@ -68,6 +71,11 @@ func (l *Launcher) LaunchProcess(self string, proc Process) error {
 	if err := l.doExecD(proc.Type); err != nil {
 		return errors.Wrap(err, "exec.d")
 	}
+	if l.EnvDebug != nil {
+		if err := l.writeEnv(l.EnvDebug); err != nil {
+			return errors.Wrap(err, "write env")
+		}
+	}
 	proc.WorkingDirectory = getProcessWorkingDirectory(proc, l.AppDir)
 
 	if proc.Direct {
@@ -44,3 +44,12 @@ func (ch *concurrentHasher) Sum(b []byte) []byte {
 	close(ch.buffers)
 	return ch.hash.Sum(b)
 }
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -141,6 +141,40 @@ func testDirs(t *testing.T, when spec.G, it spec.S) {
 				fmt.Sprintf("Reusing tarball for layer \"some-layer-id\" with SHA: %s\n", dirLayer.Digest),
 			)
 		})
+
+		it("records the size of the layer", func() {
+			contents, err := ioutil.ReadFile(dirLayer.TarPath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, dirLayer.Size, int64(len(contents)))
+			// the layer is compressed by the image it is added to
+			h.AssertEq(t, dirLayer.CompressedSize, int64(0))
+		})
+
+		when("ModTime is set", func() {
+			it("uses the mod time for all entries", func() {
+				factory.ModTime = time.Unix(1234567890, 0).UTC()
+				modTimeLayer, err := factory.DirLayer("some-other-layer-id", dir)
+				h.AssertNil(t, err)
+				if modTimeLayer.Digest == dirLayer.Digest {
+					t.Fatalf("expected digest to change with mod time, got %s", modTimeLayer.Digest)
+				}
+
+				lf, err := os.Open(modTimeLayer.TarPath)
+				h.AssertNil(t, err)
+				defer lf.Close()
+				tr := tar.NewReader(lf)
+				for {
+					header, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					h.AssertNil(t, err)
+					if !header.ModTime.Equal(factory.ModTime) {
+						t.Fatalf("expected entry '%s' to have mod time '%s', got '%s'", header.Name, factory.ModTime, header.ModTime)
+					}
+				}
+			})
+		})
 	})
 }
 
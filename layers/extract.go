@@ -2,22 +2,116 @@ package layers
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
 
+	"github.com/pkg/errors"
+
 	"github.com/buildpacks/lifecycle/archive"
 )
 
 // Extract extracts entries from r to the dest directory
-// Contents of r should be an OCI layer.
+// Contents of r should be an OCI layer, either uncompressed or compressed with gzip or zstd.
 // If dest is an empty string files with be extracted to `/` or `c:\` on unix and windows filesystems respectively.
 func Extract(r io.Reader, dest string) error {
-	tr := tarReader(r, dest)
-	return archive.Extract(tr)
+	return ExtractWithOptions(r, dest, archive.ExtractOptions{})
+}
+
+// ExtractWithOptions extracts entries from r to the dest directory like Extract,
+// rejecting entries that are not permitted by opts.
+func ExtractWithOptions(r io.Reader, dest string, opts archive.ExtractOptions) error {
+	dr, _, err := archive.NewDecompressingReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	return archive.ExtractWithOptions(tarReader(dr, dest), opts)
+}
+
+// ExtractVerified extracts entries from r to the dest directory like ExtractWithOptions, and returns an error
+// if the sha256 digest of the uncompressed contents of r does not match the given digest (e.g. "sha256:abc...").
+// The contents of r are read to the end so that the digest covers any padding after the end of the archive.
+// If extraction fails or the digest does not match, the files and directories created by the extraction are removed.
+func ExtractVerified(r io.Reader, dest, digest string, opts archive.ExtractOptions) (err error) {
+	dr, _, err := archive.NewDecompressingReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	hasher := sha256.New()
+	tr := io.TeeReader(dr, hasher)
+	created := &createdPathsReader{TarReader: tarReader(tr, dest)}
+	defer func() {
+		if err != nil {
+			if removeErr := created.removeAll(); removeErr != nil {
+				err = errors.Wrapf(err, "removing extracted files: %s", removeErr)
+			}
+		}
+	}()
+	if err := archive.ExtractWithOptions(created, opts); err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+		return err
+	}
+	if actual := fmt.Sprintf("sha256:%x", hasher.Sum(nil)); actual != digest {
+		return fmt.Errorf("layer digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// createdPathsReader records the topmost path created by each entry read from the wrapped TarReader,
+// so that an extraction can be undone.
+type createdPathsReader struct {
+	archive.TarReader
+	paths []string
+}
+
+func (r *createdPathsReader) Next() (*tar.Header, error) {
+	hdr, err := r.TarReader.Next()
+	if err != nil {
+		return nil, err
+	}
+	if path, ok := topmostMissing(hdr.Name); ok {
+		r.paths = append(r.paths, path)
+	}
+	return hdr, nil
+}
+
+func (r *createdPathsReader) removeAll() error {
+	for i := len(r.paths) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(r.paths[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topmostMissing returns the topmost ancestor of path (or path itself) that does not exist,
+// or false if path already exists
+func topmostMissing(path string) (string, bool) {
+	if _, err := os.Lstat(path); err == nil {
+		return "", false
+	}
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, true
+		}
+		if _, err := os.Lstat(parent); err == nil {
+			return path, true
+		}
+		path = parent
+	}
 }
 
 func tarReader(r io.Reader, dest string) archive.TarReader {
-	tr := archive.NewNormalizingTarReader(tar.NewReader(r))
+	tr := archive.NewNormalizingTarReader(estargzTarReader{tar.NewReader(r)})
 	if runtime.GOOS == "windows" {
 		tr.ExcludePaths([]string{"Hives"})
 		tr.Strip(`Files/`)
@@ -31,3 +125,29 @@ func tarReader(r io.Reader, dest string) archive.TarReader {
 	tr.PrependDir(dest)
 	return tr
 }
+
+// the names of the entries that eStargz layers add, see github.com/containerd/stargz-snapshotter/estargz
+const (
+	estargzTOCName            = "stargz.index.json"
+	estargzPrefetchLandmark   = ".prefetch.landmark"
+	estargzNoPrefetchLandmark = ".no.prefetch.landmark"
+)
+
+// estargzTarReader skips the entries that eStargz layers add next to the layer contents.
+type estargzTarReader struct {
+	*tar.Reader
+}
+
+func (r estargzTarReader) Next() (*tar.Header, error) {
+	for {
+		hdr, err := r.Reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case estargzTOCName, estargzPrefetchLandmark, estargzNoPrefetchLandmark:
+			continue
+		}
+		return hdr, nil
+	}
+}
@@ -4,22 +4,47 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/archive"
 )
 
 type Factory struct {
-	ArtifactsDir string // ArtifactsDir is the directory where layer files are written
-	UID, GID     int    // UID and GID are used to normalize layer entries
+	ArtifactsDir string    // ArtifactsDir is the directory where layer files are written
+	UID, GID     int       // UID and GID are used to normalize layer entries
+	ModTime      time.Time // ModTime, when non-zero, overrides archive.NormalizedModTime for layer entries
 	Logger       Logger
+	ForceHash    bool          // ForceHash, when true, ignores recorded fingerprints so that every layer is hashed
+	Fingerprints *Fingerprints // Fingerprints, when non-nil, records fingerprints of layer directories to reuse unchanged layers
+	Converter    Converter     // Converter, when non-nil, converts the layer tars, e.g. to eStargz blobs for lazy pulling
+
+	tarLayers map[string]Layer // tarLayers stores the layers written to each tarball for reuse between the export and cache steps.
+}
 
-	tarHashes map[string]string // tarHases Stores hashes of layer tarballs for reuse between the export and cache steps.
+// Converter converts the layer tars written by a Factory to another layer format.
+type Converter interface {
+	// Convert converts the layer tar at tarPath, which it removes, and returns the path and diff ID of the converted
+	// layer with its size.
+	Convert(tarPath string) (path, diffID string, size LayerSize, err error)
+	// Settings identifies the options of the conversion, so that layers converted differently are not reused.
+	Settings() string
 }
 
 type Layer struct {
 	ID      string
 	TarPath string
 	Digest  string
+	LayerSize
+}
+
+// LayerSize is the size of a layer in bytes, uncompressed and compressed.
+// The compressed size is the size of the layer as it is written to the image, so it is only known for layers that are
+// written compressed: eStargz layers, and the layers of images that compress the layers added to them.
+type LayerSize struct {
+	Size           int64 `json:"size,omitempty" toml:"size,omitzero"`
+	CompressedSize int64 `json:"compressedSize,omitempty" toml:"compressed-size,omitzero"`
 }
 
 type Logger interface {
@@ -36,43 +61,58 @@ type Logger interface {
 	Errorf(fmt string, v ...interface{})
 }
 
-func (f *Factory) writeLayer(id string, addEntries func(tw *archive.NormalizingTarWriter) error) (layer Layer, err error) {
+func (f *Factory) writeLayer(id string, addEntries func(tw *archive.NormalizingTarWriter) error) (Layer, error) {
 	tarPath := filepath.Join(f.ArtifactsDir, escape(id)+".tar")
-	if f.tarHashes == nil {
-		f.tarHashes = make(map[string]string)
+	if f.tarLayers == nil {
+		f.tarLayers = make(map[string]Layer)
 	}
-	if sha, ok := f.tarHashes[tarPath]; ok {
-		f.Logger.Debugf("Reusing tarball for layer %q with SHA: %s\n", id, sha)
-		return Layer{
-			ID:      id,
-			TarPath: tarPath,
-			Digest:  sha,
-		}, nil
+	if layer, ok := f.tarLayers[tarPath]; ok {
+		f.Logger.Debugf("Reusing tarball for layer %q with SHA: %s\n", id, layer.Digest)
+		layer.ID = id
+		return layer, nil
 	}
-	lw, err := newFileLayerWriter(tarPath)
+	digest, size, err := f.writeTar(tarPath, addEntries)
 	if err != nil {
 		return Layer{}, err
 	}
+	layerPath := tarPath
+	if f.Converter != nil {
+		if layerPath, digest, size, err = f.Converter.Convert(tarPath); err != nil {
+			return Layer{}, errors.Wrapf(err, "converting layer %q", id)
+		}
+	}
+	layer := Layer{
+		ID:        id,
+		Digest:    digest,
+		TarPath:   layerPath,
+		LayerSize: size,
+	}
+	f.tarLayers[tarPath] = layer
+	return layer, nil
+}
+
+func (f *Factory) writeTar(tarPath string, addEntries func(tw *archive.NormalizingTarWriter) error) (digest string, size LayerSize, err error) {
+	lw, err := newFileLayerWriter(tarPath)
+	if err != nil {
+		return "", LayerSize{}, err
+	}
 	defer func() {
 		if closeErr := lw.Close(); err == nil {
 			err = closeErr
 		}
 	}()
 	tw := tarWriter(lw)
+	if !f.ModTime.IsZero() {
+		tw.WithModTime(f.ModTime)
+	}
 	if err := addEntries(tw); err != nil {
-		return Layer{}, err
+		return "", LayerSize{}, err
 	}
 
 	if err := tw.Close(); err != nil {
-		return Layer{}, err
+		return "", LayerSize{}, err
 	}
-	digest := lw.Digest()
-	f.tarHashes[tarPath] = digest
-	return Layer{
-		ID:      id,
-		Digest:  digest,
-		TarPath: tarPath,
-	}, err
+	return lw.Digest(), LayerSize{Size: lw.Size()}, nil
 }
 
 func escape(id string) string {
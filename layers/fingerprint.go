@@ -0,0 +1,245 @@
+package layers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/internal/encoding"
+)
+
+// fingerprintVersion must change whenever the fingerprint or the layer tarball written for a directory changes.
+const fingerprintVersion = "3"
+
+var errFingerprintUnsupported = errors.New("fingerprints are not supported on this platform")
+
+// Fingerprints records a fingerprint of each layer directory that a layer is created from or restored to, with the
+// digest of the layer, so that UnchangedDirLayer can find the digest during a later export.
+//
+// The fingerprints are kept in a file owned by the lifecycle, see FingerprintsPath, rather than next to the layer
+// directories that buildpacks write.
+type Fingerprints struct {
+	path string
+	mu   sync.Mutex // mu serializes the updates of the file, as layers are restored concurrently
+}
+
+// fingerprintsFile is the file of the recorded fingerprints, keyed by the absolute path of each layer directory.
+type fingerprintsFile struct {
+	Version string                       `toml:"version"`
+	Layers  map[string]fingerprintRecord `toml:"layers"`
+}
+
+type fingerprintRecord struct {
+	Settings    string `toml:"settings"`
+	Fingerprint string `toml:"fingerprint"`
+	Digest      string `toml:"digest"`
+}
+
+type fileStat struct {
+	uid, gid uint32
+	ctime    int64
+}
+
+// FingerprintsPath returns the path of the fingerprints of the layers in layersDir.
+func FingerprintsPath(layersDir string) string {
+	return filepath.Join(layersDir, "fingerprints.toml")
+}
+
+// NewFingerprints returns the fingerprints recorded in the file at path, which is created when a fingerprint is recorded.
+func NewFingerprints(path string) *Fingerprints {
+	return &Fingerprints{path: path}
+}
+
+// Record records a fingerprint of the given directory, which was restored from or written to a layer with the given
+// digest by a factory with the given FingerprintSettings. It does nothing on platforms that don't support fingerprints.
+// The fingerprint includes the change time of each file, so it must be recorded once the lifecycle is done writing
+// the directory.
+func (f *Fingerprints) Record(dir, settings, digest string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := fingerprint(dir)
+	if err == errFingerprintUnsupported {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return f.record(dir, fingerprintRecord{Settings: settings, Fingerprint: fingerprint, Digest: digest})
+}
+
+func (f *Fingerprints) record(dir string, record fingerprintRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	recorded, err := f.read()
+	if err != nil {
+		return err
+	}
+	recorded.Layers[dir] = record
+	return encoding.WriteTOML(f.path, recorded)
+}
+
+// lookup returns the fingerprint recorded for the given absolute directory.
+func (f *Fingerprints) lookup(dir string) (fingerprintRecord, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	recorded, err := f.read()
+	if err != nil {
+		return fingerprintRecord{}, false, err
+	}
+	record, ok := recorded.Layers[dir]
+	return record, ok, nil
+}
+
+// read reads the recorded fingerprints, ignoring a missing file and fingerprints of another version.
+func (f *Fingerprints) read() (fingerprintsFile, error) {
+	empty := fingerprintsFile{Version: fingerprintVersion, Layers: map[string]fingerprintRecord{}}
+	var recorded fingerprintsFile
+	if _, err := toml.DecodeFile(f.path, &recorded); err != nil {
+		if os.IsNotExist(err) {
+			return empty, nil
+		}
+		return fingerprintsFile{}, errors.Wrap(err, "reading fingerprints")
+	}
+	if recorded.Version != fingerprintVersion || recorded.Layers == nil {
+		return empty, nil
+	}
+	return recorded, nil
+}
+
+// FingerprintSettings identifies the settings of the factory that determine the layer tarball written for a directory,
+// including the options of its converter. It is recorded in the cache metadata so that layers restored from the cache can be
+// fingerprinted by Fingerprints.Record.
+func (f *Factory) FingerprintSettings() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %d %d %d\n", fingerprintVersion, f.UID, f.GID, f.ModTime.Unix())
+	if f.Converter != nil {
+		fmt.Fprintf(h, "%s\n", f.Converter.Settings())
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// FingerprintedDirLayer creates a layer from the given directory like DirLayer, and records a fingerprint of the
+// directory in Factory.Fingerprints so that UnchangedDirLayer can find the digest of the layer during a later export.
+func (f *Factory) FingerprintedDirLayer(id string, dir string) (Layer, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Layer{}, err
+	}
+	if f.Fingerprints == nil {
+		return f.DirLayer(id, dir)
+	}
+	// the directory is fingerprinted before and after the tarball is written, and the fingerprint is only recorded
+	// if the directory did not change while it was written
+	before, fpErr := fingerprint(dir)
+	layer, err := f.DirLayer(id, dir)
+	if err != nil {
+		return Layer{}, err
+	}
+	if fpErr == nil {
+		var after string
+		if after, fpErr = fingerprint(dir); fpErr == nil && after != before {
+			f.Logger.Debugf("Layer %q changed while it was written, not recording its fingerprint\n", id)
+			return layer, nil
+		}
+	}
+	if fpErr != nil {
+		if fpErr != errFingerprintUnsupported {
+			f.Logger.Warnf("Failed to fingerprint layer %q: %s", id, fpErr)
+		}
+		return layer, nil
+	}
+	if err := f.Fingerprints.record(dir, fingerprintRecord{
+		Settings:    f.FingerprintSettings(),
+		Fingerprint: before,
+		Digest:      layer.Digest,
+	}); err != nil {
+		f.Logger.Warnf("Failed to record fingerprint for layer %q: %s", id, err)
+	}
+	return layer, nil
+}
+
+// UnchangedDirLayer returns the layer recorded for the given directory by FingerprintedDirLayer or Fingerprints.Record
+// if the directory and its parents have not changed since, and the layer was created with the same settings.
+// The returned layer has a digest but no tarball.
+// UnchangedDirLayer always returns false when Factory.ForceHash is set or Factory.Fingerprints is nil.
+func (f *Factory) UnchangedDirLayer(id string, dir string) (Layer, bool) {
+	if f.ForceHash || f.Fingerprints == nil {
+		return Layer{}, false
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Layer{}, false
+	}
+	recorded, ok, err := f.Fingerprints.lookup(dir)
+	if err != nil {
+		f.Logger.Debugf("Ignoring fingerprint for layer %q: %s\n", id, err)
+		return Layer{}, false
+	}
+	if !ok || recorded.Digest == "" || recorded.Settings != f.FingerprintSettings() {
+		return Layer{}, false
+	}
+	fingerprint, err := fingerprint(dir)
+	if err != nil || fingerprint != recorded.Fingerprint {
+		return Layer{}, false
+	}
+	f.Logger.Debugf("Layer %q is unchanged since it was created with SHA: %s\n", id, recorded.Digest)
+	return Layer{ID: id, Digest: recorded.Digest}, true
+}
+
+// fingerprint hashes the mode and ownership of the parents of dir, and the path, mode, size, modification time, change
+// time, ownership and link target of dir and every file in it. The change time detects files that are rewritten with
+// the same size and modification time. Inode numbers are not included.
+func fingerprint(dir string) (string, error) {
+	parents, err := parents(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, parent := range parents {
+		stat, ok := statFile(parent.Info)
+		if !ok {
+			return "", errFingerprintUnsupported
+		}
+		// the change time of a parent changes whenever a sibling of the layer is written, e.g. <layer>.toml
+		fmt.Fprintf(h, "%q %o %d %d\n", parent.Path, uint32(parent.Info.Mode()), stat.uid, stat.gid)
+	}
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return fingerprintEntry(h, dir, path, fi)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+func fingerprintEntry(h hash.Hash, dir, path string, fi os.FileInfo) error {
+	stat, ok := statFile(fi)
+	if !ok {
+		return errFingerprintUnsupported
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err
+	}
+	var target string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if target, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(h, "%q %o %d %d %d %d %d %q\n",
+		rel, uint32(fi.Mode()), fi.Size(), fi.ModTime().UnixNano(), stat.ctime, stat.uid, stat.gid, target,
+	)
+	return nil
+}
@@ -0,0 +1,15 @@
+package layers
+
+import (
+	"os"
+	"syscall"
+)
+
+// statFile returns the owner and change time of fi, which are not exposed by os.FileInfo.
+func statFile(fi os.FileInfo) (fileStat, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{uid: stat.Uid, gid: stat.Gid, ctime: stat.Ctim.Nano()}, true
+}
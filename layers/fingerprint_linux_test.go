@@ -0,0 +1,213 @@
+package layers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/layers/stargz"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestFingerprints(t *testing.T) {
+	spec.Run(t, "Fingerprints", testFingerprints, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testFingerprints(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir           string
+		dir              string
+		fingerprintsPath string
+		layer            layers.Layer
+		logHandler       = memory.New()
+	)
+
+	newFactory := func() *layers.Factory {
+		artifactsDir, err := ioutil.TempDir(tmpDir, "artifacts")
+		h.AssertNil(t, err)
+		return &layers.Factory{
+			ArtifactsDir: artifactsDir,
+			Logger:       &log.Logger{Handler: logHandler},
+			UID:          1234,
+			GID:          4321,
+			Fingerprints: layers.NewFingerprints(fingerprintsPath),
+		}
+	}
+
+	// rewrite writes a file with the same size and modification time as before
+	rewrite := func(path string, contents string) {
+		fi, err := os.Stat(path)
+		h.AssertNil(t, err)
+		h.AssertEq(t, int64(len(contents)), fi.Size())
+		// file times are only as precise as the clock tick of the kernel
+		time.Sleep(20 * time.Millisecond)
+		h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), fi.Mode()))
+		h.AssertNil(t, os.Chtimes(path, fi.ModTime(), fi.ModTime()))
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "layers.fingerprints")
+		h.AssertNil(t, err)
+		dir = filepath.Join(tmpDir, "layers", "some-layer")
+		fingerprintsPath = filepath.Join(tmpDir, "fingerprints.toml")
+		h.AssertNil(t, os.MkdirAll(filepath.Join(dir, "sub-dir"), 0755))
+		h.AssertNil(t, ioutil.WriteFile(filepath.Join(dir, "sub-dir", "some-file.txt"), []byte("some-content"), 0644))
+		h.AssertNil(t, os.Symlink("sub-dir/some-file.txt", filepath.Join(dir, "some-link")))
+
+		layer, err = newFactory().FingerprintedDirLayer("some-layer-id", dir)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#FingerprintedDirLayer", func() {
+		it("creates a layer from the directory", func() {
+			expected, err := newFactory().DirLayer("some-layer-id", dir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, layer.Digest, expected.Digest)
+			h.AssertPathExists(t, layer.TarPath)
+		})
+
+		it("records a fingerprint outside of the layers dir", func() {
+			h.AssertPathExists(t, fingerprintsPath)
+			h.AssertPathDoesNotExist(t, dir+".fingerprint")
+		})
+
+		it("creates the layer again if a file was rewritten with the same size and modification time", func() {
+			rewrite(filepath.Join(dir, "sub-dir", "some-file.txt"), "some-contnet")
+
+			factory := newFactory()
+			_, ok := factory.UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+			rewritten, err := factory.FingerprintedDirLayer("some-layer-id", dir)
+			h.AssertNil(t, err)
+			h.AssertPathExists(t, rewritten.TarPath)
+			if rewritten.Digest == layer.Digest {
+				t.Fatalf("expected the rewritten layer to have a new digest, got %s", rewritten.Digest)
+			}
+		})
+	})
+
+	when("#UnchangedDirLayer", func() {
+		it("returns the recorded digest without creating a tarball", func() {
+			unchanged, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, unchanged, layers.Layer{ID: "some-layer-id", Digest: layer.Digest})
+		})
+
+		it("returns false if no fingerprint was recorded", func() {
+			h.AssertNil(t, os.Remove(fingerprintsPath))
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if a file was modified", func() {
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(dir, "sub-dir", "some-file.txt"), []byte("other-content"), 0644))
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if a file was added", func() {
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(dir, "sub-dir", "other-file.txt"), []byte("other-content"), 0644))
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if a file was rewritten with the same size and modification time", func() {
+			rewrite(filepath.Join(dir, "sub-dir", "some-file.txt"), "some-contnet")
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if the mode of a file changed", func() {
+			h.AssertNil(t, os.Chmod(filepath.Join(dir, "sub-dir", "some-file.txt"), 0755))
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if the mode of a parent changed", func() {
+			h.AssertNil(t, os.Chmod(filepath.Dir(dir), 0700))
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if the factory normalizes entries differently", func() {
+			factory := newFactory()
+			factory.UID = 2345
+			_, ok := factory.UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if the eStargz options changed", func() {
+			factory := newFactory()
+			factory.Converter = &stargz.Converter{Prefetch: []string{filepath.Join(dir, "sub-dir", "some-file.txt")}}
+			_, ok := factory.UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false without a store", func() {
+			factory := newFactory()
+			factory.Fingerprints = nil
+			_, ok := factory.UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("returns false if ForceHash is set", func() {
+			factory := newFactory()
+			factory.ForceHash = true
+			_, ok := factory.UnchangedDirLayer("some-layer-id", dir)
+			h.AssertEq(t, ok, false)
+		})
+	})
+
+	when("Fingerprints#Record", func() {
+		var restoredDir string
+
+		it.Before(func() {
+			// restore the layer to another directory, as the restorer does
+			restoredDir = filepath.Join(tmpDir, "restored", "some-layer")
+			h.AssertNil(t, os.MkdirAll(filepath.Dir(restoredDir), 0755))
+			f, err := os.Open(layer.TarPath)
+			h.AssertNil(t, err)
+			defer f.Close()
+			h.AssertNil(t, layers.Extract(f, filepath.Join(tmpDir, "restored")))
+			h.AssertNil(t, os.Rename(filepath.Join(tmpDir, "restored", dir), restoredDir))
+		})
+
+		it("records the restored layer so that it is reused if the directory is unchanged", func() {
+			h.AssertNil(t, layers.NewFingerprints(fingerprintsPath).Record(restoredDir, newFactory().FingerprintSettings(), layer.Digest))
+
+			unchanged, ok := newFactory().UnchangedDirLayer("some-layer-id", restoredDir)
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, unchanged.Digest, layer.Digest)
+		})
+
+		it("does not reuse the restored layer if a file was modified", func() {
+			h.AssertNil(t, layers.NewFingerprints(fingerprintsPath).Record(restoredDir, newFactory().FingerprintSettings(), layer.Digest))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(restoredDir, "sub-dir", "some-file.txt"), []byte("other-content"), 0644))
+
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", restoredDir)
+			h.AssertEq(t, ok, false)
+		})
+
+		it("does not reuse the restored layer if it was created with other settings", func() {
+			factory := newFactory()
+			factory.UID = 2345
+			h.AssertNil(t, layers.NewFingerprints(fingerprintsPath).Record(restoredDir, factory.FingerprintSettings(), layer.Digest))
+
+			_, ok := newFactory().UnchangedDirLayer("some-layer-id", restoredDir)
+			h.AssertEq(t, ok, false)
+		})
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package layers
+
+import "os"
+
+// statFile is not supported on this platform, so directories are never fingerprinted.
+func statFile(fi os.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
@@ -0,0 +1,170 @@
+// Package stargz converts the layers written by a layers.Factory to eStargz blobs for lazy pulling.
+package stargz
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/layers"
+)
+
+// Converter converts layer tars to eStargz blobs. It is kept out of the layers package so that the launcher, which
+// reads layer metadata, does not link the eStargz library.
+type Converter struct {
+	Level    int      // Level is the gzip compression level of the layers, 0 selects gzip.BestSpeed
+	Prefetch []string // Prefetch lists absolute paths of files that are placed first in the layers that contain them
+}
+
+// Settings identifies the options of the converter in layer fingerprints.
+func (c *Converter) Settings() string {
+	return fmt.Sprintf("estargz %d %q", c.Level, c.Prefetch)
+}
+
+// blobPath returns the path of the eStargz blob converted from the layer tar at tarPath.
+func blobPath(tarPath string) string {
+	return strings.TrimSuffix(tarPath, ".tar") + ".estargz.tar.gz"
+}
+
+// Convert converts the layer tar at tarPath to an eStargz blob and returns the path and diff ID of the blob with the
+// size of the layer. The tar is removed once it has been converted.
+func (c *Converter) Convert(tarPath string) (string, string, layers.LayerSize, error) {
+	in, err := os.Open(tarPath)
+	if err != nil {
+		return "", "", layers.LayerSize{}, err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return "", "", layers.LayerSize{}, err
+	}
+
+	level := c.Level
+	if level == 0 {
+		level = gzip.BestSpeed
+	}
+	var missing []string
+	blob, err := estargz.Build(io.NewSectionReader(in, 0, fi.Size()),
+		estargz.WithCompression(&estargzCompression{
+			GzipCompressor:   estargz.NewGzipCompressorWithLevel(level),
+			GzipDecompressor: &estargz.GzipDecompressor{},
+			level:            level,
+		}),
+		estargz.WithPrioritizedFiles(c.Prefetch),
+		estargz.WithAllowPrioritizeNotFound(&missing),
+	)
+	if err != nil {
+		return "", "", layers.LayerSize{}, errors.Wrap(err, "building eStargz layer")
+	}
+	defer blob.Close()
+
+	path := blobPath(tarPath)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", "", layers.LayerSize{}, err
+	}
+	defer out.Close()
+	compressedSize, err := io.Copy(out, blob)
+	if err != nil {
+		return "", "", layers.LayerSize{}, errors.Wrap(err, "writing eStargz layer")
+	}
+	if err := out.Close(); err != nil {
+		return "", "", layers.LayerSize{}, err
+	}
+	// the diff ID of the blob is only known once it has been closed
+	if err := blob.Close(); err != nil {
+		return "", "", layers.LayerSize{}, err
+	}
+	if err := os.Remove(tarPath); err != nil {
+		return "", "", layers.LayerSize{}, err
+	}
+	size, err := uncompressedSize(path)
+	if err != nil {
+		return "", "", layers.LayerSize{}, errors.Wrap(err, "reading eStargz layer")
+	}
+	return path, blob.DiffID().String(), layers.LayerSize{Size: size, CompressedSize: compressedSize}, nil
+}
+
+// uncompressedSize returns the size of the decompressed contents of the file at path.
+func uncompressedSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gr.Close()
+	return io.Copy(ioutil.Discard, gr)
+}
+
+// estargzCompression compresses eStargz blobs with gzip at the given level.
+// The footer is written byte for byte rather than with compress/gzip, which does not guarantee the encoding of
+// the empty block that gives the footer the fixed size that readers of eStargz blobs expect.
+type estargzCompression struct {
+	*estargz.GzipCompressor
+	*estargz.GzipDecompressor
+	level int
+}
+
+func (c *estargzCompression) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	gz, err := gzip.NewWriterLevel(w, c.level)
+	if err != nil {
+		return "", err
+	}
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     estargz.TOCTarName,
+		Size:     int64(len(tocJSON)),
+	}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if _, err := w.Write(estargzFooter(off)); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
+
+// estargzFooter returns the footer of an eStargz blob whose TOC starts at tocOffset:
+// an empty gzip member with the offset in an extra field of its header.
+func estargzFooter(tocOffset int64) []byte {
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOffset)
+	footer := make([]byte, 0, estargz.FooterSize)
+	footer = append(footer, 0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff) // gzip header with an extra field
+	footer = append(footer, byte(4+len(subfield)), 0)              // length of the extra field
+	footer = append(footer, 'S', 'G', byte(len(subfield)), 0)
+	footer = append(footer, subfield...)
+	footer = append(footer, 1, 0, 0, 0xff, 0xff)    // final, empty stored block
+	footer = append(footer, 0, 0, 0, 0, 0, 0, 0, 0) // checksum and size of the empty contents
+	return footer
+}
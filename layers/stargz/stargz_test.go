@@ -0,0 +1,148 @@
+package stargz_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/archive"
+	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/layers/stargz"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestConverter(t *testing.T) {
+	spec.Run(t, "Converter", testConverter, spec.Report(report.Terminal{}))
+}
+
+func testConverter(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory     *layers.Factory
+		artifactDir string
+		dir         string
+	)
+
+	it.Before(func() {
+		h.SkipIf(t, runtime.GOOS == "windows", "eStargz layers are not supported on Windows")
+		var err error
+		artifactDir, err = ioutil.TempDir("", "stargz.layer")
+		h.AssertNil(t, err)
+		dir, err = filepath.Abs(filepath.Join("..", "testdata", "target-dir"))
+		h.AssertNil(t, err)
+		factory = &layers.Factory{
+			ArtifactsDir: artifactDir,
+			Logger:       &log.Logger{Handler: memory.New()},
+			Converter: &stargz.Converter{
+				Prefetch: []string{filepath.Join(dir, "some-dir", "some-file.txt"), "/not/in/layer"},
+			},
+		}
+	})
+
+	it.After(func() {
+		os.RemoveAll(artifactDir)
+	})
+
+	when("#DirLayer", func() {
+		it("writes an eStargz blob with the prefetched files first", func() {
+			layer, err := factory.DirLayer("some-layer-id", dir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, filepath.Ext(layer.TarPath), ".gz")
+			h.AssertPathDoesNotExist(t, filepath.Join(artifactDir, "some-layer-id.tar"))
+
+			f, err := os.Open(layer.TarPath)
+			h.AssertNil(t, err)
+			defer f.Close()
+			fi, err := f.Stat()
+			h.AssertNil(t, err)
+			r, err := estargz.Open(io.NewSectionReader(f, 0, fi.Size()))
+			h.AssertNil(t, err)
+			_, ok := r.Lookup(estargz.PrefetchLandmark)
+			h.AssertEq(t, ok, true)
+
+			gr, err := gzip.NewReader(f)
+			h.AssertNil(t, err)
+			hasher := sha256.New()
+			tr := tar.NewReader(io.TeeReader(gr, hasher))
+			var names []string
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				h.AssertNil(t, err)
+				names = append(names, hdr.Name)
+			}
+			_, err = io.Copy(ioutil.Discard, gr)
+			h.AssertNil(t, err)
+			h.AssertEq(t, layer.Digest, fmt.Sprintf("sha256:%x", hasher.Sum(nil)))
+
+			h.AssertEq(t, layer.CompressedSize, fi.Size())
+			_, err = f.Seek(0, io.SeekStart)
+			h.AssertNil(t, err)
+			h.AssertNil(t, gr.Reset(f))
+			size, err := io.Copy(ioutil.Discard, gr)
+			h.AssertNil(t, err)
+			h.AssertEq(t, layer.Size, size)
+
+			landmark := -1
+			prefetched := -1
+			for i, name := range names {
+				switch name {
+				case estargz.PrefetchLandmark:
+					landmark = i
+				case filepath.Join(dir, "some-dir", "some-file.txt"):
+					prefetched = i
+				}
+			}
+			if prefetched == -1 || landmark == -1 || prefetched > landmark {
+				t.Fatalf("expected the prefetched file before the landmark, got entries %v", names)
+			}
+		})
+
+		it("extracts the layer contents without the eStargz metadata", func() {
+			layer, err := factory.DirLayer("some-layer-id", dir)
+			h.AssertNil(t, err)
+			f, err := os.Open(layer.TarPath)
+			h.AssertNil(t, err)
+			defer f.Close()
+			dest, err := ioutil.TempDir("", "stargz.dest")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(dest)
+
+			h.AssertNil(t, layers.ExtractVerified(f, dest, layer.Digest, archive.ExtractOptions{}))
+			h.AssertPathExists(t, filepath.Join(dest, dir, "some-dir", "some-file.txt"))
+			for _, name := range []string{estargz.TOCTarName, estargz.PrefetchLandmark, estargz.NoPrefetchLandmark} {
+				h.AssertPathDoesNotExist(t, filepath.Join(dest, name))
+			}
+		})
+
+		it("writes the same blob regardless of the number of CPUs", func() {
+			first, err := factory.DirLayer("some-layer-id", dir)
+			h.AssertNil(t, err)
+
+			procs := runtime.GOMAXPROCS(1)
+			defer runtime.GOMAXPROCS(procs)
+			other := &layers.Factory{
+				ArtifactsDir: artifactDir,
+				Logger:       factory.Logger,
+				Converter:    factory.Converter,
+			}
+			second, err := other.DirLayer("other-layer-id", dir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, second.Digest, first.Digest)
+		})
+	})
+}
@@ -16,24 +16,32 @@ import (
 type layerWriter struct {
 	io.Writer
 	io.Closer
-	hasher *concurrentHasher
-	path   string
+	hasher  *concurrentHasher
+	counter *countingWriter
+	path    string
 }
 
+// newFileLayerWriter returns a writer of the layer tar at dest that hashes and counts the tar as it is written.
 func newFileLayerWriter(dest string) (*layerWriter, error) {
 	hasher := newConcurrentHasher(sha256.New())
 	file, err := os.Create(dest)
 	if err != nil {
 		return nil, err
 	}
-	w := io.MultiWriter(hasher, file)
-	return &layerWriter{w, file, hasher, dest}, nil
+	counter := &countingWriter{}
+	w := io.MultiWriter(hasher, file, counter)
+	return &layerWriter{w, file, hasher, counter, dest}, nil
 }
 
 func (lw *layerWriter) Digest() string {
 	return fmt.Sprintf("sha256:%x", lw.hasher.Sum(nil))
 }
 
+// Size returns the size of the tar written so far.
+func (lw *layerWriter) Size() int64 {
+	return lw.counter.n
+}
+
 func tarWriter(lw *layerWriter) *archive.NormalizingTarWriter {
 	var tw *archive.NormalizingTarWriter
 	if runtime.GOOS == "windows" {
@@ -5,6 +5,9 @@ import "github.com/buildpacks/lifecycle/buildpack"
 type CacheMetadata struct {
 	BOM        LayerMetadata              `json:"sbom"`
 	Buildpacks []buildpack.LayersMetadata `json:"buildpacks"`
+	// FingerprintSettings identifies the settings that the cached layers were created with, so that the restorer can
+	// fingerprint the layers it restores for the exporter to reuse if they are unchanged.
+	FingerprintSettings string `json:"fingerprintSettings,omitempty"`
 }
 
 func (cm *CacheMetadata) MetadataForBuildpack(id string) buildpack.LayersMetadata {
@@ -15,6 +15,7 @@ const (
 	ExportError                               // generic export error
 	RebaseError                               // generic rebase error
 	LaunchError                               // generic launch error
+	ExportSizeError                           // the exported layers exceed a budget of the size policy
 )
 
 type Exiter interface {
@@ -40,7 +41,8 @@ var defaultExitCodes = map[LifecycleExitError]int{
 	BuildError:            52, // BuildError indicates generic build error
 
 	// export phase errors: 60-69
-	ExportError: 62, // ExportError indicates generic export error
+	ExportError:     62, // ExportError indicates generic export error
+	ExportSizeError: 63, // ExportSizeError indicates that the exported layers exceed a budget of the size policy
 
 	// rebase phase errors: 70-79
 	RebaseError: 72, // RebaseError indicates generic rebase error
@@ -72,7 +74,8 @@ var legacyExitCodes = map[LifecycleExitError]int{
 	BuildError:            402, // BuildError indicates generic build error
 
 	// export phase errors: 500-599
-	ExportError: 502, // ExportError indicates generic export error
+	ExportError:     502, // ExportError indicates generic export error
+	ExportSizeError: 503, // ExportSizeError indicates that the exported layers exceed a budget of the size policy
 
 	// rebase phase errors: 600-699
 	RebaseError: 602, // RebaseError indicates generic rebase error
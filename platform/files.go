@@ -17,6 +17,17 @@ type AnalyzedMetadata struct {
 	PreviousImage *ImageIdentifier `toml:"image"`
 	Metadata      LayersMetadata   `toml:"metadata"`
 	RunImage      *ImageIdentifier `toml:"run-image,omitempty"`
+	Stack         *AnalyzedStack   `toml:"stack,omitempty"`
+	ProjectSource *ProjectSource   `toml:"project-source,omitempty"` // ProjectSource is read from the app's checkout before the build
+}
+
+// AnalyzedStack is the stack of the build and run images, recorded once the run image has been validated against the build image.
+// Mixins are nil if they are not known, in which case they are omitted from analyzed.toml; an image known to provide
+// no mixins is recorded with an empty list.
+type AnalyzedStack struct {
+	ID          string   `toml:"id"`
+	BuildMixins []string `toml:"build-mixins"`
+	RunMixins   []string `toml:"run-mixins"`
 }
 
 // FIXME: fix key names to be accurate in the daemon case
@@ -61,6 +72,7 @@ func (m *LayersMetadata) MetadataForBuildpack(id string) buildpack.LayersMetadat
 
 type LayerMetadata struct {
 	SHA string `json:"sha" toml:"sha"`
+	layers.LayerSize
 }
 
 type RunImageMetadata struct {
@@ -78,6 +90,11 @@ type BuildMetadata struct {
 	Processes                   []launch.Process           `toml:"processes" json:"processes"`
 	Slices                      []layers.Slice             `toml:"slices" json:"-"`
 	BuildpackDefaultProcessType string                     `toml:"buildpack-default-process-type,omitempty" json:"buildpack-default-process-type,omitempty"`
+	Ports                       []buildpack.Port           `toml:"ports,omitempty" json:"-"`
+	Volumes                     []buildpack.Volume         `toml:"volumes,omitempty" json:"-"`
+	StopSignal                  string                     `toml:"stop-signal,omitempty" json:"-"`
+	User                        string                     `toml:"user,omitempty" json:"-"`
+	Prefetch                    []string                   `toml:"prefetch,omitempty" json:"-"`
 }
 
 type LauncherMetadata struct {
@@ -174,11 +191,61 @@ type ProjectSource struct {
 	Metadata map[string]interface{} `toml:"metadata" json:"metadata,omitempty"`
 }
 
+// AddSourceDefaults fills in the source of the project with values read from its checkout.
+// Values provided by the platform are kept, and source is ignored when it has a different type.
+func (p *ProjectMetadata) AddSourceDefaults(source *ProjectSource) {
+	if source == nil {
+		return
+	}
+	if p.Source == nil {
+		p.Source = &ProjectSource{}
+	}
+	if p.Source.Type == "" {
+		p.Source.Type = source.Type
+	} else if p.Source.Type != source.Type {
+		return
+	}
+	p.Source.Version = addDefaults(p.Source.Version, source.Version)
+	p.Source.Metadata = addDefaults(p.Source.Metadata, source.Metadata)
+}
+
+func addDefaults(values, defaults map[string]interface{}) map[string]interface{} {
+	for k, v := range defaults {
+		if _, ok := values[k]; ok {
+			continue
+		}
+		if values == nil {
+			values = map[string]interface{}{}
+		}
+		values[k] = v
+	}
+	return values
+}
+
+// OCIAnnotations returns the standard OCI annotations describing the source of the project:
+// the repository in the source metadata and the commit of the source version.
+func (p ProjectMetadata) OCIAnnotations() map[string]string {
+	annotations := map[string]string{}
+	if p.Source == nil {
+		return annotations
+	}
+	if repository, ok := p.Source.Metadata["repository"].(string); ok && repository != "" {
+		annotations[OCISourceAnnotation] = repository
+	}
+	if commit, ok := p.Source.Version["commit"].(string); ok && commit != "" {
+		annotations[OCIRevisionAnnotation] = commit
+	}
+	return annotations
+}
+
 // report.toml
 
 type ExportReport struct {
-	Build BuildReport `toml:"build,omitempty"`
-	Image ImageReport `toml:"image"`
+	Build           BuildReport            `toml:"build,omitempty"`
+	Image           ImageReport            `toml:"image"`
+	Reproducibility *ReproducibilityReport `toml:"reproducibility,omitempty"`
+	Retries         int                    `toml:"retries,omitzero"`
+	Sizes           *SizeReport            `toml:"sizes,omitempty"`
 }
 
 type BuildReport struct {
@@ -186,16 +253,49 @@ type BuildReport struct {
 }
 
 type ImageReport struct {
-	Tags         []string `toml:"tags"`
-	ImageID      string   `toml:"image-id,omitempty"`
-	Digest       string   `toml:"digest,omitempty"`
-	ManifestSize int64    `toml:"manifest-size,omitzero"`
+	Tags         []string         `toml:"tags"`
+	ImageID      string           `toml:"image-id,omitempty"`
+	Digest       string           `toml:"digest,omitempty"`
+	ManifestSize int64            `toml:"manifest-size,omitzero"`
+	Registries   []RegistryReport `toml:"registries,omitempty"`
+}
+
+// RegistryReport describes the outcome of saving an image to the tags on one registry.
+type RegistryReport struct {
+	Registry string       `toml:"registry"`
+	Digest   string       `toml:"digest,omitempty"`
+	Tags     []string     `toml:"tags,omitempty"`
+	Failures []TagFailure `toml:"failures,omitempty"`
+}
+
+type TagFailure struct {
+	Tag   string `toml:"tag"`
+	Error string `toml:"error"`
+}
+
+// ReproducibilityReport lists buildpack layers whose digest differs from the previous image.
+type ReproducibilityReport struct {
+	Compared        int                    `toml:"compared"`
+	NonReproducible []NonReproducibleLayer `toml:"non-reproducible,omitempty"`
+}
+
+type NonReproducibleLayer struct {
+	Buildpack   string `toml:"buildpack"`
+	Layer       string `toml:"layer"`
+	SHA         string `toml:"sha"`
+	PreviousSHA string `toml:"previous-sha"`
 }
 
 // stack.toml
 
 type StackMetadata struct {
-	RunImage StackRunImageMetadata `json:"runImage" toml:"run-image"`
+	ID         string                   `json:"-" toml:"id,omitempty"`
+	BuildImage *StackBuildImageMetadata `json:"-" toml:"build-image,omitempty"`
+	RunImage   StackRunImageMetadata    `json:"runImage" toml:"run-image"`
+}
+
+type StackBuildImageMetadata struct {
+	Mixins []string `toml:"mixins,omitempty"`
 }
 
 type StackRunImageMetadata struct {
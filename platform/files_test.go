@@ -1,8 +1,10 @@
 package platform_test
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/BurntSushi/toml"
 	"github.com/sclevine/spec"
 
 	"github.com/buildpacks/lifecycle/platform"
@@ -72,4 +74,106 @@ func testMetadata(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+
+	when("ProjectMetadata#OCIAnnotations", func() {
+		it("returns the source repository and revision", func() {
+			projectMD := platform.ProjectMetadata{Source: &platform.ProjectSource{
+				Type:     "git",
+				Version:  map[string]interface{}{"commit": "some-commit"},
+				Metadata: map[string]interface{}{"repository": "https://github.com/some/repo", "refs": []string{"main"}},
+			}}
+			h.AssertEq(t, projectMD.OCIAnnotations(), map[string]string{
+				"org.opencontainers.image.source":   "https://github.com/some/repo",
+				"org.opencontainers.image.revision": "some-commit",
+			})
+		})
+
+		it("returns no annotations when the source is not known", func() {
+			h.AssertEq(t, platform.ProjectMetadata{}.OCIAnnotations(), map[string]string{})
+			projectMD := platform.ProjectMetadata{Source: &platform.ProjectSource{Type: "image"}}
+			h.AssertEq(t, projectMD.OCIAnnotations(), map[string]string{})
+		})
+	})
+
+	when("ProjectMetadata#AddSourceDefaults", func() {
+		var gitSource *platform.ProjectSource
+
+		it.Before(func() {
+			gitSource = &platform.ProjectSource{
+				Type:     "git",
+				Version:  map[string]interface{}{"commit": "some-commit"},
+				Metadata: map[string]interface{}{"repository": "https://github.com/some/repo", "dirty": false},
+			}
+		})
+
+		it("uses the source when the platform provides none", func() {
+			projectMD := platform.ProjectMetadata{}
+			projectMD.AddSourceDefaults(gitSource)
+			h.AssertEq(t, projectMD.Source, gitSource)
+		})
+
+		it("keeps the values provided by the platform", func() {
+			projectMD := platform.ProjectMetadata{Source: &platform.ProjectSource{
+				Type:     "git",
+				Version:  map[string]interface{}{"commit": "other-commit"},
+				Metadata: map[string]interface{}{"url": "https://example.com"},
+			}}
+			projectMD.AddSourceDefaults(gitSource)
+			h.AssertEq(t, projectMD.Source, &platform.ProjectSource{
+				Type:     "git",
+				Version:  map[string]interface{}{"commit": "other-commit"},
+				Metadata: map[string]interface{}{"url": "https://example.com", "repository": "https://github.com/some/repo", "dirty": false},
+			})
+		})
+
+		it("ignores a source of a different type", func() {
+			projectMD := platform.ProjectMetadata{Source: &platform.ProjectSource{Type: "image"}}
+			projectMD.AddSourceDefaults(gitSource)
+			h.AssertEq(t, projectMD.Source, &platform.ProjectSource{Type: "image"})
+		})
+
+		it("ignores a missing source", func() {
+			projectMD := platform.ProjectMetadata{}
+			projectMD.AddSourceDefaults(nil)
+			h.AssertNil(t, projectMD.Source)
+		})
+	})
+	when("AnalyzedStack", func() {
+		it("distinguishes mixins that are not known from no mixins", func() {
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, toml.NewEncoder(buf).Encode(platform.AnalyzedMetadata{
+				Stack: &platform.AnalyzedStack{ID: "some-stack", RunMixins: []string{}},
+			}))
+
+			var analyzedMD platform.AnalyzedMetadata
+			_, err := toml.Decode(buf.String(), &analyzedMD)
+			h.AssertNil(t, err)
+			h.AssertEq(t, analyzedMD.Stack.BuildMixins, []string(nil))
+			h.AssertEq(t, analyzedMD.Stack.RunMixins, []string{})
+		})
+	})
+
+	when("AnalyzedMetadata", func() {
+		it("records the project source read before the build", func() {
+			buf := &bytes.Buffer{}
+			h.AssertNil(t, toml.NewEncoder(buf).Encode(platform.AnalyzedMetadata{
+				ProjectSource: &platform.ProjectSource{
+					Type:     "git",
+					Version:  map[string]interface{}{"commit": "some-commit"},
+					Metadata: map[string]interface{}{"dirty": false, "repository": "https://github.com/some-org/some-app.git"},
+				},
+			}))
+
+			var analyzedMD platform.AnalyzedMetadata
+			_, err := toml.Decode(buf.String(), &analyzedMD)
+			h.AssertNil(t, err)
+			h.AssertEq(t, analyzedMD.ProjectSource.Metadata["dirty"], false)
+			var projectMD platform.ProjectMetadata
+			projectMD.AddSourceDefaults(analyzedMD.ProjectSource)
+			h.AssertEq(t, projectMD.OCIAnnotations(), map[string]string{
+				platform.OCISourceAnnotation:   "https://github.com/some-org/some-app.git",
+				platform.OCIRevisionAnnotation: "some-commit",
+			})
+		})
+	})
 }
@@ -7,3 +7,11 @@ const (
 	StackIDLabel         = "io.buildpacks.stack.id"
 	MixinsLabel          = "io.buildpacks.stack.mixins"
 )
+
+// ReservedLabelPrefix is the prefix of the labels set by the lifecycle and by stacks.
+const ReservedLabelPrefix = "io.buildpacks."
+
+const (
+	OCISourceAnnotation   = "org.opencontainers.image.source"
+	OCIRevisionAnnotation = "org.opencontainers.image.revision"
+)
@@ -0,0 +1,51 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LazyLayersFile is written to the layers directory by the restorer when any cached layers were not restored
+// because their buildpack requested restore = "lazy" in <layer>.toml.
+const LazyLayersFile = "lazy-layers.toml"
+
+// LazyLayersMetadata records the cache that lazy layers can be restored from and the layers that were deferred.
+// Every buildpack can read the file, so CacheURL never includes credentials; they must be provided to restore-layer again.
+type LazyLayersMetadata struct {
+	CacheDir   string      `toml:"cache-dir,omitempty"`
+	CacheImage string      `toml:"cache-image,omitempty"`
+	CacheURL   string      `toml:"cache-url,omitempty"`
+	Layers     []LazyLayer `toml:"layers"`
+}
+
+type LazyLayer struct {
+	Buildpack string `toml:"buildpack"`
+	Name      string `toml:"name"`
+	SHA       string `toml:"sha"`
+	Restored  bool   `toml:"restored"`
+}
+
+func LazyLayersPath(layersDir string) string {
+	return filepath.Join(layersDir, LazyLayersFile)
+}
+
+// ReadLazyLayers reads the lazy layers file at the given path, returning empty metadata if it does not exist.
+func ReadLazyLayers(path string) (LazyLayersMetadata, error) {
+	var md LazyLayersMetadata
+	if _, err := toml.DecodeFile(path, &md); err != nil && !os.IsNotExist(err) {
+		return LazyLayersMetadata{}, err
+	}
+	return md, nil
+}
+
+// Find returns the lazy layer with the given name for the given buildpack, or nil if the layer was not deferred.
+func (m *LazyLayersMetadata) Find(buildpackID, name string) *LazyLayer {
+	for i := range m.Layers {
+		if m.Layers[i].Buildpack == buildpackID && m.Layers[i].Name == name {
+			return &m.Layers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/layers"
+)
+
+// size-policy.toml
+
+const (
+	SizePolicyWarn = "warn" // SizePolicyWarn warns about exceeded budgets
+	SizePolicyFail = "fail" // SizePolicyFail fails the export when a budget is exceeded
+)
+
+// SizePolicy limits the compressed size of the layers that the exporter adds to the run image.
+// A budget of zero is unlimited.
+type SizePolicy struct {
+	Action           string                `toml:"action"`
+	MaxSize          ByteSize              `toml:"max-size"`
+	MaxBuildpackSize ByteSize              `toml:"max-buildpack-size"`
+	Buildpacks       []BuildpackSizeBudget `toml:"buildpacks"` // Buildpacks overrides MaxBuildpackSize for the given buildpacks
+}
+
+type BuildpackSizeBudget struct {
+	ID      string   `toml:"id"`
+	MaxSize ByteSize `toml:"max-size"`
+}
+
+// ReadSizePolicy reads the size policy at path. The action defaults to SizePolicyWarn.
+func ReadSizePolicy(path string) (*SizePolicy, error) {
+	policy := &SizePolicy{}
+	if _, err := toml.DecodeFile(path, policy); err != nil {
+		return nil, errors.Wrapf(err, "reading size policy '%s'", path)
+	}
+	switch policy.Action {
+	case "":
+		policy.Action = SizePolicyWarn
+	case SizePolicyWarn, SizePolicyFail:
+	default:
+		return nil, fmt.Errorf("invalid size policy action '%s', expected '%s' or '%s'", policy.Action, SizePolicyWarn, SizePolicyFail)
+	}
+	return policy, nil
+}
+
+// Check returns the budgets of the policy that are exceeded by the layers in the report.
+func (p *SizePolicy) Check(report SizeReport) []SizeViolation {
+	var violations []SizeViolation
+	if p.MaxSize > 0 && report.CompressedSize > int64(p.MaxSize) {
+		violations = append(violations, SizeViolation{
+			Budget:         "total",
+			MaxSize:        int64(p.MaxSize),
+			CompressedSize: report.CompressedSize,
+		})
+	}
+	for _, group := range report.Groups {
+		if group.Group != LayerGroupBuildpack {
+			continue
+		}
+		maxSize := p.buildpackBudget(group.Buildpack)
+		if maxSize > 0 && group.CompressedSize > int64(maxSize) {
+			violations = append(violations, SizeViolation{
+				Budget:         group.Buildpack,
+				MaxSize:        int64(maxSize),
+				CompressedSize: group.CompressedSize,
+			})
+		}
+	}
+	return violations
+}
+
+func (p *SizePolicy) buildpackBudget(id string) ByteSize {
+	for _, budget := range p.Buildpacks {
+		if budget.ID == id {
+			return budget.MaxSize
+		}
+	}
+	return p.MaxBuildpackSize
+}
+
+// ByteSize is a number of bytes, given in TOML as an integer or as a string with a unit, e.g. "500MB" or "1.5GiB".
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	// longer suffixes first, so that "MiB" is not read as "B"
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// ParseByteSize parses a number of bytes with an optional unit (B, KB, MB, GB, TB, KiB, MiB, GiB or TiB).
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.TrimSpace(s)
+	multiplier := 1.0
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(strings.ToUpper(str), strings.ToUpper(unit.suffix)) {
+			str, multiplier = strings.TrimSpace(str[:len(str)-len(unit.suffix)]), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// String formats the size with the largest decimal unit that keeps it above one, e.g. "1.5 GB".
+func (b ByteSize) String() string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(b)
+	unit := 0
+	for size >= 1000 && unit < len(units)-1 {
+		size /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", int64(b))
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// report.toml
+
+const (
+	LayerGroupBuildpack = "buildpack"
+	LayerGroupApp       = "app"
+	LayerGroupLauncher  = "launcher"
+	LayerGroupSBOM      = "sbom"
+)
+
+// SizeReport describes the size of the layers that the exporter added to or reused in the image, on top of the run image.
+// The size of a layer is omitted when it is not known, e.g. when it was reused from an image exported by an older lifecycle.
+type SizeReport struct {
+	layers.LayerSize
+	Groups     []LayerGroupSize `toml:"groups"`
+	Growth     []LayerGrowth    `toml:"growth,omitempty"`
+	Violations []SizeViolation  `toml:"violations,omitempty"`
+}
+
+// LayerGroupSize describes the size of the layers of a buildpack, the app slices, the launcher layers or the SBOM layer.
+type LayerGroupSize struct {
+	Group     string `toml:"group"`
+	Buildpack string `toml:"buildpack,omitempty"`
+	layers.LayerSize
+	Layers []NamedLayerSize `toml:"layers"`
+}
+
+type NamedLayerSize struct {
+	Name string `toml:"name"`
+	SHA  string `toml:"sha"`
+	layers.LayerSize
+}
+
+// LayerGrowth describes how much the compressed size of a layer grew compared with the previous image.
+// The layer is identified by the ID of its buildpack or by its group, and its name, e.g. "some-buildpack:some-layer".
+type LayerGrowth struct {
+	Layer                  string `toml:"layer"`
+	CompressedSize         int64  `toml:"compressed-size"`
+	PreviousCompressedSize int64  `toml:"previous-compressed-size"`
+}
+
+// SizeViolation describes a budget of the size policy that was exceeded, either the "total" budget or that of a buildpack.
+type SizeViolation struct {
+	Budget         string `toml:"budget"`
+	MaxSize        int64  `toml:"max-size"`
+	CompressedSize int64  `toml:"compressed-size"`
+}
+
+func (v SizeViolation) String() string {
+	if v.Budget == "total" {
+		return fmt.Sprintf("layers are %s compressed, exceeding the budget of %s", ByteSize(v.CompressedSize), ByteSize(v.MaxSize))
+	}
+	return fmt.Sprintf("layers of buildpack '%s' are %s compressed, exceeding the budget of %s", v.Budget, ByteSize(v.CompressedSize), ByteSize(v.MaxSize))
+}
+
+// AddGroup adds a group of layers to the report and to its totals.
+func (r *SizeReport) AddGroup(group LayerGroupSize) {
+	for _, layer := range group.Layers {
+		group.Size += layer.Size
+		group.CompressedSize += layer.CompressedSize
+	}
+	r.Size += group.Size
+	r.CompressedSize += group.CompressedSize
+	r.Groups = append(r.Groups, group)
+}
+
+// SetGrowth records the layers that grew the most compared with the layers of the same name in the previous report,
+// keeping at most max layers.
+func (r *SizeReport) SetGrowth(previous SizeReport, max int) {
+	previousSizes := map[string]int64{}
+	for _, group := range previous.Groups {
+		for _, layer := range group.Layers {
+			previousSizes[growthKey(group, layer.Name)] = layer.CompressedSize
+		}
+	}
+	var growth []LayerGrowth
+	for _, group := range r.Groups {
+		for _, layer := range group.Layers {
+			key := growthKey(group, layer.Name)
+			previousSize := previousSizes[key]
+			if previousSize == 0 || layer.CompressedSize <= previousSize {
+				continue
+			}
+			growth = append(growth, LayerGrowth{
+				Layer:                  key,
+				CompressedSize:         layer.CompressedSize,
+				PreviousCompressedSize: previousSize,
+			})
+		}
+	}
+	sort.SliceStable(growth, func(i, j int) bool {
+		return growth[i].CompressedSize-growth[i].PreviousCompressedSize > growth[j].CompressedSize-growth[j].PreviousCompressedSize
+	})
+	if len(growth) > max {
+		growth = growth[:max]
+	}
+	r.Growth = growth
+}
+
+func growthKey(group LayerGroupSize, name string) string {
+	if group.Buildpack != "" {
+		return group.Buildpack + ":" + name
+	}
+	return group.Group + ":" + name
+}
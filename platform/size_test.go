@@ -0,0 +1,219 @@
+package platform_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/lifecycle/layers"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestSize(t *testing.T) {
+	spec.Run(t, "Test Size", testSize)
+}
+
+func testSize(t *testing.T, when spec.G, it spec.S) {
+	when("ParseByteSize", func() {
+		it("parses sizes with and without units", func() {
+			for input, expected := range map[string]platform.ByteSize{
+				"123":     123,
+				"10B":     10,
+				"500KB":   500000,
+				"500 mb":  500000000,
+				"1.5GB":   1500000000,
+				"1TB":     1000000000000,
+				"2KiB":    2048,
+				"1.5MiB":  1572864,
+				"1GiB":    1 << 30,
+				" 3 TiB ": 3 << 40,
+			} {
+				size, err := platform.ParseByteSize(input)
+				h.AssertNil(t, err)
+				h.AssertEq(t, size, expected)
+			}
+		})
+
+		it("fails for invalid sizes", func() {
+			for _, input := range []string{"", "MB", "-1MB", "1XB", "one"} {
+				_, err := platform.ParseByteSize(input)
+				h.AssertError(t, err, "invalid size")
+			}
+		})
+	})
+
+	when("ByteSize#String", func() {
+		it("formats with the largest decimal unit", func() {
+			h.AssertEq(t, platform.ByteSize(999).String(), "999 B")
+			h.AssertEq(t, platform.ByteSize(1500).String(), "1.5 KB")
+			h.AssertEq(t, platform.ByteSize(1500000000).String(), "1.5 GB")
+		})
+	})
+
+	when("ReadSizePolicy", func() {
+		var tmpDir string
+
+		it.Before(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "size-policy")
+			h.AssertNil(t, err)
+		})
+
+		it.After(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		writePolicy := func(contents string) string {
+			path := filepath.Join(tmpDir, "size-policy.toml")
+			h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+			return path
+		}
+
+		it("reads budgets given as integers or with units", func() {
+			policy, err := platform.ReadSizePolicy(writePolicy(`
+action = "fail"
+max-size = "1GB"
+max-buildpack-size = 1000
+
+[[buildpacks]]
+id = "some/buildpack"
+max-size = "2 MiB"
+`))
+			h.AssertNil(t, err)
+			h.AssertEq(t, policy, &platform.SizePolicy{
+				Action:           platform.SizePolicyFail,
+				MaxSize:          1000000000,
+				MaxBuildpackSize: 1000,
+				Buildpacks:       []platform.BuildpackSizeBudget{{ID: "some/buildpack", MaxSize: 2 << 20}},
+			})
+		})
+
+		it("defaults the action to warn", func() {
+			policy, err := platform.ReadSizePolicy(writePolicy(`max-size = "1GB"`))
+			h.AssertNil(t, err)
+			h.AssertEq(t, policy.Action, platform.SizePolicyWarn)
+		})
+
+		it("fails for an invalid action", func() {
+			_, err := platform.ReadSizePolicy(writePolicy(`action = "ignore"`))
+			h.AssertError(t, err, "invalid size policy action 'ignore'")
+		})
+
+		it("fails for an invalid size", func() {
+			_, err := platform.ReadSizePolicy(writePolicy(`max-size = "big"`))
+			h.AssertError(t, err, "invalid size 'big'")
+		})
+	})
+
+	when("SizeReport", func() {
+		var report platform.SizeReport
+
+		it.Before(func() {
+			report = platform.SizeReport{}
+			report.AddGroup(platform.LayerGroupSize{
+				Group:     platform.LayerGroupBuildpack,
+				Buildpack: "buildpack.a",
+				Layers: []platform.NamedLayerSize{
+					{Name: "layer1", SHA: "sha256:a1", LayerSize: layers.LayerSize{Size: 100, CompressedSize: 40}},
+					{Name: "layer2", SHA: "sha256:a2", LayerSize: layers.LayerSize{Size: 200, CompressedSize: 60}},
+				},
+			})
+			report.AddGroup(platform.LayerGroupSize{
+				Group:     platform.LayerGroupBuildpack,
+				Buildpack: "buildpack.b",
+				Layers: []platform.NamedLayerSize{
+					{Name: "layer1", SHA: "sha256:b1", LayerSize: layers.LayerSize{Size: 50, CompressedSize: 20}},
+				},
+			})
+			report.AddGroup(platform.LayerGroupSize{
+				Group: platform.LayerGroupApp,
+				Layers: []platform.NamedLayerSize{
+					{Name: "slice-1", SHA: "sha256:app", LayerSize: layers.LayerSize{Size: 30, CompressedSize: 10}},
+				},
+			})
+		})
+
+		when("#AddGroup", func() {
+			it("sums the sizes of the groups and the report", func() {
+				h.AssertEq(t, report.LayerSize, layers.LayerSize{Size: 380, CompressedSize: 130})
+				h.AssertEq(t, report.Groups[0].LayerSize, layers.LayerSize{Size: 300, CompressedSize: 100})
+				h.AssertEq(t, report.Groups[1].LayerSize, layers.LayerSize{Size: 50, CompressedSize: 20})
+				h.AssertEq(t, report.Groups[2].LayerSize, layers.LayerSize{Size: 30, CompressedSize: 10})
+			})
+		})
+
+		when("#SetGrowth", func() {
+			var previous platform.SizeReport
+
+			it.Before(func() {
+				previous = platform.SizeReport{}
+				previous.AddGroup(platform.LayerGroupSize{
+					Group:     platform.LayerGroupBuildpack,
+					Buildpack: "buildpack.a",
+					Layers: []platform.NamedLayerSize{
+						{Name: "layer1", LayerSize: layers.LayerSize{CompressedSize: 30}},
+						{Name: "layer2", LayerSize: layers.LayerSize{CompressedSize: 60}},
+					},
+				})
+				previous.AddGroup(platform.LayerGroupSize{
+					Group:     platform.LayerGroupBuildpack,
+					Buildpack: "buildpack.b",
+					Layers: []platform.NamedLayerSize{
+						{Name: "layer1", LayerSize: layers.LayerSize{CompressedSize: 5}},
+					},
+				})
+				previous.AddGroup(platform.LayerGroupSize{
+					Group: platform.LayerGroupApp,
+					Layers: []platform.NamedLayerSize{
+						{Name: "slice-1"}, // size not known
+					},
+				})
+			})
+
+			it("lists the layers that grew the most first", func() {
+				report.SetGrowth(previous, 5)
+				h.AssertEq(t, report.Growth, []platform.LayerGrowth{
+					{Layer: "buildpack.b:layer1", CompressedSize: 20, PreviousCompressedSize: 5},
+					{Layer: "buildpack.a:layer1", CompressedSize: 40, PreviousCompressedSize: 30},
+				})
+			})
+
+			it("keeps at most max layers", func() {
+				report.SetGrowth(previous, 1)
+				h.AssertEq(t, report.Growth, []platform.LayerGrowth{
+					{Layer: "buildpack.b:layer1", CompressedSize: 20, PreviousCompressedSize: 5},
+				})
+			})
+		})
+
+		when("SizePolicy#Check", func() {
+			it("returns nothing when the budgets are not exceeded", func() {
+				policy := &platform.SizePolicy{MaxSize: 130, MaxBuildpackSize: 100}
+				h.AssertEq(t, len(policy.Check(report)), 0)
+			})
+
+			it("returns the exceeded total and buildpack budgets", func() {
+				policy := &platform.SizePolicy{
+					MaxSize:          129,
+					MaxBuildpackSize: 19,
+					Buildpacks:       []platform.BuildpackSizeBudget{{ID: "buildpack.a", MaxSize: 100}},
+				}
+				h.AssertEq(t, policy.Check(report), []platform.SizeViolation{
+					{Budget: "total", MaxSize: 129, CompressedSize: 130},
+					{Budget: "buildpack.b", MaxSize: 19, CompressedSize: 20},
+				})
+			})
+
+			it("treats a budget of zero as unlimited", func() {
+				policy := &platform.SizePolicy{Buildpacks: []platform.BuildpackSizeBudget{{ID: "buildpack.b", MaxSize: 10}}}
+				h.AssertEq(t, policy.Check(report), []platform.SizeViolation{
+					{Budget: "buildpack.b", MaxSize: 10, CompressedSize: 20},
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package priv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// User is the user that a phase runs as after dropping privileges.
+type User struct {
+	UID int
+	GID int
+	// Groups are the supplementary group IDs; when privileges are dropped, any other supplementary groups are removed.
+	Groups []int
+	// Capabilities are the Linux capabilities that are kept when privileges are dropped; all others are dropped,
+	// including from the bounding set so that they can't be regained by executing another program.
+	// If nil, every capability is dropped.
+	Capabilities []Capability
+	// KeepCapabilities, when true, leaves capabilities to the kernel, which clears them when a root process changes to
+	// another user but not when it keeps running as root. Capabilities is ignored.
+	KeepCapabilities bool
+}
+
+// Capability is a Linux capability number, e.g. 10 for CAP_NET_BIND_SERVICE.
+type Capability int
+
+var capabilityNumbers = map[string]Capability{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// lastCapability is the highest capability number known to the lifecycle.
+const lastCapability Capability = 40
+
+// ParseCapability parses a capability name such as "CAP_NET_BIND_SERVICE" or "net_bind_service".
+func ParseCapability(name string) (Capability, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(normalized, "CAP_") {
+		normalized = "CAP_" + normalized
+	}
+	c, ok := capabilityNumbers[normalized]
+	if !ok {
+		return 0, fmt.Errorf("unknown capability '%s'", name)
+	}
+	return c, nil
+}
+
+func (c Capability) String() string {
+	for name, n := range capabilityNumbers {
+		if n == c {
+			return name
+		}
+	}
+	return fmt.Sprintf("capability %d", int(c))
+}
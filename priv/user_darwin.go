@@ -10,7 +10,7 @@ func IsPrivileged() bool {
 	return os.Getuid() == 0
 }
 
-func RunAs(uid, gid int) error {
+func RunAs(u User) error {
 	return nil
 }
 
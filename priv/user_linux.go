@@ -4,15 +4,21 @@
 package priv
 
 import (
-	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"sync"
 	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
-// EnsureOwner recursively chowns a dir if it isn't writable
+// EnsureOwner recursively chowns a dir if it isn't writable.
+// Subdirectories that are already owned by uid:gid are assumed to have correctly owned children and are skipped.
 func EnsureOwner(uid, gid int, paths ...string) error {
 	for _, p := range paths {
 		fi, err := os.Stat(p)
@@ -26,7 +32,10 @@ func EnsureOwner(uid, gid int, paths ...string) error {
 			// if a dir has correct ownership, assume it's children do, for performance
 			continue
 		}
-		if err := recursiveEnsureOwner(p, uid, gid); err != nil {
+		if err := os.Chown(p, uid, gid); err != nil {
+			return err
+		}
+		if err := chownTree(p, uid, gid); err != nil {
 			return err
 		}
 	}
@@ -56,45 +65,183 @@ func IsPrivileged() bool {
 	return os.Getuid() == 0
 }
 
-func recursiveEnsureOwner(path string, uid, gid int) error {
-	if err := os.Chown(path, uid, gid); err != nil {
-		return err
+// chownConcurrency is the number of workers that chown directories concurrently.
+var chownConcurrency = 2 * runtime.NumCPU()
+
+// chownTree chowns the contents of dir, walking subdirectories on a fixed number of workers that share a queue.
+func chownTree(dir string, uid, gid int) error {
+	var (
+		mu       sync.Mutex
+		ready    = sync.NewCond(&mu)
+		queue    = []string{dir}
+		pending  = 1 // directories that are queued or being chowned
+		firstErr error
+	)
+	worker := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			for len(queue) == 0 && pending > 0 {
+				ready.Wait()
+			}
+			if pending == 0 {
+				return
+			}
+			next := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+
+			var subdirs []string
+			if firstErr == nil {
+				// once a directory has failed, the remaining directories are dequeued without being chowned
+				mu.Unlock()
+				var err error
+				subdirs, err = chownEntries(next, uid, gid)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+			if firstErr == nil {
+				queue = append(queue, subdirs...)
+				pending += len(subdirs)
+			}
+			pending--
+			ready.Broadcast()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < chownConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
 	}
-	fis, err := ioutil.ReadDir(path)
+	wg.Wait()
+	return firstErr
+}
+
+// chownEntries chowns the entries of dir, returning the subdirectories that must be walked.
+func chownEntries(dir string, uid, gid int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, fi := range fis {
-		filePath := filepath.Join(path, fi.Name())
-		if fi.IsDir() {
-			if err := recursiveEnsureOwner(filePath, uid, gid); err != nil {
-				return err
+	var subdirs []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			fi, err := entry.Info()
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			if err := os.Lchown(filePath, uid, gid); err != nil {
-				return err
+			if stat, ok := fi.Sys().(*syscall.Stat_t); ok && stat.Uid == uint32(uid) && stat.Gid == uint32(gid) {
+				continue
 			}
+			subdirs = append(subdirs, path)
+		}
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return subdirs, nil
 }
 
-// RunAs sets the user ID and group ID of the calling process.
-func RunAs(uid, gid int) error {
-	if uid == os.Getuid() && gid == os.Getgid() {
-		return nil
+// RunAs sets the user ID, group ID and supplementary groups of the calling process.
+// When the process is privileged, all capabilities that are not in the allowlist of the user are dropped, including from
+// the bounding set, which requires a lifecycle built without cgo. Unless the user keeps its capabilities, a nil allowlist
+// drops them all.
+func RunAs(u User) error {
+	if !IsPrivileged() {
+		if u.UID == os.Getuid() && u.GID == os.Getgid() {
+			return nil
+		}
+		return setIDs(u)
+	}
+	if u.KeepCapabilities {
+		if err := syscall.Setgroups(u.Groups); err != nil {
+			return errors.Wrap(err, "setting supplementary groups")
+		}
+		return setIDs(u)
 	}
 
-	if err := syscall.Setresgid(gid, gid, gid); err != nil {
+	keep := map[Capability]bool{}
+	for _, c := range u.Capabilities {
+		keep[c] = true
+	}
+	for c := Capability(0); c <= lastCapability; c++ {
+		if keep[c] {
+			continue
+		}
+		// EINVAL means the kernel does not know the capability
+		if err := prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0); err != nil && err != syscall.EINVAL {
+			return errors.Wrapf(err, "dropping %s from the capability bounding set", c)
+		}
+	}
+	if len(keep) > 0 && u.UID != 0 {
+		// keep the permitted capabilities when the user ID changes, so the allowlisted capabilities can be set below
+		if err := prctl(unix.PR_SET_KEEPCAPS, 1, 0); err != nil {
+			return errors.Wrap(err, "keeping capabilities")
+		}
+	}
+
+	if err := syscall.Setgroups(u.Groups); err != nil {
+		return errors.Wrap(err, "setting supplementary groups")
+	}
+	if err := setIDs(u); err != nil {
 		return err
 	}
-	if err := syscall.Setresuid(uid, uid, uid); err != nil {
+
+	if err := setCapabilities(u.Capabilities); err != nil {
+		return errors.Wrap(err, "setting capabilities")
+	}
+	return nil
+}
+
+func setIDs(u User) error {
+	if err := syscall.Setresgid(u.GID, u.GID, u.GID); err != nil {
 		return err
 	}
+	return syscall.Setresuid(u.UID, u.UID, u.UID)
+}
 
+// setCapabilities sets the effective, permitted and inheritable capabilities of every thread to caps,
+// and raises them in the ambient set so that programs executed by the lifecycle keep them.
+func setCapabilities(caps []Capability) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	for _, c := range caps {
+		data[c/32].Effective |= 1 << (uint(c) % 32)
+		data[c/32].Permitted |= 1 << (uint(c) % 32)
+		data[c/32].Inheritable |= 1 << (uint(c) % 32)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(unix.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return allThreadsErr(errno)
+	}
+	for _, c := range caps {
+		if err := prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c)); err != nil {
+			return errors.Wrapf(err, "raising ambient capability %s", c)
+		}
+	}
 	return nil
 }
 
+// prctl calls prctl on every thread, since capabilities are a per-thread attribute.
+func prctl(option, arg2, arg3 uintptr) error {
+	if _, _, errno := syscall.AllThreadsSyscall6(unix.SYS_PRCTL, option, arg2, arg3, 0, 0, 0); errno != 0 {
+		return allThreadsErr(errno)
+	}
+	return nil
+}
+
+func allThreadsErr(errno syscall.Errno) error {
+	if errno == syscall.ENOTSUP {
+		return errors.New("capabilities can only be changed by a lifecycle built with CGO_ENABLED=0")
+	}
+	return errno
+}
+
 func SetEnvironmentForUser(uid int) error {
 	user, err := user.LookupId(strconv.Itoa(uid))
 	if err != nil {
@@ -0,0 +1,178 @@
+//go:build linux
+// +build linux
+
+package priv_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/priv"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestEnsureOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to chown files")
+	}
+	spec.Run(t, "EnsureOwner", testEnsureOwner, spec.Report(report.Terminal{}))
+}
+
+func testEnsureOwner(t *testing.T, when spec.G, it spec.S) {
+	const uid, gid = 1234, 5678
+	var tmpDir string
+
+	owner := func(path string) (uint32, uint32) {
+		fi, err := os.Lstat(path)
+		h.AssertNil(t, err)
+		stat := fi.Sys().(*syscall.Stat_t)
+		return stat.Uid, stat.Gid
+	}
+
+	assertOwner := func(path string, expectedUID, expectedGID uint32) {
+		t.Helper()
+		actualUID, actualGID := owner(path)
+		h.AssertEq(t, actualUID, expectedUID)
+		h.AssertEq(t, actualGID, expectedGID)
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.priv")
+		h.AssertNil(t, err)
+		h.AssertNil(t, os.Chmod(tmpDir, 0755))
+		for i := 0; i < 20; i++ {
+			dir := filepath.Join(tmpDir, "dir", string(rune('a'+i)), "nested")
+			h.AssertNil(t, os.MkdirAll(dir, 0755))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("contents"), 0644))
+		}
+		h.AssertNil(t, os.Symlink("dir/a", filepath.Join(tmpDir, "link")))
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("chowns every file in a directory that isn't writable", func() {
+		h.AssertNil(t, priv.EnsureOwner(uid, gid, tmpDir))
+
+		assertOwner(tmpDir, uid, gid)
+		assertOwner(filepath.Join(tmpDir, "link"), uid, gid)
+		for i := 0; i < 20; i++ {
+			dir := filepath.Join(tmpDir, "dir", string(rune('a'+i)))
+			assertOwner(dir, uid, gid)
+			assertOwner(filepath.Join(dir, "nested"), uid, gid)
+			assertOwner(filepath.Join(dir, "nested", "file"), uid, gid)
+		}
+	})
+
+	it("skips subdirectories that are already owned by the user", func() {
+		owned := filepath.Join(tmpDir, "dir", "b")
+		h.AssertNil(t, os.Chown(owned, uid, gid))
+
+		h.AssertNil(t, priv.EnsureOwner(uid, gid, tmpDir))
+
+		assertOwner(filepath.Join(owned, "nested"), 0, 0)
+		assertOwner(filepath.Join(tmpDir, "dir", "c", "nested", "file"), uid, gid)
+	})
+
+	it("skips directories that are writable", func() {
+		h.AssertNil(t, os.Chmod(tmpDir, 0777))
+
+		h.AssertNil(t, priv.EnsureOwner(uid, gid, tmpDir))
+
+		assertOwner(tmpDir, 0, 0)
+	})
+
+	it("ignores paths that don't exist", func() {
+		h.AssertNil(t, priv.EnsureOwner(uid, gid, filepath.Join(tmpDir, "missing")))
+	})
+}
+
+func TestRunAs(t *testing.T) {
+	if os.Getenv("PRIV_TEST_RUN_AS") == "true" {
+		runAs()
+	}
+	if os.Getuid() != 0 {
+		t.Skip("requires root to drop capabilities")
+	}
+	spec.Run(t, "RunAs", testRunAs, spec.Report(report.Terminal{}))
+}
+
+// runAs runs as root with the capabilities given by the environment, and prints the status of the process.
+// It is called in a new test process, as RunAs changes the capabilities of the whole process for good.
+func runAs() {
+	u := priv.User{UID: 0, GID: 0, Groups: []int{}, KeepCapabilities: os.Getenv("PRIV_TEST_KEEP_CAPABILITIES") == "true"}
+	if allowed := os.Getenv("PRIV_TEST_CAPABILITIES"); allowed != "" {
+		c, err := priv.ParseCapability(allowed)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		u.Capabilities = []priv.Capability{c}
+	}
+	if err := priv.RunAs(u); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(status)
+	os.Exit(0)
+}
+
+func testRunAs(t *testing.T, when spec.G, it spec.S) {
+	// capabilities returns the capability sets of a root process after RunAs, e.g. "CapBnd" to the bounding set
+	capabilities := func(env ...string) map[string]string {
+		t.Helper()
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRunAs$") // #nosec G204
+		cmd.Env = append(append(os.Environ(), "PRIV_TEST_RUN_AS=true"), env...)
+		out, err := cmd.CombinedOutput()
+		if strings.Contains(string(out), "CGO_ENABLED=0") {
+			t.Skip("capabilities can only be dropped by a test binary built with CGO_ENABLED=0")
+		}
+		if err != nil {
+			t.Fatalf("running as root: %s: %s", err, out)
+		}
+		sets := map[string]string{}
+		for _, line := range strings.Split(string(out), "\n") {
+			if name := strings.SplitN(line, ":", 2)[0]; strings.HasPrefix(name, "Cap") {
+				sets[name] = strings.TrimSpace(strings.SplitN(line, ":", 2)[1])
+			}
+		}
+		return sets
+	}
+	const none = "0000000000000000"
+
+	it("drops every capability when the user has no allowlist", func() {
+		sets := capabilities()
+		for _, set := range []string{"CapPrm", "CapEff", "CapInh", "CapAmb", "CapBnd"} {
+			h.AssertEq(t, sets[set], none)
+		}
+	})
+
+	it("keeps the allowlisted capabilities", func() {
+		sets := capabilities("PRIV_TEST_CAPABILITIES=CAP_NET_BIND_SERVICE")
+		for _, set := range []string{"CapPrm", "CapEff", "CapAmb", "CapBnd"} {
+			h.AssertEq(t, sets[set], "0000000000000400")
+		}
+	})
+
+	it("leaves the capabilities of a root user when the user keeps them", func() {
+		sets := capabilities("PRIV_TEST_KEEP_CAPABILITIES=true")
+		h.AssertEq(t, sets["CapBnd"] != none, true)
+		h.AssertEq(t, sets["CapPrm"] != none, true)
+	})
+}
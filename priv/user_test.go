@@ -0,0 +1,33 @@
+package priv_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/priv"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestUser(t *testing.T) {
+	spec.Run(t, "User", testUser, spec.Report(report.Terminal{}))
+}
+
+func testUser(t *testing.T, when spec.G, it spec.S) {
+	when("#ParseCapability", func() {
+		it("parses capability names with or without the CAP_ prefix", func() {
+			for _, name := range []string{"CAP_NET_BIND_SERVICE", "net_bind_service", " Net_Bind_Service "} {
+				c, err := priv.ParseCapability(name)
+				h.AssertNil(t, err)
+				h.AssertEq(t, c, priv.Capability(10))
+				h.AssertEq(t, c.String(), "CAP_NET_BIND_SERVICE")
+			}
+		})
+
+		it("returns an error for unknown capabilities", func() {
+			_, err := priv.ParseCapability("CAP_FLY")
+			h.AssertError(t, err, "unknown capability 'CAP_FLY'")
+		})
+	})
+}
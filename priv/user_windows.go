@@ -8,7 +8,7 @@ func IsPrivileged() bool {
 	return false
 }
 
-func RunAs(uid, gid int) error {
+func RunAs(u User) error {
 	return nil
 }
 
@@ -18,10 +18,12 @@ import (
 type Rebaser struct {
 	Logger      Logger
 	PlatformAPI *api.Version
+	RetryPolicy *image.RetryPolicy // RetryPolicy, when non-nil, is used to retry saving the image
 }
 
 type RebaseReport struct {
-	Image platform.ImageReport `toml:"image"`
+	Image   platform.ImageReport `toml:"image"`
+	Retries int                  `toml:"retries,omitzero"`
 }
 
 func (r *Rebaser) Rebase(appImage imgutil.Image, newBaseImage imgutil.Image, additionalNames []string) (RebaseReport, error) {
@@ -86,10 +88,14 @@ func (r *Rebaser) Rebase(appImage imgutil.Image, newBaseImage imgutil.Image, add
 	}
 
 	report := RebaseReport{}
-	report.Image, err = saveImage(appImage, additionalNames, r.Logger)
+	report.Image, err = saveImage(appImage, additionalNames, r.RetryPolicy, r.Logger)
 	if err != nil {
-		return RebaseReport{}, err
+		if _, isSaveErr := err.(imgutil.SaveError); !isSaveErr {
+			return RebaseReport{}, err
+		}
+		// the image was saved to some of the tags; return the report so the failures can be recorded
 	}
+	report.Retries = r.RetryPolicy.Retries()
 	if !r.supportsManifestSize() {
 		// unset manifest size in report.toml for old platform API versions
 		report.Image.ManifestSize = 0
@@ -1,14 +1,21 @@
 package lifecycle
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sync/atomic"
 
+	"github.com/buildpacks/imgutil"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/archive"
 	"github.com/buildpacks/lifecycle/buildpack"
 	"github.com/buildpacks/lifecycle/internal/layer"
+	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
 	"github.com/buildpacks/lifecycle/platform"
 )
@@ -22,6 +29,17 @@ type Restorer struct {
 	LayersMetadata        platform.LayersMetadata // Platform API >= 0.7
 	Platform              Platform
 	SBOMRestorer          layer.SBOMRestorer
+
+	// PreviousImage, when set, provides the data for launch=true, cache=true layers that are missing from the cache,
+	// or that fail to be retrieved from the cache. Platform API >= 0.7.
+	PreviousImage imgutil.Image
+
+	// Concurrency is the maximum number of layers restored at once; it defaults to the number of CPUs.
+	Concurrency int
+
+	// LazyLayers, when non-nil, records the layers that are not restored because their buildpack requested restore = "lazy".
+	// When nil, lazy layers are restored before the build like any other layer.
+	LazyLayers *platform.LazyLayersMetadata
 }
 
 // Restore restores metadata for launch and cache layers into the layers directory and attempts to restore layer data for cache=true layers, removing the layer when unsuccessful.
@@ -31,6 +49,7 @@ func (r *Restorer) Restore(cache Cache) error {
 	if err != nil {
 		return err
 	}
+	imageLayers := r.addPreviousImageLayers(&cacheMeta)
 
 	useShaFiles := !r.restoresLayerMetadata()
 	layerSHAStore := layer.NewSHAStore(useShaFiles)
@@ -40,7 +59,9 @@ func (r *Restorer) Restore(cache Cache) error {
 		}
 	}
 
-	var g errgroup.Group
+	fingerprints := layers.NewFingerprints(layers.FingerprintsPath(r.LayersDir))
+	// layers from all buildpacks share one pool so that downloading and extracting layers overlap
+	g := newBoundedGroup(r.concurrency())
 	for _, bp := range r.Buildpacks {
 		cachedLayers := cacheMeta.MetadataForBuildpack(bp.ID).Layers
 
@@ -67,6 +88,7 @@ func (r *Restorer) Restore(cache Cache) error {
 		foundLayers := buildpackDir.FindLayers(cachedFn)
 
 		for _, bpLayer := range foundLayers {
+			bpLayer := bpLayer
 			cachedLayer, exists := cachedLayers[bpLayer.Name()]
 			if !exists {
 				r.Logger.Infof("Removing %q, not in cache", bpLayer.Identifier())
@@ -87,10 +109,41 @@ func (r *Restorer) Restore(cache Cache) error {
 				if err := bpLayer.Remove(); err != nil {
 					return errors.Wrapf(err, "removing layer")
 				}
+			} else if cachedLayer.Restore == buildpack.RestoreSkip {
+				r.Logger.Infof("Removing %q, buildpack requested that it not be restored", bpLayer.Identifier())
+				if err := bpLayer.Remove(); err != nil {
+					return errors.Wrapf(err, "removing layer")
+				}
+			} else if imageLayers[cachedLayer.SHA] {
+				// restore-layer only has access to the cache, so layers from the previous image are never deferred
+				r.Logger.Infof("Restoring data for %q from previous image", bpLayer.Identifier())
+				g.Go(func() error {
+					return r.restoreImageLayer(cachedLayer.SHA)
+				})
+			} else if cachedLayer.Restore == buildpack.RestoreLazy && !cachedLayer.Launch && r.LazyLayers != nil {
+				r.Logger.Infof("Deferring restore of data for %q until requested by the buildpack", bpLayer.Identifier())
+				r.LazyLayers.Layers = append(r.LazyLayers.Layers, platform.LazyLayer{
+					Buildpack: bp.ID,
+					Name:      bpLayer.Name(),
+					SHA:       cachedLayer.SHA,
+				})
 			} else {
 				r.Logger.Infof("Restoring data for %q from cache", bpLayer.Identifier())
+				inImage := r.inPreviousImage(bp.ID, bpLayer.Name(), cachedLayer.SHA)
 				g.Go(func() error {
-					return r.restoreCacheLayer(cache, cachedLayer.SHA)
+					err := r.restoreCacheLayer(cache, cachedLayer.SHA)
+					if err == nil {
+						r.recordFingerprint(fingerprints, bpLayer, cacheMeta.FingerprintSettings, cachedLayer.SHA)
+						return nil
+					}
+					if !inImage {
+						return err
+					}
+					r.Logger.Warnf("Failed to restore data for %q from cache, restoring from previous image: %s", bpLayer.Identifier(), err)
+					if err := os.RemoveAll(bpLayer.Path()); err != nil {
+						return errors.Wrapf(err, "removing partially restored layer")
+					}
+					return r.restoreImageLayer(cachedLayer.SHA)
 				})
 			}
 		}
@@ -115,10 +168,131 @@ func (r *Restorer) Restore(cache Cache) error {
 	return nil
 }
 
+// RestoreLazyLayers restores the data for the given layer directories, which must have been deferred by a previous call to Restore.
+// Layers that were already restored are left untouched. Restored layers are marked as such in lazyLayers.
+func (r *Restorer) RestoreLazyLayers(cache Cache, lazyLayers *platform.LazyLayersMetadata, layerPaths ...string) error {
+	for _, layerPath := range layerPaths {
+		lazyLayer, err := r.findLazyLayer(lazyLayers, layerPath)
+		if err != nil {
+			return err
+		}
+		identifier := fmt.Sprintf("%s:%s", lazyLayer.Buildpack, lazyLayer.Name)
+		if lazyLayer.Restored {
+			r.Logger.Infof("Data for %q was already restored", identifier)
+			continue
+		}
+		r.Logger.Infof("Restoring data for %q from cache", identifier)
+		if err := r.restoreCacheLayer(cache, lazyLayer.SHA); err != nil {
+			return errors.Wrapf(err, "restoring data for %q", identifier)
+		}
+		lazyLayer.Restored = true
+	}
+	return nil
+}
+
+func (r *Restorer) findLazyLayer(lazyLayers *platform.LazyLayersMetadata, layerPath string) (*platform.LazyLayer, error) {
+	absPath, err := filepath.Abs(layerPath)
+	if err != nil {
+		return nil, err
+	}
+	layersDir, err := filepath.Abs(r.LayersDir)
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range lazyLayers.Layers {
+		if filepath.Join(layersDir, launch.EscapeID(l.Buildpack), l.Name) == absPath {
+			return &lazyLayers.Layers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s was not deferred by the restorer", layerPath)
+}
+
+func (r *Restorer) concurrency() int {
+	if r.Concurrency > 0 {
+		return r.Concurrency
+	}
+	return runtime.NumCPU()
+}
+
 func (r *Restorer) restoresLayerMetadata() bool {
 	return r.Platform.API().AtLeast("0.7")
 }
 
+// addPreviousImageLayers adds the launch=true, cache=true layers of the previous image that are missing from the cache
+// to cacheMeta, so that their metadata and data are restored like any other cached layer.
+// It returns the diff IDs of the layers that were added.
+func (r *Restorer) addPreviousImageLayers(cacheMeta *platform.CacheMetadata) map[string]bool {
+	imageLayers := map[string]bool{}
+	if !r.restoresLayerMetadata() || r.PreviousImage == nil || !r.PreviousImage.Found() {
+		return imageLayers
+	}
+	for _, bp := range r.Buildpacks {
+		var missing map[string]buildpack.LayerMetadata
+		cachedLayers := cacheMeta.MetadataForBuildpack(bp.ID).Layers
+		for name, appLayer := range r.LayersMetadata.MetadataForBuildpack(bp.ID).Layers {
+			if !appLayer.Launch || !appLayer.Cache || appLayer.SHA == "" {
+				continue
+			}
+			if cachedLayer, ok := cachedLayers[name]; ok && cachedLayer.Cache {
+				continue
+			}
+			if missing == nil {
+				missing = map[string]buildpack.LayerMetadata{}
+			}
+			missing[name] = appLayer
+			imageLayers[appLayer.SHA] = true
+		}
+		if missing != nil {
+			addCachedLayers(cacheMeta, bp.ID, missing)
+		}
+	}
+	return imageLayers
+}
+
+// addCachedLayers adds layers to the cache metadata for the buildpack without modifying the maps of the original metadata,
+// which may be shared with the cache.
+func addCachedLayers(cacheMeta *platform.CacheMetadata, buildpackID string, added map[string]buildpack.LayerMetadata) {
+	cacheMeta.Buildpacks = append([]buildpack.LayersMetadata{}, cacheMeta.Buildpacks...)
+	for i, bpMD := range cacheMeta.Buildpacks {
+		if bpMD.ID != buildpackID {
+			continue
+		}
+		layers := make(map[string]buildpack.LayerMetadata, len(bpMD.Layers)+len(added))
+		for name, l := range bpMD.Layers {
+			layers[name] = l
+		}
+		for name, l := range added {
+			layers[name] = l
+		}
+		cacheMeta.Buildpacks[i].Layers = layers
+		return
+	}
+	cacheMeta.Buildpacks = append(cacheMeta.Buildpacks, buildpack.LayersMetadata{ID: buildpackID, Layers: added})
+}
+
+// inPreviousImage returns true if the previous image has the layer with the given diff ID.
+func (r *Restorer) inPreviousImage(buildpackID, layerName, sha string) bool {
+	if !r.restoresLayerMetadata() || r.PreviousImage == nil || !r.PreviousImage.Found() {
+		return false
+	}
+	appLayer, ok := r.LayersMetadata.MetadataForBuildpack(buildpackID).Layers[layerName]
+	return ok && appLayer.Launch && appLayer.SHA == sha
+}
+
+func (r *Restorer) restoreImageLayer(sha string) error {
+	r.Logger.Debugf("Retrieving data for %q from previous image", sha)
+	rc, err := r.PreviousImage.GetLayer(sha)
+	if err != nil {
+		return errors.Wrapf(err, "retrieving layer %s from previous image", sha)
+	}
+	defer rc.Close()
+
+	if err := layers.ExtractVerified(rc, "", sha, archive.ExtractOptions{Root: r.LayersDir}); err != nil {
+		return errors.Wrapf(err, "restoring layer %s from previous image", sha)
+	}
+	return nil
+}
+
 func (r *Restorer) restoreCacheLayer(cache Cache, sha string) error {
 	// Sanity check to prevent panic.
 	if cache == nil {
@@ -131,5 +305,63 @@ func (r *Restorer) restoreCacheLayer(cache Cache, sha string) error {
 	}
 	defer rc.Close()
 
-	return layers.Extract(rc, "")
+	// stream the layer straight into the layers directory, failing if its contents don't match the cache metadata
+	// or if any entry would be written outside of the layers directory
+	if err := layers.ExtractVerified(rc, "", sha, archive.ExtractOptions{Root: r.LayersDir}); err != nil {
+		return errors.Wrapf(err, "restoring layer %s", sha)
+	}
+	return nil
+}
+
+// recordFingerprint records a fingerprint of a layer restored from the cache, so that the exporter can reuse the cached
+// layer without creating a tarball if the buildpack doesn't change it. Layers are never reused by mistake if it fails.
+func (r *Restorer) recordFingerprint(fingerprints *layers.Fingerprints, bpLayer buildpack.Layer, settings, sha string) {
+	if settings == "" {
+		return
+	}
+	if err := fingerprints.Record(bpLayer.Path(), settings, sha); err != nil {
+		r.Logger.Debugf("Failed to fingerprint restored layer %q: %s", bpLayer.Identifier(), err)
+	}
+}
+
+// boundedGroup runs functions on a fixed number of workers once Wait is called.
+// Once a function returns an error, functions that have not started yet are not run.
+type boundedGroup struct {
+	limit  int
+	queue  []func() error
+	failed int32
+}
+
+func newBoundedGroup(limit int) *boundedGroup {
+	return &boundedGroup{limit: limit}
+}
+
+func (b *boundedGroup) Go(f func() error) {
+	b.queue = append(b.queue, f)
+}
+
+func (b *boundedGroup) Wait() error {
+	work := make(chan func() error, len(b.queue))
+	for _, f := range b.queue {
+		work <- f
+	}
+	close(work)
+	b.queue = nil
+
+	var group errgroup.Group
+	for i := 0; i < b.limit; i++ {
+		group.Go(func() error {
+			for f := range work {
+				if atomic.LoadInt32(&b.failed) != 0 {
+					return nil
+				}
+				if err := f(); err != nil {
+					atomic.StoreInt32(&b.failed, 1)
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return group.Wait()
 }
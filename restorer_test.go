@@ -6,10 +6,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/memory"
+	"github.com/buildpacks/imgutil/fakes"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/sclevine/spec"
@@ -319,9 +322,10 @@ func testRestorerBuilder(buildpackAPI, platformAPI string) func(t *testing.T, wh
                 }
             }
         }
-    ]
+    ],
+    "fingerprintSettings": "%s"
 }
-`, cacheFalseLayerSHA, cacheLaunchLayerSHA, cacheOnlyLayerSHA, noGroupLayerSHA, escapedLayerSHA)
+`, cacheFalseLayerSHA, cacheLaunchLayerSHA, cacheOnlyLayerSHA, noGroupLayerSHA, escapedLayerSHA, lf.FingerprintSettings())
 
 					err = ioutil.WriteFile(
 						filepath.Join(cacheDir, "committed", "io.buildpacks.lifecycle.cache.metadata"),
@@ -367,6 +371,170 @@ func testRestorerBuilder(buildpackAPI, platformAPI string) func(t *testing.T, wh
 						want := "echo text from cache-only layer\n"
 						h.AssertEq(t, string(got), want)
 					})
+
+					it("records a fingerprint so that the exporter can reuse the unchanged layer", func() {
+						h.SkipIf(t, runtime.GOOS != "linux", "fingerprints are only supported on linux")
+						lf := &layers.Factory{
+							ArtifactsDir: tarTempDir,
+							Logger:       &log.Logger{Handler: logHandler},
+							Fingerprints: layers.NewFingerprints(layers.FingerprintsPath(layersDir)),
+						}
+						unchanged, ok := lf.UnchangedDirLayer("buildpack.id:cache-only", filepath.Join(layersDir, "buildpack.id", "cache-only"))
+						h.AssertEq(t, ok, true)
+						h.AssertEq(t, unchanged.Digest, cacheOnlyLayerSHA)
+					})
+				})
+
+				when("the cached data for a cache=true layer does not match its digest", func() {
+					it.Before(func() {
+						var meta string
+						if api.MustParse(buildpackAPI).LessThan("0.6") {
+							meta = "build = false\nlaunch = false\ncache = true\n\n"
+						}
+						var sha string
+						if api.MustParse(platformAPI).LessThan("0.7") {
+							sha = cacheOnlyLayerSHA
+						}
+						h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", meta, sha))
+
+						cacheOnlyPath, err := testCache.(*cache.VolumeCache).RetrieveLayerFile(cacheOnlyLayerSHA)
+						h.AssertNil(t, err)
+						cacheFalsePath, err := testCache.(*cache.VolumeCache).RetrieveLayerFile(cacheFalseLayerSHA)
+						h.AssertNil(t, err)
+						h.AssertNil(t, os.Remove(cacheOnlyPath))
+						h.AssertNil(t, os.Link(cacheFalsePath, cacheOnlyPath))
+					})
+
+					it("fails", func() {
+						err := restorer.Restore(testCache)
+						h.AssertError(t, err, fmt.Sprintf("layer digest mismatch: expected %s, got %s", cacheOnlyLayerSHA, cacheFalseLayerSHA))
+					})
+
+					it("removes the extracted files", func() {
+						h.AssertNotNil(t, restorer.Restore(testCache))
+						h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-false"))
+					})
+				})
+
+				when("the buildpack requested a restore mode for a cache=true layer", func() {
+					var (
+						lazyLayers *platform.LazyLayersMetadata
+						meta       string
+					)
+
+					setRestoreMode := func(mode string) {
+						metadataPath := filepath.Join(cacheDir, "committed", "io.buildpacks.lifecycle.cache.metadata")
+						contents := h.MustReadFile(t, metadataPath)
+						contents = []byte(strings.Replace(string(contents), `"cache-only": {`, fmt.Sprintf(`"cache-only": {
+                    "restore": "%s",`, mode), 1))
+						h.AssertNil(t, ioutil.WriteFile(metadataPath, contents, 0600))
+					}
+
+					it.Before(func() {
+						lazyLayers = &platform.LazyLayersMetadata{CacheDir: cacheDir}
+						restorer.LazyLayers = lazyLayers
+
+						if api.MustParse(buildpackAPI).LessThan("0.6") {
+							meta = "build = false\nlaunch = false\ncache = true\n\n"
+						}
+						meta += "[metadata]\n  cache-only-key = \"cache-only-val\"\n"
+						var sha string
+						if api.MustParse(platformAPI).LessThan("0.7") {
+							sha = cacheOnlyLayerSHA
+						}
+						h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", meta, sha))
+					})
+
+					when("lazy", func() {
+						it.Before(func() {
+							setRestoreMode(buildpack.RestoreLazy)
+							h.AssertNil(t, restorer.Restore(testCache))
+						})
+
+						it("keeps layer metadata", func() {
+							h.AssertPathExists(t, filepath.Join(layersDir, "buildpack.id", "cache-only.toml"))
+						})
+
+						it("does not restore data", func() {
+							h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only"))
+						})
+
+						it("records the deferred layer", func() {
+							h.AssertEq(t, lazyLayers.Layers, []platform.LazyLayer{
+								{Buildpack: "buildpack.id", Name: "cache-only", SHA: cacheOnlyLayerSHA},
+							})
+						})
+
+						it("restores data when requested", func() {
+							h.AssertNil(t, restorer.RestoreLazyLayers(testCache, lazyLayers, filepath.Join(layersDir, "buildpack.id", "cache-only")))
+
+							got := h.MustReadFile(t, filepath.Join(layersDir, "buildpack.id", "cache-only", "file-from-cache-only-layer"))
+							h.AssertEq(t, string(got), "echo text from cache-only layer\n")
+							h.AssertEq(t, lazyLayers.Layers[0].Restored, true)
+						})
+
+						it("fails to restore a layer that was not deferred", func() {
+							err := restorer.RestoreLazyLayers(testCache, lazyLayers, filepath.Join(layersDir, "buildpack.id", "cache-launch"))
+							h.AssertError(t, err, "was not deferred by the restorer")
+						})
+
+						when("lazy layers are not supported by the platform", func() {
+							it.Before(func() {
+								restorer.LazyLayers = nil
+								h.AssertNil(t, restorer.Restore(testCache))
+							})
+
+							it("restores data", func() {
+								h.AssertPathExists(t, filepath.Join(layersDir, "buildpack.id", "cache-only", "file-from-cache-only-layer"))
+							})
+						})
+					})
+
+					when("lazy for a launch layer", func() {
+						it.Before(func() {
+							metadataPath := filepath.Join(cacheDir, "committed", "io.buildpacks.lifecycle.cache.metadata")
+							contents := strings.Replace(string(h.MustReadFile(t, metadataPath)), `"cache-launch": {`, `"cache-launch": {
+                    "restore": "lazy",`, 1)
+							h.AssertNil(t, ioutil.WriteFile(metadataPath, []byte(contents), 0600))
+
+							var launchMeta, sha string
+							if api.MustParse(buildpackAPI).LessThan("0.6") {
+								launchMeta = "build = false\nlaunch = true\ncache = true\n\n"
+							}
+							if api.MustParse(platformAPI).LessThan("0.7") {
+								sha = cacheLaunchLayerSHA
+							}
+							h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-launch", launchMeta+"[metadata]\n  cache-launch-key = \"cache-launch-val\"\n", sha))
+							restorer.LayersMetadata = platform.LayersMetadata{Buildpacks: []buildpack.LayersMetadata{{
+								ID: "buildpack.id",
+								Layers: map[string]buildpack.LayerMetadata{
+									"cache-launch": {SHA: cacheLaunchLayerSHA, LayerMetadataFile: buildpack.LayerMetadataFile{Launch: true, Cache: true}},
+								},
+							}}}
+							h.AssertNil(t, restorer.Restore(testCache))
+						})
+
+						it("restores data, as the exporter needs it", func() {
+							h.AssertPathExists(t, filepath.Join(layersDir, "buildpack.id", "cache-launch", "file-from-cache-launch-layer"))
+							h.AssertEq(t, len(lazyLayers.Layers), 0)
+						})
+					})
+
+					when("skip", func() {
+						it.Before(func() {
+							setRestoreMode(buildpack.RestoreSkip)
+							h.AssertNil(t, restorer.Restore(testCache))
+						})
+
+						it("removes metadata file", func() {
+							h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.toml"))
+						})
+
+						it("does not restore data", func() {
+							h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only"))
+							h.AssertEq(t, len(lazyLayers.Layers), 0)
+						})
+					})
 				})
 
 				when("there is a cache=false layer", func() {
@@ -667,6 +835,79 @@ func testRestorerBuilder(buildpackAPI, platformAPI string) func(t *testing.T, wh
 				})
 			})
 
+			when("the cache is missing launch=true, cache=true layers of the previous image", func() {
+				var (
+					tarTempDir     string
+					launchLayerSHA string
+					previousImage  *fakes.Image
+					layerPath      string
+				)
+
+				it.Before(func() {
+					h.SkipIf(t, api.MustParse(platformAPI).LessThan("0.7"), "Platform API < 0.7 does not provide the previous image metadata to the restorer")
+
+					h.RecursiveCopy(t, filepath.Join("testdata", "restorer"), layersDir)
+					var err error
+					tarTempDir, err = ioutil.TempDir("", "restorer-test-temp-layer")
+					h.AssertNil(t, err)
+
+					lf := layers.Factory{ArtifactsDir: tarTempDir}
+					layerPath = filepath.Join(layersDir, "buildpack.id", "cache-launch")
+					layer, err := lf.DirLayer("buildpack.id:cache-launch", layerPath)
+					h.AssertNil(t, err)
+					launchLayerSHA = layer.Digest
+					h.AssertNil(t, os.RemoveAll(layersDir))
+					h.AssertNil(t, os.Mkdir(layersDir, 0777))
+
+					previousImage = fakes.NewImage("previous-image", "", nil)
+					h.AssertNil(t, previousImage.AddLayerWithDiffID(layer.TarPath, launchLayerSHA))
+					restorer.PreviousImage = previousImage
+					restorer.LayersMetadata = platform.LayersMetadata{
+						Buildpacks: []buildpack.LayersMetadata{{
+							ID: "buildpack.id",
+							Layers: map[string]buildpack.LayerMetadata{
+								"cache-launch": {
+									SHA:               launchLayerSHA,
+									LayerMetadataFile: buildpack.LayerMetadataFile{Launch: true, Cache: true},
+								},
+							},
+						}},
+					}
+				})
+
+				it.After(func() {
+					h.AssertNil(t, os.RemoveAll(tarTempDir))
+				})
+
+				it("restores the layer from the previous image", func() {
+					h.AssertNil(t, restorer.Restore(testCache))
+
+					h.AssertPathExists(t, filepath.Join(layersDir, "buildpack.id", "cache-launch.toml"))
+					got := h.MustReadFile(t, filepath.Join(layerPath, "file-from-cache-launch-layer"))
+					h.AssertEq(t, string(got), "echo text from cache launch layer\n")
+					assertLogEntry(t, logHandler, `Restoring data for "buildpack.id:cache-launch" from previous image`)
+				})
+
+				it("restores the layer from the previous image when it can't be retrieved from the cache", func() {
+					h.AssertNil(t, testCache.SetMetadata(platform.CacheMetadata{Buildpacks: restorer.LayersMetadata.Buildpacks}))
+					h.AssertNil(t, testCache.Commit())
+
+					h.AssertNil(t, restorer.Restore(testCache))
+
+					got := h.MustReadFile(t, filepath.Join(layerPath, "file-from-cache-launch-layer"))
+					h.AssertEq(t, string(got), "echo text from cache launch layer\n")
+					assertLogEntry(t, logHandler, `Failed to restore data for "buildpack.id:cache-launch" from cache, restoring from previous image`)
+				})
+
+				it("does not restore the layer when there is no previous image", func() {
+					restorer.PreviousImage = nil
+
+					h.AssertNil(t, restorer.Restore(testCache))
+
+					h.AssertPathDoesNotExist(t, layerPath)
+				})
+			})
+
 			when("there is no app image metadata", func() {
 				it.Before(func() {
 					restorer.LayersMetadata = platform.LayersMetadata{}
@@ -6,23 +6,25 @@ import (
 	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/local"
 	"github.com/buildpacks/imgutil/remote"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/platform"
 )
 
-func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (platform.ImageReport, error) {
+func saveImage(img imgutil.Image, additionalNames []string, retryPolicy *image.RetryPolicy, logger Logger) (platform.ImageReport, error) {
 	var saveErr error
 	imageReport := platform.ImageReport{}
-	logger.Infof("Saving %s...\n", image.Name())
-	if err := image.Save(additionalNames...); err != nil {
+	logger.Infof("Saving %s...\n", img.Name())
+	if err := saveWithRetries(img, additionalNames, retryPolicy); err != nil {
 		var ok bool
 		if saveErr, ok = err.(imgutil.SaveError); !ok {
 			return platform.ImageReport{}, errors.Wrap(err, "saving image")
 		}
 	}
 
-	id, idErr := image.Identifier()
+	id, idErr := img.Identifier()
 	if idErr != nil {
 		if saveErr != nil {
 			return platform.ImageReport{}, &MultiError{Errors: []error{idErr, saveErr}}
@@ -31,12 +33,15 @@ func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (pl
 	}
 
 	logger.Infof("*** Images (%s):\n", shortID(id))
-	for _, n := range append([]string{image.Name()}, additionalNames...) {
+	registries := &registryReports{}
+	for _, n := range append([]string{img.Name()}, additionalNames...) {
 		if ok, message := getSaveStatus(saveErr, n); !ok {
 			logger.Infof("      %s - %s\n", n, message)
+			registries.addFailure(n, message)
 		} else {
 			logger.Infof("      %s\n", n)
 			imageReport.Tags = append(imageReport.Tags, n)
+			registries.addTag(n)
 		}
 	}
 	switch v := id.(type) {
@@ -45,11 +50,12 @@ func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (pl
 		logger.Debugf("\n*** Image ID: %s\n", v.String())
 	case remote.DigestIdentifier:
 		imageReport.Digest = v.Digest.DigestStr()
+		imageReport.Registries = registries.withDigest(imageReport.Digest)
 		logger.Debugf("\n*** Digest: %s\n", v.Digest.DigestStr())
 	default:
 	}
 
-	manifestSize, sizeErr := image.ManifestSize()
+	manifestSize, sizeErr := img.ManifestSize()
 	if sizeErr != nil {
 		// ignore the manifest size if it's unavailable
 		logger.Infof("*** Manifest size is unavailable: %s\n", sizeErr.Error())
@@ -61,6 +67,62 @@ func saveImage(image imgutil.Image, additionalNames []string, logger Logger) (pl
 	return imageReport, saveErr
 }
 
+// saveWithRetries saves the image under its name and the additional names.
+// When saving fails for some of the names, only those names are saved again on retry.
+func saveWithRetries(img imgutil.Image, additionalNames []string, retryPolicy *image.RetryPolicy) error {
+	imageName := img.Name()
+	defer img.Rename(imageName)
+	names := append([]string{imageName}, additionalNames...)
+	return retryPolicy.Do(fmt.Sprintf("saving %s", imageName), func() error {
+		img.Rename(names[0])
+		err := img.Save(names[1:]...)
+		if saveErr, ok := err.(imgutil.SaveError); ok && len(saveErr.Errors) > 0 {
+			names = nil
+			for _, d := range saveErr.Errors {
+				names = append(names, d.ImageName)
+			}
+		}
+		return err
+	})
+}
+
+// registryReports groups the outcome of saving each tag by registry, in the order the registries were first seen.
+type registryReports []platform.RegistryReport
+
+func (r *registryReports) addTag(tag string) {
+	report := r.reportFor(tag)
+	report.Tags = append(report.Tags, tag)
+}
+
+func (r *registryReports) addFailure(tag, message string) {
+	report := r.reportFor(tag)
+	report.Failures = append(report.Failures, platform.TagFailure{Tag: tag, Error: message})
+}
+
+func (r *registryReports) reportFor(tag string) *platform.RegistryReport {
+	registry := tag
+	if ref, err := name.ParseReference(tag, name.WeakValidation); err == nil {
+		registry = ref.Context().RegistryStr()
+	}
+	for i := range *r {
+		if (*r)[i].Registry == registry {
+			return &(*r)[i]
+		}
+	}
+	*r = append(*r, platform.RegistryReport{Registry: registry})
+	return &(*r)[len(*r)-1]
+}
+
+// withDigest returns the reports, recording the digest for each registry the image was saved to.
+func (r registryReports) withDigest(digest string) []platform.RegistryReport {
+	for i := range r {
+		if len(r[i].Tags) > 0 {
+			r[i].Digest = digest
+		}
+	}
+	return r
+}
+
 type MultiError struct {
 	Errors []error
 }
@@ -0,0 +1,164 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/platform"
+)
+
+const (
+	buildStagePrefix = "build:"
+	runStagePrefix   = "run:"
+	anyStack         = "*"
+)
+
+// BuildStack is the stack of the build image that the lifecycle is running in.
+type BuildStack struct {
+	ID string
+	// Mixins are the mixins provided by the build image, or nil if they are not known.
+	Mixins []string
+}
+
+// ValidateRunImageStack checks that runImage belongs to the same stack as the build image, and that it provides the
+// mixins of the build image that are not specific to the build stage. Checks are skipped when the stack ID or mixins
+// of either image are not known. It returns the stack to record in analyzed.toml.
+func ValidateRunImageStack(build BuildStack, runImage imgutil.Image) (*platform.AnalyzedStack, error) {
+	runStackID, err := runImage.Label(platform.StackIDLabel)
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieving label '%s' for image '%s'", platform.StackIDLabel, runImage.Name())
+	}
+	var runMixins []string
+	mixinsLabel, err := runImage.Label(platform.MixinsLabel)
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieving label '%s' for image '%s'", platform.MixinsLabel, runImage.Name())
+	}
+	if mixinsLabel != "" {
+		if err := json.Unmarshal([]byte(mixinsLabel), &runMixins); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal context of label '%s'", platform.MixinsLabel)
+		}
+		if runMixins == nil {
+			runMixins = []string{}
+		}
+	}
+
+	if build.ID != "" && runStackID != "" && build.ID != runStackID {
+		return nil, fmt.Errorf("incompatible stack: run image '%s' has stack '%s', but the build image has stack '%s'", runImage.Name(), runStackID, build.ID)
+	}
+	if build.Mixins != nil && runMixins != nil {
+		var required []string
+		for _, m := range build.Mixins {
+			if !strings.HasPrefix(m, buildStagePrefix) {
+				required = append(required, strings.TrimPrefix(m, runStagePrefix))
+			}
+		}
+		if missing := missingMixins(required, runMixins, runStagePrefix); len(missing) > 0 {
+			return nil, fmt.Errorf("incompatible stack: run image '%s' is missing mixin(s) provided by the build image: %s", runImage.Name(), strings.Join(missing, ", "))
+		}
+	}
+
+	stack := &platform.AnalyzedStack{
+		ID:          build.ID,
+		BuildMixins: build.Mixins,
+		RunMixins:   runMixins,
+	}
+	if stack.ID == "" {
+		stack.ID = runStackID
+	}
+	return stack, nil
+}
+
+// ValidateBuildpackStacks checks that every buildpack in the group that lists stacks in its buildpack.toml supports the
+// stack, and that the build and run images provide the mixins required by it.
+// All incompatible buildpacks are reported in the returned error.
+func ValidateBuildpackStacks(stack platform.AnalyzedStack, group []buildpack.GroupBuildpack, store BuildpackStore) error {
+	var problems []string
+	for _, groupBp := range group {
+		bp, err := store.Lookup(groupBp.ID, groupBp.Version)
+		if err != nil {
+			return errors.Wrapf(err, "lookup buildpack.toml for buildpack '%s'", groupBp.String())
+		}
+		stacks := bp.ConfigFile().Stacks
+		if len(stacks) == 0 || stack.ID == "" {
+			continue
+		}
+		bpStack, ok := findStack(stacks, stack.ID)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s does not support stack '%s'", groupBp.String(), stack.ID))
+			continue
+		}
+
+		var buildRequired, runRequired []string
+		for _, m := range bpStack.Mixins {
+			switch {
+			case strings.HasPrefix(m, buildStagePrefix):
+				buildRequired = append(buildRequired, strings.TrimPrefix(m, buildStagePrefix))
+			case strings.HasPrefix(m, runStagePrefix):
+				runRequired = append(runRequired, strings.TrimPrefix(m, runStagePrefix))
+			default:
+				buildRequired = append(buildRequired, m)
+				runRequired = append(runRequired, m)
+			}
+		}
+		if stack.BuildMixins != nil {
+			if missing := missingMixins(buildRequired, stack.BuildMixins, buildStagePrefix); len(missing) > 0 {
+				problems = append(problems, fmt.Sprintf("%s requires build image mixin(s): %s", groupBp.String(), strings.Join(missing, ", ")))
+			}
+		}
+		if stack.RunMixins != nil {
+			if missing := missingMixins(runRequired, stack.RunMixins, runStagePrefix); len(missing) > 0 {
+				problems = append(problems, fmt.Sprintf("%s requires run image mixin(s): %s", groupBp.String(), strings.Join(missing, ", ")))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("incompatible buildpacks: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func findStack(stacks []buildpack.Stack, id string) (buildpack.Stack, bool) {
+	for _, s := range stacks {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	for _, s := range stacks {
+		if s.ID == anyStack {
+			return s, true
+		}
+	}
+	return buildpack.Stack{}, false
+}
+
+// missingMixins returns the sorted required mixins that are not provided by an image for the stage with the given prefix,
+// where the image provides its unprefixed mixins and the mixins with the stage prefix.
+func missingMixins(required, provided []string, stagePrefix string) []string {
+	available := map[string]bool{}
+	for _, m := range provided {
+		switch {
+		case strings.HasPrefix(m, stagePrefix):
+			available[strings.TrimPrefix(m, stagePrefix)] = true
+		case strings.HasPrefix(m, buildStagePrefix), strings.HasPrefix(m, runStagePrefix):
+			// specific to the other stage
+		default:
+			available[m] = true
+		}
+	}
+	var missing []string
+	seen := map[string]bool{}
+	for _, m := range required {
+		if !available[m] && !seen[m] {
+			missing = append(missing, m)
+			seen[m] = true
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
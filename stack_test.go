@@ -0,0 +1,132 @@
+package lifecycle_test
+
+import (
+	"testing"
+
+	"github.com/buildpacks/imgutil/fakes"
+	"github.com/golang/mock/gomock"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/buildpack"
+	"github.com/buildpacks/lifecycle/platform"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+	"github.com/buildpacks/lifecycle/testmock"
+)
+
+func TestStack(t *testing.T) {
+	spec.Run(t, "Stack", testStack, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testStack(t *testing.T, when spec.G, it spec.S) {
+	when("#ValidateRunImageStack", func() {
+		var runImage *fakes.Image
+
+		it.Before(func() {
+			runImage = fakes.NewImage("some-run-image", "", nil)
+			h.AssertNil(t, runImage.SetLabel(platform.StackIDLabel, "some.stack"))
+			h.AssertNil(t, runImage.SetLabel(platform.MixinsLabel, `["curl", "run:libpq", "build:git"]`))
+		})
+
+		it("returns the stack of both images", func() {
+			build := lifecycle.BuildStack{ID: "some.stack", Mixins: []string{"curl", "build:git"}}
+
+			stack, err := lifecycle.ValidateRunImageStack(build, runImage)
+			h.AssertNil(t, err)
+			h.AssertEq(t, stack, &platform.AnalyzedStack{
+				ID:          "some.stack",
+				BuildMixins: []string{"curl", "build:git"},
+				RunMixins:   []string{"curl", "run:libpq", "build:git"},
+			})
+		})
+
+		it("fails if the stack IDs don't match", func() {
+			_, err := lifecycle.ValidateRunImageStack(lifecycle.BuildStack{ID: "other.stack"}, runImage)
+			h.AssertError(t, err, "incompatible stack: run image 'some-run-image' has stack 'some.stack', but the build image has stack 'other.stack'")
+		})
+
+		it("fails if the run image is missing mixins of the build image", func() {
+			build := lifecycle.BuildStack{ID: "some.stack", Mixins: []string{"curl", "zlib", "run:openssl", "build:make"}}
+
+			_, err := lifecycle.ValidateRunImageStack(build, runImage)
+			h.AssertError(t, err, "run image 'some-run-image' is missing mixin(s) provided by the build image: openssl, zlib")
+		})
+
+		it("uses the run image stack ID if the build image stack ID is not known", func() {
+			stack, err := lifecycle.ValidateRunImageStack(lifecycle.BuildStack{}, runImage)
+			h.AssertNil(t, err)
+			h.AssertEq(t, stack, &platform.AnalyzedStack{
+				ID:        "some.stack",
+				RunMixins: []string{"curl", "run:libpq", "build:git"},
+			})
+		})
+	})
+
+	when("#ValidateBuildpackStacks", func() {
+		var (
+			mockCtrl *gomock.Controller
+			store    *testmock.MockBuildpackStore
+			stack    platform.AnalyzedStack
+			group    []buildpack.GroupBuildpack
+		)
+
+		it.Before(func() {
+			mockCtrl = gomock.NewController(t)
+			store = testmock.NewMockBuildpackStore(mockCtrl)
+			stack = platform.AnalyzedStack{
+				ID:          "some.stack",
+				BuildMixins: []string{"curl", "build:git"},
+				RunMixins:   []string{"curl", "run:libpq"},
+			}
+			group = []buildpack.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v2"}}
+		})
+
+		it.After(func() {
+			mockCtrl.Finish()
+		})
+
+		it("passes when the stack provides the required mixins", func() {
+			store.EXPECT().Lookup("A", "v1").Return(&buildpack.Descriptor{
+				Stacks: []buildpack.Stack{{ID: "other.stack"}, {ID: "some.stack", Mixins: []string{"curl", "build:git", "run:libpq"}}},
+			}, nil)
+			store.EXPECT().Lookup("B", "v2").Return(&buildpack.Descriptor{
+				Stacks: []buildpack.Stack{{ID: "*", Mixins: []string{"curl"}}},
+			}, nil)
+
+			h.AssertNil(t, lifecycle.ValidateBuildpackStacks(stack, group, store))
+		})
+
+		it("passes for buildpacks that don't list stacks", func() {
+			store.EXPECT().Lookup("A", "v1").Return(&buildpack.Descriptor{}, nil)
+			store.EXPECT().Lookup("B", "v2").Return(&buildpack.Descriptor{}, nil)
+
+			h.AssertNil(t, lifecycle.ValidateBuildpackStacks(stack, group, store))
+		})
+
+		it("reports every incompatible buildpack", func() {
+			store.EXPECT().Lookup("A", "v1").Return(&buildpack.Descriptor{
+				Stacks: []buildpack.Stack{{ID: "other.stack"}},
+			}, nil)
+			store.EXPECT().Lookup("B", "v2").Return(&buildpack.Descriptor{
+				Stacks: []buildpack.Stack{{ID: "some.stack", Mixins: []string{"zlib", "build:make", "run:git"}}},
+			}, nil)
+
+			err := lifecycle.ValidateBuildpackStacks(stack, group, store)
+			h.AssertError(t, err, "incompatible buildpacks: "+
+				"A@v1 does not support stack 'some.stack'; "+
+				"B@v2 requires build image mixin(s): make, zlib; "+
+				"B@v2 requires run image mixin(s): git, zlib")
+		})
+
+		it("does not check the mixins of an image if they are not known", func() {
+			stack.RunMixins = nil
+			store.EXPECT().Lookup("A", "v1").Return(&buildpack.Descriptor{
+				Stacks: []buildpack.Stack{{ID: "some.stack", Mixins: []string{"run:zlib"}}},
+			}, nil)
+			store.EXPECT().Lookup("B", "v2").Return(&buildpack.Descriptor{}, nil)
+
+			h.AssertNil(t, lifecycle.ValidateBuildpackStacks(stack, group, store))
+		})
+	})
+}
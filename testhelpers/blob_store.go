@@ -0,0 +1,101 @@
+package testhelpers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// BlobStore is an in-memory stand-in for the HTTP blob store used by cache.BlobCache.
+type BlobStore struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	blobs    map[string][]byte // "/metadata" and "/blobs/<diffID>" -> contents
+	requests []string          // "<method> <path>" for each request
+	failures []int             // status codes to respond with before handling requests normally
+}
+
+// NewBlobStore starts a blob store; the caller should call Close when done.
+func NewBlobStore() *BlobStore {
+	s := &BlobStore{blobs: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// FailNext makes the store respond to the next requests with the given status codes, in order.
+func (s *BlobStore) FailNext(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statusCodes...)
+}
+
+// Requests returns the requests received so far, formatted as "<method> <path>".
+func (s *BlobStore) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// ResetRequests forgets the requests received so far.
+func (s *BlobStore) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// Contents returns the stored contents for the path, e.g. "/metadata", and whether the path exists.
+func (s *BlobStore) Contents(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	contents, ok := s.blobs[path]
+	return contents, ok
+}
+
+// SetContents stores contents at the path, e.g. to corrupt a blob.
+func (s *BlobStore) SetContents(path string, contents []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[path] = contents
+}
+
+func (s *BlobStore) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		w.WriteHeader(status)
+		return
+	}
+	if r.URL.Path != "/metadata" && !strings.HasPrefix(r.URL.Path, "/blobs/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		contents, ok := s.blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(contents)
+		}
+	case http.MethodPut:
+		contents, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.blobs[r.URL.Path] = contents
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -51,6 +51,35 @@ func (mr *MockLayerFactoryMockRecorder) DirLayer(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DirLayer", reflect.TypeOf((*MockLayerFactory)(nil).DirLayer), arg0, arg1)
 }
 
+// FingerprintSettings mocks base method.
+func (m *MockLayerFactory) FingerprintSettings() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FingerprintSettings")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// FingerprintSettings indicates an expected call of FingerprintSettings.
+func (mr *MockLayerFactoryMockRecorder) FingerprintSettings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FingerprintSettings", reflect.TypeOf((*MockLayerFactory)(nil).FingerprintSettings))
+}
+
+// FingerprintedDirLayer mocks base method.
+func (m *MockLayerFactory) FingerprintedDirLayer(arg0, arg1 string) (layers.Layer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FingerprintedDirLayer", arg0, arg1)
+	ret0, _ := ret[0].(layers.Layer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FingerprintedDirLayer indicates an expected call of FingerprintedDirLayer.
+func (mr *MockLayerFactoryMockRecorder) FingerprintedDirLayer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FingerprintedDirLayer", reflect.TypeOf((*MockLayerFactory)(nil).FingerprintedDirLayer), arg0, arg1)
+}
+
 // LauncherLayer mocks base method.
 func (m *MockLayerFactory) LauncherLayer(arg0 string) (layers.Layer, error) {
 	m.ctrl.T.Helper()
@@ -95,3 +124,18 @@ func (mr *MockLayerFactoryMockRecorder) SliceLayers(arg0, arg1 interface{}) *gom
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SliceLayers", reflect.TypeOf((*MockLayerFactory)(nil).SliceLayers), arg0, arg1)
 }
+
+// UnchangedDirLayer mocks base method.
+func (m *MockLayerFactory) UnchangedDirLayer(arg0, arg1 string) (layers.Layer, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnchangedDirLayer", arg0, arg1)
+	ret0, _ := ret[0].(layers.Layer)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// UnchangedDirLayer indicates an expected call of UnchangedDirLayer.
+func (mr *MockLayerFactoryMockRecorder) UnchangedDirLayer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnchangedDirLayer", reflect.TypeOf((*MockLayerFactory)(nil).UnchangedDirLayer), arg0, arg1)
+}